@@ -121,16 +121,18 @@ func (c *Sys) DisableAudit(path string) error {
 // documentation. Please refer to that documentation for more details.
 
 type EnableAuditOptions struct {
-	Type        string            `json:"type" mapstructure:"type"`
-	Description string            `json:"description" mapstructure:"description"`
-	Options     map[string]string `json:"options" mapstructure:"options"`
-	Local       bool              `json:"local" mapstructure:"local"`
+	Type        string                 `json:"type" mapstructure:"type"`
+	Description string                 `json:"description" mapstructure:"description"`
+	Options     map[string]string      `json:"options" mapstructure:"options"`
+	Local       bool                   `json:"local" mapstructure:"local"`
+	Filter      map[string]interface{} `json:"filter,omitempty" mapstructure:"filter"`
 }
 
 type Audit struct {
-	Type        string            `json:"type" mapstructure:"type"`
-	Description string            `json:"description" mapstructure:"description"`
-	Options     map[string]string `json:"options" mapstructure:"options"`
-	Local       bool              `json:"local" mapstructure:"local"`
-	Path        string            `json:"path" mapstructure:"path"`
+	Type        string                 `json:"type" mapstructure:"type"`
+	Description string                 `json:"description" mapstructure:"description"`
+	Options     map[string]string      `json:"options" mapstructure:"options"`
+	Local       bool                   `json:"local" mapstructure:"local"`
+	Path        string                 `json:"path" mapstructure:"path"`
+	Filter      map[string]interface{} `json:"filter,omitempty" mapstructure:"filter"`
 }
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ControlGroupAuthorize approves the request held by the control group token
+// with the given accessor and reports whether the request is now approved.
+func (c *Sys) ControlGroupAuthorize(accessor string) (bool, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/control-group/authorize")
+	if err := r.SetJSONBody(map[string]string{"accessor": accessor}); err != nil {
+		return false, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if secret == nil || secret.Data == nil {
+		return false, errors.New("data from server response is empty")
+	}
+
+	approved, _ := secret.Data["approved"].(bool)
+	return approved, nil
+}
+
+// ControlGroupRequest looks up the status of the request held by the control
+// group token with the given accessor.
+func (c *Sys) ControlGroupRequest(accessor string) (*ControlGroupRequestStatus, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/control-group/request")
+	if err := r.SetJSONBody(map[string]string{"accessor": accessor}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result ControlGroupRequestStatus
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type ControlGroupRequestStatus struct {
+	Approved       bool                         `mapstructure:"approved"`
+	RequestPath    string                       `mapstructure:"request_path"`
+	RequestTime    string                       `mapstructure:"request_time"`
+	RequestEntity  *ControlGroupEntity          `mapstructure:"request_entity"`
+	Authorizations []*ControlGroupAuthorization `mapstructure:"authorizations"`
+}
+
+type ControlGroupEntity struct {
+	ID   string `mapstructure:"id"`
+	Name string `mapstructure:"name"`
+}
+
+type ControlGroupAuthorization struct {
+	EntityID          string `mapstructure:"entity_id"`
+	EntityName        string `mapstructure:"entity_name"`
+	AuthorizationTime string `mapstructure:"authorization_time"`
+}
@@ -104,6 +104,158 @@ func (c *Sys) DeletePolicy(name string) error {
 	return err
 }
 
+// PolicyVersionHistory is the recent version history of an ACL policy,
+// oldest version first.
+type PolicyVersionHistory struct {
+	CurrentVersion int              `mapstructure:"current_version"`
+	Versions       []*PolicyVersion `mapstructure:"versions"`
+}
+
+// PolicyVersion is a single version of an ACL policy along with the token
+// that wrote it.
+type PolicyVersion struct {
+	Version     int    `mapstructure:"version"`
+	Policy      string `mapstructure:"policy"`
+	CreatedTime string `mapstructure:"created_time"`
+	Accessor    string `mapstructure:"accessor"`
+	EntityID    string `mapstructure:"entity_id"`
+}
+
+// PolicyVersions returns the version history of the named ACL policy, or nil
+// if it has none.
+func (c *Sys) PolicyVersions(name string) (*PolicyVersionHistory, error) {
+	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/policies/acl/%s/versions", name))
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result PolicyVersionHistory
+	if err := mapstructure.WeakDecode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// RollbackPolicy restores the named ACL policy to the given version and
+// returns the new version that the rollback created.
+func (c *Sys) RollbackPolicy(name string, version int) (int, error) {
+	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/policies/acl/%s/rollback", name))
+	if err := r.SetJSONBody(map[string]int{"version": version}); err != nil {
+		return 0, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, errors.New("data from server response is empty")
+	}
+
+	var result struct {
+		Version int `mapstructure:"version"`
+	}
+	if err := mapstructure.WeakDecode(secret.Data, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Version, nil
+}
+
+// PolicySimulateInput describes a hypothetical request to evaluate against a
+// set of ACL policies. Exactly one of Policies, Accessor or EntityID must be
+// set.
+type PolicySimulateInput struct {
+	Policies   []string               `json:"policies,omitempty"`
+	Accessor   string                 `json:"accessor,omitempty"`
+	EntityID   string                 `json:"entity_id,omitempty"`
+	Path       string                 `json:"path"`
+	Operation  string                 `json:"operation,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	WrapTTL    string                 `json:"wrap_ttl,omitempty"`
+	RemoteAddr string                 `json:"remote_addr,omitempty"`
+	Headers    map[string]string      `json:"headers,omitempty"`
+}
+
+// PolicySimulateOutput explains how the ACL policies decided the simulated
+// request.
+type PolicySimulateOutput struct {
+	Path            string              `mapstructure:"path"`
+	Operation       string              `mapstructure:"operation"`
+	Policies        []string            `mapstructure:"policies"`
+	Allowed         bool                `mapstructure:"allowed"`
+	Root            bool                `mapstructure:"root"`
+	Sudo            bool                `mapstructure:"sudo"`
+	MatchedRule     *PolicySimulateRule `mapstructure:"matched_rule"`
+	DeniedBy        string              `mapstructure:"denied_by"`
+	DeniedParameter string              `mapstructure:"denied_parameter"`
+}
+
+// PolicySimulateRule is the policy rule selected for a simulated request.
+type PolicySimulateRule struct {
+	Path         string              `mapstructure:"path"`
+	Type         string              `mapstructure:"type"`
+	Capabilities []string            `mapstructure:"capabilities"`
+	Policies     map[string][]string `mapstructure:"policies"`
+}
+
+func (c *Sys) SimulatePolicy(input *PolicySimulateInput) (*PolicySimulateOutput, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/policies/simulate/acl")
+	if err := r.SetJSONBody(input); err != nil {
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result PolicySimulateOutput
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 type getPoliciesResp struct {
 	Rules string `json:"rules"`
 }
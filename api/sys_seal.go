@@ -65,19 +65,29 @@ func sealStatusRequest(c *Sys, r *Request) (*SealStatusResponse, error) {
 }
 
 type SealStatusResponse struct {
-	Type         string `json:"type"`
-	Initialized  bool   `json:"initialized"`
-	Sealed       bool   `json:"sealed"`
-	T            int    `json:"t"`
-	N            int    `json:"n"`
-	Progress     int    `json:"progress"`
-	Nonce        string `json:"nonce"`
-	Version      string `json:"version"`
-	Migration    bool   `json:"migration"`
-	ClusterName  string `json:"cluster_name,omitempty"`
-	ClusterID    string `json:"cluster_id,omitempty"`
-	RecoverySeal bool   `json:"recovery_seal"`
-	StorageType  string `json:"storage_type,omitempty"`
+	Type         string             `json:"type"`
+	Initialized  bool               `json:"initialized"`
+	Sealed       bool               `json:"sealed"`
+	T            int                `json:"t"`
+	N            int                `json:"n"`
+	Progress     int                `json:"progress"`
+	Nonce        string             `json:"nonce"`
+	Version      string             `json:"version"`
+	Migration    bool               `json:"migration"`
+	ClusterName  string             `json:"cluster_name,omitempty"`
+	ClusterID    string             `json:"cluster_id,omitempty"`
+	RecoverySeal bool               `json:"recovery_seal"`
+	StorageType  string             `json:"storage_type,omitempty"`
+	Seals        []SealHealthStatus `json:"seals,omitempty"`
+}
+
+type SealHealthStatus struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Priority    int    `json:"priority"`
+	Healthy     bool   `json:"healthy"`
+	LastError   string `json:"last_error,omitempty"`
+	LastChecked string `json:"last_checked,omitempty"`
 }
 
 type UnsealOpts struct {
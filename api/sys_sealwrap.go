@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+func (c *Sys) SealWrapRewrap() error {
+	r := c.c.NewRequest("POST", "/v1/sys/sealwrap/rewrap")
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) SealWrapRewrapStatus() (*SealWrapRewrapStatus, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/sealwrap/rewrap")
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("data from server response is empty")
+	}
+
+	var result SealWrapRewrapStatus
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, err
+}
+
+type SealWrapRewrapStatus struct {
+	IsRunning    bool                  `json:"is_running" mapstructure:"is_running"`
+	Entries      SealWrapRewrapEntries `json:"entries" mapstructure:"entries"`
+	KeyID        string                `json:"key_id" mapstructure:"key_id"`
+	KeyIDs       map[string]int        `json:"key_ids" mapstructure:"key_ids"`
+	StartTime    string                `json:"start_time" mapstructure:"start_time"`
+	CompleteTime string                `json:"complete_time" mapstructure:"complete_time"`
+	LastError    string                `json:"last_error" mapstructure:"last_error"`
+}
+
+type SealWrapRewrapEntries struct {
+	Processed int `json:"processed" mapstructure:"processed"`
+	Succeeded int `json:"succeeded" mapstructure:"succeeded"`
+	Failed    int `json:"failed" mapstructure:"failed"`
+}
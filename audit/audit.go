@@ -36,6 +36,13 @@ type Backend interface {
 	Invalidate(context.Context)
 }
 
+// Closer is implemented by audit backends that hold entries in memory before
+// writing them out. Close is called when the backend is disabled and before
+// Vault is sealed, so that these entries are not lost.
+type Closer interface {
+	Close() error
+}
+
 // BackendConfig contains configuration parameters used in the factory func to
 // instantiate audit backends
 type BackendConfig struct {
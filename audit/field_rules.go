@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/quid/vault/sdk/helper/jsonutil"
+	"github.com/quid/vault/sdk/helper/strutil"
+	"github.com/mitchellh/copystructure"
+)
+
+// ParseFieldRules returns the field rules of an audit device from its
+// configuration: "raw_fields" lists the paths of the request and response data
+// fields logged without hashing, and "drop_fields" the paths of the fields left
+// out of the entries. Paths are dotted, following the JSON entries, e.g.
+// "request.data.role_name" or "response.data.serial_number".
+func ParseFieldRules(config map[string]string) (rawFields []string, dropFields []string, err error) {
+	for _, path := range strutil.ParseDedupAndSortStrings(config["raw_fields"], ",") {
+		if !strings.HasPrefix(path, "request.data.") && !strings.HasPrefix(path, "response.data.") {
+			return nil, nil, fmt.Errorf("raw field %q must be a request or response data field", path)
+		}
+		if err := validateFieldPath(path); err != nil {
+			return nil, nil, err
+		}
+		rawFields = append(rawFields, path)
+	}
+
+	for _, path := range strutil.ParseDedupAndSortStrings(config["drop_fields"], ",") {
+		switch strings.SplitN(path, ".", 2)[0] {
+		case "auth", "request", "response":
+		default:
+			return nil, nil, fmt.Errorf("dropped field %q must be an auth, request or response field", path)
+		}
+		if err := validateFieldPath(path); err != nil {
+			return nil, nil, err
+		}
+		dropFields = append(dropFields, path)
+	}
+
+	return rawFields, dropFields, nil
+}
+
+// validateFieldPath checks that a path names a field within an entry object
+func validateFieldPath(path string) error {
+	keys := strings.Split(path, ".")
+	if len(keys) < 2 {
+		return fmt.Errorf("field %q must be within an object of the entry", path)
+	}
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("field %q has an empty key", path)
+		}
+	}
+	return nil
+}
+
+// restoreRawFields returns the hashed data with the values of the raw fields
+// of the given entry object, "request" or "response", taken from the original
+// data. The maps along the restored paths are copied, so that neither data is
+// modified.
+func restoreRawFields(hashed, original map[string]interface{}, rawFields []string, object string) (map[string]interface{}, error) {
+	prefix := object + ".data."
+	for _, path := range rawFields {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		keys := strings.Split(strings.TrimPrefix(path, prefix), ".")
+
+		value, ok := lookupField(original, keys)
+		if !ok {
+			continue
+		}
+		value, err := copystructure.Copy(value)
+		if err != nil {
+			return nil, err
+		}
+
+		hashed = setField(hashed, keys, value)
+	}
+
+	return hashed, nil
+}
+
+// lookupField returns the value at the path of keys in nested maps
+func lookupField(data map[string]interface{}, keys []string) (interface{}, bool) {
+	for i, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return value, true
+		}
+		if data, ok = value.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// setField returns a copy of data with the value set at the path of keys. Only
+// the maps along the path are copied; a path going through a value that isn't
+// a map is ignored.
+func setField(data map[string]interface{}, keys []string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+
+	if len(keys) == 1 {
+		copied[keys[0]] = value
+		return copied
+	}
+
+	next, ok := data[keys[0]].(map[string]interface{})
+	if !ok {
+		return data
+	}
+	copied[keys[0]] = setField(next, keys[1:], value)
+	return copied
+}
+
+// dropFields removes the fields at the given paths from an entry, decoding the
+// result into out. The entry is converted to its JSON representation, so that
+// any field can be dropped.
+func dropFields(entry interface{}, paths []string, out interface{}) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := jsonutil.DecodeJSONFromReader(bytes.NewReader(encoded), &fields); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		deleteField(fields, strings.Split(path, "."))
+	}
+
+	encoded, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return jsonutil.DecodeJSONFromReader(bytes.NewReader(encoded), out)
+}
+
+// deleteField removes the value at the path of keys in nested maps
+func deleteField(data map[string]interface{}, keys []string) {
+	for len(keys) > 1 {
+		next, ok := data[keys[0]].(map[string]interface{})
+		if !ok {
+			return
+		}
+		data, keys = next, keys[1:]
+	}
+	delete(data, keys[0])
+}
@@ -29,6 +29,8 @@ type AuditFormatWriter interface {
 // marshaller to be swapped out
 type AuditFormatter struct {
 	AuditFormatWriter
+
+	chain hashChain
 }
 
 var _ Formatter = (*AuditFormatter)(nil)
@@ -73,6 +75,13 @@ func (f *AuditFormatter) FormatRequest(ctx context.Context, w io.Writer, config
 		if err != nil {
 			return err
 		}
+
+		if len(config.RawFields) > 0 && req.Data != nil {
+			req.Data, err = restoreRawFields(req.Data, in.Request.Data, config.RawFields, "request")
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	var errString string
@@ -141,6 +150,21 @@ func (f *AuditFormatter) FormatRequest(ctx context.Context, w io.Writer, config
 		reqEntry.Time = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
+	if len(config.DropFields) > 0 {
+		dropped := new(AuditRequestEntry)
+		if err := dropFields(reqEntry, config.DropFields, dropped); err != nil {
+			return err
+		}
+		reqEntry = dropped
+	}
+
+	if config.HashChain {
+		return f.writeChained(w, salt, func(w io.Writer, chain *AuditHashChain) error {
+			reqEntry.HashChain = chain
+			return f.AuditFormatWriter.WriteRequest(w, reqEntry)
+		})
+	}
+
 	return f.AuditFormatWriter.WriteRequest(w, reqEntry)
 }
 
@@ -191,6 +215,21 @@ func (f *AuditFormatter) FormatResponse(ctx context.Context, w io.Writer, config
 		if err != nil {
 			return err
 		}
+
+		if len(config.RawFields) > 0 {
+			if req.Data != nil {
+				req.Data, err = restoreRawFields(req.Data, in.Request.Data, config.RawFields, "request")
+				if err != nil {
+					return err
+				}
+			}
+			if resp.Data != nil && in.Response != nil {
+				resp.Data, err = restoreRawFields(resp.Data, in.Response.Data, config.RawFields, "response")
+				if err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	var errString string
@@ -313,26 +352,43 @@ func (f *AuditFormatter) FormatResponse(ctx context.Context, w io.Writer, config
 		respEntry.Time = time.Now().UTC().Format(time.RFC3339Nano)
 	}
 
+	if len(config.DropFields) > 0 {
+		dropped := new(AuditResponseEntry)
+		if err := dropFields(respEntry, config.DropFields, dropped); err != nil {
+			return err
+		}
+		respEntry = dropped
+	}
+
+	if config.HashChain {
+		return f.writeChained(w, salt, func(w io.Writer, chain *AuditHashChain) error {
+			respEntry.HashChain = chain
+			return f.AuditFormatWriter.WriteResponse(w, respEntry)
+		})
+	}
+
 	return f.AuditFormatWriter.WriteResponse(w, respEntry)
 }
 
 // AuditRequestEntry is the structure of a request audit log entry in Audit.
 type AuditRequestEntry struct {
-	Time    string        `json:"time,omitempty"`
-	Type    string        `json:"type,omitempty"`
-	Auth    *AuditAuth    `json:"auth,omitempty"`
-	Request *AuditRequest `json:"request,omitempty"`
-	Error   string        `json:"error,omitempty"`
+	Time      string          `json:"time,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Auth      *AuditAuth      `json:"auth,omitempty"`
+	Request   *AuditRequest   `json:"request,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	HashChain *AuditHashChain `json:"hash_chain,omitempty"`
 }
 
 // AuditResponseEntry is the structure of a response audit log entry in Audit.
 type AuditResponseEntry struct {
-	Time     string         `json:"time,omitempty"`
-	Type     string         `json:"type,omitempty"`
-	Auth     *AuditAuth     `json:"auth,omitempty"`
-	Request  *AuditRequest  `json:"request,omitempty"`
-	Response *AuditResponse `json:"response,omitempty"`
-	Error    string         `json:"error,omitempty"`
+	Time      string          `json:"time,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Auth      *AuditAuth      `json:"auth,omitempty"`
+	Request   *AuditRequest   `json:"request,omitempty"`
+	Response  *AuditResponse  `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	HashChain *AuditHashChain `json:"hash_chain,omitempty"`
 }
 
 type AuditRequest struct {
@@ -21,6 +21,15 @@ type FormatterConfig struct {
 	Raw          bool
 	HMACAccessor bool
 
+	// HashChain links each entry to the previous one, see AuditHashChain
+	HashChain bool
+
+	// RawFields are the paths of the request and response data fields that
+	// are not hashed, and DropFields the paths of the fields left out of the
+	// entries, see ParseFieldRules
+	RawFields  []string
+	DropFields []string
+
 	// This should only ever be used in a testing context
 	OmitTime bool
 }
@@ -0,0 +1,308 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/quid/vault/sdk/helper/salt"
+)
+
+// AuditHashChain links an audit entry to the entry written before it, so that
+// removed or modified entries can be detected. The HMAC is computed, with the
+// salt of the audit device, over the sequence number of the entry, the random
+// nonce of its chain, the digest of the previous entry and the digest of the
+// entry itself, as written with an empty HMAC.
+type AuditHashChain struct {
+	Sequence uint64 `json:"sequence"`
+	Nonce    string `json:"nonce"`
+	Previous string `json:"previous"`
+
+	// HMAC must remain the last field, as hash_chain is the last field of the
+	// entries, so that it is the last HMAC of an entry as written
+	HMAC string `json:"hmac"`
+}
+
+// hashChain is the head of the hash chain of a formatter. The digest is kept
+// when a new chain is started, so that it is linked to the last entry written.
+type hashChain struct {
+	l        sync.Mutex
+	started  bool
+	sequence uint64
+	nonce    string
+	digest   string
+}
+
+// emptyHMAC is how an entry being chained is written before it is signed
+var emptyHMAC = []byte(`"hmac":""`)
+
+// hashChainInput returns the data that is HMAC'd to sign an entry. The digest
+// of the previous entry is empty for the first entry of a log.
+func hashChainInput(chain *AuditHashChain, entryDigest string) string {
+	return fmt.Sprintf("%d:%s:%s:%s", chain.Sequence, chain.Nonce, chain.Previous, entryDigest)
+}
+
+// entryDigest returns the digest of an entry as written, including its prefix
+// and line break
+func entryDigest(entry []byte) string {
+	sum := sha256.Sum256(entry)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeChained writes an entry linked to the previous one. The chain is locked
+// until the entry is written, so entries are linked in the order they are
+// written to w. Callers must in turn persist the entries in the order they are
+// formatted.
+func (f *AuditFormatter) writeChained(w io.Writer, salt *salt.Salt, write func(io.Writer, *AuditHashChain) error) error {
+	f.chain.l.Lock()
+	defer f.chain.l.Unlock()
+
+	var sequence uint64
+	nonce := f.chain.nonce
+	if f.chain.started {
+		sequence = f.chain.sequence + 1
+	} else {
+		var err error
+		nonce, err = uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+	}
+
+	chain := &AuditHashChain{
+		Sequence: sequence,
+		Nonce:    nonce,
+		Previous: f.chain.digest,
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, chain); err != nil {
+		return err
+	}
+
+	// Sign the entry as written, then fill in its HMAC
+	unsigned := buf.Bytes()
+	i := bytes.LastIndex(unsigned, emptyHMAC)
+	if i < 0 {
+		return fmt.Errorf("hash chaining requires entries in the JSON format")
+	}
+	hmac := HashString(salt, hashChainInput(chain, entryDigest(unsigned)))
+
+	entry := make([]byte, 0, len(unsigned)+len(hmac))
+	entry = append(entry, unsigned[:i]...)
+	entry = append(entry, `"hmac":"`+hmac+`"`...)
+	entry = append(entry, unsigned[i+len(emptyHMAC):]...)
+	if _, err := w.Write(entry); err != nil {
+		return err
+	}
+
+	f.chain.started = true
+	f.chain.sequence = sequence
+	f.chain.nonce = nonce
+	f.chain.digest = entryDigest(entry)
+	return nil
+}
+
+// ResumeHashChain continues the hash chain after an entry written by a
+// previous formatter, such as the last line of an existing audit log. If the
+// entry isn't a chained JSON entry, a new chain linked to it is started.
+func (f *AuditFormatter) ResumeHashChain(entry []byte) {
+	f.chain.l.Lock()
+	defer f.chain.l.Unlock()
+
+	f.chain.started = false
+	f.chain.sequence = 0
+	f.chain.nonce = ""
+	f.chain.digest = ""
+	if len(entry) == 0 {
+		return
+	}
+	f.chain.digest = entryDigest(entry)
+
+	chain, err := parseChainedEntry(entry)
+	if err != nil || chain == nil {
+		return
+	}
+
+	f.chain.started = true
+	f.chain.sequence = chain.Sequence
+	f.chain.nonce = chain.Nonce
+}
+
+// parseChainedEntry returns the hash chain of a JSON entry, skipping its
+// prefix. A nil chain is returned if the entry isn't chained.
+func parseChainedEntry(entry []byte) (*AuditHashChain, error) {
+	start := bytes.IndexByte(entry, '{')
+	if start < 0 {
+		return nil, fmt.Errorf("entry is not a JSON object")
+	}
+
+	var parsed struct {
+		HashChain *AuditHashChain `json:"hash_chain"`
+	}
+	if err := json.Unmarshal(entry[start:], &parsed); err != nil {
+		return nil, err
+	}
+
+	return parsed.HashChain, nil
+}
+
+// unsignedEntry returns an entry as it was written before its HMAC was filled
+// in, or nil if the HMAC can't be found in the entry
+func unsignedEntry(entry []byte, hmac string) []byte {
+	signed := []byte(`"hmac":"` + hmac + `"`)
+	i := bytes.LastIndex(entry, signed)
+	if i < 0 {
+		return nil
+	}
+
+	unsigned := make([]byte, 0, len(entry))
+	unsigned = append(unsigned, entry[:i]...)
+	unsigned = append(unsigned, emptyHMAC...)
+	return append(unsigned, entry[i+len(signed):]...)
+}
+
+// HashChainBreak is an entry of an audit log that doesn't follow the entry
+// before it
+type HashChainBreak struct {
+	Line   int
+	Reason string
+}
+
+// HashChainVerifier verifies the hash chain of audit logs written in the JSON
+// format with hash chaining enabled. The state of the chain is kept between
+// calls to Verify, so that a log split across several files, such as rotated
+// files, can be verified by passing them in order.
+type HashChainVerifier struct {
+	// HashFunc must return the HMAC of its input with the salt of the audit
+	// device that wrote the log, as returned by the sys/audit-hash endpoint.
+	HashFunc func(string) (string, error)
+
+	// Entries is the number of entries read
+	Entries int
+
+	// FirstSequence is the sequence number of the first entry read. When it
+	// isn't 0, the entries before it were not available for verification.
+	FirstSequence uint64
+
+	// Restarts is the number of times a new chain was started after the
+	// previous entry, which happens when an audit device can't resume the
+	// chain, e.g. when Vault restarts after the last entry of its log was not
+	// chained. A new chain that isn't linked to the previous entry is a break.
+	Restarts int
+
+	// read is set once an entry was read, and digest is then its digest
+	read     bool
+	started  bool
+	sequence uint64
+	nonce    string
+	digest   string
+}
+
+// Verify reads the entries of a log, one per line, and returns where its
+// chain is broken. An error is returned if the log can't be read or the
+// HMACs can't be computed.
+func (v *HashChainVerifier) Verify(r io.Reader) ([]*HashChainBreak, error) {
+	var breaks []*HashChainBreak
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		entry, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(entry) == 0 {
+				return breaks, nil
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		reason, err := v.verifyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			breaks = append(breaks, &HashChainBreak{
+				Line:   line,
+				Reason: reason,
+			})
+		}
+	}
+}
+
+// verifyEntry checks that an entry is authentic and follows the previous one,
+// and returns why it doesn't
+func (v *HashChainVerifier) verifyEntry(entry []byte) (string, error) {
+	read, previous := v.read, v.digest
+	v.read = true
+	v.digest = entryDigest(entry)
+	v.Entries++
+
+	chain, err := parseChainedEntry(entry)
+	if err != nil || chain == nil {
+		// The next entry can't be verified either, since the sequence of this
+		// one is unknown
+		v.started = false
+		return "entry is not a chained audit entry", nil
+	}
+
+	if v.Entries == 1 {
+		v.FirstSequence = chain.Sequence
+	}
+
+	var reason string
+	unsigned := unsignedEntry(entry, chain.HMAC)
+	if unsigned == nil {
+		reason = "entry's HMAC can't be found, it was modified"
+	} else {
+		expected, err := v.HashFunc(hashChainInput(chain, entryDigest(unsigned)))
+		if err != nil {
+			return "", err
+		}
+		if chain.HMAC != expected {
+			reason = "entry's HMAC doesn't match, it was modified"
+		}
+	}
+
+	switch {
+	case reason != "":
+
+	case chain.Sequence == 0:
+		// A new chain, which must be linked to the previous entry if it was
+		// read. The first entry of a log is linked to nothing.
+		if read {
+			v.Restarts++
+			if chain.Previous != previous {
+				reason = "entry starts a new chain that isn't linked to the previous entry, entries are missing or were modified"
+			}
+		}
+
+	case !v.started:
+		// The previous entry is unknown, so the link can't be verified
+
+	case chain.Nonce != v.nonce:
+		reason = "entry belongs to a different chain than the previous entry, entries are missing"
+
+	case chain.Sequence == v.sequence+1:
+		if chain.Previous != previous {
+			reason = "entry doesn't match the previous entry, which was modified"
+		}
+
+	case chain.Sequence > v.sequence+1:
+		missing := chain.Sequence - v.sequence - 1
+		reason = fmt.Sprintf("sequence jumps from %d to %d, %d entries are missing", v.sequence, chain.Sequence, missing)
+
+	default:
+		reason = fmt.Sprintf("sequence goes back from %d to %d, entries were reordered or duplicated", v.sequence, chain.Sequence)
+	}
+
+	v.started = true
+	v.sequence = chain.Sequence
+	v.nonce = chain.Nonce
+	return reason, nil
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/salt"
+	"github.com/quid/vault/sdk/logical"
+)
+
+func testHashChainLog(t *testing.T, formatter *AuditFormatter, entries int) []string {
+	t.Helper()
+
+	config := FormatterConfig{
+		HashChain: true,
+	}
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "secret/foo",
+		},
+	}
+
+	var lines []string
+	for i := 0; i < entries; i++ {
+		var buf bytes.Buffer
+		if err := formatter.FormatRequest(namespace.RootContext(nil), &buf, config, in); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, buf.String())
+	}
+	return lines
+}
+
+func TestHashChain_Verify(t *testing.T) {
+	salter, err := salt.NewSalt(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saltFunc := func(context.Context) (*salt.Salt, error) {
+		return salter, nil
+	}
+	hashFunc := func(data string) (string, error) {
+		return HashString(salter, data), nil
+	}
+
+	formatter := &AuditFormatter{
+		AuditFormatWriter: &JSONFormatWriter{
+			Prefix:   "@cee: ",
+			SaltFunc: saltFunc,
+		},
+	}
+	lines := testHashChainLog(t, formatter, 5)
+
+	verify := func(lines []string) []*HashChainBreak {
+		t.Helper()
+		verifier := &HashChainVerifier{
+			HashFunc: hashFunc,
+		}
+		breaks, err := verifier.Verify(strings.NewReader(strings.Join(lines, "")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return breaks
+	}
+
+	if breaks := verify(lines); len(breaks) != 0 {
+		t.Fatalf("expected no breaks, got %#v", breaks[0])
+	}
+
+	// A removed entry
+	removed := append(append([]string(nil), lines[:2]...), lines[3:]...)
+	breaks := verify(removed)
+	if len(breaks) != 1 || breaks[0].Line != 3 || !strings.Contains(breaks[0].Reason, "1 entries are missing") {
+		t.Fatalf("bad breaks: %#v", breaks)
+	}
+
+	// A modified entry is detected by its own HMAC and by the next entry
+	modified := append([]string(nil), lines...)
+	modified[1] = strings.Replace(modified[1], "secret/foo", "secret/bar", 1)
+	breaks = verify(modified)
+	if len(breaks) != 2 || breaks[0].Line != 2 || breaks[1].Line != 3 || !strings.Contains(breaks[0].Reason, "HMAC doesn't match") {
+		t.Fatalf("bad breaks: %#v", breaks)
+	}
+
+	// The first entries of chains differ, even with the same content
+	other := testHashChainLog(t, &AuditFormatter{AuditFormatWriter: formatter.AuditFormatWriter}, 1)
+	if other[0] == lines[0] {
+		t.Fatal("expected the first entries of two chains to differ")
+	}
+
+	// A first entry replaced by the first entry of another chain
+	breaks = verify(append(other, lines[1:]...))
+	if len(breaks) != 1 || breaks[0].Line != 2 || !strings.Contains(breaks[0].Reason, "different chain") {
+		t.Fatalf("bad breaks: %#v", breaks)
+	}
+
+	// A new formatter resuming the chain
+	resumed := &AuditFormatter{
+		AuditFormatWriter: formatter.AuditFormatWriter,
+	}
+	resumed.ResumeHashChain([]byte(lines[len(lines)-1]))
+	more := testHashChainLog(t, resumed, 2)
+	if breaks := verify(append(lines, more...)); len(breaks) != 0 {
+		t.Fatalf("expected no breaks, got %#v", breaks[0])
+	}
+
+	// Logs split across files are verified in order
+	verifier := &HashChainVerifier{
+		HashFunc: hashFunc,
+	}
+	for _, log := range [][]string{lines, more} {
+		breaks, err := verifier.Verify(strings.NewReader(strings.Join(log, "")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(breaks) != 0 {
+			t.Fatalf("expected no breaks, got %#v", breaks[0])
+		}
+	}
+	if verifier.Entries != 7 || verifier.FirstSequence != 0 || verifier.Restarts != 0 {
+		t.Fatalf("bad verifier state: %#v", verifier)
+	}
+
+	// A formatter resuming after an entry that isn't chained starts a new
+	// chain linked to it, which isn't a break
+	unchained := "@cee: {\"type\":\"request\"}\n"
+	restarted := &AuditFormatter{
+		AuditFormatWriter: formatter.AuditFormatWriter,
+	}
+	restarted.ResumeHashChain([]byte(unchained))
+	verifier = &HashChainVerifier{
+		HashFunc: hashFunc,
+	}
+	breaks, err = verifier.Verify(strings.NewReader(strings.Join(append(append(lines, unchained), testHashChainLog(t, restarted, 2)...), "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breaks) != 1 || breaks[0].Line != 6 || verifier.Restarts != 1 {
+		t.Fatalf("bad breaks: %#v, restarts: %d", breaks, verifier.Restarts)
+	}
+
+	// A new chain that isn't linked to the previous entry is a break
+	verifier = &HashChainVerifier{
+		HashFunc: hashFunc,
+	}
+	breaks, err = verifier.Verify(strings.NewReader(strings.Join(append(lines, other...), "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breaks) != 1 || breaks[0].Line != 6 || !strings.Contains(breaks[0].Reason, "isn't linked") || verifier.Restarts != 1 {
+		t.Fatalf("bad breaks: %#v, restarts: %d", breaks, verifier.Restarts)
+	}
+}
@@ -1,23 +1,37 @@
 package file
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/hashicorp/errwrap"
 	"github.com/quid/vault/audit"
+	"github.com/quid/vault/sdk/helper/parseutil"
 	"github.com/quid/vault/sdk/helper/salt"
 	"github.com/quid/vault/sdk/logical"
 )
 
+const (
+	// rotateTimeFormat is the format of the time in the name of rotated files
+	rotateTimeFormat = "2006-01-02T15-04-05.000000000"
+
+	compressedExt = ".gz"
+)
+
 func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
 	if conf.SaltConfig == nil {
 		return nil, fmt.Errorf("nil salt config")
@@ -72,6 +86,25 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	// Check which fields are logged raw or dropped
+	rawFields, dropFields, err := audit.ParseFieldRules(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if entries should be hash chained
+	hashChain := false
+	if hashChainRaw, ok := conf.Config["hash_chain"]; ok {
+		value, err := strconv.ParseBool(hashChainRaw)
+		if err != nil {
+			return nil, err
+		}
+		hashChain = value
+	}
+	if hashChain && format != "json" {
+		return nil, fmt.Errorf("hash_chain is only supported with the %q format", "json")
+	}
+
 	// Check if mode is provided
 	mode := os.FileMode(0600)
 	if modeRaw, ok := conf.Config["mode"]; ok {
@@ -84,15 +117,68 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	// Check if the file should be rotated
+	var maxBytes int64
+	if maxBytesRaw, ok := conf.Config["max_bytes"]; ok {
+		value, err := strconv.ParseInt(maxBytesRaw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("max_bytes can't be negative")
+		}
+		maxBytes = value
+	}
+
+	var maxAge time.Duration
+	if maxAgeRaw, ok := conf.Config["max_age"]; ok {
+		value, err := parseutil.ParseDurationSecond(maxAgeRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("max_age can't be negative")
+		}
+		maxAge = value
+	}
+
+	var maxFiles int
+	if maxFilesRaw, ok := conf.Config["max_files"]; ok {
+		value, err := strconv.Atoi(maxFilesRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("max_files can't be negative")
+		}
+		maxFiles = value
+	}
+
+	compress := false
+	if compressRaw, ok := conf.Config["compress"]; ok {
+		value, err := strconv.ParseBool(compressRaw)
+		if err != nil {
+			return nil, err
+		}
+		compress = value
+	}
+
 	b := &Backend{
 		path:       path,
 		mode:       mode,
+		maxBytes:   maxBytes,
+		maxAge:     maxAge,
+		maxFiles:   maxFiles,
+		compress:   compress,
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
 		salt:       new(atomic.Value),
 		formatConfig: audit.FormatterConfig{
 			Raw:          logRaw,
 			HMACAccessor: hmacAccessor,
+			RawFields:    rawFields,
+			DropFields:   dropFields,
+			HashChain:    hashChain,
 		},
 	}
 
@@ -123,6 +209,16 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		if err := b.open(); err != nil {
 			return nil, errwrap.Wrapf(fmt.Sprintf("sanity check failed; unable to open %q for writing: {{err}}", path), err)
 		}
+
+		// Continue the chain of the entries already in the file, or in the
+		// last rotated file if the file is empty
+		if hashChain {
+			entry, err := b.lastEntry()
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("unable to read the last entry of %q: {{err}}", path), err)
+			}
+			b.formatter.ResumeHashChain(entry)
+		}
 	}
 
 	return b, nil
@@ -130,9 +226,9 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 
 // Backend is the audit backend for the file-based audit store.
 //
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// The backend appends to a file. The file can be rotated by an external tool
+// followed by a Reload, or by the backend itself when it grows past maxBytes
+// or gets older than maxAge.
 type Backend struct {
 	path string
 
@@ -143,6 +239,24 @@ type Backend struct {
 	f        *os.File
 	mode     os.FileMode
 
+	// size and openedAt describe the current file, they are protected by the
+	// file lock
+	size     int64
+	openedAt time.Time
+
+	maxBytes int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+
+	// rotateLock serializes the compression and removal of rotated files,
+	// which happen in the background
+	rotateLock sync.Mutex
+	rotations  sync.WaitGroup
+
+	// chainLock keeps hash chained entries in the order they are formatted
+	chainLock sync.Mutex
+
 	saltMutex  sync.RWMutex
 	salt       *atomic.Value
 	saltConfig *salt.Config
@@ -193,6 +307,11 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 		return nil
 	}
 
+	if b.formatConfig.HashChain {
+		b.chainLock.Lock()
+		defer b.chainLock.Unlock()
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0, 2000))
 	err := b.formatter.FormatRequest(ctx, buf, b.formatConfig, in)
 	if err != nil {
@@ -212,10 +331,20 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 			b.fileLock.Unlock()
 			return err
 		}
+
+		// Rotating under the file lock ensures every entry is written whole
+		// to a single file
+		if b.shouldRotate(int64(buf.Len())) {
+			if err := b.rotate(); err != nil {
+				b.fileLock.Unlock()
+				return err
+			}
+		}
 		writer = b.f
 	}
 
-	if _, err := reader.WriteTo(writer); err == nil {
+	if n, err := reader.WriteTo(writer); err == nil {
+		b.size += n
 		b.fileLock.Unlock()
 		return nil
 	} else if b.path == "stdout" {
@@ -235,7 +364,8 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 	}
 
 	reader.Seek(0, io.SeekStart)
-	_, err := reader.WriteTo(writer)
+	n, err := reader.WriteTo(writer)
+	b.size += n
 	b.fileLock.Unlock()
 	return err
 }
@@ -249,6 +379,11 @@ func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
 		return nil
 	}
 
+	if b.formatConfig.HashChain {
+		b.chainLock.Lock()
+		defer b.chainLock.Unlock()
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0, 6000))
 	err := b.formatter.FormatResponse(ctx, buf, b.formatConfig, in)
 	if err != nil {
@@ -286,9 +421,255 @@ func (b *Backend) open() error {
 		}
 	}
 
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	b.size = info.Size()
+
+	// The file may have been rotated by an external tool before a reload
+	if b.openedAt.IsZero() || b.size == 0 {
+		b.openedAt = time.Now()
+	}
+
+	return nil
+}
+
+// lastEntry returns the last entry written by the backend, from the file or,
+// if it was just rotated, from the last rotated file. nil is returned if there
+// is no entry.
+func (b *Backend) lastEntry() ([]byte, error) {
+	entry, err := lastLine(b.path)
+	if err != nil || len(entry) > 0 {
+		return entry, err
+	}
+
+	rotated, err := b.rotatedFiles()
+	if err != nil || len(rotated) == 0 {
+		return nil, err
+	}
+
+	last := rotated[len(rotated)-1]
+	if !strings.HasSuffix(last, compressedExt) {
+		return lastLine(last)
+	}
+
+	f, err := os.Open(last)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compressed files can only be read from the start
+	reader := bufio.NewReader(gzipReader)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			entry = line
+		}
+		if err == io.EOF {
+			return entry, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lastLine returns the last line of a file, or nil if it is empty
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read backwards until the line break ending the line before the last one
+	var line []byte
+	chunk := make([]byte, 4096)
+	for offset := end; offset > 0; {
+		n := int64(len(chunk))
+		if n > offset {
+			n = offset
+		}
+		offset -= n
+
+		if _, err := f.ReadAt(chunk[:n], offset); err != nil {
+			return nil, err
+		}
+		line = append(append([]byte(nil), chunk[:n]...), line...)
+
+		// Skip the line break ending the last line
+		if i := bytes.LastIndexByte(line[:len(line)-1], '\n'); i >= 0 {
+			return line[i+1:], nil
+		}
+	}
+
+	return line, nil
+}
+
+// shouldRotate returns if the file must be rotated before writing an entry of
+// the given size. The file lock must be held before calling this.
+func (b *Backend) shouldRotate(entrySize int64) bool {
+	switch b.path {
+	case "/dev/null":
+		return false
+	}
+
+	if b.size == 0 {
+		return false
+	}
+	if b.maxBytes > 0 && b.size+entrySize > b.maxBytes {
+		return true
+	}
+	if b.maxAge > 0 && time.Since(b.openedAt) >= b.maxAge {
+		return true
+	}
+	return false
+}
+
+// rotate renames the file with the current time and opens a new one. The
+// rotated file is then compressed and the oldest ones are removed in the
+// background. The file lock must be held before calling this.
+func (b *Backend) rotate() error {
+	err := b.f.Close()
+	b.f = nil
+	if err != nil {
+		return err
+	}
+
+	rotated := b.rotatedPath(time.Now())
+	if err := os.Rename(b.path, rotated); err != nil {
+		return err
+	}
+
+	b.openedAt = time.Time{}
+	if err := b.open(); err != nil {
+		return err
+	}
+
+	b.rotations.Add(1)
+	go b.cleanupRotated(rotated)
 	return nil
 }
 
+// rotatedPath returns the path of the file rotated at the given time, which
+// adds the time to the name of the file before its extension, so that the
+// rotated files sort by age
+func (b *Backend) rotatedPath(t time.Time) string {
+	ext := filepath.Ext(b.path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(b.path, ext), t.UTC().Format(rotateTimeFormat), ext)
+}
+
+// rotatedFiles returns the rotated files, compressed or not, oldest first
+func (b *Backend) rotatedFiles() ([]string, error) {
+	dir := filepath.Dir(b.path)
+	ext := filepath.Ext(b.path)
+	prefix := strings.TrimSuffix(filepath.Base(b.path), ext) + "-"
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), compressedExt)
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := time.Parse(rotateTimeFormat, name[len(prefix):len(name)-len(ext)]); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// cleanupRotated compresses a rotated file and removes the oldest rotated
+// files beyond maxFiles
+func (b *Backend) cleanupRotated(rotated string) {
+	defer b.rotations.Done()
+
+	b.rotateLock.Lock()
+	defer b.rotateLock.Unlock()
+
+	if b.compress {
+		if err := compressFile(rotated, b.mode); err != nil {
+			// The rotated file is kept uncompressed
+			metrics.IncrCounter([]string{"audit", "file", "compress_failed"}, 1)
+		}
+	}
+
+	if b.maxFiles == 0 {
+		return
+	}
+
+	files, err := b.rotatedFiles()
+	if err != nil {
+		metrics.IncrCounter([]string{"audit", "file", "remove_failed"}, 1)
+		return
+	}
+	for len(files) > b.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			metrics.IncrCounter([]string{"audit", "file", "remove_failed"}, 1)
+		}
+		files = files[1:]
+	}
+}
+
+// compressFile replaces a file with its gzip compressed version
+func compressFile(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if mode == 0 {
+		mode = 0600
+	}
+
+	// Write to a temporary file first so that a partially written file is
+	// never mistaken for a rotated one
+	tmpPath := path + compressedExt + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(dst)
+	_, err = io.Copy(gzipWriter, src)
+	if cErr := gzipWriter.Close(); err == nil {
+		err = cErr
+	}
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path+compressedExt); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
 func (b *Backend) Reload(_ context.Context) error {
 	switch b.path {
 	case "stdout", "discard":
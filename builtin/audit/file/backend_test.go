@@ -1,7 +1,9 @@
 package file
 
 import (
+	"compress/gzip"
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -93,6 +95,186 @@ func TestAuditFile_fileModeExisting(t *testing.T) {
 	}
 }
 
+func TestAuditFile_rotate(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "audit.log")
+	sink, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"file_path": file,
+			"max_bytes": "1024",
+			"max_files": "2",
+			"compress":  "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := sink.(*Backend)
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "secret/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+	for i := 0; i < 50; i++ {
+		if err := b.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.rotations.Wait()
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1024 {
+		t.Fatalf("expected the file to be rotated, got %d bytes", info.Size())
+	}
+
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", rotated)
+	}
+
+	for _, name := range rotated {
+		if filepath.Ext(name) != ".gz" {
+			t.Fatalf("expected %q to be compressed", name)
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 || len(data) > 1024 || data[len(data)-1] != '\n' {
+			t.Fatalf("bad rotated file %q: %d bytes", name, len(data))
+		}
+	}
+}
+
+func TestAuditFile_hashChainResume(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-test_audit_file-hash_chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "audit.log")
+	config := &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"file_path":  file,
+			"max_bytes":  "1048576",
+			"compress":   "true",
+			"hash_chain": "true",
+		},
+	}
+
+	in := &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "secret/foo",
+		},
+	}
+	ctx := namespace.RootContext(nil)
+
+	sink, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := sink.(*Backend)
+	for i := 0; i < 3; i++ {
+		if err := b.LogRequest(ctx, in); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rotate right before Vault restarts, leaving an empty file
+	b.fileLock.Lock()
+	err = b.rotate()
+	b.fileLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.rotations.Wait()
+
+	// The chain continues from the compressed rotated file
+	sink, err = Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = sink.(*Backend)
+	if err := b.LogRequest(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+
+	salter, err := b.Salt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &audit.HashChainVerifier{
+		HashFunc: func(data string) (string, error) {
+			return audit.HashString(salter, data), nil
+		},
+	}
+
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 || filepath.Ext(rotated[0]) != ".gz" {
+		t.Fatalf("expected 1 compressed rotated file, got %v", rotated)
+	}
+	f, err := os.Open(rotated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer current.Close()
+
+	for _, log := range []io.Reader{r, current} {
+		breaks, err := verifier.Verify(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(breaks) != 0 {
+			t.Fatalf("expected no breaks, got %#v", breaks[0])
+		}
+	}
+	if verifier.Entries != 4 || verifier.Restarts != 0 {
+		t.Fatalf("bad verifier state: %#v", verifier)
+	}
+}
+
 func BenchmarkAuditFile_request(b *testing.B) {
 	config := map[string]string{
 		"path": "/dev/null",
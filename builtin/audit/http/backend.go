@@ -0,0 +1,560 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/quid/vault/audit"
+	"github.com/quid/vault/sdk/helper/parseutil"
+	"github.com/quid/vault/sdk/helper/salt"
+	"github.com/quid/vault/sdk/logical"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 5 * time.Second
+	defaultSpillMaxSize  = 100 * 1024 * 1024
+
+	// maxSpillRetryInterval bounds the time between the retries of the
+	// spilled batches while the endpoint can't be reached
+	maxSpillRetryInterval = time.Minute
+)
+
+func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.SaltConfig == nil {
+		return nil, fmt.Errorf("nil salt config")
+	}
+	if conf.SaltView == nil {
+		return nil, fmt.Errorf("nil salt view")
+	}
+
+	address, ok := conf.Config["address"]
+	if !ok {
+		return nil, fmt.Errorf("address is required")
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid address: {{err}}", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid address %q, the scheme must be http or https", address)
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	switch format {
+	case "json", "jsonx":
+	default:
+		return nil, fmt.Errorf("unknown format type %q", format)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	// Check which fields are logged raw or dropped
+	rawFields, dropFields, err := audit.ParseFieldRules(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// By default a request only proceeds once its entry has been delivered,
+	// or spilled to disk for retry
+	blocking := true
+	if blockingRaw, ok := conf.Config["blocking"]; ok {
+		value, err := strconv.ParseBool(blockingRaw)
+		if err != nil {
+			return nil, err
+		}
+		blocking = value
+	}
+
+	batchSize := defaultBatchSize
+	if batchSizeRaw, ok := conf.Config["batch_size"]; ok {
+		value, err := strconv.Atoi(batchSizeRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("batch_size must be positive")
+		}
+		batchSize = value
+	}
+
+	flushInterval := defaultFlushInterval
+	if flushIntervalRaw, ok := conf.Config["flush_interval"]; ok {
+		value, err := parseutil.ParseDurationSecond(flushIntervalRaw)
+		if err != nil {
+			return nil, err
+		}
+		if value <= 0 {
+			return nil, fmt.Errorf("flush_interval must be positive")
+		}
+		flushInterval = value
+	}
+
+	timeout := defaultTimeout
+	if timeoutRaw, ok := conf.Config["request_timeout"]; ok {
+		value, err := parseutil.ParseDurationSecond(timeoutRaw)
+		if err != nil {
+			return nil, err
+		}
+		timeout = value
+	}
+
+	headers := make(map[string]string)
+	if headersRaw, ok := conf.Config["headers"]; ok {
+		if err := json.Unmarshal([]byte(headersRaw), &headers); err != nil {
+			return nil, errwrap.Wrapf("headers must be a JSON object of strings: {{err}}", err)
+		}
+	}
+
+	tlsConfig, err := tlsConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backend{
+		saltConfig: conf.SaltConfig,
+		saltView:   conf.SaltView,
+		formatConfig: audit.FormatterConfig{
+			Raw:          logRaw,
+			HMACAccessor: hmacAccessor,
+			RawFields:    rawFields,
+			DropFields:   dropFields,
+		},
+
+		address:       address,
+		jsonx:         format == "jsonx",
+		headers:       headers,
+		blocking:      blocking,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+
+	switch format {
+	case "json":
+		b.contentType = "application/x-ndjson"
+		b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	case "jsonx":
+		b.contentType = "application/xml"
+		b.formatter.AuditFormatWriter = &audit.JSONxFormatWriter{
+			Prefix:   conf.Config["prefix"],
+			SaltFunc: b.Salt,
+		}
+	}
+
+	if spillPath, ok := conf.Config["spill_path"]; ok {
+		maxSize := int64(defaultSpillMaxSize)
+		if maxSizeRaw, ok := conf.Config["spill_max_size"]; ok {
+			value, err := strconv.ParseInt(maxSizeRaw, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			if value <= 0 {
+				return nil, fmt.Errorf("spill_max_size must be positive")
+			}
+			maxSize = value
+		}
+
+		b.spill, err = newSpillQueue(spillPath, maxSize)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("sanity check failed; unable to use %q for spilling: {{err}}", spillPath), err)
+		}
+	}
+
+	return b, nil
+}
+
+// tlsConfig builds the TLS configuration used to connect to the collector
+func tlsConfig(config map[string]string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config["tls_server_name"],
+	}
+
+	if skipVerifyRaw, ok := config["tls_skip_verify"]; ok {
+		value, err := strconv.ParseBool(skipVerifyRaw)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = value
+	}
+
+	if caCert, ok := config["tls_ca_cert"]; ok {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, errwrap.Wrapf("error reading tls_ca_cert: {{err}}", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in tls_ca_cert %q", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	clientCert, hasCert := config["tls_client_cert"]
+	clientKey, hasKey := config["tls_client_key"]
+	switch {
+	case hasCert && hasKey:
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, errwrap.Wrapf("error loading the TLS client certificate: {{err}}", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case hasCert || hasKey:
+		return nil, fmt.Errorf("both tls_client_cert and tls_client_key must be set")
+	}
+
+	return tlsConfig, nil
+}
+
+// Backend is the audit backend that sends batches of entries to an HTTP
+// endpoint.
+//
+// Entries are sent in the order they are logged. When the endpoint can't be
+// reached, batches are spilled to disk, if configured, and sent again before
+// any newer entry. The pending entries are sent when the backend is closed.
+type Backend struct {
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+	contentType  string
+	jsonx        bool
+
+	address       string
+	headers       map[string]string
+	blocking      bool
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+	spill         *spillQueue
+
+	// pendingLock protects the entries waiting to be sent and the timer
+	// flushing them
+	pendingLock sync.Mutex
+	pending     []*pendingEntry
+	timer       *time.Timer
+
+	// sendLock serializes the flushes so that entries are sent in order. It
+	// also protects the state of the retries of the spilled batches: while
+	// spillErr is set, the spilled batches are only retried once spillRetry
+	// is reached, so that an endpoint that is down doesn't hold up every flush
+	// for the request timeout.
+	sendLock     sync.Mutex
+	spillErr     error
+	spillRetry   time.Time
+	spillBackoff time.Duration
+
+	saltMutex  sync.RWMutex
+	salt       *salt.Salt
+	saltConfig *salt.Config
+	saltView   logical.Storage
+}
+
+// pendingEntry is a formatted entry waiting to be sent. In blocking mode, the
+// outcome of sending it is reported on done.
+type pendingEntry struct {
+	data []byte
+	done chan error
+}
+
+var _ audit.Backend = (*Backend)(nil)
+var _ audit.Closer = (*Backend)(nil)
+
+func (b *Backend) GetHash(ctx context.Context, data string) (string, error) {
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return "", err
+	}
+	return audit.HashString(salt, data), nil
+}
+
+func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.log(ctx, buf.Bytes())
+}
+
+func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.log(ctx, buf.Bytes())
+}
+
+// log queues the entry to be sent. In blocking mode it flushes the queue
+// right away and returns the outcome for the entry, so the entries of
+// concurrent requests are batched together while one is being sent. Otherwise
+// the entry is sent once the batch is full or the flush interval expires.
+func (b *Backend) log(ctx context.Context, data []byte) error {
+	entry := &pendingEntry{
+		data: data,
+	}
+	if b.blocking {
+		entry.done = make(chan error, 1)
+	}
+
+	b.pendingLock.Lock()
+	b.pending = append(b.pending, entry)
+	full := len(b.pending) >= b.batchSize
+	if !b.blocking && !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.flushInterval, b.flush)
+	}
+	b.pendingLock.Unlock()
+
+	if !b.blocking {
+		if full {
+			go b.flush()
+		}
+		return nil
+	}
+
+	// Once the flush returns, the entry was sent either by it or by the flush
+	// that was running when it was called
+	b.flush()
+	select {
+	case err := <-entry.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush sends the pending entries in batches, after any spilled batch. In
+// blocking mode, the failure to send an entry is reported even if the entry
+// was spilled.
+func (b *Backend) flush() {
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+
+	b.pendingLock.Lock()
+	entries := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.pendingLock.Unlock()
+
+	// Newer entries are spilled too while older ones can't be sent
+	spillErr := b.retrySpilled()
+
+	for len(entries) > 0 {
+		n := b.batchSize
+		if n > len(entries) {
+			n = len(entries)
+		}
+		batch := entries[:n]
+		entries = entries[n:]
+
+		body := b.batchBody(batch)
+
+		err := spillErr
+		if err == nil {
+			err = b.send(body.Bytes())
+		}
+
+		spilled := false
+		if err != nil && b.spill != nil {
+			if sErr := b.spill.write(body.Bytes()); sErr != nil {
+				err = multierror.Append(err, sErr)
+			} else {
+				metrics.IncrCounter([]string{"audit", "http", "spilled"}, float32(len(batch)))
+				spilled = true
+				if spillErr == nil {
+					b.setSpillErr(err)
+					spillErr = err
+				}
+			}
+		}
+
+		if err != nil && !spilled {
+			metrics.IncrCounter([]string{"audit", "http", "failed"}, float32(len(batch)))
+		}
+
+		for _, entry := range batch {
+			if entry.done != nil {
+				entry.done <- err
+			}
+		}
+	}
+}
+
+// batchBody joins the formatted entries of a batch. JSONx entries are the
+// members of an object without the enclosing element, so they are wrapped in a
+// JSONx array to form a single XML document.
+func (b *Backend) batchBody(batch []*pendingEntry) *bytes.Buffer {
+	var body bytes.Buffer
+	if b.jsonx {
+		body.WriteString(xml.Header)
+		body.WriteString(`<json:array xmlns:json="http://www.ibm.com/xmlns/prod/2009/jsonx">`)
+	}
+	for _, entry := range batch {
+		if b.jsonx {
+			body.WriteString("<json:object>")
+		}
+		body.Write(entry.data)
+		if b.jsonx {
+			body.WriteString("</json:object>\n")
+		}
+	}
+	if b.jsonx {
+		body.WriteString("</json:array>\n")
+	}
+	return &body
+}
+
+// retrySpilled sends the spilled batches, oldest first. It stops at the first
+// batch that can't be sent and returns the error. After a failure, the
+// previous error is returned until the next retry is due.
+func (b *Backend) retrySpilled() error {
+	if b.spill == nil {
+		return nil
+	}
+
+	if b.spillErr != nil && time.Now().Before(b.spillRetry) {
+		return b.spillErr
+	}
+
+	err := b.spill.drain(b.send)
+	b.setSpillErr(err)
+	return err
+}
+
+// setSpillErr records the outcome of sending the spilled batches. The time
+// until the next retry doubles with every failure in a row, starting from the
+// flush interval.
+func (b *Backend) setSpillErr(err error) {
+	b.spillErr = err
+	if err == nil {
+		b.spillBackoff = 0
+		return
+	}
+
+	switch {
+	case b.spillBackoff == 0:
+		b.spillBackoff = b.flushInterval
+	case b.spillBackoff < maxSpillRetryInterval:
+		b.spillBackoff *= 2
+	}
+	if b.spillBackoff > maxSpillRetryInterval {
+		b.spillBackoff = maxSpillRetryInterval
+	}
+	b.spillRetry = time.Now().Add(b.spillBackoff)
+}
+
+// send posts a batch of formatted entries to the endpoint
+func (b *Backend) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, b.address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", b.contentType)
+	for k, v := range b.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d from the audit endpoint", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Reload flushes the pending entries, retrying the spilled ones
+func (b *Backend) Reload(_ context.Context) error {
+	b.flush()
+
+	return nil
+}
+
+// Close flushes the pending entries, so that the entries of a non-blocking
+// device are not lost when it is disabled or Vault is sealed
+func (b *Backend) Close() error {
+	b.flush()
+
+	return nil
+}
+
+func (b *Backend) Salt(ctx context.Context) (*salt.Salt, error) {
+	b.saltMutex.RLock()
+	if b.salt != nil {
+		defer b.saltMutex.RUnlock()
+		return b.salt, nil
+	}
+	b.saltMutex.RUnlock()
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	if b.salt != nil {
+		return b.salt, nil
+	}
+	salt, err := salt.NewSalt(ctx, b.saltView, b.saltConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.salt = salt
+	return salt, nil
+}
+
+func (b *Backend) Invalidate(_ context.Context) {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	b.salt = nil
+}
@@ -0,0 +1,307 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quid/vault/audit"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/salt"
+	"github.com/quid/vault/sdk/logical"
+)
+
+type testCollector struct {
+	sync.Mutex
+	down     int32
+	requests int32
+	batches  [][]byte
+	headers  []http.Header
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&c.requests, 1)
+	if atomic.LoadInt32(&c.down) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.batches = append(c.batches, body)
+	c.headers = append(c.headers, r.Header)
+}
+
+// entries returns the number of entries received, in order
+func (c *testCollector) entries(t *testing.T) int {
+	t.Helper()
+	c.Lock()
+	defer c.Unlock()
+
+	count := 0
+	for _, batch := range c.batches {
+		scanner := bufio.NewScanner(bytes.NewReader(batch))
+		for scanner.Scan() {
+			count++
+		}
+	}
+	return count
+}
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	t.Helper()
+	b, err := Factory(namespace.RootContext(nil), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testLogInput() *logical.LogInput {
+	return &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "secret/foo",
+		},
+	}
+}
+
+func TestAuditHTTP_Blocking(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address": server.URL,
+		"headers": `{"X-Collector-Token": "foo"}`,
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Blocking entries are delivered by the time they are logged
+	if n := collector.entries(t); n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+	if v := collector.headers[0].Get("X-Collector-Token"); v != "foo" {
+		t.Fatalf("bad header: %q", v)
+	}
+
+	// Without spilling, the failure is reported so that the broker can fail
+	// the request
+	atomic.StoreInt32(&collector.down, 1)
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err == nil {
+		t.Fatal("expected an error with the endpoint down")
+	}
+}
+
+func TestAuditHTTP_Batching(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"blocking":       "false",
+		"batch_size":     "5",
+		"flush_interval": "1h",
+	})
+
+	for i := 0; i < 4; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := collector.entries(t); n != 0 {
+		t.Fatalf("expected the entries to wait for the batch to be full, got %d", n)
+	}
+
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The full batch is sent in the background
+	b.flush()
+	if n := collector.entries(t); n != 5 {
+		t.Fatalf("expected 5 entries, got %d", n)
+	}
+	if len(collector.batches) != 1 {
+		t.Fatalf("expected a single batch, got %d", len(collector.batches))
+	}
+}
+
+func TestAuditHTTP_Spill(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-test_audit_http-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"spill_path":     dir,
+		"spill_max_size": "4096",
+		"flush_interval": "1h",
+	})
+
+	// Blocking entries are spilled, but the failure is still reported
+	atomic.StoreInt32(&collector.down, 1)
+	for i := 0; i < 2; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err == nil {
+			t.Fatal("expected an error with the endpoint down")
+		}
+	}
+	if files := spillFiles(t, b); len(files) != 2 {
+		t.Fatalf("expected 2 spilled batches, got %d", len(files))
+	}
+
+	// The spilled batches are not retried with every flush
+	if n := atomic.LoadInt32(&collector.requests); n != 1 {
+		t.Fatalf("expected a single request to the collector, got %d", n)
+	}
+	if b.spillRetry.IsZero() {
+		t.Fatal("expected a retry of the spilled batches to be scheduled")
+	}
+
+	// The spill is bounded
+	for i := 0; i < 100; i++ {
+		b.LogRequest(namespace.RootContext(nil), testLogInput())
+	}
+	if b.spill.size > 4096 {
+		t.Fatalf("expected the spill to be bounded, got %d bytes", b.spill.size)
+	}
+
+	// The spilled batches are sent before the new entries once the retry is
+	// due
+	atomic.StoreInt32(&collector.down, 0)
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err == nil {
+		t.Fatal("expected the entry to be spilled until the retry is due")
+	}
+	spilled := len(spillFiles(t, b))
+	b.sendLock.Lock()
+	b.spillRetry = time.Time{}
+	b.sendLock.Unlock()
+	if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+		t.Fatal(err)
+	}
+	if n := collector.entries(t); n != spilled+1 {
+		t.Fatalf("expected %d entries, got %d", spilled+1, n)
+	}
+	if files := spillFiles(t, b); len(files) != 0 {
+		t.Fatalf("expected the spill to be drained, got %d files", len(files))
+	}
+}
+
+func TestAuditHTTP_Close(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"blocking":       "false",
+		"flush_interval": "1h",
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pending entries are sent when the device is disabled or Vault is sealed
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := collector.entries(t); n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+}
+
+func TestAuditHTTP_JSONx(t *testing.T) {
+	collector := &testCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	b := testBackend(t, map[string]string{
+		"address":        server.URL,
+		"format":         "jsonx",
+		"blocking":       "false",
+		"flush_interval": "1h",
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := b.LogRequest(namespace.RootContext(nil), testLogInput()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.flush()
+
+	// The entries of a batch form a single XML document
+	collector.Lock()
+	defer collector.Unlock()
+	if len(collector.batches) != 1 {
+		t.Fatalf("expected a single batch, got %d", len(collector.batches))
+	}
+	roots, entries, depth := 0, 0, 0
+	decoder := xml.NewDecoder(bytes.NewReader(collector.batches[0]))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("bad XML document: %v", err)
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			switch depth {
+			case 0:
+				roots++
+			case 1:
+				entries++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 || entries != 2 {
+		t.Fatalf("expected a single root element with 2 entries, got %d roots and %d entries", roots, entries)
+	}
+}
+
+func spillFiles(t *testing.T, b *Backend) []string {
+	t.Helper()
+	files, err := b.spill.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
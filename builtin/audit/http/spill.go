@@ -0,0 +1,129 @@
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const spillFileSuffix = ".batch"
+
+// spillQueue stores the batches that couldn't be sent in a directory, one
+// file per batch, until they can be sent again. The total size of the stored
+// batches is bounded, since the endpoint may be down for a long time.
+type spillQueue struct {
+	path    string
+	maxSize int64
+
+	l    sync.Mutex
+	size int64
+	last int64
+}
+
+// newSpillQueue opens the spill directory, creating it if needed. Batches
+// spilled before a restart are picked up.
+func newSpillQueue(path string, maxSize int64) (*spillQueue, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	q := &spillQueue{
+		path:    path,
+		maxSize: maxSize,
+	}
+
+	files, err := q.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		q.size += info.Size()
+	}
+
+	return q, nil
+}
+
+// files returns the spilled batch files, oldest first
+func (q *spillQueue) files() ([]string, error) {
+	entries, err := ioutil.ReadDir(q.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spillFileSuffix) {
+			continue
+		}
+		files = append(files, filepath.Join(q.path, entry.Name()))
+	}
+
+	// The names are zero padded timestamps, so they sort in spill order
+	sort.Strings(files)
+	return files, nil
+}
+
+// write stores a batch, unless the queue is full
+func (q *spillQueue) write(batch []byte) error {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	if q.size+int64(len(batch)) > q.maxSize {
+		return fmt.Errorf("audit spill directory %q is full", q.path)
+	}
+
+	// Keep the names increasing even if the clock doesn't
+	name := time.Now().UnixNano()
+	if name <= q.last {
+		name = q.last + 1
+	}
+
+	file := filepath.Join(q.path, fmt.Sprintf("%020d%s", name, spillFileSuffix))
+	if err := ioutil.WriteFile(file, batch, 0600); err != nil {
+		os.Remove(file)
+		return err
+	}
+
+	q.last = name
+	q.size += int64(len(batch))
+	return nil
+}
+
+// drain sends the stored batches in order, removing each once sent. It stops
+// at the first batch that can't be sent.
+func (q *spillQueue) drain(send func([]byte) error) error {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	files, err := q.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		batch, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err := send(batch); err != nil {
+			return err
+		}
+
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		q.size -= int64(len(batch))
+	}
+
+	return nil
+}
@@ -73,12 +73,20 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	// Check which fields are logged raw or dropped
+	rawFields, dropFields, err := audit.ParseFieldRules(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &Backend{
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
 		formatConfig: audit.FormatterConfig{
 			Raw:          logRaw,
 			HMACAccessor: hmacAccessor,
+			RawFields:    rawFields,
+			DropFields:   dropFields,
 		},
 
 		writeDuration: writeDuration,
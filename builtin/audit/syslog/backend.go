@@ -63,6 +63,12 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	// Check which fields are logged raw or dropped
+	rawFields, dropFields, err := audit.ParseFieldRules(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the logger
 	logger, err := gsyslog.NewLogger(gsyslog.LOG_INFO, facility, tag)
 	if err != nil {
@@ -76,6 +82,8 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		formatConfig: audit.FormatterConfig{
 			Raw:          logRaw,
 			HMACAccessor: hmacAccessor,
+			RawFields:    rawFields,
+			DropFields:   dropFields,
 		},
 	}
 
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/quid/vault/audit"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*AuditVerifyCommand)(nil)
+var _ cli.CommandAutocomplete = (*AuditVerifyCommand)(nil)
+
+type AuditVerifyCommand struct {
+	*BaseCommand
+
+	flagPath string
+}
+
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verifies the hash chain of an audit log"
+}
+
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: vault audit verify [options] FILE...
+
+  Verifies that the entries of an audit log written by a file audit device
+  with "hash_chain" enabled were not removed or modified. The HMACs of the
+  entries are computed by the audit device, so this requires a token allowed
+  to update "sys/audit-hash" for the device.
+
+  Files are verified in the order given, so that rotated logs can be verified
+  together, oldest first. Files ending with ".gz" are decompressed. A new chain
+  must be linked to the last entry of the previous file, otherwise entries are
+  reported missing. The last entries of the log can be removed without being
+  detected, unless the log is compared with a later copy.
+
+  Verify the log of the audit device enabled at "file/":
+
+      $ vault audit verify /var/log/vault_audit.log
+
+  Verify a rotated log of the audit device enabled at "chained/":
+
+      $ vault audit verify -path=chained/ audit.log.1 audit.log
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AuditVerifyCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.StringVar(&StringVar{
+		Name:       "path",
+		Target:     &c.flagPath,
+		Default:    "file/",
+		EnvVar:     "",
+		Completion: c.PredictVaultAudits(),
+		Usage:      "Path of the audit device that wrote the log.",
+	})
+
+	return set
+}
+
+func (c *AuditVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *AuditVerifyCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *AuditVerifyCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) < 1 {
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected at least 1, got %d)", len(args)))
+		return 1
+	}
+
+	path := ensureTrailingSlash(sanitizePath(c.flagPath))
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	verifier := &audit.HashChainVerifier{
+		HashFunc: func(input string) (string, error) {
+			return client.Sys().AuditHash(path, input)
+		},
+	}
+
+	broken := false
+	for _, file := range args {
+		logFile, err := os.Open(file)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error opening audit log: %s", err))
+			return 2
+		}
+
+		// Files rotated by the audit device may be compressed
+		var logReader io.Reader = logFile
+		if strings.HasSuffix(file, ".gz") {
+			gzipReader, err := gzip.NewReader(logFile)
+			if err != nil {
+				logFile.Close()
+				c.UI.Error(fmt.Sprintf("Error reading %s: %s", file, err))
+				return 2
+			}
+			logReader = gzipReader
+		}
+
+		breaks, err := verifier.Verify(logReader)
+		logFile.Close()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error verifying %s: %s", file, err))
+			return 2
+		}
+
+		for _, b := range breaks {
+			c.UI.Error(fmt.Sprintf("%s:%d: %s", file, b.Line, b.Reason))
+			broken = true
+		}
+	}
+
+	if verifier.Entries == 0 {
+		c.UI.Error("No audit entries found")
+		return 2
+	}
+
+	if verifier.FirstSequence != 0 {
+		c.UI.Warn(wrapAtLength(fmt.Sprintf("The log starts at sequence %d, the "+
+			"entries before it were not verified.", verifier.FirstSequence)))
+	}
+
+	if broken {
+		c.UI.Error("The audit log was tampered with")
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Verified %d audit entries", verifier.Entries))
+	return 0
+}
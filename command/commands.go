@@ -20,6 +20,7 @@ import (
 	_ "github.com/quid/vault/helper/builtinplugins"
 
 	auditFile "github.com/quid/vault/builtin/audit/file"
+	auditHTTP "github.com/quid/vault/builtin/audit/http"
 	auditSocket "github.com/quid/vault/builtin/audit/socket"
 	auditSyslog "github.com/quid/vault/builtin/audit/syslog"
 
@@ -115,6 +116,7 @@ const (
 var (
 	auditBackends = map[string]audit.Factory{
 		"file":   auditFile.Factory,
+		"http":   auditHTTP.Factory,
 		"socket": auditSocket.Factory,
 		"syslog": auditSyslog.Factory,
 	}
@@ -232,6 +234,11 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"audit verify": func() (cli.Command, error) {
+			return &AuditVerifyCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"auth tune": func() (cli.Command, error) {
 			return &AuthTuneCommand{
 				BaseCommand: getBaseCommand(),
@@ -330,6 +337,11 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"operator decrypt-share": func() (cli.Command, error) {
+			return &OperatorDecryptShareCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"operator generate-root": func() (cli.Command, error) {
 			return &OperatorGenerateRootCommand{
 				BaseCommand: getBaseCommand(),
@@ -362,6 +374,16 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"operator raft autopilot": func() (cli.Command, error) {
+			return &OperatorRaftAutopilotCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator raft autopilot state": func() (cli.Command, error) {
+			return &OperatorRaftAutopilotStateCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"operator raft join": func() (cli.Command, error) {
 			return &OperatorRaftJoinCommand{
 				BaseCommand: getBaseCommand(),
@@ -377,6 +399,16 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"operator raft snapshot extract": func() (cli.Command, error) {
+			return &OperatorRaftSnapshotExtractCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator raft snapshot inspect": func() (cli.Command, error) {
+			return &OperatorRaftSnapshotInspectCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"operator raft snapshot restore": func() (cli.Command, error) {
 			return &OperatorRaftSnapshotRestoreCommand{
 				BaseCommand: getBaseCommand(),
@@ -407,6 +439,31 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"operator storage-migration": func() (cli.Command, error) {
+			return &OperatorStorageMigrationCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator storage-migration abort": func() (cli.Command, error) {
+			return &OperatorStorageMigrationAbortCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator storage-migration cutover": func() (cli.Command, error) {
+			return &OperatorStorageMigrationCutoverCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator storage-migration start": func() (cli.Command, error) {
+			return &OperatorStorageMigrationStartCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"operator storage-migration status": func() (cli.Command, error) {
+			return &OperatorStorageMigrationStatusCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"operator unseal": func() (cli.Command, error) {
 			return &OperatorUnsealCommand{
 				BaseCommand: getBaseCommand(),
@@ -467,6 +524,11 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"policy history": func() (cli.Command, error) {
+			return &PolicyHistoryCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"policy list": func() (cli.Command, error) {
 			return &PolicyListCommand{
 				BaseCommand: getBaseCommand(),
@@ -477,6 +539,16 @@ func initCommands(ui, serverCmdUi cli.Ui, runOpts *RunOptions) {
 				BaseCommand: getBaseCommand(),
 			}, nil
 		},
+		"policy rollback": func() (cli.Command, error) {
+			return &PolicyRollbackCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
+		"policy simulate": func() (cli.Command, error) {
+			return &PolicySimulateCommand{
+				BaseCommand: getBaseCommand(),
+			}, nil
+		},
 		"policy write": func() (cli.Command, error) {
 			return &PolicyWriteCommand{
 				BaseCommand: getBaseCommand(),
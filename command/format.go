@@ -334,6 +334,14 @@ func OutputSealStatus(ui cli.Ui, client *api.Client, status *api.SealStatusRespo
 		out = append(out, fmt.Sprintf("Seal Migration in Progress | %t", status.Migration))
 	}
 
+	for _, seal := range status.Seals {
+		health := "healthy"
+		if !seal.Healthy {
+			health = fmt.Sprintf("unhealthy (%s)", seal.LastError)
+		}
+		out = append(out, fmt.Sprintf("Seal %s (%s, priority %d) | %s", seal.Name, seal.Type, seal.Priority, health))
+	}
+
 	out = append(out, fmt.Sprintf("Version | %s", status.Version))
 
 	if status.ClusterName != "" && status.ClusterID != "" {
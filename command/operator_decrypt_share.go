@@ -0,0 +1,145 @@
+package command
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/quid/vault/helper/pgpkeys"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorDecryptShareCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorDecryptShareCommand)(nil)
+
+type OperatorDecryptShareCommand struct {
+	*BaseCommand
+
+	flagIdentity string
+
+	testStdin io.Reader // for tests
+}
+
+func (c *OperatorDecryptShareCommand) Synopsis() string {
+	return "Decrypts a key share encrypted to an age recipient"
+}
+
+func (c *OperatorDecryptShareCommand) Help() string {
+	helpText := `
+Usage: vault operator decrypt-share [options] KEY
+
+  Decrypts an unseal key, a recovery key or a root token that was encrypted
+  to an age X25519 recipient given in -pgp-keys or -root-token-pgp-key of
+  "vault operator init", in -pgp-keys of "vault operator rekey" or in -pgp-key
+  of "vault operator generate-root". KEY is the base64-encoded key as output
+  by these commands. If KEY is "-", it is read from stdin. The key is
+  decrypted offline, no Vault server is contacted.
+
+  Decrypt an unseal key with the identity file written by age-keygen:
+
+      $ vault operator decrypt-share -identity=key.txt YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOS...
+
+  The shares can also be decrypted with the age tooling:
+
+      $ echo "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOS..." | base64 --decode | age --decrypt -i key.txt
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorDecryptShareCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetNone)
+
+	f := set.NewFlagSet("Common Options")
+
+	f.StringVar(&StringVar{
+		Name:       "identity",
+		Target:     &c.flagIdentity,
+		Completion: complete.PredictFiles("*"),
+		Usage: "Path to a file on disk containing the age X25519 identity, " +
+			"in the format \"AGE-SECRET-KEY-1...\", of the recipient the key " +
+			"was encrypted to. This is required.",
+	})
+
+	return set
+}
+
+func (c *OperatorDecryptShareCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictAnything
+}
+
+func (c *OperatorDecryptShareCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorDecryptShareCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	key := ""
+
+	args = f.Args()
+	switch len(args) {
+	case 1:
+		key = strings.TrimSpace(args[0])
+	default:
+		c.UI.Error(fmt.Sprintf("Incorrect arguments (expected 1, got %d)", len(args)))
+		return 1
+	}
+
+	if c.flagIdentity == "" {
+		c.UI.Error("Missing -identity")
+		return 1
+	}
+
+	if key == "-" {
+		// Pull our fake stdin if needed
+		stdin := (io.Reader)(os.Stdin)
+		if c.testStdin != nil {
+			stdin = c.testStdin
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, stdin); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to read stdin: %s", err))
+			return 1
+		}
+		key = strings.TrimSpace(buf.String())
+	}
+
+	identityFile, err := ioutil.ReadFile(c.flagIdentity)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading identity file: %s", err))
+		return 1
+	}
+	identity, err := pgpkeys.ReadAgeIdentity(string(identityFile))
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error parsing identity file: %s", err))
+		return 1
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error decoding key: %s", err))
+		return 1
+	}
+
+	plaintext, err := pgpkeys.AgeDecrypt(identity, ciphertext)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error decrypting key: %s", err))
+		return 2
+	}
+
+	c.UI.Output(string(plaintext))
+	return 0
+}
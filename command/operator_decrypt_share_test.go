@@ -0,0 +1,157 @@
+package command
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/quid/vault/helper/pgpkeys"
+	"github.com/mitchellh/cli"
+)
+
+func testOperatorDecryptShareCommand(tb testing.TB) (*cli.MockUi, *OperatorDecryptShareCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &OperatorDecryptShareCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+	}
+}
+
+// testAgeDecrypt decrypts the base64-encoded key with the identity file, using
+// the operator decrypt-share command
+func testAgeDecrypt(tb testing.TB, identityFile, enc string) string {
+	tb.Helper()
+
+	ui, cmd := testOperatorDecryptShareCommand(tb)
+	code := cmd.Run([]string{"-identity", identityFile, enc})
+	if exp := 0; code != exp {
+		tb.Fatalf("expected %d to be %d: %s", code, exp, ui.ErrorWriter.String())
+	}
+	return strings.TrimSpace(ui.OutputWriter.String())
+}
+
+func TestOperatorDecryptShareCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	identity, recipient, err := pgpkeys.GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(tempDir, "key.txt")
+	if err := ioutil.WriteFile(identityFile, []byte("# public key: "+recipient+"\n"+identity+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, _, err := pgpkeys.GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentityFile := filepath.Join(tempDir, "other.txt")
+	if err := ioutil.WriteFile(otherIdentityFile, []byte(otherIdentity+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := pgpkeys.AgeEncrypt(recipient, []byte("6ecb46277133e04b29bd0b1b05e60722"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := base64.StdEncoding.EncodeToString(ciphertext)
+
+	cases := []struct {
+		name string
+		args []string
+		out  string
+		code int
+	}{
+		{
+			"not_enough_args",
+			[]string{"-identity", identityFile},
+			"Incorrect arguments",
+			1,
+		},
+		{
+			"too_many_args",
+			[]string{"-identity", identityFile, "foo", "bar"},
+			"Incorrect arguments",
+			1,
+		},
+		{
+			"missing_identity",
+			[]string{share},
+			"Missing -identity",
+			1,
+		},
+		{
+			"bad_identity_file",
+			[]string{"-identity", filepath.Join(tempDir, "missing.txt"), share},
+			"Error reading identity file",
+			1,
+		},
+		{
+			"bad_key",
+			[]string{"-identity", identityFile, "not-base64!"},
+			"Error decoding key",
+			1,
+		},
+		{
+			"other_identity",
+			[]string{"-identity", otherIdentityFile, share},
+			"Error decrypting key",
+			2,
+		},
+		{
+			"decrypt",
+			[]string{"-identity", identityFile, share},
+			"6ecb46277133e04b29bd0b1b05e60722",
+			0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ui, cmd := testOperatorDecryptShareCommand(t)
+
+			code := cmd.Run(tc.args)
+			if code != tc.code {
+				t.Errorf("expected %d to be %d", code, tc.code)
+			}
+
+			combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+			if !strings.Contains(combined, tc.out) {
+				t.Errorf("expected %q to contain %q", combined, tc.out)
+			}
+		})
+	}
+
+	t.Run("stdin", func(t *testing.T) {
+		t.Parallel()
+
+		ui, cmd := testOperatorDecryptShareCommand(t)
+		cmd.testStdin = strings.NewReader(share + "\n")
+
+		code := cmd.Run([]string{"-identity", identityFile, "-"})
+		if exp := 0; code != exp {
+			t.Fatalf("expected %d to be %d: %s", code, exp, ui.ErrorWriter.String())
+		}
+
+		expected := "6ecb46277133e04b29bd0b1b05e60722"
+		if combined := ui.OutputWriter.String(); strings.TrimSpace(combined) != expected {
+			t.Errorf("expected %q to be %q", combined, expected)
+		}
+	})
+}
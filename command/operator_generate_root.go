@@ -179,7 +179,8 @@ func (c *OperatorGenerateRootCommand) Flags() *FlagSets {
 		Completion: complete.PredictAnything,
 		Usage: "Path to a file on disk containing a binary or base64-encoded " +
 			"public GPG key. This can also be specified as a Keybase username " +
-			"using the format \"keybase:<username>\". When supplied, the generated " +
+			"using the format \"keybase:<username>\" or as an age X25519 " +
+			"recipient using the format \"age1...\". When supplied, the generated " +
 			"root token will be encrypted and base64-encoded with the given public " +
 			"key.",
 	})
@@ -74,6 +74,14 @@ Usage: vault operator init [options]
           -key-threshold=2 \
           -pgp-keys="keybase:hashicorp,keybase:jefferai,keybase:sethvargo"
 
+  Initialize, but encrypt the unseal keys with age X25519 recipients, the keys
+  are decrypted with "vault operator decrypt-share":
+
+      $ vault operator init \
+          -key-shares=2 \
+          -key-threshold=2 \
+          -pgp-keys="age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p,alice.age"
+
   Encrypt the initial root token using a pgp key:
 
       $ vault operator init -root-token-pgp-key="keybase:hashicorp"
@@ -123,7 +131,8 @@ func (c *OperatorInitCommand) Flags() *FlagSets {
 		Completion: complete.PredictAnything,
 		Usage: "Comma-separated list of paths to files on disk containing " +
 			"public GPG keys OR a comma-separated list of Keybase usernames using " +
-			"the format \"keybase:<username>\". When supplied, the generated " +
+			"the format \"keybase:<username>\" OR age X25519 recipients using " +
+			"the format \"age1...\". When supplied, the generated " +
 			"unseal keys will be encrypted and base64-encoded in the order " +
 			"specified in this list. The number of entries must match -key-shares, " +
 			"unless -stored-shares are used.",
@@ -135,7 +144,8 @@ func (c *OperatorInitCommand) Flags() *FlagSets {
 		Completion: complete.PredictAnything,
 		Usage: "Path to a file on disk containing a binary or base64-encoded " +
 			"public GPG key. This can also be specified as a Keybase username " +
-			"using the format \"keybase:<username>\". When supplied, the generated " +
+			"using the format \"keybase:<username>\" or as an age X25519 " +
+			"recipient using the format \"age1...\". When supplied, the generated " +
 			"root token will be encrypted and base64-encoded with the given public " +
 			"key.",
 	})
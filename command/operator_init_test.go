@@ -4,7 +4,9 @@ package command
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -338,6 +340,83 @@ func TestOperatorInitCommand_Run(t *testing.T) {
 		}
 	})
 
+	t.Run("age", func(t *testing.T) {
+		t.Parallel()
+
+		tempDir, err := ioutil.TempDir("", "vault-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		identity, recipient, err := pgpkeys.GenerateAgeIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		identityFile := filepath.Join(tempDir, "key.txt")
+		if err := ioutil.WriteFile(identityFile, []byte(identity+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		otherIdentity, otherRecipient, err := pgpkeys.GenerateAgeIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherIdentityFile := filepath.Join(tempDir, "other.txt")
+		if err := ioutil.WriteFile(otherIdentityFile, []byte(otherIdentity+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		recipientFile := filepath.Join(tempDir, "recipient.age")
+		if err := ioutil.WriteFile(recipientFile, []byte("# public key\n"+otherRecipient+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		client, closer := testVaultServerUninit(t)
+		defer closer()
+
+		ui, cmd := testOperatorInitCommand(t)
+		cmd.client = client
+
+		code := cmd.Run([]string{
+			"-key-shares", "2",
+			"-key-threshold", "2",
+			"-pgp-keys", recipient + "," + recipientFile,
+			"-root-token-pgp-key", recipient,
+		})
+		if exp := 0; code != exp {
+			t.Fatalf("expected %d to be %d: %s", code, exp, ui.ErrorWriter.String())
+		}
+
+		re := regexp.MustCompile(`Unseal Key \d+: (.+)`)
+		output := ui.OutputWriter.String()
+		match := re.FindAllStringSubmatch(output, -1)
+		if len(match) < 2 || len(match[0]) < 2 {
+			t.Fatalf("no match: %#v", match)
+		}
+
+		// Unseal with the keys encrypted to each identity, in order
+		for i, file := range []string{identityFile, otherIdentityFile} {
+			decryptedKey := testAgeDecrypt(t, file, match[i][1])
+			status, err := client.Sys().Unseal(decryptedKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sealed := i == 0; status.Sealed != sealed {
+				t.Fatalf("expected sealed to be %t after %d keys", sealed, i+1)
+			}
+		}
+
+		reToken := regexp.MustCompile(`Root Token: (.+)`)
+		match = reToken.FindAllStringSubmatch(output, -1)
+		if len(match) < 1 || len(match[0]) < 2 {
+			t.Fatalf("no match")
+		}
+		decryptedRoot := testAgeDecrypt(t, identityFile, match[0][1])
+
+		if l, exp := len(decryptedRoot), vault.TokenLength+2; l != exp {
+			t.Errorf("expected %d to be %d", l, exp)
+		}
+	})
+
 	t.Run("communication_failure", func(t *testing.T) {
 		t.Parallel()
 
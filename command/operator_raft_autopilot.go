@@ -0,0 +1,40 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+var _ cli.Command = (*OperatorRaftAutopilotCommand)(nil)
+
+type OperatorRaftAutopilotCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorRaftAutopilotCommand) Synopsis() string {
+	return "Inspects the autopilot of the Raft cluster"
+}
+
+func (c *OperatorRaftAutopilotCommand) Help() string {
+	helpText := `
+Usage: vault operator raft autopilot <subcommand> [options] [args]
+
+  This command groups subcommands for operators interacting with the autopilot
+  of the integrated Raft storage backend. Autopilot promotes the nodes that
+  were staged as non-voters once they are stable and removes the dead nodes.
+  Here is an example of the Raft autopilot operator commands:
+
+  Returns the health of the Raft cluster as seen by autopilot:
+
+      $ vault operator raft autopilot state
+
+  Please see the individual subcommand help for detailed usage information.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorRaftAutopilotCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
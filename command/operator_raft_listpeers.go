@@ -77,7 +77,7 @@ func (c *OperatorRaftListPeersCommand) Run(args []string) int {
 	config := secret.Data["config"].(map[string]interface{})
 
 	servers := config["servers"].([]interface{})
-	out := []string{"Node | Address | State | Voter"}
+	out := []string{"Node | Address | State | Voter | Suffrage"}
 	for _, serverRaw := range servers {
 		server := serverRaw.(map[string]interface{})
 		state := "follower"
@@ -85,7 +85,16 @@ func (c *OperatorRaftListPeersCommand) Run(args []string) int {
 			state = "leader"
 		}
 
-		out = append(out, fmt.Sprintf("%s | %s | %s | %t", server["node_id"].(string), server["address"].(string), state, server["voter"].(bool)))
+		// Older servers don't report the suffrage
+		suffrage, ok := server["suffrage"].(string)
+		if !ok {
+			suffrage = "non-voter"
+			if server["voter"].(bool) {
+				suffrage = "voter"
+			}
+		}
+
+		out = append(out, fmt.Sprintf("%s | %s | %s | %t | %s", server["node_id"].(string), server["address"].(string), state, server["voter"].(bool), suffrage))
 	}
 
 	c.UI.Output(tableOutput(out, nil))
@@ -32,6 +32,14 @@ Usage: vault operator raft snapshot <subcommand> [options] [args]
 
       $ vault operator raft snapshot save raft.snap
 
+  Shows the index, term and the keys by prefix of a snapshot file:
+
+      $ vault operator raft snapshot inspect raft.snap
+
+  Restores the data of a single mount of a snapshot file into the cluster:
+
+      $ vault operator raft snapshot extract -restore-to=secret/ raft.snap secret/
+
   Please see the individual subcommand help for detailed usage information.
 `
 
@@ -0,0 +1,381 @@
+package command
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/quid/vault/command/server"
+	"github.com/quid/vault/internalshared/configutil"
+	"github.com/quid/vault/sdk/helper/password"
+	"github.com/quid/vault/sdk/logical"
+	"github.com/quid/vault/vault"
+	vaultseal "github.com/quid/vault/vault/seal"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorRaftSnapshotExtractCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorRaftSnapshotExtractCommand)(nil)
+
+type OperatorRaftSnapshotExtractCommand struct {
+	*BaseCommand
+
+	flagUnsealKeys []string
+	flagConfig     string
+	flagOutput     string
+	flagRestoreTo  string
+
+	testOutput io.Writer // for tests
+}
+
+// snapshotMountExport is the file written by the extract command
+type snapshotMountExport struct {
+	Path    string            `json:"path"`
+	Type    string            `json:"type"`
+	UUID    string            `json:"uuid"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) Synopsis() string {
+	return "Extracts or restores the data of a single mount from a snapshot file"
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) Help() string {
+	helpText := `
+Usage: vault operator raft snapshot extract [options] <snapshot_file> <mount>
+
+  Decrypts the data of a single mount from a snapshot file, given the unseal
+  keys or the seal of the cluster the snapshot was taken from. The mount is
+  given by its path, prefixed with "auth/" for auth methods, or by its UUID.
+
+  The data is either written to a file, with the values base64 encoded, or
+  restored into a mount of a running cluster through the sys/raw endpoint,
+  which must be enabled with "raw_storage_endpoint". The restored keys
+  overwrite the existing ones, keys missing from the snapshot are left
+  untouched.
+
+  Snapshots of clusters using the Shamir seal are decrypted with the unseal
+  keys, which are prompted for, unless given with -unseal-key. With an
+  auto-unseal, the master key is encrypted by the seal and the recovery keys
+  can't decrypt it: the seal is instead read from the server configuration
+  given with -config, and must be reachable with its credentials. The snapshot
+  is loaded in memory.
+
+  Extract the data of the "secret/" mount to a file:
+
+      $ vault operator raft snapshot extract -output=secret.json raft.snap secret/
+
+  Restore the data of the "secret/" mount into the "secret-restored/" mount of
+  the cluster:
+
+      $ vault operator raft snapshot extract -restore-to=secret-restored/ raft.snap secret/
+
+  Extract the data of the "secret/" mount from the snapshot of a cluster using
+  an auto-unseal:
+
+      $ vault operator raft snapshot extract -config=/etc/vault.hcl -output=secret.json raft.snap secret/
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.StringSliceVar(&StringSliceVar{
+		Name:   "unseal-key",
+		Target: &c.flagUnsealKeys,
+		Usage: "Unseal key of the cluster the snapshot was taken from. This can " +
+			"be specified multiple times, and is not recommended as the keys " +
+			"will be available in your history.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "config",
+		Target:     &c.flagConfig,
+		Completion: complete.PredictOr(complete.PredictFiles("*.hcl"), complete.PredictFiles("*.json")),
+		Usage: "Path to the configuration file of a server of the cluster the " +
+			"snapshot was taken from. Its seal is used to decrypt snapshots of " +
+			"clusters using an auto-unseal.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "output",
+		Target:     &c.flagOutput,
+		Completion: complete.PredictFiles("*"),
+		Usage:      "Path of the file to write the data of the mount to.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "restore-to",
+		Target:     &c.flagRestoreTo,
+		Completion: complete.PredictAnything,
+		Usage: "Path of the mount of the running cluster to restore the data " +
+			"into. The mount must be of the same type as the extracted one.",
+	})
+
+	return set
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictFiles("*")
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorRaftSnapshotExtractCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) != 2 {
+		c.UI.Error(fmt.Sprintf("Incorrect arguments (expected 2, got %d)", len(args)))
+		return 1
+	}
+	snapFile, mountPath := strings.TrimSpace(args[0]), strings.TrimSpace(args[1])
+
+	switch {
+	case c.flagOutput == "" && c.flagRestoreTo == "":
+		c.UI.Error("One of -output or -restore-to is required")
+		return 1
+	case c.flagOutput != "" && c.flagRestoreTo != "":
+		c.UI.Error("Only one of -output or -restore-to can be specified")
+		return 1
+	}
+
+	snapReader, err := os.Open(snapFile)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error opening snapshot file: %s", err))
+		return 2
+	}
+	defer snapReader.Close()
+
+	ctx := context.Background()
+	snap, err := vault.LoadRaftSnapshot(ctx, log.NewNullLogger(), snapReader)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error loading the snapshot: %s", err))
+		return 2
+	}
+
+	sealConfig, err := snap.SealConfig(ctx)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading the seal configuration of the snapshot: %s", err))
+		return 2
+	}
+
+	if sealConfig.Type != wrapping.Shamir {
+		if c.flagConfig == "" {
+			c.UI.Error(fmt.Sprintf("The snapshot was taken from a cluster using the %q seal, -config is required", sealConfig.Type))
+			return 1
+		}
+		if err := c.unsealWithSeal(ctx, snap); err != nil {
+			c.UI.Error(fmt.Sprintf("Error unsealing the snapshot: %s", err))
+			return 2
+		}
+	} else if code := c.unseal(ctx, snap, sealConfig); code != 0 {
+		return code
+	}
+
+	mount, err := snap.Mount(ctx, mountPath)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error finding the mount: %s", err))
+		return 2
+	}
+
+	if c.flagOutput != "" {
+		return c.extract(ctx, snap, mount)
+	}
+	return c.restore(ctx, snap, mount)
+}
+
+// unseal unseals a snapshot with the unseal keys, prompting for the missing
+// ones
+func (c *OperatorRaftSnapshotExtractCommand) unseal(ctx context.Context, snap *vault.RaftSnapshotData, sealConfig *vault.SealConfig) int {
+	unsealKeys := c.flagUnsealKeys
+	for len(unsealKeys) < sealConfig.SecretThreshold {
+		// Override the output
+		writer := (io.Writer)(os.Stdout)
+		if c.testOutput != nil {
+			writer = c.testOutput
+		}
+
+		fmt.Fprintf(writer, "Unseal Key %d of %d (will be hidden): ", len(unsealKeys)+1, sealConfig.SecretThreshold)
+		value, err := password.Read(os.Stdin)
+		fmt.Fprintf(writer, "\n")
+		if err != nil {
+			c.UI.Error(wrapAtLength(fmt.Sprintf("An error occurred attempting to "+
+				"ask for an unseal key. You should run this command from a "+
+				"terminal (tty). If this is not an option, the unseal keys can "+
+				"be provided with -unseal-key. The raw error was:\n\n%s", err)))
+			return 1
+		}
+		unsealKeys = append(unsealKeys, strings.TrimSpace(value))
+	}
+
+	if err := snap.Unseal(ctx, unsealKeys); err != nil {
+		c.UI.Error(fmt.Sprintf("Error unsealing the snapshot: %s", err))
+		return 2
+	}
+	return 0
+}
+
+// unsealWithSeal unseals a snapshot with the enabled seals of the server
+// configuration, combined as the server does when there are several
+func (c *OperatorRaftSnapshotExtractCommand) unsealWithSeal(ctx context.Context, snap *vault.RaftSnapshotData) error {
+	config, err := server.LoadConfig(c.flagConfig)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("error loading configuration from %s: {{err}}", c.flagConfig), err)
+	}
+
+	var seals []*vaultseal.MultiWrapperSeal
+	for _, configSeal := range config.Seals {
+		if configSeal.Disabled {
+			continue
+		}
+
+		wrapper, err := configutil.ConfigureWrapper(configSeal, nil, nil, log.NewNullLogger())
+		if err != nil {
+			return errwrap.Wrapf("error configuring the seal: {{err}}", err)
+		}
+		if wrapper == nil {
+			return fmt.Errorf("the seal of %s is a Shamir seal", c.flagConfig)
+		}
+		if err := wrapper.Init(ctx); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error initializing the %q seal: {{err}}", configSeal.Type), err)
+		}
+		defer wrapper.Finalize(ctx)
+
+		name := configSeal.Name
+		if name == "" {
+			name = configSeal.Type
+		}
+		seals = append(seals, &vaultseal.MultiWrapperSeal{
+			Name:     name,
+			Priority: configSeal.Priority,
+			Wrapper:  wrapper,
+		})
+	}
+
+	switch len(seals) {
+	case 0:
+		return fmt.Errorf("no enabled seal found in %s", c.flagConfig)
+	case 1:
+		return snap.UnsealWithSeal(ctx, seals[0].Wrapper)
+	}
+
+	wrapper, err := vaultseal.NewMultiWrapper(seals)
+	if err != nil {
+		return errwrap.Wrapf("error combining the seals: {{err}}", err)
+	}
+	return snap.UnsealWithSeal(ctx, wrapper)
+}
+
+// extract writes the data of the mount to the output file
+func (c *OperatorRaftSnapshotExtractCommand) extract(ctx context.Context, snap *vault.RaftSnapshotData, mount *vault.SnapshotMount) int {
+	export := &snapshotMountExport{
+		Path:    mount.Path,
+		Type:    mount.Type,
+		UUID:    mount.UUID,
+		Entries: make(map[string][]byte),
+	}
+	err := snap.ReadMount(ctx, mount, func(entry *logical.StorageEntry) error {
+		export.Entries[entry.Key] = entry.Value
+		return nil
+	})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading the data of the mount: %s", err))
+		return 2
+	}
+
+	encoded, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error encoding the data of the mount: %s", err))
+		return 2
+	}
+	if err := ioutil.WriteFile(c.flagOutput, encoded, 0600); err != nil {
+		c.UI.Error(fmt.Sprintf("Error writing the data of the mount: %s", err))
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Extracted %d keys of %q to %s", len(export.Entries), mount.Path, c.flagOutput))
+	return 0
+}
+
+// restore writes the data of the mount into the target mount of the cluster
+func (c *OperatorRaftSnapshotExtractCommand) restore(ctx context.Context, snap *vault.RaftSnapshotData, mount *vault.SnapshotMount) int {
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	// Find the storage prefix of the target mount
+	target := strings.TrimSuffix(c.flagRestoreTo, "/") + "/"
+	var targetType, targetPrefix string
+	if strings.HasPrefix(target, "auth/") {
+		auths, err := client.Sys().ListAuth()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing the auth methods: %s", err))
+			return 2
+		}
+		if auth, ok := auths[strings.TrimPrefix(target, "auth/")]; ok {
+			targetType, targetPrefix = auth.Type, "auth/"+auth.UUID+"/"
+		}
+	} else {
+		mounts, err := client.Sys().ListMounts()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing the secrets engines: %s", err))
+			return 2
+		}
+		if m, ok := mounts[target]; ok {
+			targetType, targetPrefix = m.Type, "logical/"+m.UUID+"/"
+		}
+	}
+
+	switch {
+	case targetPrefix == "":
+		c.UI.Error(fmt.Sprintf("No mount found at %q", target))
+		return 2
+	case targetType != mount.Type:
+		c.UI.Error(fmt.Sprintf("Mount %q is of type %q, the extracted mount is of type %q", target, targetType, mount.Type))
+		return 2
+	}
+
+	keys := 0
+	err = snap.ReadMount(ctx, mount, func(entry *logical.StorageEntry) error {
+		_, err := client.Logical().Write("sys/raw/"+targetPrefix+entry.Key, map[string]interface{}{
+			"value":    base64.StdEncoding.EncodeToString(entry.Value),
+			"encoding": "base64",
+		})
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to write %q: {{err}}", entry.Key), err)
+		}
+		keys++
+		return nil
+	})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error restoring the data of the mount after %d keys: %s", keys, err))
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Restored %d keys of %q into %q", keys, mount.Path, target))
+	return 0
+}
@@ -0,0 +1,26 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestSnapshotKeyPrefix(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"core/mounts":   "core/",
+		"core/raft/tls": "core/",
+		"logical/6d2ad5c6-3cd2-0fd5-1ca3-7e4b2e6dcd4b/foo":   "logical/6d2ad5c6-3cd2-0fd5-1ca3-7e4b2e6dcd4b/",
+		"auth/18ac7b3e-5a07-8c5e-cc31-5d3c1a4f3e92/role/web": "auth/18ac7b3e-5a07-8c5e-cc31-5d3c1a4f3e92/",
+		"sys/expire/id/auth/token/create/abcd":               "sys/expire/",
+		"sys/token/id/h1234":                                 "sys/token/",
+		"sys/counters":                                       "sys/",
+		"index-dirty":                                        "index-dirty",
+	}
+
+	for key, expected := range cases {
+		if prefix := snapshotKeyPrefix(key); prefix != expected {
+			t.Errorf("bad prefix of %q: expected %q, got %q", key, expected, prefix)
+		}
+	}
+}
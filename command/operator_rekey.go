@@ -176,7 +176,8 @@ func (c *OperatorRekeyCommand) Flags() *FlagSets {
 		Completion: complete.PredictAnything,
 		Usage: "Comma-separated list of paths to files on disk containing " +
 			"public GPG keys OR a comma-separated list of Keybase usernames using " +
-			"the format \"keybase:<username>\". When supplied, the generated " +
+			"the format \"keybase:<username>\" OR age X25519 recipients using " +
+			"the format \"age1...\". When supplied, the generated " +
 			"unseal keys will be encrypted and base64-encoded in the order " +
 			"specified in this list.",
 	})
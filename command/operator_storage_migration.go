@@ -0,0 +1,54 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+var _ cli.Command = (*OperatorStorageMigrationCommand)(nil)
+
+type OperatorStorageMigrationCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorStorageMigrationCommand) Synopsis() string {
+	return "Migrates the storage to another backend without downtime"
+}
+
+func (c *OperatorStorageMigrationCommand) Help() string {
+	helpText := `
+Usage: vault operator storage-migration <subcommand> [options] [args]
+
+  This command groups subcommands for operators migrating the storage of a
+  running cluster to the backend configured in the "storage_migration" stanza
+  of the active node. The writes of the active node are duplicated to the
+  destination while the existing keys are copied in the background, then the
+  cut over moves the reads to the destination. Here are a few examples of the
+  storage migration operator commands:
+
+  Starts copying the keys to the destination:
+
+      $ vault operator storage-migration start
+
+  Shows the progress of the copy:
+
+      $ vault operator storage-migration status
+
+  Moves the reads to the destination once the keys are copied:
+
+      $ vault operator storage-migration cutover
+
+  Stops the migration, going back to the source storage:
+
+      $ vault operator storage-migration abort
+
+  Please see the individual subcommand help for detailed usage information.
+`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorStorageMigrationCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorStorageMigrationAbortCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorStorageMigrationAbortCommand)(nil)
+
+type OperatorStorageMigrationAbortCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorStorageMigrationAbortCommand) Synopsis() string {
+	return "Aborts the storage migration"
+}
+
+func (c *OperatorStorageMigrationAbortCommand) Help() string {
+	helpText := `
+Usage: vault operator storage-migration abort
+
+  Stops the online storage migration: the writes aren't duplicated to the
+  destination anymore and, after a cut over, the reads go back to the source
+  storage, which was kept in sync.
+
+      $ vault operator storage-migration abort
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorStorageMigrationAbortCommand) Flags() *FlagSets {
+	return c.flagSet(FlagSetHTTP)
+}
+
+func (c *OperatorStorageMigrationAbortCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *OperatorStorageMigrationAbortCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorStorageMigrationAbortCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) > 0 {
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 0, got %d)", len(args)))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	if _, err := client.Logical().Delete("sys/storage/migration"); err != nil {
+		c.UI.Error(fmt.Sprintf("Error aborting the storage migration: %s", err))
+		return 2
+	}
+
+	c.UI.Output("Success! Aborted the storage migration")
+	return 0
+}
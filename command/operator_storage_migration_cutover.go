@@ -0,0 +1,78 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorStorageMigrationCutoverCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorStorageMigrationCutoverCommand)(nil)
+
+type OperatorStorageMigrationCutoverCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) Synopsis() string {
+	return "Moves the reads to the destination of the storage migration"
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) Help() string {
+	helpText := `
+Usage: vault operator storage-migration cutover
+
+  Moves the reads of the active node to the destination once all the keys are
+  copied. The source storage is still written to, so that the migration can be
+  aborted. To complete the migration, restart the nodes with the destination as
+  their "storage" and without the "storage_migration" stanza, starting with the
+  active node.
+
+      $ vault operator storage-migration cutover
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) Flags() *FlagSets {
+	return c.flagSet(FlagSetHTTP)
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorStorageMigrationCutoverCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) > 0 {
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 0, got %d)", len(args)))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	if _, err := client.Logical().Write("sys/storage/migration/cutover", nil); err != nil {
+		c.UI.Error(fmt.Sprintf("Error cutting over the storage migration: %s", err))
+		return 2
+	}
+
+	c.UI.Output(wrapAtLength("Success! The destination is now the storage of the active node. Restart the nodes with it as their \"storage\" to complete the migration"))
+	return 0
+}
@@ -0,0 +1,79 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorStorageMigrationStartCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorStorageMigrationStartCommand)(nil)
+
+type OperatorStorageMigrationStartCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorStorageMigrationStartCommand) Synopsis() string {
+	return "Starts copying the storage to the migration destination"
+}
+
+func (c *OperatorStorageMigrationStartCommand) Help() string {
+	helpText := `
+Usage: vault operator storage-migration start
+
+  Starts the online migration of the storage to the backend configured in the
+  "storage_migration" stanza of the active node. The writes of the active node
+  are duplicated to the destination and the existing keys are copied in the
+  background, resuming from a checkpoint if the node is restarted. The
+  migration fails if another node becomes active before the cut over; a failed
+  migration can be started again.
+
+      $ vault operator storage-migration start
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorStorageMigrationStartCommand) Flags() *FlagSets {
+	return c.flagSet(FlagSetHTTP)
+}
+
+func (c *OperatorStorageMigrationStartCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *OperatorStorageMigrationStartCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorStorageMigrationStartCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) > 0 {
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 0, got %d)", len(args)))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	if _, err := client.Logical().Write("sys/storage/migration", nil); err != nil {
+		c.UI.Error(fmt.Sprintf("Error starting the storage migration: %s", err))
+		return 2
+	}
+
+	c.UI.Output(wrapAtLength("Success! Started the storage migration, check its progress with \"vault operator storage-migration status\""))
+	return 0
+}
@@ -0,0 +1,113 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*OperatorStorageMigrationStatusCommand)(nil)
+var _ cli.CommandAutocomplete = (*OperatorStorageMigrationStatusCommand)(nil)
+
+type OperatorStorageMigrationStatusCommand struct {
+	*BaseCommand
+}
+
+func (c *OperatorStorageMigrationStatusCommand) Synopsis() string {
+	return "Returns the progress of the storage migration"
+}
+
+func (c *OperatorStorageMigrationStatusCommand) Help() string {
+	helpText := `
+Usage: vault operator storage-migration status
+
+  Shows the state of the online storage migration, the number of keys copied
+  and the last key checkpointed. The pending keys are the keys whose last write
+  to the destination failed, they are copied again before the cut over.
+
+      $ vault operator storage-migration status
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *OperatorStorageMigrationStatusCommand) Flags() *FlagSets {
+	return c.flagSet(FlagSetHTTP | FlagSetOutputFormat)
+}
+
+func (c *OperatorStorageMigrationStatusCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *OperatorStorageMigrationStatusCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *OperatorStorageMigrationStatusCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) > 0 {
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 0, got %d)", len(args)))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	secret, err := client.Logical().Read("sys/storage/migration")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading the storage migration status: %s", err))
+		return 2
+	}
+	if secret == nil {
+		c.UI.Error("No storage migration status found")
+		return 2
+	}
+
+	if Format(c.UI) != "table" {
+		return OutputSecret(c.UI, secret)
+	}
+
+	state := secret.Data["state"]
+	if state == "" {
+		state = "not started"
+	}
+
+	out := []string{
+		fmt.Sprintf("Configured | %v", secret.Data["configured"]),
+		fmt.Sprintf("Destination Type | %v", secret.Data["destination_type"]),
+		fmt.Sprintf("State | %v", state),
+	}
+	for _, field := range []struct {
+		name string
+		key  string
+	}{
+		{"Node", "node"},
+		{"Start Time", "start_time"},
+		{"Keys Copied", "keys_copied"},
+		{"Checkpoint", "checkpoint"},
+		{"Pending Keys", "pending_keys"},
+		{"Copied Time", "copied_time"},
+		{"Cut Over Time", "cut_over_time"},
+		{"Last Error", "last_error"},
+	} {
+		if value, ok := secret.Data[field.key]; ok {
+			out = append(out, fmt.Sprintf("%s | %v", field.name, value))
+		}
+	}
+
+	c.UI.Output(tableOutput(out, nil))
+	return 0
+}
@@ -32,6 +32,14 @@ Usage: vault policy <subcommand> [options] [args]
 
       $ vault policy write my-policy ./my-policy.hcl
 
+  Restore the policy named "my-policy" to version 2 of its history:
+
+      $ vault policy rollback -version=2 my-policy
+
+  Explain whether the "dev" policy allows reading "secret/foo":
+
+      $ vault policy simulate -policies=dev secret/foo
+
   Delete the policy named my-policy:
 
       $ vault policy delete my-policy
@@ -154,6 +154,52 @@ path "secret" {
 		}
 	})
 
+	t.Run("bad_conditions", func(t *testing.T) {
+		t.Parallel()
+
+		policy := strings.TrimSpace(`
+path "secret/prod/*" {
+  capabilities = ["update"]
+  conditions {
+    time_window {
+      timezone = "Mars/Olympus_Mons"
+      start    = "09:00"
+      end      = "17:00"
+    }
+  }
+}
+`)
+
+		f, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.Write([]byte(policy)); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		client, closer := testVaultServer(t)
+		defer closer()
+
+		ui, cmd := testPolicyFmtCommand(t)
+		cmd.client = client
+
+		code := cmd.Run([]string{
+			f.Name(),
+		})
+		if exp := 1; code != exp {
+			t.Errorf("expected %d to be %d", code, exp)
+		}
+
+		stderr := ui.ErrorWriter.String()
+		expected := `invalid timezone "Mars/Olympus_Mons"`
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("expected %q to include %q", stderr, expected)
+		}
+	})
+
 	t.Run("bad_policy", func(t *testing.T) {
 		t.Parallel()
 
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*PolicyHistoryCommand)(nil)
+var _ cli.CommandAutocomplete = (*PolicyHistoryCommand)(nil)
+
+type PolicyHistoryCommand struct {
+	*BaseCommand
+
+	flagVersion int
+}
+
+func (c *PolicyHistoryCommand) Synopsis() string {
+	return "Lists the versions of a policy"
+}
+
+func (c *PolicyHistoryCommand) Help() string {
+	helpText := `
+Usage: vault policy history [options] NAME
+
+  Lists the most recent versions of the ACL policy named NAME, along with when
+  each version was written and the accessor and entity of the token that wrote
+  it. The history is kept after a policy is deleted.
+
+  List the versions of the policy named "my-policy":
+
+      $ vault policy history my-policy
+
+  Print the contents of version 3 of the policy named "my-policy":
+
+      $ vault policy history -version=3 my-policy
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *PolicyHistoryCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP | FlagSetOutputFormat)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.IntVar(&IntVar{
+		Name:   "version",
+		Target: &c.flagVersion,
+		Usage:  "Print the contents of the given version instead of listing versions.",
+	})
+
+	return set
+}
+
+func (c *PolicyHistoryCommand) AutocompleteArgs() complete.Predictor {
+	return c.PredictVaultPolicies()
+}
+
+func (c *PolicyHistoryCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *PolicyHistoryCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	switch {
+	case len(args) < 1:
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected 1, got %d)", len(args)))
+		return 1
+	case len(args) > 1:
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 1, got %d)", len(args)))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	name := strings.ToLower(strings.TrimSpace(args[0]))
+	history, err := client.Sys().PolicyVersions(name)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading history of policy %s: %s", name, err))
+		return 2
+	}
+	if history == nil || len(history.Versions) == 0 {
+		c.UI.Error(fmt.Sprintf("No history for policy: %s", name))
+		return 2
+	}
+
+	if c.flagVersion > 0 {
+		for _, v := range history.Versions {
+			if v.Version != c.flagVersion {
+				continue
+			}
+			switch Format(c.UI) {
+			case "table":
+				c.UI.Output(strings.TrimSpace(v.Policy))
+				return 0
+			default:
+				return OutputData(c.UI, v)
+			}
+		}
+		c.UI.Error(fmt.Sprintf("Version %d of policy %s is not in its history", c.flagVersion, name))
+		return 2
+	}
+
+	if Format(c.UI) != "table" {
+		return OutputData(c.UI, history)
+	}
+
+	out := []string{"Version | Created Time | Accessor | Entity ID | Current"}
+	for _, v := range history.Versions {
+		out = append(out, fmt.Sprintf("%d | %s | %s | %s | %t",
+			v.Version,
+			v.CreatedTime,
+			v.Accessor,
+			v.EntityID,
+			v.Version == history.CurrentVersion))
+	}
+
+	c.UI.Output(tableOutput(out, nil))
+	return 0
+}
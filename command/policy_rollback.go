@@ -0,0 +1,102 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*PolicyRollbackCommand)(nil)
+var _ cli.CommandAutocomplete = (*PolicyRollbackCommand)(nil)
+
+type PolicyRollbackCommand struct {
+	*BaseCommand
+
+	flagVersion int
+}
+
+func (c *PolicyRollbackCommand) Synopsis() string {
+	return "Restores a policy to an earlier version"
+}
+
+func (c *PolicyRollbackCommand) Help() string {
+	helpText := `
+Usage: vault policy rollback [options] NAME
+
+  Restores the ACL policy named NAME to the contents of an earlier version. The
+  rollback is recorded as a new version of the policy. Rolling back a deleted
+  policy recreates it. Use "vault policy history" to list the versions that
+  can be restored.
+
+  Restore the policy named "my-policy" to version 2:
+
+      $ vault policy rollback -version=2 my-policy
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *PolicyRollbackCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.IntVar(&IntVar{
+		Name:   "version",
+		Target: &c.flagVersion,
+		Usage:  "The version of the policy to restore. This is required.",
+	})
+
+	return set
+}
+
+func (c *PolicyRollbackCommand) AutocompleteArgs() complete.Predictor {
+	return c.PredictVaultPolicies()
+}
+
+func (c *PolicyRollbackCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *PolicyRollbackCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	switch {
+	case len(args) < 1:
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected 1, got %d)", len(args)))
+		return 1
+	case len(args) > 1:
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 1, got %d)", len(args)))
+		return 1
+	}
+
+	if c.flagVersion <= 0 {
+		c.UI.Error("A positive -version must be provided")
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	name := strings.ToLower(strings.TrimSpace(args[0]))
+	version, err := client.Sys().RollbackPolicy(name, c.flagVersion)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error rolling back policy %s: %s", name, err))
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Rolled back policy %s to version %d (now version %d)", name, c.flagVersion, version))
+	return 0
+}
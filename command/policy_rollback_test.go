@@ -0,0 +1,152 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func testPolicyRollbackCommand(tb testing.TB) (*cli.MockUi, *PolicyRollbackCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &PolicyRollbackCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+	}
+}
+
+func TestPolicyRollbackCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		args []string
+		out  string
+		code int
+	}{
+		{
+			"not_enough_args",
+			[]string{"-version", "1"},
+			"Not enough arguments",
+			1,
+		},
+		{
+			"too_many_args",
+			[]string{"-version", "1", "foo", "bar"},
+			"Too many arguments",
+			1,
+		},
+		{
+			"missing_version",
+			[]string{"foo"},
+			"A positive -version must be provided",
+			1,
+		},
+		{
+			"unknown_version",
+			[]string{"-version", "7", "default"},
+			"Error rolling back policy default: ",
+			2,
+		},
+	}
+
+	t.Run("validations", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tc := range cases {
+			tc := tc
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				client, closer := testVaultServer(t)
+				defer closer()
+
+				ui, cmd := testPolicyRollbackCommand(t)
+				cmd.client = client
+
+				code := cmd.Run(tc.args)
+				if code != tc.code {
+					t.Errorf("expected %d to be %d", code, tc.code)
+				}
+
+				combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+				if !strings.Contains(combined, tc.out) {
+					t.Errorf("expected %q to contain %q", combined, tc.out)
+				}
+			})
+		}
+	})
+
+	t.Run("integration", func(t *testing.T) {
+		t.Parallel()
+
+		client, closer := testVaultServer(t)
+		defer closer()
+
+		for _, policy := range []string{`path "secret/a" {}`, `path "secret/b" {}`} {
+			if err := client.Sys().PutPolicy("my-policy", policy); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ui, cmd := testPolicyRollbackCommand(t)
+		cmd.client = client
+
+		code := cmd.Run([]string{
+			"-version", "1",
+			"my-policy",
+		})
+		if exp := 0; code != exp {
+			t.Errorf("expected %d to be %d", code, exp)
+		}
+
+		expected := "Success! Rolled back policy my-policy to version 1 (now version 3)"
+		combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+		if !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+
+		policy, err := client.Sys().GetPolicy("my-policy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy != `path "secret/a" {}` {
+			t.Errorf("expected policy to be restored, got %q", policy)
+		}
+	})
+
+	t.Run("communication_failure", func(t *testing.T) {
+		t.Parallel()
+
+		client, closer := testVaultServerBad(t)
+		defer closer()
+
+		ui, cmd := testPolicyRollbackCommand(t)
+		cmd.client = client
+
+		code := cmd.Run([]string{
+			"-version", "1",
+			"my-policy",
+		})
+		if exp := 2; code != exp {
+			t.Errorf("expected %d to be %d", code, exp)
+		}
+
+		expected := "Error rolling back policy my-policy: "
+		combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+		if !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+	})
+
+	t.Run("no_tabs", func(t *testing.T) {
+		t.Parallel()
+
+		_, cmd := testPolicyRollbackCommand(t)
+		assertNoTabs(t, cmd)
+	})
+}
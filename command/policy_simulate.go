@@ -0,0 +1,227 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quid/vault/api"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*PolicySimulateCommand)(nil)
+var _ cli.CommandAutocomplete = (*PolicySimulateCommand)(nil)
+
+type PolicySimulateCommand struct {
+	*BaseCommand
+
+	flagPolicies       []string
+	flagAccessor       string
+	flagEntityID       string
+	flagOperation      string
+	flagRequestWrapTTL time.Duration
+	flagRemoteAddr     string
+	flagHeaders        map[string]string
+
+	testStdin io.Reader // for tests
+}
+
+func (c *PolicySimulateCommand) Synopsis() string {
+	return "Explains how policies decide a request"
+}
+
+func (c *PolicySimulateCommand) Help() string {
+	helpText := `
+Usage: vault policy simulate [options] PATH [DATA K=V...]
+
+  Evaluates a hypothetical request against a set of ACL policies and explains
+  the decision: which policy rule matched the path and how, which capabilities
+  each policy granted on it, and which check rejected the request if it was
+  denied. No request is actually made against PATH.
+
+  The policies are given by name with -policies, or are taken from the token
+  identified by -accessor or the entity identified by -entity-id. Request data
+  is given as key=value pairs, as with "vault write".
+
+  Check whether the "dev" and "ops" policies allow a write to "secret/foo":
+
+      $ vault policy simulate -policies=dev,ops -operation=update secret/foo ttl=1h
+
+  Check whether a write to "secret/prod/app" is allowed from a given address
+  with a given request header:
+
+      $ vault policy simulate -policies=deploy -operation=update \
+          -remote-addr=10.20.1.5 -header=X-Deploy-Id=42 secret/prod/app
+
+  Check why a token cannot list "secret/metadata/":
+
+      $ vault policy simulate -accessor=7c2e3b4d -operation=list secret/metadata/
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *PolicySimulateCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP | FlagSetOutputFormat)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.StringSliceVar(&StringSliceVar{
+		Name:       "policies",
+		Target:     &c.flagPolicies,
+		Completion: c.PredictVaultPolicies(),
+		Usage: "Names of the policies to evaluate. This can be specified " +
+			"multiple times or as a comma-separated list.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "accessor",
+		Target:     &c.flagAccessor,
+		Completion: complete.PredictAnything,
+		Usage:      "Accessor of a token whose policies should be evaluated.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "entity-id",
+		Target:     &c.flagEntityID,
+		Completion: complete.PredictAnything,
+		Usage:      "ID of an entity whose policies should be evaluated.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "operation",
+		Target:     &c.flagOperation,
+		Default:    "read",
+		Completion: complete.PredictSet("create", "read", "update", "delete", "list"),
+		Usage:      "Operation to simulate.",
+	})
+
+	f.DurationVar(&DurationVar{
+		Name:       "request-wrap-ttl",
+		Target:     &c.flagRequestWrapTTL,
+		Completion: complete.PredictAnything,
+		Usage: "Response-wrapping TTL to evaluate against the min_wrapping_ttl " +
+			"and max_wrapping_ttl constraints. Unlike -wrap-ttl, this does not " +
+			"wrap the response of this command.",
+	})
+
+	f.StringVar(&StringVar{
+		Name:       "remote-addr",
+		Target:     &c.flagRemoteAddr,
+		Completion: complete.PredictAnything,
+		Usage: "Client address to evaluate against the source_cidrs " +
+			"conditions of the policies.",
+	})
+
+	f.StringMapVar(&StringMapVar{
+		Name:       "header",
+		Target:     &c.flagHeaders,
+		Completion: complete.PredictAnything,
+		Usage: "Request header, in the form key=value, to evaluate against the " +
+			"required_headers conditions of the policies. This can be " +
+			"specified multiple times.",
+	})
+
+	return set
+}
+
+func (c *PolicySimulateCommand) AutocompleteArgs() complete.Predictor {
+	return c.PredictVaultFiles()
+}
+
+func (c *PolicySimulateCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *PolicySimulateCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) < 1 {
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected at least 1, got %d)", len(args)))
+		return 1
+	}
+
+	// Pull our fake stdin if needed
+	stdin := (io.Reader)(os.Stdin)
+	if c.testStdin != nil {
+		stdin = c.testStdin
+	}
+
+	data, err := parseArgsData(stdin, args[1:])
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse K=V data: %s", err))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	input := &api.PolicySimulateInput{
+		Policies:   c.flagPolicies,
+		Accessor:   c.flagAccessor,
+		EntityID:   c.flagEntityID,
+		Path:       sanitizePath(args[0]),
+		Operation:  c.flagOperation,
+		Data:       data,
+		RemoteAddr: c.flagRemoteAddr,
+		Headers:    c.flagHeaders,
+	}
+	if c.flagRequestWrapTTL > 0 {
+		input.WrapTTL = c.flagRequestWrapTTL.String()
+	}
+
+	result, err := client.Sys().SimulatePolicy(input)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error simulating policies: %s", err))
+		return 2
+	}
+
+	if Format(c.UI) != "table" {
+		return OutputData(c.UI, result)
+	}
+
+	out := []string{"Key | Value"}
+	out = append(out, fmt.Sprintf("allowed | %t", result.Allowed))
+	out = append(out, fmt.Sprintf("path | %s", result.Path))
+	out = append(out, fmt.Sprintf("operation | %s", result.Operation))
+	out = append(out, fmt.Sprintf("policies | %s", strings.Join(result.Policies, ", ")))
+	if result.Root {
+		out = append(out, "root | true")
+	}
+	if result.MatchedRule != nil {
+		out = append(out, fmt.Sprintf("matched_rule | %s (%s)", result.MatchedRule.Path, result.MatchedRule.Type))
+		out = append(out, fmt.Sprintf("capabilities | %s", strings.Join(result.MatchedRule.Capabilities, ", ")))
+
+		names := make([]string, 0, len(result.MatchedRule.Policies))
+		for name := range result.MatchedRule.Policies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			out = append(out, fmt.Sprintf("policy %s | %s", name, strings.Join(result.MatchedRule.Policies[name], ", ")))
+		}
+	}
+	if result.DeniedBy != "" {
+		out = append(out, fmt.Sprintf("denied_by | %s", result.DeniedBy))
+	}
+	if result.DeniedParameter != "" {
+		out = append(out, fmt.Sprintf("denied_parameter | %s", result.DeniedParameter))
+	}
+
+	c.UI.Output(tableOutput(out, nil))
+	return 0
+}
@@ -0,0 +1,101 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func testPolicySimulateCommand(tb testing.TB) (*cli.MockUi, *PolicySimulateCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &PolicySimulateCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+	}
+}
+
+func TestPolicySimulateCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		args []string
+		out  string
+		code int
+	}{
+		{
+			"not_enough_args",
+			[]string{},
+			"Not enough arguments",
+			1,
+		},
+		{
+			"no_policy_source",
+			[]string{"secret/foo"},
+			"exactly one of",
+			2,
+		},
+		{
+			"allowed",
+			[]string{"-policies=my-policy", "secret/foo"},
+			"secret/*",
+			0,
+		},
+		{
+			"denied",
+			[]string{"-policies=my-policy", "-operation=delete", "secret/foo"},
+			"missing_capability",
+			0,
+		},
+		{
+			"request_wrap_ttl",
+			[]string{"-policies=my-policy", "-request-wrap-ttl=5m", "secret/foo"},
+			"secret/*",
+			0,
+		},
+	}
+
+	t.Run("validations", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tc := range cases {
+			tc := tc
+
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				client, closer := testVaultServer(t)
+				defer closer()
+
+				policy := `path "secret/*" { capabilities = ["read"] }`
+				if err := client.Sys().PutPolicy("my-policy", policy); err != nil {
+					t.Fatal(err)
+				}
+
+				ui, cmd := testPolicySimulateCommand(t)
+				cmd.client = client
+
+				code := cmd.Run(tc.args)
+				if code != tc.code {
+					t.Errorf("expected %d to be %d", code, tc.code)
+				}
+
+				combined := ui.OutputWriter.String() + ui.ErrorWriter.String()
+				if !strings.Contains(combined, tc.out) {
+					t.Errorf("expected %q to contain %q", combined, tc.out)
+				}
+			})
+		}
+	})
+
+	t.Run("no_tabs", func(t *testing.T) {
+		t.Parallel()
+
+		_, cmd := testPolicySimulateCommand(t)
+		assertNoTabs(t, cmd)
+	})
+}
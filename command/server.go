@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -36,6 +37,7 @@ import (
 	"github.com/quid/vault/internalshared/gatedwriter"
 	"github.com/quid/vault/internalshared/listenerutil"
 	"github.com/quid/vault/internalshared/reloadutil"
+	"github.com/quid/vault/physical/raft"
 	"github.com/quid/vault/sdk/helper/jsonutil"
 	"github.com/quid/vault/sdk/helper/logging"
 	"github.com/quid/vault/sdk/helper/mlock"
@@ -1003,6 +1005,18 @@ func (c *ServerCommand) Run(args []string) int {
 		return 1
 	}
 
+	// Initialize the destination of the online storage migration, if any
+	var migrationBackend physical.Backend
+	if config.StorageMigration != nil {
+		namedMigrationLogger := c.logger.Named("storage_migration." + config.StorageMigration.Type)
+		allLoggers = append(allLoggers, namedMigrationLogger)
+		migrationBackend, err = c.storageMigrationDestination(config, namedMigrationLogger)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error initializing storage_migration of type %s: %s", config.StorageMigration.Type, err))
+			return 1
+		}
+	}
+
 	// Initialize the Service Discovery, if there is one
 	var configSR sr.ServiceRegistration
 	if config.ServiceRegistration != nil {
@@ -1056,9 +1070,20 @@ func (c *ServerCommand) Run(args []string) int {
 				config.Seals = append(config.Seals, &configutil.KMS{Type: wrapping.Shamir})
 			}
 		}
+
+		// Several enabled seals are combined to wrap the master key, so that
+		// any of them is able to unseal
+		enabledSeals := 0
+		for _, configSeal := range config.Seals {
+			if !configSeal.Disabled {
+				enabledSeals++
+			}
+		}
+		var multiSeals []*vaultseal.MultiWrapperSeal
+
 		for _, configSeal := range config.Seals {
 			sealType := wrapping.Shamir
-			if !configSeal.Disabled && os.Getenv("VAULT_SEAL_TYPE") != "" {
+			if !configSeal.Disabled && enabledSeals == 1 && os.Getenv("VAULT_SEAL_TYPE") != "" {
 				sealType = os.Getenv("VAULT_SEAL_TYPE")
 				configSeal.Type = sealType
 			} else {
@@ -1081,6 +1106,23 @@ func (c *ServerCommand) Run(args []string) int {
 					return 1
 				}
 			}
+			if !configSeal.Disabled && enabledSeals > 1 {
+				if wrapper == nil {
+					c.UI.Error(fmt.Sprintf("Seals of type %q cannot be combined with other seals", configSeal.Type))
+					return 1
+				}
+				name := configSeal.Name
+				if name == "" {
+					name = configSeal.Type
+				}
+				multiSeals = append(multiSeals, &vaultseal.MultiWrapperSeal{
+					Name:     name,
+					Priority: configSeal.Priority,
+					Wrapper:  wrapper,
+				})
+				continue
+			}
+
 			if wrapper == nil {
 				seal = defaultSeal
 			} else {
@@ -1105,6 +1147,31 @@ func (c *ServerCommand) Run(args []string) int {
 			}()
 
 		}
+
+		if len(multiSeals) > 0 {
+			var multiWrapper *vaultseal.MultiWrapper
+			multiWrapper, err = vaultseal.NewMultiWrapper(multiSeals)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error parsing Seal configuration: %s", err))
+				return 1
+			}
+			seal := vault.NewAutoSeal(&vaultseal.Access{
+				Wrapper: multiWrapper,
+			})
+			barrierSeal = seal
+			barrierWrapper = multiWrapper
+
+			infoKeys = append(infoKeys, "Seals")
+			info["Seals"] = strings.Join(multiWrapper.Types(), ", ")
+
+			// Finalizing the combined seals finalizes each of them
+			defer func() {
+				err = seal.Finalize(context.Background())
+				if err != nil {
+					c.UI.Error(fmt.Sprintf("Error finalizing seals: %v", err))
+				}
+			}()
+		}
 	}
 
 	if barrierSeal == nil {
@@ -1151,6 +1218,10 @@ func (c *ServerCommand) Run(args []string) int {
 		MetricSink:                metricSink,
 		SecureRandomReader:        secureRandomReader,
 	}
+	if migrationBackend != nil {
+		coreConfig.StorageMigrationDestination = migrationBackend
+		coreConfig.StorageMigrationDestinationType = config.StorageMigration.Type
+	}
 	if c.flagDev {
 		coreConfig.EnableRaw = true
 		coreConfig.DevToken = c.flagDevRootTokenID
@@ -2440,6 +2511,66 @@ func (c *ServerCommand) storageMigrationActive(backend physical.Backend) bool {
 	}
 }
 
+// storageMigrationDestination creates the backend the storage is migrated to
+// online. A raft destination is bootstrapped with this node as its only peer,
+// the other nodes join it once restarted with raft as their storage.
+func (c *ServerCommand) storageMigrationDestination(config *server.Config, logger hclog.Logger) (physical.Backend, error) {
+	if config.StorageMigration.Type == config.Storage.Type {
+		return nil, errors.New("the destination must be of a different type than the storage")
+	}
+
+	factory, exists := c.PhysicalBackends[config.StorageMigration.Type]
+	if !exists {
+		return nil, fmt.Errorf("unknown storage type %s", config.StorageMigration.Type)
+	}
+
+	backend, err := factory(config.StorageMigration.Config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	raftStorage, ok := backend.(*raft.RaftBackend)
+	if !ok {
+		return backend, nil
+	}
+
+	clusterAddr := config.ClusterAddr
+	if envCA := os.Getenv("VAULT_CLUSTER_ADDR"); envCA != "" {
+		clusterAddr = envCA
+	}
+	if len(clusterAddr) == 0 {
+		return nil, errors.New("cluster address must be set when migrating to raft storage")
+	}
+	parsedClusterAddr, err := url.Parse(clusterAddr)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing cluster address: {{err}}", err)
+	}
+
+	// The raft state is kept across restarts, so that the copy resumes
+	hasState, err := raftStorage.HasState()
+	if err != nil {
+		return nil, err
+	}
+	if !hasState {
+		if err := raftStorage.Bootstrap([]raft.Peer{
+			{
+				ID:      raftStorage.NodeID(),
+				Address: parsedClusterAddr.Host,
+			},
+		}); err != nil {
+			return nil, errwrap.Wrapf("could not bootstrap clustered storage: {{err}}", err)
+		}
+	}
+
+	if err := raftStorage.SetupCluster(context.Background(), raft.SetupOpts{
+		StartAsLeader: true,
+	}); err != nil {
+		return nil, errwrap.Wrapf("could not start clustered storage: {{err}}", err)
+	}
+
+	return backend, nil
+}
+
 type StorageMigrationStatus struct {
 	Start time.Time `json:"start"`
 }
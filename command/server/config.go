@@ -29,6 +29,9 @@ type Config struct {
 	Storage   *Storage `hcl:"-"`
 	HAStorage *Storage `hcl:"-"`
 
+	// StorageMigration is the backend the storage is migrated to online
+	StorageMigration *Storage `hcl:"-"`
+
 	ServiceRegistration *ServiceRegistration `hcl:"-"`
 
 	CacheSize                int         `hcl:"cache_size"`
@@ -152,6 +155,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.HAStorage = c2.HAStorage
 	}
 
+	result.StorageMigration = c.StorageMigration
+	if c2.StorageMigration != nil {
+		result.StorageMigration = c2.StorageMigration
+	}
+
 	result.ServiceRegistration = c.ServiceRegistration
 	if c2.ServiceRegistration != nil {
 		result.ServiceRegistration = c2.ServiceRegistration
@@ -420,6 +428,12 @@ func ParseConfig(d string) (*Config, error) {
 		}
 	}
 
+	if o := list.Filter("storage_migration"); len(o.Items) > 0 {
+		if err := parseStorageMigration(result, o, "storage_migration"); err != nil {
+			return nil, errwrap.Wrapf("error parsing 'storage_migration': {{err}}", err)
+		}
+	}
+
 	// Parse service discovery
 	if o := list.Filter("service_registration"); len(o.Items) > 0 {
 		if err := parseServiceRegistration(result, o, "service_registration"); err != nil {
@@ -660,6 +674,23 @@ func parseHAStorage(result *Config, list *ast.ObjectList, name string) error {
 	return nil
 }
 
+// parseStorageMigration reuses the storage parsing, keeping the result as the
+// destination of the online storage migration
+func parseStorageMigration(result *Config, list *ast.ObjectList, name string) error {
+	tmpConfig := &Config{
+		APIAddr:              result.APIAddr,
+		ClusterAddr:          result.ClusterAddr,
+		DisableClustering:    result.DisableClustering,
+		DisableClusteringRaw: result.DisableClusteringRaw,
+	}
+	if err := ParseStorage(tmpConfig, list, name); err != nil {
+		return err
+	}
+
+	result.StorageMigration = tmpConfig.Storage
+	return nil
+}
+
 func parseServiceRegistration(result *Config, list *ast.ObjectList, name string) error {
 	if len(list.Items) > 1 {
 		return fmt.Errorf("only one %q block is permitted", name)
@@ -691,6 +722,7 @@ func parseServiceRegistration(result *Config, list *ast.ObjectList, name string)
 // Specifically, the fields that this method strips are:
 // - Storage.Config
 // - HAStorage.Config
+// - StorageMigration.Config
 // - Seals.Config
 // - Telemetry.CirconusAPIToken
 func (c *Config) Sanitized() map[string]interface{} {
@@ -752,6 +784,16 @@ func (c *Config) Sanitized() map[string]interface{} {
 		result["ha_storage"] = sanitizedHAStorage
 	}
 
+	// Sanitize storage_migration stanza
+	if c.StorageMigration != nil {
+		result["storage_migration"] = map[string]interface{}{
+			"type":               c.StorageMigration.Type,
+			"redirect_addr":      c.StorageMigration.RedirectAddr,
+			"cluster_addr":       c.StorageMigration.ClusterAddr,
+			"disable_clustering": c.StorageMigration.DisableClustering,
+		}
+	}
+
 	// Sanitize service_registration stanza
 	if c.ServiceRegistration != nil {
 		sanitizedServiceRegistration := map[string]interface{}{
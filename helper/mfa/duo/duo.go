@@ -59,6 +59,29 @@ func DuoHandler(ctx context.Context, req *logical.Request, d *framework.FieldDat
 	return duoHandler(duoConfig, duoAuthClient, request)
 }
 
+// Authenticate verifies the given user with Duo outside of a login flow,
+// such as when a request needs a second factor. The username is used as-is
+// in place of the configured username format.
+func Authenticate(duoConfig *DuoConfig, duoAuthClient AuthClient, username, method, passcode, ipAddr string) error {
+	config := *duoConfig
+	config.UsernameFormat = "%s"
+
+	resp, err := duoHandler(&config, duoAuthClient, &duoAuthRequest{
+		successResp: &logical.Response{},
+		username:    username,
+		method:      method,
+		passcode:    passcode,
+		ipAddr:      ipAddr,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return resp.Error()
+	}
+	return nil
+}
+
 type duoAuthRequest struct {
 	successResp *logical.Response
 	username    string
@@ -58,11 +58,17 @@ func GetDuoAuthClient(ctx context.Context, req *logical.Request, config *DuoConf
 		return nil, err
 	}
 
+	return NewDuoAuthClient(&access, config.UserAgent)
+}
+
+// NewDuoAuthClient creates a Duo Auth API client from the given access
+// credentials and verifies that Duo can be reached with them.
+func NewDuoAuthClient(access *DuoAccess, userAgent string) (AuthClient, error) {
 	duoClient := duoapi.NewDuoApi(
 		access.IKey,
 		access.SKey,
 		access.Host,
-		config.UserAgent,
+		userAgent,
 	)
 	duoAuthClient := authapi.NewAuthApi(*duoClient)
 	check, err := duoAuthClient.Check()
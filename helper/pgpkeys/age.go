@@ -0,0 +1,517 @@
+package pgpkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The shares encrypted to X25519 recipients use the age format, so that they
+// can be decrypted with the age tooling as well as with the Vault CLI. See
+// https://age-encryption.org/v1 for the specification.
+const (
+	ageRecipientPrefix = "age1"
+	ageRecipientHRP    = "age"
+	ageIdentityHRP     = "age-secret-key-"
+
+	ageVersionLine = "age-encryption.org/v1"
+	ageX25519Label = "age-encryption.org/v1/X25519"
+
+	ageFileKeySize      = 16
+	agePayloadNonceSize = 16
+	ageChunkSize        = 64 * 1024
+	ageColumnsPerLine   = 64
+)
+
+var ageBase64 = base64.RawStdEncoding.Strict()
+
+// IsAgeRecipient returns whether the key is an age X25519 recipient, such as
+// "age1...", rather than a PGP key
+func IsAgeRecipient(key string) bool {
+	return strings.HasPrefix(strings.TrimSpace(key), ageRecipientPrefix)
+}
+
+func parseAgeRecipient(recipient string) ([]byte, error) {
+	hrp, key, err := bech32Decode(strings.TrimSpace(recipient))
+	if err != nil {
+		return nil, errwrap.Wrapf("error decoding age recipient: {{err}}", err)
+	}
+	if hrp != ageRecipientHRP || len(key) != curve25519.PointSize {
+		return nil, errors.New("invalid age X25519 recipient")
+	}
+	return key, nil
+}
+
+func parseAgeIdentity(identity string) ([]byte, error) {
+	hrp, key, err := bech32Decode(strings.TrimSpace(identity))
+	if err != nil {
+		return nil, errwrap.Wrapf("error decoding age identity: {{err}}", err)
+	}
+	if hrp != ageIdentityHRP || len(key) != curve25519.ScalarSize {
+		return nil, errors.New("invalid age X25519 identity")
+	}
+	return key, nil
+}
+
+// ValidateAgeRecipient returns an error if the key isn't a valid age X25519
+// recipient
+func ValidateAgeRecipient(recipient string) error {
+	_, err := parseAgeRecipient(recipient)
+	return err
+}
+
+// GenerateAgeIdentity returns a new age X25519 identity, "AGE-SECRET-KEY-1...",
+// and its recipient
+func GenerateAgeIdentity() (string, string, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", "", err
+	}
+	identity, err := bech32Encode(ageIdentityHRP, secret)
+	if err != nil {
+		return "", "", err
+	}
+	recipient, err := AgeRecipient(strings.ToUpper(identity))
+	if err != nil {
+		return "", "", err
+	}
+	return strings.ToUpper(identity), recipient, nil
+}
+
+// AgeRecipient returns the recipient of an age X25519 identity
+func AgeRecipient(identity string) (string, error) {
+	secret, err := parseAgeIdentity(identity)
+	if err != nil {
+		return "", err
+	}
+	key, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return bech32Encode(ageRecipientHRP, key)
+}
+
+// ReadAgeIdentity returns the first age identity of the content of an identity
+// file, as written by age-keygen
+func ReadAgeIdentity(content string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := parseAgeIdentity(line); err != nil {
+			return "", err
+		}
+		return line, nil
+	}
+	return "", errors.New("no age identity found")
+}
+
+// AgeEncrypt encrypts the plaintext to the age X25519 recipient
+func AgeEncrypt(recipient string, plaintext []byte) ([]byte, error) {
+	theirKey, err := parseAgeRecipient(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, err
+	}
+
+	// Wrap the file key for the recipient
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, err
+	}
+	ourKey, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := curve25519.X25519(ephemeral, theirKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte{}, ourKey...), theirKey...)
+	wrappingKey, err := ageHKDF(sharedSecret, salt, ageX25519Label)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey := aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil)
+
+	header := bytes.NewBuffer(nil)
+	fmt.Fprintf(header, "%s\n", ageVersionLine)
+	fmt.Fprintf(header, "-> X25519 %s\n", ageBase64.EncodeToString(ourKey))
+	header.WriteString(ageWrapLines(ageBase64.EncodeToString(wrappedKey)))
+	header.WriteString("---")
+
+	mac, err := ageHeaderMAC(fileKey, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(header, " %s\n", ageBase64.EncodeToString(mac))
+
+	// Encrypt the payload with a key derived from the file key
+	nonce := make([]byte, agePayloadNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	payloadKey, err := ageHKDF(fileKey, nonce, "payload")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := ageStreamSeal(payloadKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Write(nonce)
+	header.Write(payload)
+	return header.Bytes(), nil
+}
+
+// AgeDecrypt decrypts the ciphertext with the age X25519 identity
+func AgeDecrypt(identity string, ciphertext []byte) ([]byte, error) {
+	secret, err := parseAgeIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+	ourKey, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(bytes.NewReader(ciphertext))
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", errors.New("malformed age header")
+		}
+		return line, nil
+	}
+
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line != ageVersionLine+"\n" {
+		return nil, errors.New("unsupported age format")
+	}
+	headerLen := len(line)
+
+	var fileKey []byte
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, "---") {
+			header := ciphertext[:headerLen+len("---")]
+			mac, err := ageBase64.DecodeString(strings.TrimSuffix(strings.TrimPrefix(line, "--- "), "\n"))
+			if err != nil {
+				return nil, errors.New("malformed age header")
+			}
+			headerLen += len(line)
+
+			if fileKey == nil {
+				return nil, errors.New("the ciphertext isn't encrypted to the age identity")
+			}
+			expected, err := ageHeaderMAC(fileKey, header)
+			if err != nil {
+				return nil, err
+			}
+			if !hmac.Equal(mac, expected) {
+				return nil, errors.New("bad age header MAC")
+			}
+			break
+		}
+
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, errors.New("malformed age header")
+		}
+		headerLen += len(line)
+		args := strings.Fields(strings.TrimPrefix(line, "-> "))
+
+		// The body of a stanza ends with a line shorter than a full line
+		var body string
+		for {
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			headerLen += len(line)
+			body += strings.TrimSuffix(line, "\n")
+			if len(line) < ageColumnsPerLine+1 {
+				break
+			}
+		}
+
+		if fileKey != nil || len(args) != 2 || args[0] != "X25519" {
+			continue
+		}
+		fileKey, err = ageUnwrapX25519(secret, ourKey, args[1], body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payload := ciphertext[headerLen:]
+	if len(payload) < agePayloadNonceSize {
+		return nil, errors.New("malformed age payload")
+	}
+	payloadKey, err := ageHKDF(fileKey, payload[:agePayloadNonceSize], "payload")
+	if err != nil {
+		return nil, err
+	}
+	return ageStreamOpen(payloadKey, payload[agePayloadNonceSize:])
+}
+
+// ageUnwrapX25519 returns the file key of an X25519 stanza, or nil if the
+// stanza is for another recipient
+func ageUnwrapX25519(secret, ourKey []byte, share, body string) ([]byte, error) {
+	theirKey, err := ageBase64.DecodeString(share)
+	if err != nil || len(theirKey) != curve25519.PointSize {
+		return nil, errors.New("malformed age X25519 stanza")
+	}
+	wrappedKey, err := ageBase64.DecodeString(body)
+	if err != nil {
+		return nil, errors.New("malformed age X25519 stanza")
+	}
+
+	sharedSecret, err := curve25519.X25519(secret, theirKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte{}, theirKey...), ourKey...)
+	wrappingKey, err := ageHKDF(sharedSecret, salt, ageX25519Label)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(wrappingKey)
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), wrappedKey, nil)
+	if err != nil || len(fileKey) != ageFileKeySize {
+		return nil, nil
+	}
+	return fileKey, nil
+}
+
+func ageHKDF(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func ageHeaderMAC(fileKey, header []byte) ([]byte, error) {
+	key, err := ageHKDF(fileKey, nil, "header")
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(header)
+	return h.Sum(nil), nil
+}
+
+// ageWrapLines wraps the base64 body of a stanza, the last line is always
+// shorter than a full line
+func ageWrapLines(s string) string {
+	var b strings.Builder
+	for len(s) >= ageColumnsPerLine {
+		b.WriteString(s[:ageColumnsPerLine] + "\n")
+		s = s[ageColumnsPerLine:]
+	}
+	b.WriteString(s + "\n")
+	return b.String()
+}
+
+func ageStreamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// ageStreamSeal encrypts the payload in chunks, the last one is flagged so
+// that a truncation is detected
+func ageStreamSeal(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		chunk := plaintext
+		last := len(chunk) <= ageChunkSize
+		if !last {
+			chunk = chunk[:ageChunkSize]
+		}
+		out = aead.Seal(out, ageStreamNonce(counter, last), chunk, nil)
+		if last {
+			return out, nil
+		}
+		plaintext = plaintext[ageChunkSize:]
+	}
+}
+
+func ageStreamOpen(key, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		chunk := ciphertext
+		last := len(chunk) <= ageChunkSize+aead.Overhead()
+		if !last {
+			chunk = chunk[:ageChunkSize+aead.Overhead()]
+		}
+		out, err = aead.Open(out, ageStreamNonce(counter, last), chunk, nil)
+		if err != nil {
+			return nil, errwrap.Wrapf("error decrypting the age payload: {{err}}", err)
+		}
+		if last {
+			return out, nil
+		}
+		ciphertext = ciphertext[len(chunk):]
+	}
+}
+
+// The age keys are encoded with bech32, see BIP 173, without its limit on the
+// length of the strings
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	ret := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range []byte(hrp) {
+		ret = append(ret, c>>5)
+	}
+	ret = append(ret, 0)
+	for _, c := range []byte(hrp) {
+		ret = append(ret, c&31)
+	}
+	return ret
+}
+
+// bech32ConvertBits regroups the bits of data from groups of fromBits to
+// groups of toBits
+func bech32ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var ret []byte
+	acc, bits := uint32(0), uint(0)
+	maxv := byte(1<<toBits - 1)
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			ret = append(ret, byte(acc>>bits)&maxv)
+		}
+	}
+	switch {
+	case pad && bits > 0:
+		ret = append(ret, byte(acc<<(toBits-bits))&maxv)
+	case !pad && bits >= fromBits:
+		return nil, errors.New("illegal zero padding")
+	case !pad && byte(acc<<(toBits-bits))&maxv != 0:
+		return nil, errors.New("non-zero padding")
+	}
+	return ret, nil
+}
+
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := bech32ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	hrp = strings.ToLower(hrp)
+
+	checksumValues := append(bech32HRPExpand(hrp), values...)
+	checksumValues = append(checksumValues, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(checksumValues) ^ 1
+	for i := 0; i < 6; i++ {
+		values = append(values, byte(mod>>uint(5*(5-i)))&31)
+	}
+
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	return b.String(), nil
+}
+
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("separator '1' at invalid position")
+	}
+	hrp := s[:pos]
+
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v == -1 {
+			return "", nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	data, err := bech32ConvertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
@@ -0,0 +1,215 @@
+package pgpkeys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// An identity file written by age-keygen, and the output of
+// "printf 'unseal key share' | age -r age15tnv...", both from age v1.0.0
+const (
+	ageKeygenIdentity  = "AGE-SECRET-KEY-1YA3TRFA0N8H46HYN5JYDXE859UARC00CCNLPG6T6KKGCUTTUT46QUXMXVF"
+	ageKeygenRecipient = "age15tnvpjss89xseguyxjhclnyx9l3raqpkdhj62depqz49mp8nfv7s0sjgyp"
+	ageKeygenFile      = "# created: 2026-10-16T11:51:18Z\n# public key: " + ageKeygenRecipient + "\n" + ageKeygenIdentity + "\n"
+
+	ageCiphertext = "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSB0UThHYzBDaVIwVnhTbXhyRWlJSGN2Tk92TUI5TW9WNFBpUEREMWN3T0FvCnVTMUlFVUMwYWt3T04zZEhvVnJTTWJNdlNkZ0kvTm9sZ3l1QTMyV1RQaVkKLS0tIFNYRzR1TlBGTGFLczErZ0t6WURtOGI0QTh6djVLMUMvNFAvbktrVjRSN0EKp73i143YtYKBQAe7mWP5MRVZVZfgrHAdyBq9n13uRJvLkRIBAdvawXWaJhW+KcKa"
+)
+
+func TestAgeIdentity(t *testing.T) {
+	identity, recipient, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(identity, "AGE-SECRET-KEY-1") {
+		t.Fatalf("bad identity: %q", identity)
+	}
+	if !IsAgeRecipient(recipient) {
+		t.Fatalf("bad recipient: %q", recipient)
+	}
+	if err := ValidateAgeRecipient(recipient); err != nil {
+		t.Fatal(err)
+	}
+
+	derived, err := AgeRecipient(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived != recipient {
+		t.Fatalf("bad recipient: expected %q, got %q", recipient, derived)
+	}
+
+	// Identity files as written by age-keygen hold comments
+	content := "# created: 2020-08-01T12:00:00Z\n# public key: " + recipient + "\n" + identity + "\n"
+	read, err := ReadAgeIdentity(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != identity {
+		t.Fatalf("bad identity: expected %q, got %q", identity, read)
+	}
+
+	for _, invalid := range []string{
+		"age1",
+		recipient[:len(recipient)-1] + "q",
+		strings.ToUpper(recipient[:10]) + recipient[10:],
+		identity,
+	} {
+		if err := ValidateAgeRecipient(invalid); err == nil {
+			t.Fatalf("expected an error validating %q", invalid)
+		}
+	}
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	identity, recipient, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIdentity, _, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 32, ageChunkSize, ageChunkSize + 1, 3 * ageChunkSize} {
+		plaintext := bytes.Repeat([]byte{'k'}, size)
+		ciphertext, err := AgeEncrypt(recipient, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(ciphertext, []byte(ageVersionLine+"\n-> X25519 ")) {
+			t.Fatalf("bad header: %q", ciphertext[:32])
+		}
+
+		output, err := AgeDecrypt(identity, ciphertext)
+		if err != nil {
+			t.Fatalf("error decrypting %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(plaintext, output) {
+			t.Fatalf("bad plaintext of %d bytes, got %d bytes", size, len(output))
+		}
+
+		if _, err := AgeDecrypt(otherIdentity, ciphertext); err == nil {
+			t.Fatal("expected an error decrypting with another identity")
+		}
+
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[len(tampered)-1] ^= 1
+		if _, err := AgeDecrypt(identity, tampered); err == nil {
+			t.Fatal("expected an error decrypting a tampered ciphertext")
+		}
+	}
+}
+
+func TestEncryptShares_age(t *testing.T) {
+	identity, recipient, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := [][]byte{[]byte("share1"), []byte("share2")}
+	fingerprints, encrypted, err := EncryptShares(input, []string{recipient, pubKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprints) != 2 || fingerprints[0] != recipient {
+		t.Fatalf("bad fingerprints: %v", fingerprints)
+	}
+
+	expected, err := GetFingerprints([]string{recipient, pubKey1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected[0] != fingerprints[0] || expected[1] != fingerprints[1] {
+		t.Fatalf("bad fingerprints: expected %v, got %v", expected, fingerprints)
+	}
+
+	output, err := AgeDecrypt(identity, encrypted[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input[0], output) {
+		t.Fatalf("bad share: expected %q, got %q", input[0], output)
+	}
+}
+
+func TestAgeBech32_knownAnswers(t *testing.T) {
+	// The test vectors of BIP 173
+	for _, valid := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	} {
+		hrp, data, err := bech32Decode(valid)
+		if err != nil {
+			t.Fatalf("error decoding %q: %v", valid, err)
+		}
+		encoded, err := bech32Encode(hrp, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded != strings.ToLower(valid) {
+			t.Fatalf("bad encoding: expected %q, got %q", strings.ToLower(valid), encoded)
+		}
+	}
+
+	for _, invalid := range []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+	} {
+		if _, _, err := bech32Decode(invalid); err == nil {
+			t.Fatalf("expected an error decoding %q", invalid)
+		}
+	}
+}
+
+func TestAgeIdentity_knownAnswer(t *testing.T) {
+	recipient, err := AgeRecipient(ageKeygenIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient != ageKeygenRecipient {
+		t.Fatalf("bad recipient: expected %q, got %q", ageKeygenRecipient, recipient)
+	}
+
+	identity, err := ReadAgeIdentity(ageKeygenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != ageKeygenIdentity {
+		t.Fatalf("bad identity: expected %q, got %q", ageKeygenIdentity, identity)
+	}
+}
+
+func TestAgeDecrypt_knownAnswer(t *testing.T) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ageCiphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := AgeDecrypt(ageKeygenIdentity, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "unseal key share" {
+		t.Fatalf("bad plaintext: %q", output)
+	}
+
+	otherIdentity, _, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AgeDecrypt(otherIdentity, ciphertext); err == nil {
+		t.Fatal("expected an error decrypting with another identity")
+	}
+}
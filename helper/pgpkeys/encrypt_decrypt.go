@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/keybase/go-crypto/openpgp"
@@ -12,7 +13,8 @@ import (
 
 // EncryptShares takes an ordered set of byte slices to encrypt and the
 // corresponding base64-encoded public keys to encrypt them with, encrypts each
-// byte slice with the corresponding public key.
+// byte slice with the corresponding public key. The public keys can also be
+// age X25519 recipients, the byte slices are then encrypted in the age format.
 //
 // Note: There is no corresponding test function; this functionality is
 // thoroughly tested in the init and rekey command unit tests
@@ -21,13 +23,24 @@ func EncryptShares(input [][]byte, pgpKeys []string) ([]string, [][]byte, error)
 		return nil, nil, fmt.Errorf("mismatch between number items to encrypt and number of PGP keys")
 	}
 	encryptedShares := make([][]byte, 0, len(pgpKeys))
-	entities, err := GetEntities(pgpKeys)
-	if err != nil {
-		return nil, nil, err
-	}
-	for i, entity := range entities {
+	fingerprints := make([]string, 0, len(pgpKeys))
+	for i, pgpKey := range pgpKeys {
+		if IsAgeRecipient(pgpKey) {
+			ct, err := AgeEncrypt(pgpKey, input[i])
+			if err != nil {
+				return nil, nil, errwrap.Wrapf("error encrypting age message: {{err}}", err)
+			}
+			encryptedShares = append(encryptedShares, ct)
+			fingerprints = append(fingerprints, strings.TrimSpace(pgpKey))
+			continue
+		}
+
+		entities, err := GetEntities([]string{pgpKey})
+		if err != nil {
+			return nil, nil, err
+		}
 		ctBuf := bytes.NewBuffer(nil)
-		pt, err := openpgp.Encrypt(ctBuf, []*openpgp.Entity{entity}, nil, nil, nil)
+		pt, err := openpgp.Encrypt(ctBuf, entities, nil, nil, nil)
 		if err != nil {
 			return nil, nil, errwrap.Wrapf("error setting up encryption for PGP message: {{err}}", err)
 		}
@@ -37,11 +50,12 @@ func EncryptShares(input [][]byte, pgpKeys []string) ([]string, [][]byte, error)
 		}
 		pt.Close()
 		encryptedShares = append(encryptedShares, ctBuf.Bytes())
-	}
 
-	fingerprints, err := GetFingerprints(nil, entities)
-	if err != nil {
-		return nil, nil, err
+		fingerprint, err := GetFingerprints(nil, entities)
+		if err != nil {
+			return nil, nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint...)
 	}
 
 	return fingerprints, encryptedShares, nil
@@ -49,15 +63,31 @@ func EncryptShares(input [][]byte, pgpKeys []string) ([]string, [][]byte, error)
 
 // GetFingerprints takes in a list of openpgp Entities and returns the
 // fingerprints. If entities is nil, it will instead parse both entities and
-// fingerprints from the pgpKeys string slice.
+// fingerprints from the pgpKeys string slice. The fingerprint of an age
+// X25519 recipient is the recipient itself.
 func GetFingerprints(pgpKeys []string, entities []*openpgp.Entity) ([]string, error) {
 	if entities == nil {
-		var err error
-		entities, err = GetEntities(pgpKeys)
+		ret := make([]string, 0, len(pgpKeys))
+		for _, pgpKey := range pgpKeys {
+			if IsAgeRecipient(pgpKey) {
+				if err := ValidateAgeRecipient(pgpKey); err != nil {
+					return nil, err
+				}
+				ret = append(ret, strings.TrimSpace(pgpKey))
+				continue
+			}
 
-		if err != nil {
-			return nil, err
+			entities, err := GetEntities([]string{pgpKey})
+			if err != nil {
+				return nil, err
+			}
+			fingerprint, err := GetFingerprints(nil, entities)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, fingerprint...)
 		}
+		return ret, nil
 	}
 	ret := make([]string, 0, len(entities))
 	for _, entity := range entities {
@@ -76,6 +76,14 @@ func ParsePGPKeys(keyfiles []string) ([]string, error) {
 	for i, keyfile := range keyfiles {
 		keyfile = strings.TrimSpace(keyfile)
 
+		if IsAgeRecipient(keyfile) {
+			if err := ValidateAgeRecipient(keyfile); err != nil {
+				return nil, err
+			}
+			keys[i] = keyfile
+			continue
+		}
+
 		if strings.HasPrefix(keyfile, kbPrefix) {
 			key, ok := keybaseMap[keyfile]
 			if !ok || key == "" {
@@ -114,6 +122,14 @@ func ReadPGPFile(path string) (string, error) {
 		return "", err
 	}
 
+	// An age recipient file holds the recipient on its own line
+	if recipient := readAgeRecipient(buf.String()); recipient != "" {
+		if err := ValidateAgeRecipient(recipient); err != nil {
+			return "", errwrap.Wrapf(fmt.Sprintf("error parsing age recipient file %q: {{err}}", path), err)
+		}
+		return recipient, nil
+	}
+
 	// First parse as an armored keyring file, if that doesn't work, treat it as a straight binary/b64 string
 	keyReader := bytes.NewReader(buf.Bytes())
 	entityList, err := openpgp.ReadArmoredKeyRing(keyReader)
@@ -141,3 +157,20 @@ func ReadPGPFile(path string) (string, error) {
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 
 }
+
+// readAgeRecipient returns the age recipient of the content of a file, the
+// empty string if the file doesn't hold a single recipient
+func readAgeRecipient(content string) string {
+	var recipient string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if recipient != "" || !IsAgeRecipient(line) {
+			return ""
+		}
+		recipient = line
+	}
+	return recipient
+}
@@ -447,6 +447,36 @@ func RaftClusterJoinNodes(t testing.T, cluster *vault.TestCluster) {
 	}
 
 	WaitForNCoresUnsealed(t, cluster, len(cluster.Cores))
+	WaitForRaftVoters(t, leader, len(cluster.Cores))
+}
+
+// WaitForRaftVoters waits for autopilot to promote the nodes that joined the
+// raft cluster, until there are the given number of voters.
+func WaitForRaftVoters(t testing.T, leader *vault.TestClusterCore, voters int) {
+	t.Helper()
+
+	backend := leader.UnderlyingRawStorage.(*raft.RaftBackend)
+	ctx := namespace.RootContext(context.Background())
+	for i := 0; i < 60; i++ {
+		config, err := backend.GetConfiguration(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count := 0
+		for _, server := range config.Servers {
+			if server.Voter {
+				count++
+			}
+		}
+		if count >= voters {
+			return
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	t.Fatalf("raft nodes were not promoted to voters")
 }
 
 // HardcodedServerAddressProvider is a ServerAddressProvider that uses
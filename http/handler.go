@@ -602,6 +602,12 @@ func parseJSONRequest(perfStandby bool, r *http.Request, w http.ResponseWriter,
 			reader = http.MaxBytesReader(w, r.Body, max)
 		}
 	}
+	// The body is already limited by the request size quota, if any, which
+	// is only reported as exceeded when it is tighter than the listener's limit
+	quotaMax, _ := ctx.Value("request_size_quota").(int64)
+	if listenerMax, _ := maxRequestSize.(int64); listenerMax > 0 && listenerMax <= quotaMax {
+		quotaMax = 0
+	}
 	var origBody io.ReadWriter
 	if perfStandby {
 		// Since we're checking PerfStandby here we key on origBody being nil
@@ -611,6 +617,9 @@ func parseJSONRequest(perfStandby bool, r *http.Request, w http.ResponseWriter,
 	}
 	err := jsonutil.DecodeJSONFromReader(reader, out)
 	if err != nil && err != io.EOF {
+		if quotaMax > 0 && strings.Contains(err.Error(), "http: request body too large") {
+			return nil, errwrap.Wrapf(fmt.Sprintf("request body larger than %d bytes: {{err}}", quotaMax), logical.ErrRequestSizeQuotaExceeded)
+		}
 		return nil, errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
 	}
 	if origBody != nil {
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/quid/vault/sdk/helper/consts"
@@ -235,23 +236,59 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		ClusterID:    clusterID,
 		RecoverySeal: core.SealAccess().RecoveryKeySupported(),
 		StorageType:  core.StorageType(),
+		Seals:        sealHealthStatus(core),
 	})
 }
 
+// sealHealthStatus returns the health of each seal, when several auto-seals
+// are combined
+func sealHealthStatus(core *vault.Core) []SealHealthStatus {
+	access := core.SealAccess().GetAccess()
+	if access == nil {
+		return nil
+	}
+
+	var seals []SealHealthStatus
+	for _, health := range access.Health() {
+		status := SealHealthStatus{
+			Name:      health.Name,
+			Type:      health.Type,
+			Priority:  health.Priority,
+			Healthy:   health.Healthy,
+			LastError: health.LastError,
+		}
+		if !health.LastChecked.IsZero() {
+			status.LastChecked = health.LastChecked.Format(time.RFC3339Nano)
+		}
+		seals = append(seals, status)
+	}
+	return seals
+}
+
 type SealStatusResponse struct {
-	Type         string `json:"type"`
-	Initialized  bool   `json:"initialized"`
-	Sealed       bool   `json:"sealed"`
-	T            int    `json:"t"`
-	N            int    `json:"n"`
-	Progress     int    `json:"progress"`
-	Nonce        string `json:"nonce"`
-	Version      string `json:"version"`
-	Migration    bool   `json:"migration"`
-	ClusterName  string `json:"cluster_name,omitempty"`
-	ClusterID    string `json:"cluster_id,omitempty"`
-	RecoverySeal bool   `json:"recovery_seal"`
-	StorageType  string `json:"storage_type,omitempty"`
+	Type         string             `json:"type"`
+	Initialized  bool               `json:"initialized"`
+	Sealed       bool               `json:"sealed"`
+	T            int                `json:"t"`
+	N            int                `json:"n"`
+	Progress     int                `json:"progress"`
+	Nonce        string             `json:"nonce"`
+	Version      string             `json:"version"`
+	Migration    bool               `json:"migration"`
+	ClusterName  string             `json:"cluster_name,omitempty"`
+	ClusterID    string             `json:"cluster_id,omitempty"`
+	RecoverySeal bool               `json:"recovery_seal"`
+	StorageType  string             `json:"storage_type,omitempty"`
+	Seals        []SealHealthStatus `json:"seals,omitempty"`
+}
+
+type SealHealthStatus struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Priority    int    `json:"priority"`
+	Healthy     bool   `json:"healthy"`
+	LastError   string `json:"last_error,omitempty"`
+	LastChecked string `json:"last_checked,omitempty"`
 }
 
 // Note: because we didn't provide explicit tagging in the past we can't do it
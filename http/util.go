@@ -1,11 +1,16 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
 
+	"github.com/quid/vault/sdk/helper/jsonutil"
 	"github.com/quid/vault/sdk/logical"
 
 	"github.com/hashicorp/errwrap"
@@ -26,8 +31,6 @@ var (
 	}
 
 	additionalRoutes = func(mux *http.ServeMux, core *vault.Core) {}
-
-	nonVotersAllowed = false
 )
 
 func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler {
@@ -47,13 +50,34 @@ func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler
 			return
 		}
 
-		quotaResp, err := core.ApplyRateLimitQuota(&quotas.Request{
+		quotaReq := &quotas.Request{
 			Type:          quotas.TypeRateLimit,
 			Path:          path,
 			MountPath:     strings.TrimPrefix(core.MatchingMount(r.Context(), path), ns.Path),
 			NamespacePath: ns.Path,
 			ClientAddress: parseRemoteIPAddress(r),
-		})
+		}
+
+		// Only gather the client details the applicable quota is keyed by
+		keyType, err := core.RateLimitQuotaKeyType(quotaReq)
+		if err != nil {
+			core.Logger().Error("failed to apply quota", "path", path, "error", err)
+			respondError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		switch keyType {
+		case quotas.RateLimitKeyEntity:
+			if token, _ := getTokenFromReq(r); token != "" {
+				te, err := core.LookupToken(r.Context(), token)
+				if err == nil && te != nil {
+					quotaReq.EntityID = te.EntityID
+				}
+			}
+		case quotas.RateLimitKeyRole:
+			quotaReq.Role, quotaReq.RoleID = parseRateLimitRole(r, path)
+		}
+
+		quotaResp, err := core.ApplyRateLimitQuota(quotaReq)
 		if err != nil {
 			core.Logger().Error("failed to apply quota", "path", path, "error", err)
 			respondError(w, http.StatusUnprocessableEntity, err)
@@ -87,11 +111,75 @@ func rateLimitQuotaWrapping(handler http.Handler, core *vault.Core) http.Handler
 			return
 		}
 
+		// Request size quotas are enforced as the request body is read, whatever
+		// its format
+		maxRequestSize, err := core.RequestSizeQuotaLimit(quotaReq)
+		if err != nil {
+			core.Logger().Error("failed to apply quota", "path", path, "error", err)
+			respondError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if maxRequestSize > 0 {
+			if r.ContentLength > maxRequestSize {
+				quotaErr := errwrap.Wrapf(fmt.Sprintf("request body larger than %d bytes: {{err}}", maxRequestSize), quotas.ErrRequestSizeQuotaExceeded)
+				respondError(w, http.StatusRequestEntityTooLarge, quotaErr)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), "request_size_quota", maxRequestSize))
+		}
+
 		handler.ServeHTTP(w, r)
 		return
 	})
 }
 
+// rateLimitRoleFields are the request fields that name the auth role of a
+// login request, in order of preference.
+var rateLimitRoleFields = []string{"role", "role_name"}
+
+// parseRateLimitRole returns the auth role a login request is made against,
+// as the request path followed by the role named in the request body. If the
+// body names no role, the role ID in the body is returned instead, as is. The
+// body is restored so that it can be read again when the request is handled.
+func parseRateLimitRole(r *http.Request, path string) (string, string) {
+	if r.Body == nil || (r.Method != "POST" && r.Method != "PUT") {
+		return "", ""
+	}
+
+	// Bodies larger than the maximum request size are rejected later on, so
+	// only read up to that point
+	max := int64(DefaultMaxRequestSize)
+	if maxRequestSize, ok := r.Context().Value("max_request_size").(int64); ok && maxRequestSize > 0 {
+		max = maxRequestSize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, max))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return "", ""
+	}
+
+	var data map[string]interface{}
+	if err := jsonutil.DecodeJSON(body, &data); err != nil {
+		return "", ""
+	}
+	for _, field := range rateLimitRoleFields {
+		if role, ok := data[field].(string); ok && role != "" {
+			return path + ":" + role, ""
+		}
+	}
+	if roleID, ok := data["role_id"].(string); ok && roleID != "" {
+		return "", roleID
+	}
+
+	return "", ""
+}
+
 func parseRemoteIPAddress(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
@@ -48,6 +48,11 @@ type KMS struct {
 	// one KMS to be specified
 	Purpose []string `hcl:"-"`
 
+	// Name and Priority identify a seal when several are configured to wrap
+	// the master key, the seals with the lowest priority are tried first
+	Name     string `hcl:"-"`
+	Priority int    `hcl:"-"`
+
 	Disabled bool
 	Config   map[string]string
 }
@@ -58,7 +63,7 @@ func (k *KMS) GoString() string {
 
 func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, maxKMS int) error {
 	if len(list.Items) > maxKMS {
-		return fmt.Errorf("only two or less %q blocks are permitted", blockName)
+		return fmt.Errorf("only %d or less %q blocks are permitted", maxKMS, blockName)
 	}
 
 	seals := make([]*KMS, 0, len(list.Items))
@@ -97,6 +102,24 @@ func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, maxKMS int
 			delete(m, "disabled")
 		}
 
+		var name string
+		if v, ok := m["name"]; ok {
+			if name, ok = v.(string); !ok {
+				return multierror.Prefix(fmt.Errorf("unable to parse 'name' in kms type %q: value could not be parsed as string", key), fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			delete(m, "name")
+		}
+
+		var priority int
+		if v, ok := m["priority"]; ok {
+			p, err := parseutil.ParseInt(v)
+			if err != nil {
+				return multierror.Prefix(fmt.Errorf("unable to parse 'priority' in kms type %q: %w", key, err), fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			priority = int(p)
+			delete(m, "priority")
+		}
+
 		strMap := make(map[string]string, len(m))
 		for k, v := range m {
 			if vs, ok := v.(string); ok {
@@ -109,6 +132,8 @@ func parseKMS(result *[]*KMS, list *ast.ObjectList, blockName string, maxKMS int
 		seal := &KMS{
 			Type:     strings.ToLower(key),
 			Purpose:  purpose,
+			Name:     name,
+			Priority: priority,
 			Disabled: disabled,
 		}
 		if len(strMap) > 0 {
@@ -153,6 +153,10 @@ type LeaderJoinInfo struct {
 	// only be provided via Vault's configuration file.
 	LeaderClientKeyFile string `json:"leader_client_key_file"`
 
+	// NonVoter indicates if the follower node joins as a non-voter, holding a
+	// full copy of the data without taking part in the quorum
+	NonVoter bool `json:"non_voter"`
+
 	// Retry indicates if the join process should automatically be retried
 	Retry bool `json:"-"`
 
@@ -360,6 +364,15 @@ func (b *RaftBackend) Close() error {
 	return nil
 }
 
+const (
+	// SuffrageVoter is the suffrage of the servers with a vote in the cluster
+	SuffrageVoter = "voter"
+
+	// SuffrageNonVoter is the suffrage of the servers that receive the log
+	// entries without taking part in the quorum
+	SuffrageNonVoter = "non-voter"
+)
+
 // RaftServer has information about a server in the Raft configuration
 type RaftServer struct {
 	// NodeID is the name of the server
@@ -377,6 +390,10 @@ type RaftServer struct {
 	// Voter is true if this server has a vote in the cluster. This might
 	// be false if the server is staging and still coming online.
 	Voter bool `json:"voter"`
+
+	// Suffrage is "voter" if the server has a vote in the cluster, and
+	// "non-voter" if it only receives the log entries
+	Suffrage string `json:"suffrage"`
 }
 
 // RaftConfigurationResponse is returned when querying for the current Raft
@@ -645,14 +662,6 @@ func (b *RaftBackend) SetupCluster(ctx context.Context, opts SetupOpts) error {
 			return errwrap.Wrapf("raft recovery failed to parse peers.json: {{err}}", err)
 		}
 
-		// Non-voting servers are only allowed in enterprise. If Suffrage is disabled,
-		// error out to indicate that it isn't allowed.
-		for idx := range recoveryConfig.Servers {
-			if !nonVotersAllowed && recoveryConfig.Servers[idx].Suffrage == raft.Nonvoter {
-				return fmt.Errorf("raft recovery failed to parse configuration for node %q: setting `non_voter` is only supported in enterprise", recoveryConfig.Servers[idx].ID)
-			}
-		}
-
 		b.logger.Info("raft recovery found new config", "config", recoveryConfig)
 
 		err = raft.RecoverCluster(raftConfig, b.fsm, b.logStore, b.stableStore, b.snapStore, b.raftTransport, recoveryConfig)
@@ -814,8 +823,12 @@ func (b *RaftBackend) GetConfiguration(ctx context.Context) (*RaftConfigurationR
 			// denotes the raft leader.
 			Leader:          string(server.ID) == b.NodeID(),
 			Voter:           server.Suffrage == raft.Voter,
+			Suffrage:        SuffrageNonVoter,
 			ProtocolVersion: strconv.Itoa(raft.ProtocolVersionMax),
 		}
+		if entry.Voter {
+			entry.Suffrage = SuffrageVoter
+		}
 		config.Servers = append(config.Servers, entry)
 	}
 
@@ -837,6 +850,37 @@ func (b *RaftBackend) AddPeer(ctx context.Context, peerID, clusterAddr string) e
 	return future.Error()
 }
 
+// AddNonVotingPeer adds a new server to the raft cluster that receives the log
+// entries but doesn't take part in the quorum. An existing voter stays a voter.
+func (b *RaftBackend) AddNonVotingPeer(ctx context.Context, peerID, clusterAddr string) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage is not initialized")
+	}
+
+	b.logger.Debug("adding raft non-voting peer", "node_id", peerID, "cluster_addr", clusterAddr)
+
+	future := b.raft.AddNonvoter(raft.ServerID(peerID), raft.ServerAddress(clusterAddr), 0, 0)
+	return future.Error()
+}
+
+// DemotePeer turns a voter of the raft cluster into a non-voter
+func (b *RaftBackend) DemotePeer(ctx context.Context, peerID string) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage is not initialized")
+	}
+
+	b.logger.Debug("demoting raft peer", "node_id", peerID)
+
+	future := b.raft.DemoteVoter(raft.ServerID(peerID), 0, 0)
+	return future.Error()
+}
+
 // Peers returns all the servers present in the raft cluster
 func (b *RaftBackend) Peers(ctx context.Context) ([]Peer, error) {
 	b.l.RLock()
@@ -903,6 +947,35 @@ func (b *RaftBackend) Snapshot(out *logical.HTTPResponseWriter, access *seal.Acc
 	return nil
 }
 
+// SnapshotToWriter takes a raft snapshot, packages it into an archive file and
+// writes it to the provided writer, like Snapshot, for callers that aren't
+// serving an HTTP request.
+func (b *RaftBackend) SnapshotToWriter(out io.Writer, access *seal.Access) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	if b.raft == nil {
+		return errors.New("raft storage backend is sealed")
+	}
+
+	// If we have access to the seal create a sealer object
+	var s snapshot.Sealer
+	if access != nil {
+		s = &sealer{
+			access: access,
+		}
+	}
+
+	snap, err := snapshot.NewWithSealer(b.logger.Named("snapshot"), b.raft, s)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	_, err = io.Copy(out, snap)
+	return err
+}
+
 // WriteSnapshotToTemp reads a snapshot archive off the provided reader,
 // extracts the data and writes the snapshot to a temporary file. The seal
 // access is used to decrypt the SHASUM file in the archive to ensure this
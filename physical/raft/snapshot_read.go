@@ -0,0 +1,44 @@
+package raft
+
+import (
+	"io"
+	"math"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	snapshot "github.com/hashicorp/raft-snapshot"
+	"github.com/quid/vault/sdk/plugin/pb"
+)
+
+// ReadSnapshot reads a snapshot archive outside of a running cluster, calling
+// fn for each of the storage entries it contains, in key order. The hashes of
+// the archive are verified, but not the sealed hashes since that needs access
+// to the seal of the cluster the snapshot was taken from.
+func ReadSnapshot(logger log.Logger, in io.Reader, fn func(*pb.StorageEntry) error) (*raft.SnapshotMeta, error) {
+	var metadata raft.SnapshotMeta
+	snap, cleanup, err := snapshot.WriteToTempFile(logger, in, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// The temporary file is closed by the cleanup function
+	protoReader := NewDelimitedReader(snap, math.MaxInt32)
+
+	for {
+		entry := new(pb.StorageEntry)
+		err := protoReader.ReadMsg(entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return &metadata, nil
+}
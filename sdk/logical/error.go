@@ -36,6 +36,14 @@ var (
 	// ErrRateLimitQuotaExceeded is returned when a request is rejected due to a
 	// rate limit quota being exceeded.
 	ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+	// ErrRequestSizeQuotaExceeded is returned when a request is rejected due
+	// to its body exceeding a request size quota.
+	ErrRequestSizeQuotaExceeded = errors.New("request size quota exceeded")
+
+	// ErrResponseSizeQuotaExceeded is returned when a request is rejected due
+	// to its response exceeding a request size quota.
+	ErrResponseSizeQuotaExceeded = errors.New("response size quota exceeded")
 )
 
 type HTTPCodedError interface {
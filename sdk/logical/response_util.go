@@ -114,6 +114,10 @@ func RespondErrorCommon(req *Request, resp *Response, err error) (int, error) {
 			statusCode = http.StatusTooManyRequests
 		case errwrap.Contains(err, ErrLeaseCountQuotaExceeded.Error()):
 			statusCode = http.StatusTooManyRequests
+		case errwrap.Contains(err, ErrRequestSizeQuotaExceeded.Error()):
+			statusCode = http.StatusRequestEntityTooLarge
+		case errwrap.Contains(err, ErrResponseSizeQuotaExceeded.Error()):
+			statusCode = http.StatusRequestEntityTooLarge
 		}
 	}
 
@@ -145,6 +149,11 @@ func AdjustErrorStatusCode(status *int, err error) {
 		*status = http.StatusRequestEntityTooLarge
 	}
 
+	// Adjust status code when the request body exceeds a request size quota
+	if errwrap.Contains(err, ErrRequestSizeQuotaExceeded.Error()) {
+		*status = http.StatusRequestEntityTooLarge
+	}
+
 	// Allow HTTPCoded error passthrough to specify a code
 	if t, ok := err.(HTTPCodedError); ok {
 		*status = t.Code()
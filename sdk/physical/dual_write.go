@@ -0,0 +1,234 @@
+package physical
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/sdk/helper/locksutil"
+)
+
+// DualWrite is used to wrap an underlying physical backend during an online
+// migration to another backend. Reads are served by the primary backend, and
+// writes go to the primary then to the secondary backend if one is set, so
+// that the secondary stays in sync while the existing keys are copied to it
+// with Copy. The writes that fail on the secondary are only logged, the keys
+// are kept as pending until copied again.
+type DualWrite struct {
+	locks  []*locksutil.LockEntry
+	logger log.Logger
+
+	l         sync.RWMutex
+	primary   Backend
+	secondary Backend
+	pending   map[string]struct{}
+}
+
+// TransactionalDualWrite is a DualWrite that wraps a transactional backend
+type TransactionalDualWrite struct {
+	*DualWrite
+}
+
+// Verify DualWrite satisfies the correct interfaces
+var _ Backend = (*DualWrite)(nil)
+var _ Transactional = (*TransactionalDualWrite)(nil)
+
+// NewDualWrite returns a DualWrite reading from and writing to the given
+// backend, without any secondary backend
+func NewDualWrite(b Backend, logger log.Logger) *DualWrite {
+	return &DualWrite{
+		locks:   locksutil.CreateLocks(),
+		logger:  logger,
+		primary: b,
+		pending: make(map[string]struct{}),
+	}
+}
+
+// NewTransactionalDualWrite returns a TransactionalDualWrite wrapping the given
+// transactional backend. The secondary backend doesn't need to be
+// transactional, the operations of a transaction are then applied one by one.
+// A failed transaction on the secondary marks all of its keys as pending.
+func NewTransactionalDualWrite(b Backend, logger log.Logger) *TransactionalDualWrite {
+	return &TransactionalDualWrite{
+		DualWrite: NewDualWrite(b, logger),
+	}
+}
+
+// SetBackends sets the backend reads are served from and the backend writes
+// are duplicated to, nil to stop duplicating them. Swapping the backends once
+// the keys are copied moves the reads to the secondary backend while keeping
+// the former primary in sync. The pending keys are reset.
+func (d *DualWrite) SetBackends(primary, secondary Backend) {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	d.primary = primary
+	d.secondary = secondary
+	d.pending = make(map[string]struct{})
+}
+
+// Pending returns the keys whose last write to the secondary failed, sorted
+func (d *DualWrite) Pending() []string {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	keys := make([]string, 0, len(d.pending))
+	for key := range d.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Primary returns the backend reads are served from
+func (d *DualWrite) Primary() Backend {
+	d.l.RLock()
+	defer d.l.RUnlock()
+	return d.primary
+}
+
+func (d *DualWrite) backends() (Backend, Backend) {
+	d.l.RLock()
+	defer d.l.RUnlock()
+	return d.primary, d.secondary
+}
+
+// secondaryDone records the result of a write to the secondary backend
+func (d *DualWrite) secondaryDone(secondary Backend, key string, err error) {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	// The secondary changed in the meantime, this write is not relevant anymore
+	if secondary != d.secondary {
+		return
+	}
+
+	if err != nil {
+		d.logger.Error("failed to write to the secondary storage", "key", key, "error", err)
+		d.pending[key] = struct{}{}
+		return
+	}
+	delete(d.pending, key)
+}
+
+// Copy copies a key from the primary to the secondary backend, deleting it from
+// the secondary if it doesn't exist anymore. The key is locked, so that a write
+// happening concurrently isn't overwritten by the copy of a stale value.
+func (d *DualWrite) Copy(ctx context.Context, key string) error {
+	lock := locksutil.LockForKey(d.locks, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	primary, secondary := d.backends()
+	if secondary == nil {
+		return nil
+	}
+
+	entry, err := primary.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		err = secondary.Delete(ctx, key)
+	} else {
+		err = secondary.Put(ctx, entry)
+	}
+	d.secondaryDone(secondary, key, err)
+	return err
+}
+
+// Put writes the entry to the primary backend, then to the secondary one
+func (d *DualWrite) Put(ctx context.Context, entry *Entry) error {
+	lock := locksutil.LockForKey(d.locks, entry.Key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	primary, secondary := d.backends()
+	if err := primary.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	if secondary != nil {
+		d.secondaryDone(secondary, entry.Key, secondary.Put(ctx, entry))
+	}
+	return nil
+}
+
+// Get reads the entry from the primary backend
+func (d *DualWrite) Get(ctx context.Context, key string) (*Entry, error) {
+	return d.Primary().Get(ctx, key)
+}
+
+// Delete deletes the key from the primary backend, then from the secondary one
+func (d *DualWrite) Delete(ctx context.Context, key string) error {
+	lock := locksutil.LockForKey(d.locks, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	primary, secondary := d.backends()
+	if err := primary.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	if secondary != nil {
+		d.secondaryDone(secondary, key, secondary.Delete(ctx, key))
+	}
+	return nil
+}
+
+// List lists the keys of the primary backend
+func (d *DualWrite) List(ctx context.Context, prefix string) ([]string, error) {
+	return d.Primary().List(ctx, prefix)
+}
+
+// Transaction runs the transaction on the primary backend, then on the
+// secondary one
+func (d *TransactionalDualWrite) Transaction(ctx context.Context, txns []*TxnEntry) error {
+	keys := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		keys = append(keys, txn.Entry.Key)
+	}
+
+	// Lock the keys in a consistent order
+	for _, lock := range locksutil.LocksForKeys(d.locks, keys) {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	primary, secondary := d.backends()
+	if err := applyTransaction(ctx, primary, txns); err != nil {
+		return err
+	}
+
+	if secondary != nil {
+		err := applyTransaction(ctx, secondary, txns)
+		for _, key := range keys {
+			d.secondaryDone(secondary, key, err)
+		}
+	}
+	return nil
+}
+
+// applyTransaction runs a transaction on a backend, applying the operations one
+// by one if it isn't transactional
+func applyTransaction(ctx context.Context, b Backend, txns []*TxnEntry) error {
+	if txnBackend, ok := b.(Transactional); ok {
+		return txnBackend.Transaction(ctx, txns)
+	}
+
+	for _, txn := range txns {
+		var err error
+		switch txn.Operation {
+		case PutOperation:
+			err = b.Put(ctx, txn.Entry)
+		case DeleteOperation:
+			err = b.Delete(ctx, txn.Entry.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package inmem
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/sdk/helper/logging"
+	"github.com/quid/vault/sdk/physical"
+)
+
+func TestDualWrite(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+
+	inm, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dual := physical.NewDualWrite(inm, logger)
+	physical.ExerciseBackend(t, dual)
+	physical.ExerciseBackend_ListPrefix(t, dual)
+}
+
+func TestTransactionalDualWrite(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+
+	inm, err := NewTransactionalInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dual := physical.NewTransactionalDualWrite(inm, logger)
+	dual.SetBackends(inm, secondary)
+
+	physical.ExerciseTransactionalBackend(t, dual)
+
+	// The non-transactional secondary has the operations applied one by one
+	keys, err := secondary.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"foo", "zip"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: expected %v, got %v", expected, keys)
+	}
+}
+
+func TestDualWrite_Copy(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+	ctx := context.Background()
+
+	primary, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Written before the secondary is set, only copied
+	if err := primary.Put(ctx, &physical.Entry{Key: "existing", Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := secondary.Put(ctx, &physical.Entry{Key: "stale", Value: []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+
+	dual := physical.NewDualWrite(primary, logger)
+	dual.SetBackends(primary, secondary)
+
+	if err := dual.Put(ctx, &physical.Entry{Key: "new", Value: []byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := secondary.Get(ctx, "existing"); err != nil || entry != nil {
+		t.Fatalf("expected the existing key to not be written yet, got %v, %v", entry, err)
+	}
+
+	for _, key := range []string{"existing", "stale"} {
+		if err := dual.Copy(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := secondary.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"existing", "new"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: expected %v, got %v", expected, keys)
+	}
+
+	// Swapping the backends moves the reads, the former primary stays in sync
+	dual.SetBackends(secondary, primary)
+	if err := dual.Delete(ctx, "existing"); err != nil {
+		t.Fatal(err)
+	}
+	for _, backend := range []physical.Backend{primary, secondary} {
+		if entry, err := backend.Get(ctx, "existing"); err != nil || entry != nil {
+			t.Fatalf("expected the key to be deleted, got %v, %v", entry, err)
+		}
+	}
+}
+
+func TestDualWrite_Pending(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+	ctx := context.Background()
+
+	primary, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inm, err := NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary := physical.NewErrorInjector(inm, 100, logger)
+
+	dual := physical.NewDualWrite(primary, logger)
+	dual.SetBackends(primary, secondary)
+
+	// The write succeeds even though the secondary fails
+	if err := dual.Put(ctx, &physical.Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if pending := dual.Pending(); !reflect.DeepEqual(pending, []string{"foo"}) {
+		t.Fatalf("expected foo to be pending, got %v", pending)
+	}
+
+	if err := dual.Copy(ctx, "foo"); err == nil {
+		t.Fatal("expected the copy to fail")
+	}
+
+	secondary.SetErrorPercentage(0)
+	if err := dual.Copy(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if pending := dual.Pending(); len(pending) != 0 {
+		t.Fatalf("expected no pending keys, got %v", pending)
+	}
+	if entry, err := inm.Get(ctx, "foo"); err != nil || entry == nil {
+		t.Fatalf("expected foo to be copied, got %v, %v", entry, err)
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/armon/go-radix"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
 	"github.com/quid/vault/helper/identity"
 	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/cidrutil"
 	"github.com/quid/vault/sdk/helper/strutil"
 	"github.com/quid/vault/sdk/logical"
 	"github.com/mitchellh/copystructure"
@@ -55,6 +57,54 @@ type ACLResults struct {
 	MFAMethods         []string
 	ControlGroup       *ControlGroup
 	CapabilitiesBitmap uint32
+	FilterListResults  bool
+}
+
+// Reasons reported in an ACLExplanation when a request is rejected.
+const (
+	aclDeniedNoMatchingRule       = "no_matching_rule"
+	aclDeniedExplicitDeny         = "explicit_deny"
+	aclDeniedMissingCapability    = "missing_capability"
+	aclDeniedUnsupportedOperation = "unsupported_operation"
+	aclDeniedMaxWrappingTTL       = "max_wrapping_ttl"
+	aclDeniedMinWrappingTTL       = "min_wrapping_ttl"
+	aclDeniedWrappingTTLConflict  = "wrapping_ttl_conflict"
+	aclDeniedRequiredParameters   = "required_parameters"
+	aclDeniedDeniedParameters     = "denied_parameters"
+	aclDeniedAllowedParameters    = "allowed_parameters"
+	aclDeniedSourceCIDRs          = "source_cidrs"
+	aclDeniedTimeWindow           = "time_window"
+	aclDeniedRequiredHeaders      = "required_headers"
+)
+
+// Kinds of rules that can be selected when matching a request path.
+const (
+	aclMatchExact           = "exact"
+	aclMatchPrefix          = "prefix"
+	aclMatchSegmentWildcard = "segment-wildcard"
+)
+
+// ACLExplanation records how AllowOperation arrived at its decision. It is
+// only populated by ExplainOperation, which is used by the policy simulation
+// endpoint; the regular request path never pays for it.
+type ACLExplanation struct {
+	// MatchedPath is the policy path of the rule that was selected, including
+	// the trailing glob for prefix rules.
+	MatchedPath string
+
+	// MatchType is one of "exact", "prefix" or "segment-wildcard". It is empty
+	// if no rule matched.
+	MatchType string
+
+	// Permissions are the merged permissions of the selected rule.
+	Permissions *ACLPermissions
+
+	// DeniedBy names the check that rejected the request, if any.
+	DeniedBy string
+
+	// DeniedParameter is the request parameter that failed a parameter
+	// check, if any.
+	DeniedParameter string
 }
 
 // NewACL is used to construct a policy based ACL from a set of policies.
@@ -127,6 +177,13 @@ func NewACL(ctx context.Context, policies []*Policy) (*ACL, error) {
 				if err != nil {
 					return nil, errwrap.Wrapf("error cloning ACL permissions: {{err}}", err)
 				}
+				if len(clonedPerms.Conditions) > 0 {
+					clonedPerms.ConditionalGrants = []*ACLConditionalGrant{{
+						CapabilitiesBitmap: clonedPerms.CapabilitiesBitmap,
+						Conditions:         clonedPerms.Conditions,
+					}}
+					clonedPerms.Conditions = nil
+				}
 				switch {
 				case pc.HasSegmentWildcards:
 					a.segmentWildcardPaths[pc.Path] = clonedPerms
@@ -150,9 +207,25 @@ func NewACL(ctx context.Context, policies []*Policy) (*ACL, error) {
 				existingPerms.CapabilitiesBitmap = DenyCapabilityInt
 				existingPerms.AllowedParameters = nil
 				existingPerms.DeniedParameters = nil
+				existingPerms.ConditionalGrants = nil
+				existingPerms.UnconditionalBitmap = 0
 				goto INSERT
 
 			default:
+				// The conditions of a rule only gate the capabilities granted
+				// by that rule, so rules with conditions are kept apart
+				if len(existingPerms.ConditionalGrants) == 0 {
+					existingPerms.UnconditionalBitmap = existingPerms.CapabilitiesBitmap
+				}
+				if len(pc.Permissions.Conditions) > 0 {
+					existingPerms.ConditionalGrants = append(existingPerms.ConditionalGrants, &ACLConditionalGrant{
+						CapabilitiesBitmap: pc.Permissions.CapabilitiesBitmap,
+						Conditions:         pc.Permissions.Conditions,
+					})
+				} else {
+					existingPerms.UnconditionalBitmap = existingPerms.UnconditionalBitmap | pc.Permissions.CapabilitiesBitmap
+				}
+
 				// Insert the capabilities in this new policy into the existing
 				// value
 				existingPerms.CapabilitiesBitmap = existingPerms.CapabilitiesBitmap | pc.Permissions.CapabilitiesBitmap
@@ -260,6 +333,11 @@ func NewACL(ctx context.Context, policies []*Policy) (*ACL, error) {
 				}
 			}
 
+			// Any policy asking for list results to be filtered is enough
+			if pc.Permissions.FilterListResults {
+				existingPerms.FilterListResults = true
+			}
+
 		INSERT:
 			switch {
 			case pc.HasSegmentWildcards:
@@ -285,8 +363,44 @@ func (a *ACL) Capabilities(ctx context.Context, path string) (pathCapabilities [
 		return []string{RootCapability}
 	}
 
-	capabilities := res.CapabilitiesBitmap
+	return capabilitiesFromBitmap(res.CapabilitiesBitmap)
+}
 
+// FilterListKeys returns the keys of the response to the given list request
+// that the ACL grants read on. Keys naming a directory are also kept if the
+// ACL grants list on them. Capabilities granted by rules with conditions are
+// only taken into account if the list request satisfies the conditions.
+func (a *ACL) FilterListKeys(ctx context.Context, req *logical.Request, keys []string) []string {
+	path := req.Path
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	filtered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res := a.AllowOperation(ctx, &logical.Request{
+			Path: path + key,
+			// Use List to trigger the same fallback behavior as Capabilities
+			Operation:  logical.ListOperation,
+			Connection: req.Connection,
+			Headers:    req.Headers,
+		}, true)
+		capabilities := res.CapabilitiesBitmap
+		switch {
+		case res.IsRoot:
+			filtered = append(filtered, key)
+		case capabilities&DenyCapabilityInt > 0:
+		case capabilities&ReadCapabilityInt > 0,
+			strings.HasSuffix(key, "/") && capabilities&ListCapabilityInt > 0:
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+// capabilitiesFromBitmap converts a capabilities bitmap into the list of
+// capability names it represents.
+func capabilitiesFromBitmap(capabilities uint32) (pathCapabilities []string) {
 	if capabilities&SudoCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, SudoCapability)
 	}
@@ -316,8 +430,34 @@ func (a *ACL) Capabilities(ctx context.Context, path string) (pathCapabilities [
 
 // AllowOperation is used to check if the given operation is permitted.
 func (a *ACL) AllowOperation(ctx context.Context, req *logical.Request, capCheckOnly bool) (ret *ACLResults) {
+	return a.allowOperation(ctx, req, capCheckOnly, nil)
+}
+
+// ExplainOperation performs the same checks as AllowOperation and
+// additionally reports which rule was selected and which check, if any,
+// rejected the request.
+func (a *ACL) ExplainOperation(ctx context.Context, req *logical.Request) (*ACLResults, *ACLExplanation) {
+	explain := new(ACLExplanation)
+	return a.allowOperation(ctx, req, false, explain), explain
+}
+
+func (a *ACL) allowOperation(ctx context.Context, req *logical.Request, capCheckOnly bool, explain *ACLExplanation) (ret *ACLResults) {
 	ret = new(ACLResults)
 
+	denied := func(reason, parameter string) {
+		if explain != nil {
+			explain.DeniedBy = reason
+			explain.DeniedParameter = parameter
+		}
+	}
+	matched := func(matchType, matchedPath string, permissions *ACLPermissions) {
+		if explain != nil {
+			explain.MatchType = matchType
+			explain.MatchedPath = matchedPath
+			explain.Permissions = permissions
+		}
+	}
+
 	// Fast-path root
 	if a.root {
 		ret.Allowed = true
@@ -353,10 +493,12 @@ func (a *ACL) AllowOperation(ctx context.Context, req *logical.Request, capCheck
 
 	// Find an exact matching rule, look for prefix if no match
 	var capabilities uint32
+	var pd wcPathDescr
 	raw, ok := a.exactRules.Get(path)
 	if ok {
 		permissions = raw.(*ACLPermissions)
 		capabilities = permissions.CapabilitiesBitmap
+		matched(aclMatchExact, path, permissions)
 		goto CHECK
 	}
 	if op == logical.ListOperation {
@@ -364,21 +506,41 @@ func (a *ACL) AllowOperation(ctx context.Context, req *logical.Request, capCheck
 		if ok {
 			permissions = raw.(*ACLPermissions)
 			capabilities = permissions.CapabilitiesBitmap
+			matched(aclMatchExact, strings.TrimSuffix(path, "/"), permissions)
 			goto CHECK
 		}
 	}
 
-	permissions = a.CheckAllowedFromNonExactPaths(path, false)
-	if permissions != nil {
+	pd, ok = a.checkAllowedFromNonExactPaths(path, false)
+	if ok {
+		permissions = pd.perms
 		capabilities = permissions.CapabilitiesBitmap
+		if explain != nil {
+			matchType, matchedPath := aclMatchPrefix, pd.wcPath
+			if pd.segmentWildcard {
+				matchType = aclMatchSegmentWildcard
+			}
+			if pd.isPrefix {
+				matchedPath += "*"
+			}
+			matched(matchType, matchedPath, permissions)
+		}
 		goto CHECK
 	}
 
 	// No exact, prefix, or segment wildcard paths found, return without
 	// setting allowed
+	denied(aclDeniedNoMatchingRule, "")
 	return
 
 CHECK:
+	// Capabilities granted by rules with conditions only apply if the
+	// request satisfies the conditions of the rule
+	var conditionReason, conditionHeader string
+	if len(permissions.ConditionalGrants) > 0 {
+		capabilities, conditionReason, conditionHeader = permissions.grantedCapabilities(req, op, time.Now())
+	}
+
 	// Check if the minimum permissions are met
 	// If "deny" has been explicitly set, only deny will be in the map, so we
 	// only need to check for the existence of other values
@@ -393,6 +555,7 @@ CHECK:
 
 	ret.MFAMethods = permissions.MFAMethods
 	ret.ControlGroup = permissions.ControlGroup
+	ret.FilterListResults = permissions.FilterListResults
 
 	operationAllowed := false
 	switch op {
@@ -413,20 +576,31 @@ CHECK:
 		operationAllowed = capabilities&UpdateCapabilityInt > 0
 
 	default:
+		denied(aclDeniedUnsupportedOperation, "")
 		return
 	}
 
 	if !operationAllowed {
+		switch {
+		case capabilities&DenyCapabilityInt > 0:
+			denied(aclDeniedExplicitDeny, "")
+		case conditionReason != "":
+			denied(conditionReason, conditionHeader)
+		default:
+			denied(aclDeniedMissingCapability, "")
+		}
 		return
 	}
 
 	if permissions.MaxWrappingTTL > 0 {
 		if req.WrapInfo == nil || req.WrapInfo.TTL > permissions.MaxWrappingTTL {
+			denied(aclDeniedMaxWrappingTTL, "")
 			return
 		}
 	}
 	if permissions.MinWrappingTTL > 0 {
 		if req.WrapInfo == nil || req.WrapInfo.TTL < permissions.MinWrappingTTL {
+			denied(aclDeniedMinWrappingTTL, "")
 			return
 		}
 	}
@@ -435,6 +609,7 @@ CHECK:
 	if permissions.MinWrappingTTL != 0 &&
 		permissions.MaxWrappingTTL != 0 &&
 		permissions.MaxWrappingTTL < permissions.MinWrappingTTL {
+		denied(aclDeniedWrappingTTLConflict, "")
 		return
 	}
 
@@ -443,6 +618,7 @@ CHECK:
 	if op == logical.ReadOperation || op == logical.UpdateOperation || op == logical.CreateOperation {
 		for _, parameter := range permissions.RequiredParameters {
 			if _, ok := req.Data[strings.ToLower(parameter)]; !ok {
+				denied(aclDeniedRequiredParameters, parameter)
 				return
 			}
 		}
@@ -459,6 +635,7 @@ CHECK:
 
 		// Check if all parameters have been denied
 		if _, ok := permissions.DeniedParameters["*"]; ok {
+			denied(aclDeniedDeniedParameters, "*")
 			return
 		}
 
@@ -467,6 +644,7 @@ CHECK:
 			if valueSlice, ok := permissions.DeniedParameters[strings.ToLower(parameter)]; ok {
 				// If the value exists in denied values slice, deny
 				if valueInParameterList(value, valueSlice) {
+					denied(aclDeniedDeniedParameters, parameter)
 					return
 				}
 			}
@@ -489,12 +667,14 @@ CHECK:
 			valueSlice, ok := permissions.AllowedParameters[strings.ToLower(parameter)]
 			// Requested parameter is not in allowed list
 			if !ok && !allowedAll {
+				denied(aclDeniedAllowedParameters, parameter)
 				return
 			}
 
 			// If the value doesn't exists in the allowed values slice,
 			// deny
 			if ok && !valueInParameterList(value, valueSlice) {
+				denied(aclDeniedAllowedParameters, parameter)
 				return
 			}
 		}
@@ -504,12 +684,136 @@ CHECK:
 	return
 }
 
+// grantedCapabilities returns the capabilities of the merged permissions that
+// apply to the request: the unconditional ones and those of the conditional
+// grants whose conditions hold. If a grant that would have allowed the
+// operation is not applied, the unsatisfied condition is also returned.
+func (p *ACLPermissions) grantedCapabilities(req *logical.Request, op logical.Operation, now time.Time) (uint32, string, string) {
+	var opCapability uint32
+	switch op {
+	case logical.ReadOperation:
+		opCapability = ReadCapabilityInt
+	case logical.ListOperation:
+		opCapability = ListCapabilityInt
+	case logical.DeleteOperation:
+		opCapability = DeleteCapabilityInt
+	case logical.CreateOperation:
+		opCapability = CreateCapabilityInt
+	case logical.UpdateOperation, logical.RevokeOperation, logical.RenewOperation, logical.RollbackOperation:
+		opCapability = UpdateCapabilityInt
+	}
+
+	capabilities := p.UnconditionalBitmap
+	var reason, header string
+	for _, grant := range p.ConditionalGrants {
+		grantReason, grantHeader := checkPathConditions(grant.Conditions, req, now)
+		switch {
+		case grantReason == "":
+			capabilities = capabilities | grant.CapabilitiesBitmap
+		case reason == "" && grant.CapabilitiesBitmap&opCapability > 0:
+			reason, header = grantReason, grantHeader
+		}
+	}
+	return capabilities, reason, header
+}
+
+// checkPathConditions evaluates the conditions of a path rule against the
+// request. It returns the name of the first condition that is not satisfied,
+// along with the offending header for header conditions, or an empty string
+// if all conditions hold.
+func checkPathConditions(conditions []*PathConditions, req *logical.Request, now time.Time) (string, string) {
+	for _, cond := range conditions {
+		if len(cond.SourceCIDRs) > 0 {
+			var remoteAddr string
+			if req.Connection != nil {
+				remoteAddr = req.Connection.RemoteAddr
+			}
+			if !cidrutil.RemoteAddrIsOk(remoteAddr, cond.SourceCIDRs) {
+				return aclDeniedSourceCIDRs, ""
+			}
+		}
+
+		if len(cond.TimeWindows) > 0 {
+			inWindow := false
+			for _, window := range cond.TimeWindows {
+				if window.contains(now) {
+					inWindow = true
+					break
+				}
+			}
+			if !inWindow {
+				return aclDeniedTimeWindow, ""
+			}
+		}
+
+		for header, allowed := range cond.RequiredHeaders {
+			values := req.Headers[header]
+			if len(values) == 0 {
+				return aclDeniedRequiredHeaders, header
+			}
+			if len(allowed) == 0 {
+				continue
+			}
+
+			found := false
+			for _, value := range values {
+				for _, item := range allowed {
+					if strutil.GlobbedStringsMatch(item, value) {
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				return aclDeniedRequiredHeaders, header
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// contains returns whether the given instant falls within the window. For
+// windows that span midnight, the part after midnight belongs to the day on
+// which the window started.
+func (w *TimeWindow) contains(now time.Time) bool {
+	local := now.In(w.Location)
+	offset := time.Duration(local.Hour())*time.Hour +
+		time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second
+
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End && w.onDay(local.Weekday())
+	}
+
+	switch {
+	case offset >= w.Start:
+		return w.onDay(local.Weekday())
+	case offset < w.End:
+		return w.onDay((local.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func (w *TimeWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
 type wcPathDescr struct {
-	firstWCOrGlob int
-	wildcards     int
-	isPrefix      bool
-	wcPath        string
-	perms         *ACLPermissions
+	firstWCOrGlob   int
+	wildcards       int
+	isPrefix        bool
+	segmentWildcard bool
+	wcPath          string
+	perms           *ACLPermissions
 }
 
 // CheckAllowedFromNonExactPaths returns permissions corresponding to a
@@ -518,6 +822,17 @@ type wcPathDescr struct {
 // of permissions from some allowed path underneath the mount (for use in mount
 // access checks), or nil indicating no non-deny permissions were found.
 func (a *ACL) CheckAllowedFromNonExactPaths(path string, bareMount bool) *ACLPermissions {
+	pd, ok := a.checkAllowedFromNonExactPaths(path, bareMount)
+	if !ok {
+		return nil
+	}
+	return pd.perms
+}
+
+// checkAllowedFromNonExactPaths performs the work of
+// CheckAllowedFromNonExactPaths, returning a description of the rule that was
+// selected rather than only its permissions.
+func (a *ACL) checkAllowedFromNonExactPaths(path string, bareMount bool) (wcPathDescr, bool) {
 	wcPathDescrs := make([]wcPathDescr, 0, len(a.segmentWildcardPaths)+1)
 
 	less := func(i, j int) bool {
@@ -580,20 +895,21 @@ func (a *ACL) CheckAllowedFromNonExactPaths(path string, bareMount bool) *ACLPer
 	{
 		prefix, raw, ok := a.prefixRules.LongestPrefix(path)
 		if ok {
-			if len(a.segmentWildcardPaths) == 0 {
-				return raw.(*ACLPermissions)
-			}
-			wcPathDescrs = append(wcPathDescrs, wcPathDescr{
+			pd := wcPathDescr{
 				firstWCOrGlob: len(prefix),
 				wcPath:        prefix,
 				isPrefix:      true,
 				perms:         raw.(*ACLPermissions),
-			})
+			}
+			if len(a.segmentWildcardPaths) == 0 {
+				return pd, true
+			}
+			wcPathDescrs = append(wcPathDescrs, pd)
 		}
 	}
 
 	if len(a.segmentWildcardPaths) == 0 {
-		return nil
+		return wcPathDescr{}, false
 	}
 
 	pathParts := strings.Split(path, "/")
@@ -603,7 +919,10 @@ SWCPATH:
 		if fullWCPath == "" {
 			continue
 		}
-		pd := wcPathDescr{firstWCOrGlob: strings.Index(fullWCPath, "+")}
+		pd := wcPathDescr{
+			firstWCOrGlob:   strings.Index(fullWCPath, "+"),
+			segmentWildcard: true,
+		}
 
 		currWCPath := fullWCPath
 		if currWCPath[len(currWCPath)-1] == '*' {
@@ -649,7 +968,8 @@ SWCPATH:
 				if strings.HasPrefix(joinedPath, path) {
 					permissions := a.segmentWildcardPaths[fullWCPath].(*ACLPermissions)
 					if permissions.CapabilitiesBitmap&DenyCapabilityInt == 0 && permissions.CapabilitiesBitmap > 0 {
-						return permissions
+						pd.perms = permissions
+						return pd, true
 					}
 				}
 				continue SWCPATH
@@ -660,14 +980,14 @@ SWCPATH:
 	}
 
 	if bareMount || len(wcPathDescrs) == 0 {
-		return nil
+		return wcPathDescr{}, false
 	}
 
 	// We don't do this in the bare mount check because we don't care about
 	// priority, we only care about any capability at all.
 	sort.Slice(wcPathDescrs, less)
 
-	return wcPathDescrs[len(wcPathDescrs)-1].perms
+	return wcPathDescrs[len(wcPathDescrs)-1], true
 }
 
 func (c *Core) performPolicyChecks(ctx context.Context, acl *ACL, te *logical.TokenEntry, req *logical.Request, inEntity *identity.Entity, opts *PolicyCheckOpts) *AuthResults {
@@ -691,6 +1011,24 @@ func (c *Core) performPolicyChecks(ctx context.Context, acl *ACL, te *logical.To
 		if !ret.RootPrivs && opts.RootPrivsRequired {
 			return ret
 		}
+		// Paths that list MFA methods require the credentials for each of them
+		// to be supplied with the request. Requests replayed after control
+		// group approval were already checked when they were first made.
+		if len(ret.ACLResults.MFAMethods) > 0 && (req.ControlGroup == nil || !req.ControlGroup.Approved) {
+			if err := c.validateMFA(ctx, req, inEntity, ret.ACLResults.MFAMethods); err != nil {
+				ret.Error = multierror.Append(ret.Error, err)
+				ret.DeniedError = true
+				return ret
+			}
+		}
+		// Requests governed by a control group are held until they have been
+		// approved; they are then run again with the approval attached
+		if ret.ACLResults.ControlGroup != nil && (req.ControlGroup == nil || !req.ControlGroup.Approved) {
+			ret.Error = multierror.Append(ret.Error, &controlGroupError{
+				controlGroup: ret.ACLResults.ControlGroup,
+			})
+			return ret
+		}
 	}
 
 	c.performEntPolicyChecks(ctx, acl, te, req, inEntity, opts, ret)
@@ -512,6 +512,275 @@ func testACLAllowOperation(t *testing.T, ns *namespace.Namespace) {
 	}
 }
 
+func TestACL_ExplainOperation(t *testing.T) {
+	ns := namespace.RootNamespace
+	ctx := namespace.ContextWithNamespace(context.Background(), ns)
+
+	policy, err := ParseACLPolicy(ns, `
+path "secret/exact" {
+	capabilities = ["read"]
+}
+path "secret/prefix/*" {
+	capabilities = ["create", "update"]
+	allowed_parameters = {
+		"ttl" = ["1h"]
+	}
+}
+path "secret/+/wild" {
+	capabilities = ["deny"]
+}
+path "secret/req" {
+	capabilities = ["update"]
+	required_parameters = ["name"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := NewACL(ctx, []*Policy{policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcases := []struct {
+		path            string
+		op              logical.Operation
+		data            map[string]interface{}
+		allowed         bool
+		matchedPath     string
+		matchType       string
+		deniedBy        string
+		deniedParameter string
+	}{
+		{"secret/exact", logical.ReadOperation, nil, true, "secret/exact", aclMatchExact, "", ""},
+		{"secret/exact", logical.UpdateOperation, nil, false, "secret/exact", aclMatchExact, aclDeniedMissingCapability, ""},
+		{"secret/prefix/a", logical.UpdateOperation, map[string]interface{}{"ttl": "1h"}, true, "secret/prefix/*", aclMatchPrefix, "", ""},
+		{"secret/prefix/a", logical.UpdateOperation, map[string]interface{}{"ttl": "2h"}, false, "secret/prefix/*", aclMatchPrefix, aclDeniedAllowedParameters, "ttl"},
+		{"secret/foo/wild", logical.ReadOperation, nil, false, "secret/+/wild", aclMatchSegmentWildcard, aclDeniedExplicitDeny, ""},
+		{"secret/req", logical.UpdateOperation, map[string]interface{}{"foo": "bar"}, false, "secret/req", aclMatchExact, aclDeniedRequiredParameters, "name"},
+		{"other/path", logical.ReadOperation, nil, false, "", "", aclDeniedNoMatchingRule, ""},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Path:      tc.path,
+			Operation: tc.op,
+			Data:      tc.data,
+		}
+		results, explanation := acl.ExplainOperation(ctx, req)
+		if results.Allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: allowed %v", tc, results.Allowed)
+		}
+		if explanation.MatchedPath != tc.matchedPath || explanation.MatchType != tc.matchType {
+			t.Fatalf("bad: case %#v: matched %q (%s)", tc, explanation.MatchedPath, explanation.MatchType)
+		}
+		if explanation.DeniedBy != tc.deniedBy || explanation.DeniedParameter != tc.deniedParameter {
+			t.Fatalf("bad: case %#v: denied by %q (%q)", tc, explanation.DeniedBy, explanation.DeniedParameter)
+		}
+
+		// The explanation must never change the decision
+		if acl.AllowOperation(ctx, req, false).Allowed != results.Allowed {
+			t.Fatalf("bad: case %#v: AllowOperation disagrees", tc)
+		}
+	}
+}
+
+func TestACL_Conditions(t *testing.T) {
+	ns := namespace.RootNamespace
+	ctx := namespace.ContextWithNamespace(context.Background(), ns)
+
+	deploy, err := ParseACLPolicy(ns, `
+path "secret/prod/*" {
+	capabilities = ["update"]
+	conditions {
+		source_cidrs = ["10.20.0.0/16"]
+		required_headers = {
+			"X-Deploy-Id" = ["deploy-*"]
+		}
+	}
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := ParseACLPolicy(ns, `
+path "secret/prod/*" {
+	capabilities = ["read"]
+	conditions {
+		source_cidrs = ["10.0.0.0/8"]
+	}
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := NewACL(ctx, []*Policy{deploy, ops})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcases := []struct {
+		remoteAddr string
+		headers    map[string][]string
+		allowed    bool
+		deniedBy   string
+	}{
+		{"10.20.1.5", map[string][]string{"X-Deploy-Id": {"deploy-42"}}, true, ""},
+		{"10.30.1.5", map[string][]string{"X-Deploy-Id": {"deploy-42"}}, false, aclDeniedSourceCIDRs},
+		{"", map[string][]string{"X-Deploy-Id": {"deploy-42"}}, false, aclDeniedSourceCIDRs},
+		{"10.20.1.5", nil, false, aclDeniedRequiredHeaders},
+		{"10.20.1.5", map[string][]string{"X-Deploy-Id": {"manual"}}, false, aclDeniedRequiredHeaders},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Path:      "secret/prod/app",
+			Operation: logical.UpdateOperation,
+			Headers:   tc.headers,
+		}
+		if tc.remoteAddr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: tc.remoteAddr}
+		}
+		results, explanation := acl.ExplainOperation(ctx, req)
+		if results.Allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: allowed %v", tc, results.Allowed)
+		}
+		if explanation.DeniedBy != tc.deniedBy {
+			t.Fatalf("bad: case %#v: denied by %q", tc, explanation.DeniedBy)
+		}
+	}
+}
+
+func TestACL_ConditionsMerged(t *testing.T) {
+	ns := namespace.RootNamespace
+	ctx := namespace.ContextWithNamespace(context.Background(), ns)
+
+	conditional, err := ParseACLPolicy(ns, `
+path "secret/shared/*" {
+	capabilities = ["update"]
+	conditions {
+		source_cidrs = ["10.20.0.0/16"]
+	}
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unconditional, err := ParseACLPolicy(ns, `
+path "secret/shared/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The order the policies are merged in must not matter
+	for _, policies := range [][]*Policy{{conditional, unconditional}, {unconditional, conditional}} {
+		acl, err := NewACL(ctx, policies)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tcases := []struct {
+			op         logical.Operation
+			remoteAddr string
+			allowed    bool
+			deniedBy   string
+		}{
+			// The conditions only gate the capabilities of their own rule
+			{logical.ReadOperation, "10.30.1.5", true, ""},
+			{logical.ReadOperation, "10.20.1.5", true, ""},
+			{logical.UpdateOperation, "10.20.1.5", true, ""},
+			{logical.UpdateOperation, "10.30.1.5", false, aclDeniedSourceCIDRs},
+			{logical.DeleteOperation, "10.20.1.5", false, aclDeniedMissingCapability},
+		}
+
+		for _, tc := range tcases {
+			req := &logical.Request{
+				Path:       "secret/shared/app",
+				Operation:  tc.op,
+				Connection: &logical.Connection{RemoteAddr: tc.remoteAddr},
+			}
+			results, explanation := acl.ExplainOperation(ctx, req)
+			if results.Allowed != tc.allowed {
+				t.Fatalf("bad: case %#v: allowed %v", tc, results.Allowed)
+			}
+			if explanation.DeniedBy != tc.deniedBy {
+				t.Fatalf("bad: case %#v: denied by %q", tc, explanation.DeniedBy)
+			}
+		}
+	}
+}
+
+func TestACL_TimeWindow(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	businessHours := &TimeWindow{
+		Location: ny,
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    9 * time.Hour,
+		End:      17 * time.Hour,
+	}
+	overnight := &TimeWindow{
+		Location: time.UTC,
+		Days:     []time.Weekday{time.Friday},
+		Start:    22 * time.Hour,
+		End:      2 * time.Hour,
+	}
+
+	tcases := []struct {
+		window   *TimeWindow
+		now      time.Time
+		expected bool
+	}{
+		// Monday 10:00 in New York
+		{businessHours, time.Date(2020, 6, 1, 14, 0, 0, 0, time.UTC), true},
+		// Monday 08:59 in New York
+		{businessHours, time.Date(2020, 6, 1, 12, 59, 0, 0, time.UTC), false},
+		// Monday 17:00 in New York
+		{businessHours, time.Date(2020, 6, 1, 21, 0, 0, 0, time.UTC), false},
+		// Sunday 10:00 in New York
+		{businessHours, time.Date(2020, 5, 31, 14, 0, 0, 0, time.UTC), false},
+		// Friday 23:00
+		{overnight, time.Date(2020, 6, 5, 23, 0, 0, 0, time.UTC), true},
+		// Saturday 01:00, still part of Friday's window
+		{overnight, time.Date(2020, 6, 6, 1, 0, 0, 0, time.UTC), true},
+		// Friday 01:00, part of Thursday's window
+		{overnight, time.Date(2020, 6, 5, 1, 0, 0, 0, time.UTC), false},
+		// Saturday 03:00
+		{overnight, time.Date(2020, 6, 6, 3, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tc := range tcases {
+		if actual := tc.window.contains(tc.now); actual != tc.expected {
+			t.Fatalf("bad: %s: expected %v, got %v", tc.now, tc.expected, actual)
+		}
+	}
+
+	perms := &ACLPermissions{
+		CapabilitiesBitmap: ReadCapabilityInt,
+		ConditionalGrants: []*ACLConditionalGrant{{
+			CapabilitiesBitmap: ReadCapabilityInt,
+			Conditions: []*PathConditions{
+				{TimeWindows: []*TimeWindow{businessHours, overnight}},
+			},
+		}},
+	}
+	req := &logical.Request{Path: "secret/foo", Operation: logical.ReadOperation}
+	capabilities, reason, _ := perms.grantedCapabilities(req, logical.ReadOperation, time.Date(2020, 6, 6, 1, 0, 0, 0, time.UTC))
+	if capabilities != ReadCapabilityInt || reason != "" {
+		t.Fatalf("expected overnight window to match, got %d, %q", capabilities, reason)
+	}
+	capabilities, reason, _ = perms.grantedCapabilities(req, logical.ReadOperation, time.Date(2020, 6, 6, 14, 0, 0, 0, time.UTC))
+	if capabilities != 0 || reason != aclDeniedTimeWindow {
+		t.Fatalf("expected time window denial, got %d, %q", capabilities, reason)
+	}
+}
+
 func TestACL_ValuePermissions(t *testing.T) {
 	t.Run("root-ns", func(t *testing.T) {
 		t.Parallel()
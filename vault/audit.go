@@ -67,6 +67,12 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 		}
 	}
 
+	// Filtered devices may skip any request, so an unfiltered device has to
+	// be there to log all of them
+	if entry.AuditFilter != nil && !hasUnfilteredAuditEntry(c.audit.Entries) {
+		return fmt.Errorf("a filtered audit device requires an unfiltered audit device to be enabled first")
+	}
+
 	// Generate a new UUID and view
 	if entry.UUID == "" {
 		entryUUID, err := uuid.GenerateUUID()
@@ -121,7 +127,7 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view, entry.Local)
+	c.auditBroker.Register(entry.Path, backend, view, entry.Local, entry.AuditFilter)
 	if c.logger.IsInfo() {
 		c.logger.Info("enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -156,6 +162,15 @@ func (c *Core) disableAudit(ctx context.Context, path string, updateStorage bool
 		return false, fmt.Errorf("no matching backend")
 	}
 
+	// The last unfiltered device can't go while filtered devices rely on it
+	if entry.AuditFilter == nil && !hasUnfilteredAuditEntry(newTable.Entries) {
+		for _, ent := range newTable.Entries {
+			if ent.AuditFilter != nil {
+				return true, fmt.Errorf("cannot disable the last unfiltered audit device while filtered audit device %q is enabled", ent.Path)
+			}
+		}
+	}
+
 	c.removeAuditReloadFunc(entry)
 
 	// When unmounting all entries the JSON code will load back up from storage
@@ -384,7 +399,7 @@ func (c *Core) setupAudits(ctx context.Context) error {
 		}
 
 		// Mount the backend
-		broker.Register(entry.Path, backend, view, entry.Local)
+		broker.Register(entry.Path, backend, view, entry.Local, entry.AuditFilter)
 
 		successCount++
 	}
@@ -410,6 +425,10 @@ func (c *Core) teardownAudits() error {
 		}
 	}
 
+	if c.auditBroker != nil {
+		c.auditBroker.Close()
+	}
+
 	c.audit = nil
 	c.auditBroker = nil
 	return nil
@@ -17,6 +17,7 @@ type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
 	local   bool
+	filter  *AuditFilter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -36,22 +37,55 @@ func NewAuditBroker(log log.Logger) *AuditBroker {
 	return b
 }
 
-// Register is used to add new audit backend to the broker
-func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool) {
+// Register is used to add new audit backend to the broker. A backend with a
+// filter only logs the requests and responses that pass it.
+func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool, filter *AuditFilter) {
 	a.Lock()
 	defer a.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
 		local:   local,
+		filter:  filter,
 	}
 }
 
-// Deregister is used to remove an audit backend from the broker
+// Deregister is used to remove an audit backend from the broker. The backend
+// is closed if it holds entries in memory.
 func (a *AuditBroker) Deregister(name string) {
 	a.Lock()
-	defer a.Unlock()
+	be, ok := a.backends[name]
 	delete(a.backends, name)
+	a.Unlock()
+
+	if ok {
+		a.closeBackend(name, be.backend)
+	}
+}
+
+// Close closes the backends that hold entries in memory, before the broker
+// is dropped when Vault is sealed
+func (a *AuditBroker) Close() {
+	a.RLock()
+	backends := make(map[string]audit.Backend, len(a.backends))
+	for name, be := range a.backends {
+		backends[name] = be.backend
+	}
+	a.RUnlock()
+
+	for name, b := range backends {
+		a.closeBackend(name, b)
+	}
+}
+
+func (a *AuditBroker) closeBackend(name string, b audit.Backend) {
+	closer, ok := b.(audit.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		a.logger.Error("failed to close audit backend", "backend", name, "error", err)
+	}
 }
 
 // IsRegistered is used to check if a given audit backend is registered
@@ -120,9 +154,17 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs. Filtered backends are best-effort, so
+	// it must be one without a filter.
 	anyLogged := false
+	unfiltered := 0
 	for name, be := range a.backends {
+		if be.filter == nil {
+			unfiltered++
+		} else if !be.filter.matches(ctx, in, false) {
+			continue
+		}
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -136,11 +178,11 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 		metrics.MeasureSince([]string{"audit", name, "log_request"}, start)
 		if lrErr != nil {
 			a.logger.Error("backend failed to log request", "backend", name, "error", lrErr)
-		} else {
+		} else if be.filter == nil {
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && unfiltered > 0 {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
 	}
 
@@ -176,9 +218,17 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		in.Request.Headers = headers
 	}()
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs. Filtered backends are best-effort, so
+	// it must be one without a filter.
 	anyLogged := false
+	unfiltered := 0
 	for name, be := range a.backends {
+		if be.filter == nil {
+			unfiltered++
+		} else if !be.filter.matches(ctx, in, true) {
+			continue
+		}
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -192,11 +242,11 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 		metrics.MeasureSince([]string{"audit", name, "log_response"}, start)
 		if lrErr != nil {
 			a.logger.Error("backend failed to log response", "backend", name, "error", lrErr)
-		} else {
+		} else if be.filter == nil {
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && unfiltered > 0 {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the response"))
 	}
 
@@ -0,0 +1,182 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/parseutil"
+	"github.com/quid/vault/sdk/helper/strutil"
+	"github.com/quid/vault/sdk/logical"
+)
+
+// AuditFilter restricts the requests and responses an audit device logs. An
+// entry is logged when it matches every criteria that is set; a criteria
+// holding several values matches when any of them does.
+type AuditFilter struct {
+	// MountPaths are the path prefixes of the requests to log, relative to
+	// their namespace
+	MountPaths []string `json:"mount_paths,omitempty" structs:"mount_paths" mapstructure:"mount_paths"`
+
+	// Operations are the operations of the requests to log
+	Operations []string `json:"operations,omitempty" structs:"operations" mapstructure:"operations"`
+
+	// Namespaces are the paths of the namespaces of the requests to log. The
+	// root namespace is specified as "root".
+	Namespaces []string `json:"namespaces,omitempty" structs:"namespaces" mapstructure:"namespaces"`
+
+	// AuthMethods are the paths of the auth methods whose tokens, or login
+	// requests, are logged
+	AuthMethods []string `json:"auth_methods,omitempty" structs:"auth_methods" mapstructure:"auth_methods"`
+
+	// ErrorsOnly only logs the requests that failed and the responses that
+	// are errors
+	ErrorsOnly bool `json:"errors_only,omitempty" structs:"errors_only" mapstructure:"errors_only"`
+}
+
+// parseAuditFilter builds an audit filter from the filter parameter of an
+// audit device. A nil filter is returned if no criteria is set.
+func parseAuditFilter(raw map[string]interface{}) (*AuditFilter, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	filter := new(AuditFilter)
+	for key, value := range raw {
+		var err error
+		switch key {
+		case "mount_paths":
+			filter.MountPaths, err = parseutil.ParseCommaStringSlice(value)
+		case "operations":
+			filter.Operations, err = parseutil.ParseCommaStringSlice(value)
+		case "namespaces":
+			filter.Namespaces, err = parseutil.ParseCommaStringSlice(value)
+		case "auth_methods":
+			filter.AuthMethods, err = parseutil.ParseCommaStringSlice(value)
+		case "errors_only":
+			filter.ErrorsOnly, err = parseutil.ParseBool(value)
+		default:
+			return nil, fmt.Errorf("unknown audit filter criteria %q", key)
+		}
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("invalid audit filter criteria %q: {{err}}", key), err)
+		}
+	}
+
+	for i, op := range filter.Operations {
+		op = strings.ToLower(strings.TrimSpace(op))
+		switch logical.Operation(op) {
+		case logical.CreateOperation, logical.ReadOperation, logical.UpdateOperation,
+			logical.DeleteOperation, logical.ListOperation, logical.HelpOperation,
+			logical.AliasLookaheadOperation:
+		default:
+			return nil, fmt.Errorf("unknown operation %q in audit filter", op)
+		}
+		filter.Operations[i] = op
+	}
+
+	for i, ns := range filter.Namespaces {
+		if ns != "root" {
+			filter.Namespaces[i] = namespace.Canonicalize(ns)
+		}
+	}
+
+	for i, authMethod := range filter.AuthMethods {
+		filter.AuthMethods[i] = "auth/" + sanitizePath(strings.TrimPrefix(strings.TrimSpace(authMethod), "auth/"))
+	}
+
+	if len(filter.MountPaths) == 0 && len(filter.Operations) == 0 && len(filter.Namespaces) == 0 &&
+		len(filter.AuthMethods) == 0 && !filter.ErrorsOnly {
+		return nil, nil
+	}
+
+	return filter, nil
+}
+
+// matches returns if the request, or response, of the log input passes the
+// filter.
+func (f *AuditFilter) matches(ctx context.Context, in *logical.LogInput, isResponse bool) bool {
+	if f == nil {
+		return true
+	}
+
+	req := in.Request
+	if req == nil {
+		return false
+	}
+
+	if f.ErrorsOnly {
+		failed := in.OuterErr != nil
+		if isResponse && in.Response != nil && in.Response.IsError() {
+			failed = true
+		}
+		if !failed {
+			return false
+		}
+	}
+
+	if len(f.Operations) > 0 && !strutil.StrListContains(f.Operations, string(req.Operation)) {
+		return false
+	}
+
+	if len(f.MountPaths) > 0 {
+		matched := false
+		for _, prefix := range f.MountPaths {
+			if strings.HasPrefix(req.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.Namespaces) > 0 {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return false
+		}
+		nsPath := ns.Path
+		if ns.ID == namespace.RootNamespaceID {
+			nsPath = "root"
+		}
+		if !strutil.StrListContains(f.Namespaces, nsPath) {
+			return false
+		}
+	}
+
+	if len(f.AuthMethods) > 0 {
+		// The auth method of a request is the one that created its token, or
+		// the one being logged in to
+		authPath := req.Path
+		if te := req.TokenEntry(); te != nil {
+			authPath = te.Path
+		}
+		matched := false
+		for _, authMethod := range f.AuthMethods {
+			if strings.HasPrefix(authPath, authMethod) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasUnfilteredAuditEntry returns if any of the audit entries logs every
+// request and response
+func hasUnfilteredAuditEntry(entries []*MountEntry) bool {
+	for _, entry := range entries {
+		if entry.AuditFilter == nil {
+			return true
+		}
+	}
+	return false
+}
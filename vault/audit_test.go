@@ -304,6 +304,57 @@ func TestCore_DisableAudit(t *testing.T) {
 	}
 }
 
+func TestCore_EnableAudit_Filter(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(ctx context.Context, config *audit.BackendConfig) (audit.Backend, error) {
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	filter := &AuditFilter{
+		Operations: []string{"update"},
+	}
+
+	// A filtered device needs an unfiltered one to be enabled
+	err := c.enableAudit(namespace.RootContext(nil), &MountEntry{
+		Table:       auditTableType,
+		Path:        "filtered",
+		Type:        "noop",
+		AuditFilter: filter,
+	}, true)
+	if err == nil {
+		t.Fatal("expected an error enabling a filtered device alone")
+	}
+
+	for _, me := range []*MountEntry{
+		{Table: auditTableType, Path: "foo", Type: "noop"},
+		{Table: auditTableType, Path: "filtered", Type: "noop", AuditFilter: filter},
+	} {
+		if err := c.enableAudit(namespace.RootContext(nil), me, true); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// The last unfiltered device can't be disabled
+	existed, err := c.disableAudit(namespace.RootContext(nil), "foo", true)
+	if !existed || err == nil {
+		t.Fatalf("expected an error disabling the unfiltered device; existed: %v; err: %v", existed, err)
+	}
+	if !c.auditBroker.IsRegistered("foo/") {
+		t.Fatal("audit backend missing")
+	}
+
+	existed, err = c.disableAudit(namespace.RootContext(nil), "filtered", true)
+	if !existed || err != nil {
+		t.Fatalf("existed: %v; err: %v", existed, err)
+	}
+	existed, err = c.disableAudit(namespace.RootContext(nil), "foo", true)
+	if !existed || err != nil {
+		t.Fatalf("existed: %v; err: %v", existed, err)
+	}
+}
+
 func TestCore_DefaultAuditTable(t *testing.T) {
 	c, keys, _ := TestCoreUnsealed(t)
 	verifyDefaultAuditTable(t, c.audit)
@@ -357,8 +408,8 @@ func TestAuditBroker_LogRequest(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -443,8 +494,8 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		NumUses:     10,
@@ -542,6 +593,59 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 	}
 }
 
+func TestAuditBroker_Filter(t *testing.T) {
+	l := logging.NewVaultLogger(log.Trace)
+	b := NewAuditBroker(l)
+	a1 := &NoopAudit{}
+	a2 := &NoopAudit{}
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, &AuditFilter{
+		MountPaths: []string{"secret/"},
+		Operations: []string{"update"},
+	})
+
+	headersConf := &AuditedHeadersConfig{
+		Headers: make(map[string]*auditedHeaderSettings),
+	}
+
+	for _, req := range []*logical.Request{
+		{Operation: logical.ReadOperation, Path: "sys/health"},
+		{Operation: logical.ReadOperation, Path: "secret/foo"},
+		{Operation: logical.UpdateOperation, Path: "secret/foo"},
+	} {
+		logInput := &logical.LogInput{
+			Request: req,
+		}
+		if err := b.LogRequest(namespace.RootContext(nil), logInput, headersConf); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	if len(a1.Req) != 3 {
+		t.Fatalf("expected the unfiltered backend to log 3 requests, got %d", len(a1.Req))
+	}
+	if len(a2.Req) != 1 || a2.Req[0].Path != "secret/foo" || a2.Req[0].Operation != logical.UpdateOperation {
+		t.Fatalf("bad: %#v", a2.Req)
+	}
+
+	// A filtered backend that succeeds isn't enough when the unfiltered one
+	// fails
+	a1.ReqErr = fmt.Errorf("failed")
+	logInput := &logical.LogInput{
+		Request: &logical.Request{Operation: logical.UpdateOperation, Path: "secret/foo"},
+	}
+	if err := b.LogRequest(namespace.RootContext(nil), logInput, headersConf); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A failing filtered backend doesn't fail the request
+	a1.ReqErr = nil
+	a2.ReqErr = fmt.Errorf("failed")
+	if err := b.LogRequest(namespace.RootContext(nil), logInput, headersConf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestAuditBroker_AuditHeaders(t *testing.T) {
 	logger := logging.NewVaultLogger(log.Trace)
 	b := NewAuditBroker(logger)
@@ -549,8 +653,8 @@ func TestAuditBroker_AuditHeaders(t *testing.T) {
 	view := NewBarrierView(barrier, "headers/")
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil, false)
-	b.Register("bar", a2, nil, false)
+	b.Register("foo", a1, nil, false, nil)
+	b.Register("bar", a2, nil, false, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -136,9 +136,29 @@ type SecurityBarrier interface {
 	// ActiveKeyInfo is used to inform details about the active key
 	ActiveKeyInfo() (*KeyInfo, error)
 
+	// Rewrap re-encrypts an entry under the active term if it is encrypted
+	// under a term older than the given one
+	Rewrap(ctx context.Context, key string, term uint32) (bool, error)
+
+	// PruneTerms removes the keys of the terms older than the given one, that
+	// were replaced before retiredBefore
+	PruneTerms(ctx context.Context, term uint32, retiredBefore time.Time) ([]uint32, error)
+
 	// Rekey is used to change the master key used to protect the keyring
 	Rekey(context.Context, []byte) error
 
+	// RotationConfig returns the configuration of the automatic rotation of
+	// the active key
+	RotationConfig() (KeyRotationConfig, error)
+
+	// SetRotationConfig persists the configuration of the automatic rotation
+	// of the active key
+	SetRotationConfig(ctx context.Context, config KeyRotationConfig) error
+
+	// CheckBarrierAutoRotate persists the number of encryptions made with the
+	// active key, and returns the reason it must be rotated, if any
+	CheckBarrierAutoRotate(ctx context.Context) (string, error)
+
 	// For replication we must send over the keyring, so this must be available
 	Keyring() (*Keyring, error)
 
@@ -177,4 +197,5 @@ type BarrierEncryptor interface {
 type KeyInfo struct {
 	Term        int
 	InstallTime time.Time
+	Encryptions int64
 }
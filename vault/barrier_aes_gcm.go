@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +18,7 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/errwrap"
 	"github.com/quid/vault/sdk/helper/jsonutil"
+	"github.com/quid/vault/sdk/helper/locksutil"
 	"github.com/quid/vault/sdk/helper/strutil"
 	"github.com/quid/vault/sdk/logical"
 	"github.com/quid/vault/sdk/physical"
@@ -30,6 +32,19 @@ const (
 
 	// termSize the number of bytes used for the key term.
 	termSize = 4
+
+	// absoluteOperationMaximum is the number of encryptions after which the
+	// active key is rotated by default. With random 96 bits nonces, it keeps
+	// the probability of a nonce collision under 2^-32.
+	absoluteOperationMaximum = int64(3865470566)
+
+	// absoluteOperationMinimum is the lowest number of encryptions the
+	// rotation can be configured with
+	absoluteOperationMinimum = int64(1000000)
+
+	// minimumRotationInterval is the shortest interval the rotation can be
+	// configured with
+	minimumRotationInterval = 24 * time.Hour
 )
 
 // Versions of the AESGCM storage methodology
@@ -73,6 +88,14 @@ type AESGCMBarrier struct {
 	currentAESGCMVersionByte byte
 
 	initialized atomic.Bool
+
+	// encryptions is the number of encryptions made with the active key
+	// since its count was last persisted in the keyring
+	encryptions atomic.Int64
+
+	// rewrapLocks serialize the rewrap of an entry with its writes, so that
+	// a rewrap never overwrites a newer value
+	rewrapLocks []*locksutil.LockEntry
 }
 
 // NewAESGCMBarrier is used to construct a new barrier that uses
@@ -83,6 +106,7 @@ func NewAESGCMBarrier(physical physical.Backend) (*AESGCMBarrier, error) {
 		sealed:                   true,
 		cache:                    make(map[uint32]cipher.AEAD),
 		currentAESGCMVersionByte: byte(AESGCMVersion2),
+		rewrapLocks:              locksutil.CreateLocks(),
 	}
 	return b, nil
 }
@@ -420,6 +444,7 @@ func (b *AESGCMBarrier) Unseal(ctx context.Context, key []byte) error {
 
 		// Setup the keyring and finish
 		b.keyring = keyring
+		b.encryptions.Store(0)
 		b.sealed = false
 		return nil
 	}
@@ -495,6 +520,7 @@ func (b *AESGCMBarrier) Seal() error {
 	b.cache = make(map[uint32]cipher.AEAD)
 	b.keyring.Zeroize(true)
 	b.keyring = nil
+	b.encryptions.Store(0)
 	b.sealed = true
 	return nil
 }
@@ -535,6 +561,7 @@ func (b *AESGCMBarrier) Rotate(ctx context.Context, reader io.Reader) (uint32, e
 
 	// Swap the keyrings
 	b.keyring = newKeyring
+	b.encryptions.Store(0)
 	return newTerm, nil
 }
 
@@ -665,10 +692,229 @@ func (b *AESGCMBarrier) ActiveKeyInfo() (*KeyInfo, error) {
 	info := &KeyInfo{
 		Term:        int(term),
 		InstallTime: key.InstallTime,
+		Encryptions: key.Encryptions + b.encryptions.Load(),
 	}
 	return info, nil
 }
 
+// RotationConfig returns the configuration of the automatic rotation of the
+// active key
+func (b *AESGCMBarrier) RotationConfig() (KeyRotationConfig, error) {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return KeyRotationConfig{}, ErrBarrierSealed
+	}
+
+	return b.keyring.RotationConfig(), nil
+}
+
+// SetRotationConfig persists the configuration of the automatic rotation of
+// the active key in the keyring
+func (b *AESGCMBarrier) SetRotationConfig(ctx context.Context, config KeyRotationConfig) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	newKeyring := b.keyring.SetRotationConfig(config)
+	if err := b.persistKeyring(ctx, newKeyring); err != nil {
+		return err
+	}
+
+	b.keyring = newKeyring
+	return nil
+}
+
+// PersistEncryptions adds the encryptions made since the last call to the
+// count of the active key, and persists the keyring if it changed
+func (b *AESGCMBarrier) PersistEncryptions(ctx context.Context) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	count := b.encryptions.Swap(0)
+	if count == 0 {
+		return nil
+	}
+
+	newKeyring := b.keyring.AddEncryptions(count)
+	if err := b.persistKeyring(ctx, newKeyring); err != nil {
+		b.encryptions.Add(count)
+		return err
+	}
+
+	b.keyring = newKeyring
+	return nil
+}
+
+// CheckBarrierAutoRotate persists the count of encryptions, and returns the
+// reason the active key must be rotated according to the rotation
+// configuration, or an empty string if it doesn't need to
+func (b *AESGCMBarrier) CheckBarrierAutoRotate(ctx context.Context) (string, error) {
+	if err := b.PersistEncryptions(ctx); err != nil {
+		return "", err
+	}
+
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return "", ErrBarrierSealed
+	}
+
+	config := b.keyring.RotationConfig()
+	if config.Disabled {
+		return "", nil
+	}
+
+	maxOperations := config.MaxOperations
+	if maxOperations == 0 {
+		maxOperations = absoluteOperationMaximum
+	}
+
+	key := b.keyring.ActiveKey()
+	switch {
+	case key.Encryptions+b.encryptions.Load() >= maxOperations:
+		return fmt.Sprintf("reached the maximum number of encryptions (%d)", maxOperations), nil
+	case config.Interval > 0 && time.Since(key.InstallTime) >= config.Interval:
+		return fmt.Sprintf("reached the rotation interval (%s)", config.Interval), nil
+	}
+	return "", nil
+}
+
+// Rewrap re-encrypts the entry under the active term if it is encrypted under
+// a term older than the given one. Values that are not encrypted by the
+// barrier are left untouched. It returns whether the entry was rewritten, and
+// an error if the entry cannot be decrypted, as it would become unreadable
+// once its term is pruned.
+func (b *AESGCMBarrier) Rewrap(ctx context.Context, key string, term uint32) (bool, error) {
+	lock := locksutil.LockForKey(b.rewrapLocks, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	b.l.RLock()
+	if b.sealed {
+		b.l.RUnlock()
+		return false, ErrBarrierSealed
+	}
+	b.l.RUnlock()
+
+	pe, err := b.backend.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if pe == nil || len(pe.Value) < termSize+1 {
+		return false, nil
+	}
+
+	oldTerm := binary.BigEndian.Uint32(pe.Value[:termSize])
+	if oldTerm >= term {
+		return false, nil
+	}
+
+	b.l.RLock()
+	if b.sealed {
+		b.l.RUnlock()
+		return false, ErrBarrierSealed
+	}
+	gcm, err := b.aeadForTerm(oldTerm)
+	if err != nil {
+		b.l.RUnlock()
+		return false, err
+	}
+	activeTerm := b.keyring.ActiveTerm()
+	primary, err := b.aeadForTerm(activeTerm)
+	b.l.RUnlock()
+	if err != nil {
+		return false, err
+	}
+
+	// Not encrypted by the barrier, such as the seal configuration
+	if gcm == nil {
+		return false, nil
+	}
+	plain, err := b.decrypt(key, gcm, pe.Value)
+	if err != nil {
+		return false, errwrap.Wrapf("decryption failed: {{err}}", err)
+	}
+	defer memzero(plain)
+
+	b.encryptions.Inc()
+	value, err := b.encrypt(key, activeTerm, primary, plain)
+	if err != nil {
+		return false, err
+	}
+
+	// Keep the entry seal wrapped if it was
+	pe.Value = value
+	if err := b.backend.Put(ctx, pe); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PruneTerms removes the keys of the terms older than the given one from the
+// keyring, once the term that replaced them was installed before retiredBefore.
+// The keys that still have an upgrade path for the standby instances are kept.
+// It returns the pruned terms.
+func (b *AESGCMBarrier) PruneTerms(ctx context.Context, term uint32, retiredBefore time.Time) ([]uint32, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.sealed {
+		return nil, ErrBarrierSealed
+	}
+
+	var terms []uint32
+	for t := range b.keyring.keys {
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+
+	var pruned []uint32
+	newKeyring := b.keyring
+	for i, t := range terms {
+		if t >= term || t == newKeyring.ActiveTerm() {
+			break
+		}
+		if !b.keyring.TermKey(terms[i+1]).InstallTime.Before(retiredBefore) {
+			break
+		}
+
+		upgrade, err := b.backend.Get(ctx, fmt.Sprintf("%s%d", keyringUpgradePrefix, t))
+		if err != nil {
+			return nil, err
+		}
+		if upgrade != nil {
+			continue
+		}
+
+		newKeyring, err = newKeyring.RemoveKey(t)
+		if err != nil {
+			return nil, err
+		}
+		pruned = append(pruned, t)
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+
+	if err := b.persistKeyring(ctx, newKeyring); err != nil {
+		return nil, err
+	}
+
+	b.cacheLock.Lock()
+	for _, t := range pruned {
+		delete(b.cache, t)
+	}
+	b.cacheLock.Unlock()
+
+	b.keyring = newKeyring
+	return pruned, nil
+}
+
 // Rekey is used to change the master key used to protect the keyring
 func (b *AESGCMBarrier) Rekey(ctx context.Context, key []byte) error {
 	b.l.Lock()
@@ -728,6 +974,13 @@ func (b *AESGCMBarrier) updateMasterKeyCommon(key []byte) (*Keyring, error) {
 // Put is used to insert or update an entry
 func (b *AESGCMBarrier) Put(ctx context.Context, entry *logical.StorageEntry) error {
 	defer metrics.MeasureSince([]string{"barrier", "put"}, time.Now())
+
+	// Held before reading the active term, so that the entry is rewrapped if
+	// the term is rotated while it's written
+	lock := locksutil.LockForKey(b.rewrapLocks, entry.Key)
+	lock.RLock()
+	defer lock.RUnlock()
+
 	b.l.RLock()
 	if b.sealed {
 		b.l.RUnlock()
@@ -741,6 +994,7 @@ func (b *AESGCMBarrier) Put(ctx context.Context, entry *logical.StorageEntry) er
 		return err
 	}
 
+	b.encryptions.Inc()
 	return b.putInternal(ctx, term, primary, entry)
 }
 
@@ -830,6 +1084,11 @@ func (b *AESGCMBarrier) lockSwitchedGet(ctx context.Context, key string, getLock
 // Delete is used to permanently delete an entry
 func (b *AESGCMBarrier) Delete(ctx context.Context, key string) error {
 	defer metrics.MeasureSince([]string{"barrier", "delete"}, time.Now())
+
+	lock := locksutil.LockForKey(b.rewrapLocks, key)
+	lock.RLock()
+	defer lock.RUnlock()
+
 	b.l.RLock()
 	sealed := b.sealed
 	b.l.RUnlock()
@@ -986,6 +1245,7 @@ func (b *AESGCMBarrier) Encrypt(ctx context.Context, key string, plaintext []byt
 		return nil, err
 	}
 
+	b.encryptions.Inc()
 	ciphertext, err := b.encrypt(key, term, primary, plaintext)
 	if err != nil {
 		return nil, err
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"testing"
+	"time"
 
 	log "github.com/hashicorp/go-hclog"
 	"github.com/quid/vault/sdk/helper/logging"
@@ -596,3 +598,242 @@ func TestAESGCMBarrier_ReloadKeyring(t *testing.T) {
 	}
 
 }
+
+func TestAESGCMBarrier_AutoRotate(t *testing.T) {
+	inm, err := inmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b, err := NewAESGCMBarrier(inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Initialize and unseal
+	key, _ := b.GenerateKey(rand.Reader)
+	b.Initialize(context.Background(), key, nil, rand.Reader)
+	b.Unseal(context.Background(), key)
+
+	for i := 0; i < 3; i++ {
+		err = b.Put(context.Background(), &logical.StorageEntry{Key: "test", Value: []byte("quick brown fox")})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	_, err = b.Encrypt(context.Background(), "foo", []byte("quick brown fox"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	info, err := b.ActiveKeyInfo()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Encryptions != 4 {
+		t.Fatalf("bad: %d", info.Encryptions)
+	}
+
+	// The default configuration doesn't rotate the key yet
+	reason, err := b.CheckBarrierAutoRotate(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if reason != "" {
+		t.Fatalf("bad: %s", reason)
+	}
+
+	// The count is persisted across unseals
+	b.Seal()
+	b.Unseal(context.Background(), key)
+	info, err = b.ActiveKeyInfo()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Encryptions != 4 {
+		t.Fatalf("bad: %d", info.Encryptions)
+	}
+
+	err = b.SetRotationConfig(context.Background(), KeyRotationConfig{MaxOperations: 4})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	reason, err = b.CheckBarrierAutoRotate(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if reason == "" {
+		t.Fatal("expected the key to be rotated on the number of encryptions")
+	}
+
+	err = b.SetRotationConfig(context.Background(), KeyRotationConfig{Disabled: true, MaxOperations: 4})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	reason, err = b.CheckBarrierAutoRotate(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if reason != "" {
+		t.Fatalf("bad: %s", reason)
+	}
+
+	err = b.SetRotationConfig(context.Background(), KeyRotationConfig{Interval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	reason, err = b.CheckBarrierAutoRotate(context.Background())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if reason == "" {
+		t.Fatal("expected the key to be rotated on the interval")
+	}
+
+	// The new key starts without any encryptions, and keeps the configuration
+	_, err = b.Rotate(context.Background(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	info, err = b.ActiveKeyInfo()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Encryptions != 0 {
+		t.Fatalf("bad: %d", info.Encryptions)
+	}
+	config, err := b.RotationConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config.Interval != time.Nanosecond {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestAESGCMBarrier_Rewrap(t *testing.T) {
+	inm, err := inmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b, err := NewAESGCMBarrier(inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Initialize and unseal
+	key, _ := b.GenerateKey(rand.Reader)
+	b.Initialize(context.Background(), key, nil, rand.Reader)
+	b.Unseal(context.Background(), key)
+
+	for _, path := range []string{"test", "old", "corrupt"} {
+		err = b.Put(context.Background(), &logical.StorageEntry{Key: path, Value: []byte("quick brown fox")})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	corrupt, err := inm.Get(context.Background(), "corrupt")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	corrupt.Value[len(corrupt.Value)-1] ^= 0xff
+	if err := inm.Put(context.Background(), corrupt); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Not encrypted by the barrier
+	plain := &physical.Entry{Key: "plain", Value: []byte(`{"type":"shamir"}`)}
+	if err := inm.Put(context.Background(), plain); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	newTerm, err := b.Rotate(context.Background(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	termOf := func(path string) uint32 {
+		pe, err := inm.Get(context.Background(), path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return binary.BigEndian.Uint32(pe.Value[:4])
+	}
+
+	ok, err := b.Rewrap(context.Background(), "test", newTerm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !ok || termOf("test") != newTerm {
+		t.Fatalf("expected the entry to be rewrapped under term %d", newTerm)
+	}
+
+	for _, path := range []string{"test", "plain", "missing"} {
+		ok, err = b.Rewrap(context.Background(), path, newTerm)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if ok {
+			t.Fatalf("expected %q to not be rewrapped", path)
+		}
+	}
+	pe, err := inm.Get(context.Background(), "plain")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(pe.Value, plain.Value) {
+		t.Fatalf("bad: %s", pe.Value)
+	}
+
+	// An entry that cannot be decrypted is reported rather than skipped
+	if _, err := b.Rewrap(context.Background(), "corrupt", newTerm); err == nil {
+		t.Fatal("expected an error rewrapping an entry that cannot be decrypted")
+	}
+	if termOf("corrupt") != newTerm-1 {
+		t.Fatal("expected the entry to be left untouched")
+	}
+
+	entry, err := b.Get(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(entry.Value) != "quick brown fox" {
+		t.Fatalf("bad: %s", entry.Value)
+	}
+
+	// The term was replaced too recently
+	pruned, err := b.PruneTerms(context.Background(), newTerm, time.Time{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Fatalf("bad: %v", pruned)
+	}
+
+	pruned, err = b.PruneTerms(context.Background(), newTerm, time.Now())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != newTerm-1 {
+		t.Fatalf("bad: %v", pruned)
+	}
+
+	// The entries that were not rewrapped are lost
+	if _, err := b.Get(context.Background(), "old"); err == nil {
+		t.Fatal("expected an error reading an entry of a pruned term")
+	}
+
+	// The pruned keyring is persisted
+	b.Seal()
+	b.Unseal(context.Background(), key)
+	keyring, err := b.Keyring()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keyring.TermKey(newTerm-1) != nil {
+		t.Fatal("expected the term to be pruned")
+	}
+	if _, err := b.Get(context.Background(), "test"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
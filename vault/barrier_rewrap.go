@@ -0,0 +1,360 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/sdk/logical"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// barrierRewrapStatusPath is the storage path of the status of the
+	// re-encryption of the storage under the newest term
+	barrierRewrapStatusPath = "core/rewrap-status"
+
+	barrierRewrapStateRewrapping = "rewrapping"
+	barrierRewrapStatePruning    = "pruning"
+	barrierRewrapStateComplete   = "complete"
+	barrierRewrapStateFailed     = "failed"
+)
+
+var (
+	// barrierRewrapRate is the number of entries rewrapped per second
+	barrierRewrapRate rate.Limit = 100
+
+	// barrierRewrapCheckpointKeys is the number of entries scanned between
+	// two checkpoints of the rewrap
+	barrierRewrapCheckpointKeys = 1000
+
+	// barrierRewrapPruneInterval is how often the obsolete terms are pruned
+	// once the entries are rewrapped, until they are all removed
+	barrierRewrapPruneInterval = time.Hour
+)
+
+var errBarrierRewrapStopped = errors.New("barrier rewrap stopped")
+
+// barrierRewrapStatus is the progress of the re-encryption of the storage
+type barrierRewrapStatus struct {
+	State         string    `json:"state"`
+	Term          uint32    `json:"term"`
+	StartTime     time.Time `json:"start_time"`
+	Checkpoint    string    `json:"checkpoint"`
+	KeysScanned   int       `json:"keys_scanned"`
+	KeysRewrapped int       `json:"keys_rewrapped"`
+	RewrappedTime time.Time `json:"rewrapped_time"`
+	PrunedTerms   []uint32  `json:"pruned_terms"`
+	CompleteTime  time.Time `json:"complete_time"`
+	LastError     string    `json:"last_error"`
+}
+
+// barrierRewrap re-encrypts the storage under the newest term after a
+// rotation, so that the keys of the older terms can be pruned from the
+// keyring. It runs on the active node, throttled, saving a checkpoint as it
+// goes so that it resumes where it stopped after a seal or a restart.
+//
+// The obsolete terms are only pruned once they were retired for longer than
+// the maximum lease TTL, as batch tokens encrypted under them may still be in
+// use until they expire.
+type barrierRewrap struct {
+	core   *Core
+	logger hclog.Logger
+
+	// ctx is the active context of the node, the rewrap runs until it's done
+	ctx context.Context
+
+	l      sync.Mutex
+	status *barrierRewrapStatus
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newBarrierRewrap(c *Core, conf *CoreConfig) *barrierRewrap {
+	logger := conf.Logger.Named("barrier.rewrap")
+	c.allLoggers = append(c.allLoggers, logger)
+
+	return &barrierRewrap{
+		core:   c,
+		logger: logger,
+	}
+}
+
+func (c *Core) loadBarrierRewrapStatus(ctx context.Context) (*barrierRewrapStatus, error) {
+	entry, err := c.barrier.Get(ctx, barrierRewrapStatusPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read the rewrap status: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var status barrierRewrapStatus
+	if err := entry.DecodeJSON(&status); err != nil {
+		return nil, errwrap.Wrapf("failed to decode the rewrap status: {{err}}", err)
+	}
+	return &status, nil
+}
+
+func (c *Core) storeBarrierRewrapStatus(ctx context.Context, status *barrierRewrapStatus) error {
+	entry, err := logical.StorageEntryJSON(barrierRewrapStatusPath, status)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(ctx, entry)
+}
+
+// startBarrierRewrap resumes the rewrap on the active node, if one is in
+// progress
+func (c *Core) startBarrierRewrap(ctx context.Context) error {
+	r := c.barrierRewrap
+	r.l.Lock()
+	r.ctx = ctx
+	r.status = nil
+	r.l.Unlock()
+
+	status, err := c.loadBarrierRewrapStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.l.Lock()
+	r.status = status
+	r.l.Unlock()
+
+	if status != nil && (status.State == barrierRewrapStateRewrapping || status.State == barrierRewrapStatePruning) {
+		r.start()
+	}
+	return nil
+}
+
+// stopBarrierRewrap stops the rewrap, saving its checkpoint
+func (c *Core) stopBarrierRewrap() {
+	c.barrierRewrap.stop()
+}
+
+// start runs the rewrap from the checkpoint of the status
+func (r *barrierRewrap) start() {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.stopCh = make(chan struct{})
+	r.doneCh = make(chan struct{})
+	go r.run(r.ctx, r.stopCh, r.doneCh)
+}
+
+func (r *barrierRewrap) stop() {
+	r.l.Lock()
+	stopCh, doneCh := r.stopCh, r.doneCh
+	r.stopCh, r.doneCh = nil, nil
+	r.l.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+// getStatus returns a copy of the status of the rewrap, nil if it never ran
+func (r *barrierRewrap) getStatus() *barrierRewrapStatus {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+	status := *r.status
+	status.PrunedTerms = append([]uint32(nil), r.status.PrunedTerms...)
+	return &status
+}
+
+// updateStatus applies update to the status of the rewrap and persists it
+func (r *barrierRewrap) updateStatus(ctx context.Context, update func(*barrierRewrapStatus)) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+	update(r.status)
+	return r.core.storeBarrierRewrapStatus(ctx, r.status)
+}
+
+// begin restarts the rewrap from the first entry, to re-encrypt everything
+// under the given term
+func (r *barrierRewrap) begin(ctx context.Context, term uint32) error {
+	r.stop()
+
+	r.l.Lock()
+	if r.ctx == nil {
+		r.l.Unlock()
+		return errors.New("the storage is only re-encrypted by the active node")
+	}
+	status := &barrierRewrapStatus{
+		State:     barrierRewrapStateRewrapping,
+		Term:      term,
+		StartTime: time.Now(),
+	}
+	if err := r.core.storeBarrierRewrapStatus(ctx, status); err != nil {
+		r.l.Unlock()
+		return err
+	}
+	r.status = status
+	r.l.Unlock()
+
+	r.logger.Info("starting the re-encryption of the storage", "term", term)
+	r.start()
+	return nil
+}
+
+func (r *barrierRewrap) run(ctx context.Context, stopCh chan struct{}, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	status := r.getStatus()
+	if status == nil {
+		return
+	}
+
+	var err error
+	if status.State == barrierRewrapStateRewrapping {
+		err = r.rewrapKeys(ctx, stopCh, status)
+		if err == nil {
+			r.logger.Info("re-encrypted the storage, pruning the obsolete terms", "term", status.Term)
+			err = r.updateStatus(ctx, func(status *barrierRewrapStatus) {
+				status.State = barrierRewrapStatePruning
+				status.RewrappedTime = time.Now()
+			})
+		}
+	}
+	if err == nil {
+		err = r.pruneTerms(ctx, stopCh, status.Term)
+	}
+
+	switch {
+	case err == errBarrierRewrapStopped || ctx.Err() != nil:
+		return
+
+	case err != nil:
+		r.logger.Error("re-encryption of the storage failed", "error", err)
+		err = r.updateStatus(ctx, func(status *barrierRewrapStatus) {
+			status.State = barrierRewrapStateFailed
+			status.LastError = err.Error()
+		})
+
+	default:
+		r.logger.Info("pruned all the obsolete terms", "term", status.Term)
+		err = r.updateStatus(ctx, func(status *barrierRewrapStatus) {
+			status.State = barrierRewrapStateComplete
+			status.CompleteTime = time.Now()
+		})
+	}
+	if err != nil {
+		r.logger.Error("failed to store the rewrap status", "error", err)
+	}
+}
+
+// rewrapKeys re-encrypts the entries of the barrier in lexicographic order,
+// starting after the checkpoint
+func (r *barrierRewrap) rewrapKeys(ctx context.Context, stopCh chan struct{}, status *barrierRewrapStatus) error {
+	checkpoint, scanned, rewrapped := status.Checkpoint, status.KeysScanned, status.KeysRewrapped
+	limiter := rate.NewLimiter(barrierRewrapRate, 1)
+
+	saveCheckpoint := func(ctx context.Context, key string) error {
+		return r.updateStatus(ctx, func(status *barrierRewrapStatus) {
+			status.Checkpoint = key
+			status.KeysScanned = scanned
+			status.KeysRewrapped = rewrapped
+		})
+	}
+
+	var lastKey string
+	err := storageMigrationScan(ctx, r.core.barrier, func(key string) error {
+		// The keyring, the master key and the upgrade paths are encrypted
+		// with their own keys
+		if key <= checkpoint || key == keyringPath || key == masterKeyPath || strings.HasPrefix(key, keyringUpgradePrefix) {
+			return nil
+		}
+
+		select {
+		case <-time.After(limiter.Reserve().Delay()):
+		case <-stopCh:
+			return errBarrierRewrapStopped
+		case <-ctx.Done():
+			return errBarrierRewrapStopped
+		}
+
+		ok, err := r.core.barrier.Rewrap(ctx, key, status.Term)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to rewrap %q: {{err}}", key), err)
+		}
+		if ok {
+			rewrapped++
+		}
+		lastKey = key
+		scanned++
+
+		if scanned%barrierRewrapCheckpointKeys == 0 {
+			return saveCheckpoint(ctx, key)
+		}
+		return nil
+	})
+	if lastKey != "" {
+		// The active context is canceled when sealing
+		if err := saveCheckpoint(context.Background(), lastKey); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// pruneTerms removes the terms older than the given one from the keyring, as
+// they were retired for longer than the maximum lease TTL
+func (r *barrierRewrap) pruneTerms(ctx context.Context, stopCh chan struct{}, term uint32) error {
+	ticker := time.NewTicker(barrierRewrapPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := r.core.barrier.PruneTerms(ctx, term, time.Now().Add(-r.core.maxLeaseTTL))
+		if err != nil {
+			return errwrap.Wrapf("failed to prune the obsolete terms: {{err}}", err)
+		}
+		if len(pruned) > 0 {
+			r.logger.Info("pruned obsolete terms from the keyring", "terms", pruned)
+			if err := r.updateStatus(ctx, func(status *barrierRewrapStatus) {
+				status.PrunedTerms = append(status.PrunedTerms, pruned...)
+			}); err != nil {
+				return err
+			}
+		}
+
+		// The keyring shares its keys with the barrier, it must not be
+		// zeroized
+		keyring, err := r.core.barrier.Keyring()
+		if err != nil {
+			return err
+		}
+		remaining := false
+		for t := range keyring.keys {
+			if t < term {
+				remaining = true
+			}
+		}
+		if !remaining {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return errBarrierRewrapStopped
+		case <-ctx.Done():
+			return errBarrierRewrapStopped
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/logical"
+	"golang.org/x/time/rate"
+)
+
+func TestBarrierRewrap(t *testing.T) {
+	// Rewrap and checkpoint as fast as possible
+	rewrapRate, checkpointKeys := barrierRewrapRate, barrierRewrapCheckpointKeys
+	barrierRewrapRate, barrierRewrapCheckpointKeys = rate.Inf, 1
+	defer func() {
+		barrierRewrapRate, barrierRewrapCheckpointKeys = rewrapRate, checkpointKeys
+	}()
+
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["foo"] = "bar"
+	resp, err := c.HandleRequest(ctx, req)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// The obsolete terms can be pruned as soon as they are replaced
+	maxLeaseTTL := c.maxLeaseTTL
+	c.maxLeaseTTL = 0
+
+	// The storage is only re-encrypted when configured
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.barrierRewrap.getStatus(); status != nil {
+		t.Fatalf("expected no rewrap, got %#v", status)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+	req.Data["rewrap"] = true
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	var status *barrierRewrapStatus
+	for i := 0; i < 100; i++ {
+		status = c.barrierRewrap.getStatus()
+		if status != nil && status.State != barrierRewrapStateRewrapping && status.State != barrierRewrapStatePruning {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.maxLeaseTTL = maxLeaseTTL
+	if status.State != barrierRewrapStateComplete {
+		t.Fatalf("expected the rewrap to complete, got %#v", status)
+	}
+	if status.Term != 3 || status.KeysRewrapped == 0 || !reflect.DeepEqual(status.PrunedTerms, []uint32{1, 2}) {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	// Every entry of the barrier is encrypted under the new term
+	err = storageMigrationScan(context.Background(), c.barrier, func(key string) error {
+		if key == keyringPath {
+			return nil
+		}
+		pe, err := c.physical.Get(context.Background(), key)
+		if err != nil {
+			return err
+		}
+		if term := binary.BigEndian.Uint32(pe.Value[:4]); term < 3 {
+			t.Fatalf("expected %q to be rewrapped", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || resp == nil || resp.Data["foo"] != "bar" {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "rotate/rewrap-status")
+	resp, err = c.systemBackend.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["state"] != barrierRewrapStateComplete || !reflect.DeepEqual(resp.Data["terms"], []int{3}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBarrierRewrap_DecryptionFailure(t *testing.T) {
+	rewrapRate := barrierRewrapRate
+	barrierRewrapRate = rate.Inf
+	defer func() {
+		barrierRewrapRate = rewrapRate
+	}()
+
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["foo"] = "bar"
+	resp, err := c.HandleRequest(ctx, req)
+	if err != nil || resp.IsError() {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// Corrupt an entry so that it can no longer be decrypted
+	var corrupt string
+	err = storageMigrationScan(context.Background(), c.barrier, func(key string) error {
+		if corrupt == "" && strings.HasPrefix(key, "logical/") {
+			corrupt = key
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, err := c.physical.Get(context.Background(), corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.Value[len(pe.Value)-1] ^= 0xff
+	if err := c.physical.Put(context.Background(), pe); err != nil {
+		t.Fatal(err)
+	}
+
+	maxLeaseTTL := c.maxLeaseTTL
+	c.maxLeaseTTL = 0
+	defer func() {
+		c.maxLeaseTTL = maxLeaseTTL
+	}()
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+	req.Data["rewrap"] = true
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	var status *barrierRewrapStatus
+	for i := 0; i < 100; i++ {
+		status = c.barrierRewrap.getStatus()
+		if status != nil && status.State != barrierRewrapStateRewrapping && status.State != barrierRewrapStatePruning {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status.State != barrierRewrapStateFailed || !strings.Contains(status.LastError, corrupt) {
+		t.Fatalf("expected the rewrap to fail on %q, got %#v", corrupt, status)
+	}
+	if len(status.PrunedTerms) != 0 {
+		t.Fatalf("expected no term to be pruned, got %v", status.PrunedTerms)
+	}
+
+	// The entries still under the old term remain readable
+	keyring, err := c.barrier.Keyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.TermKey(1) == nil {
+		t.Fatal("expected the old term to be kept")
+	}
+}
@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/quid/vault/sdk/logical"
+)
+
+// barrierAutoRotateInterval is how often the active node persists the number
+// of encryptions made with the active key and checks whether the key must be
+// rotated
+var barrierAutoRotateInterval = 5 * time.Minute
+
+// rotateBarrierKey installs a new encryption key, with an upgrade path for the
+// standby instances
+func (c *Core) rotateBarrierKey(ctx context.Context) (uint32, error) {
+	// Rotate to the new term
+	newTerm, err := c.barrier.Rotate(ctx, c.secureRandomReader)
+	if err != nil {
+		c.logger.Error("failed to create new encryption key", "error", err)
+		return 0, err
+	}
+	c.logger.Info("installed new encryption key", "term", newTerm)
+
+	// In HA mode, we need to an upgrade path for the standby instances
+	if c.ha != nil {
+		// Create the upgrade path to the new term
+		if err := c.barrier.CreateUpgrade(ctx, newTerm); err != nil {
+			c.logger.Error("failed to create new upgrade", "term", newTerm, "error", err)
+		}
+
+		// Schedule the destroy of the upgrade path
+		time.AfterFunc(KeyRotateGracePeriod, func() {
+			c.logger.Debug("cleaning up upgrade keys", "waited", KeyRotateGracePeriod)
+			if err := c.barrier.DestroyUpgrade(c.activeContext, newTerm); err != nil {
+				c.logger.Error("failed to destroy upgrade", "term", newTerm, "error", err)
+			}
+		})
+	}
+
+	// Write to the canary path, which will force a synchronous truing during
+	// replication
+	if err := c.barrier.Put(ctx, &logical.StorageEntry{
+		Key:   coreKeyringCanaryPath,
+		Value: []byte(fmt.Sprintf("new-rotation-term-%d", newTerm)),
+	}); err != nil {
+		c.logger.Error("error saving keyring canary", "error", err)
+		return 0, errwrap.Wrapf("failed to save keyring canary: {{err}}", err)
+	}
+
+	// Re-encrypt the storage under the new term in the background, if
+	// configured to
+	config, err := c.barrier.RotationConfig()
+	if err != nil {
+		c.logger.Error("failed to read the rotation configuration", "error", err)
+	} else if config.Rewrap {
+		if err := c.barrierRewrap.begin(ctx, newTerm); err != nil {
+			c.logger.Error("failed to start the re-encryption of the storage", "term", newTerm, "error", err)
+		}
+	}
+
+	return newTerm, nil
+}
+
+// startBarrierAutoRotate starts checking on the active node whether the
+// encryption key must be rotated, according to its rotation configuration
+func (c *Core) startBarrierAutoRotate(ctx context.Context) {
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	c.barrierAutoRotateStopCh = stopCh
+	c.barrierAutoRotateDoneCh = doneCh
+
+	go func() {
+		defer close(doneCh)
+
+		ticker := time.NewTicker(barrierAutoRotateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.checkBarrierAutoRotate(ctx)
+			case <-stopCh:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopBarrierAutoRotate stops the checks and persists the number of
+// encryptions made with the active key, so that it is kept across restarts
+func (c *Core) stopBarrierAutoRotate() {
+	if c.barrierAutoRotateStopCh == nil {
+		return
+	}
+
+	close(c.barrierAutoRotateStopCh)
+	<-c.barrierAutoRotateDoneCh
+	c.barrierAutoRotateStopCh = nil
+	c.barrierAutoRotateDoneCh = nil
+
+	if _, err := c.barrier.CheckBarrierAutoRotate(context.Background()); err != nil {
+		c.logger.Error("failed to persist the number of encryptions of the encryption key", "error", err)
+	}
+}
+
+// checkBarrierAutoRotate rotates the encryption key if it reached the number
+// of encryptions or the interval of its rotation configuration
+func (c *Core) checkBarrierAutoRotate(ctx context.Context) {
+	reason, err := c.barrier.CheckBarrierAutoRotate(ctx)
+	if err != nil {
+		c.logger.Error("failed to check the rotation of the encryption key", "error", err)
+		return
+	}
+
+	if info, err := c.barrier.ActiveKeyInfo(); err == nil {
+		c.MetricSink().SetGaugeWithLabels([]string{"barrier", "estimated_encryptions"}, float32(info.Encryptions), []metrics.Label{{"term", fmt.Sprint(info.Term)}})
+	}
+
+	if reason == "" {
+		return
+	}
+
+	c.logger.Info("rotating the encryption key automatically", "reason", reason)
+	newTerm, err := c.rotateBarrierKey(ctx)
+	if err != nil {
+		c.MetricSink().IncrCounterWithLabels([]string{"barrier", "auto_rotation", "failure"}, 1, nil)
+		return
+	}
+	c.MetricSink().IncrCounterWithLabels([]string{"barrier", "auto_rotation"}, 1, nil)
+
+	c.auditBarrierAutoRotation(ctx, newTerm, reason)
+}
+
+// auditBarrierAutoRotation logs the automatic rotation of the encryption key to
+// the audit devices, as a request to sys/rotate without a client token
+func (c *Core) auditBarrierAutoRotation(ctx context.Context, newTerm uint32, reason string) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		c.logger.Error("failed to generate the identifier of the audit entry", "error", err)
+		return
+	}
+
+	logInput := &logical.LogInput{
+		Request: &logical.Request{
+			ID:        id,
+			Operation: logical.UpdateOperation,
+			Path:      "sys/rotate",
+		},
+		Response: &logical.Response{
+			Data: map[string]interface{}{
+				"term": newTerm,
+			},
+			Warnings: []string{
+				fmt.Sprintf("automatic rotation of the encryption key: %s", reason),
+			},
+		},
+	}
+	if err := c.auditBroker.LogResponse(ctx, logInput, c.auditedHeaders); err != nil {
+		c.logger.Error("failed to audit the automatic rotation of the encryption key", "error", err)
+	}
+}
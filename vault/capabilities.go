@@ -4,6 +4,7 @@ import (
 	"context"
 	"sort"
 
+	"github.com/quid/vault/helper/identity"
 	"github.com/quid/vault/helper/namespace"
 	"github.com/quid/vault/sdk/logical"
 )
@@ -27,50 +28,63 @@ func (c *Core) Capabilities(ctx context.Context, token, path string) ([]string,
 		return nil, &logical.StatusBadRequest{Err: "invalid token"}
 	}
 
-	tokenNS, err := NamespaceByID(ctx, te.NamespaceID, c)
+	tokenNS, entity, policyNames, err := c.tokenEntryPolicyNames(ctx, te)
+	if err != nil {
+		return nil, err
+	}
+
+	var policyCount int
+	for _, nsPolicies := range policyNames {
+		policyCount += len(nsPolicies)
+	}
+	if policyCount == 0 {
+		return []string{DenyCapability}, nil
+	}
+
+	// Construct the corresponding ACL object. ACL construction should be
+	// performed on the token's namespace.
+	tokenCtx := namespace.ContextWithNamespace(ctx, tokenNS)
+	acl, err := c.policyStore.ACL(tokenCtx, entity, policyNames)
 	if err != nil {
 		return nil, err
 	}
+
+	capabilities := acl.Capabilities(ctx, path)
+	sort.Strings(capabilities)
+	return capabilities, nil
+}
+
+// tokenEntryPolicyNames returns the namespace of the given token along with
+// its entity and the names of all policies, keyed by namespace ID, that make
+// up its ACL.
+func (c *Core) tokenEntryPolicyNames(ctx context.Context, te *logical.TokenEntry) (*namespace.Namespace, *identity.Entity, map[string][]string, error) {
+	tokenNS, err := NamespaceByID(ctx, te.NamespaceID, c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	if tokenNS == nil {
-		return nil, namespace.ErrNoNamespace
+		return nil, nil, nil, namespace.ErrNoNamespace
 	}
 
-	var policyCount int
 	policyNames := make(map[string][]string)
 	policyNames[tokenNS.ID] = te.Policies
-	policyCount += len(te.Policies)
 
 	entity, identityPolicies, err := c.fetchEntityAndDerivedPolicies(ctx, tokenNS, te.EntityID)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	if entity != nil && entity.Disabled {
 		c.logger.Warn("permission denied as the entity on the token is disabled")
-		return nil, logical.ErrPermissionDenied
+		return nil, nil, nil, logical.ErrPermissionDenied
 	}
 	if te.EntityID != "" && entity == nil {
 		c.logger.Warn("permission denied as the entity on the token is invalid")
-		return nil, logical.ErrPermissionDenied
+		return nil, nil, nil, logical.ErrPermissionDenied
 	}
 
 	for nsID, nsPolicies := range identityPolicies {
 		policyNames[nsID] = append(policyNames[nsID], nsPolicies...)
-		policyCount += len(nsPolicies)
 	}
 
-	if policyCount == 0 {
-		return []string{DenyCapability}, nil
-	}
-
-	// Construct the corresponding ACL object. ACL construction should be
-	// performed on the token's namespace.
-	tokenCtx := namespace.ContextWithNamespace(ctx, tokenNS)
-	acl, err := c.policyStore.ACL(tokenCtx, entity, policyNames)
-	if err != nil {
-		return nil, err
-	}
-
-	capabilities := acl.Capabilities(ctx, path)
-	sort.Strings(capabilities)
-	return capabilities, nil
+	return tokenNS, entity, policyNames, nil
 }
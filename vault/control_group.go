@@ -0,0 +1,657 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/quid/vault/helper/identity"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/helper/jsonutil"
+	"github.com/quid/vault/sdk/helper/wrapping"
+	"github.com/quid/vault/sdk/logical"
+)
+
+const (
+	// controlGroupRequestPath is the cubbyhole path of a control group token
+	// under which the held request is stored. It is deliberately outside of
+	// what the control-group policy grants, so only Vault itself can read or
+	// modify it.
+	controlGroupRequestPath = "cubbyhole/request"
+)
+
+// controlGroupError is returned by the policy checks when a request is
+// allowed by the ACL but has to be approved through a control group before
+// it can be carried out.
+type controlGroupError struct {
+	controlGroup *ControlGroup
+}
+
+func (e *controlGroupError) Error() string {
+	return "request requires control group approval"
+}
+
+// controlGroupRequest is the state of a request that is held until its
+// control group is satisfied.
+type controlGroupRequest struct {
+	ID                  string                       `json:"id"`
+	Path                string                       `json:"path"`
+	Operation           logical.Operation            `json:"operation"`
+	Data                map[string]interface{}       `json:"data"`
+	Headers             map[string][]string          `json:"headers"`
+	RemoteAddr          string                       `json:"remote_addr"`
+	NamespaceID         string                       `json:"namespace_id"`
+	RequestTime         time.Time                    `json:"request_time"`
+	ClientTokenAccessor string                       `json:"client_token_accessor"`
+	RequesterEntityID   string                       `json:"requester_entity_id"`
+	Factors             []*ControlGroupFactor        `json:"factors"`
+	Authorizations      []*controlGroupAuthorization `json:"authorizations"`
+
+	// RevokeClientToken is set when the held request was the final use of
+	// the requester's token, which is then revoked once the request has been
+	// carried out
+	RevokeClientToken bool `json:"revoke_client_token"`
+}
+
+type controlGroupAuthorization struct {
+	EntityID          string    `json:"entity_id"`
+	EntityName        string    `json:"entity_name"`
+	AuthorizationTime time.Time `json:"authorization_time"`
+}
+
+func checkErrControlGroupTokenNeedsCreated(err error) bool {
+	return errwrap.ContainsType(err, new(controlGroupError))
+}
+
+// checkNeedsCG holds a request that was rejected because it requires control
+// group approval. The request is stored in the cubbyhole of a new control
+// group token, which is returned to the client as wrapping information so
+// that it can be unwrapped once the request has been approved. finalUse is
+// set when the request was the final use of its token.
+func checkNeedsCG(ctx context.Context, c *Core, req *logical.Request, auth *logical.Auth, ctErr error, finalUse bool, nonHMACReqDataKeys []string) (error, *logical.Response, *logical.Auth, error) {
+	cgErr, ok := errwrap.GetType(ctErr, new(controlGroupError)).(*controlGroupError)
+	if !ok || cgErr == nil {
+		return nil, nil, nil, nil
+	}
+
+	logInput := &logical.LogInput{
+		Auth:               auth,
+		Request:            req,
+		NonHMACReqDataKeys: nonHMACReqDataKeys,
+	}
+	if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
+		c.logger.Error("failed to audit request", "path", req.Path, "error", err)
+		return nil, nil, auth, ErrInternalError
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, nil, auth, err
+	}
+
+	ttl := cgErr.controlGroup.TTL
+	if ttl == 0 {
+		ttl = c.maxLeaseTTL
+	}
+
+	cgReq := &controlGroupRequest{
+		ID:                req.ID,
+		Path:              req.Path,
+		Operation:         req.Operation,
+		Data:              req.Data,
+		Headers:           req.Headers,
+		NamespaceID:       ns.ID,
+		RequestTime:       time.Now(),
+		RequesterEntityID: req.EntityID,
+		Factors:           cgErr.controlGroup.Factors,
+		RevokeClientToken: finalUse,
+	}
+	// Only the accessor is stored, the token is looked up again when the
+	// request is carried out
+	if te := req.TokenEntry(); te != nil {
+		cgReq.ClientTokenAccessor = te.Accessor
+	}
+	if req.Connection != nil {
+		cgReq.RemoteAddr = req.Connection.RemoteAddr
+	}
+
+	wrapInfo, err := c.createControlGroupToken(ctx, cgReq, ttl)
+	if err != nil {
+		c.logger.Error("failed to create control group token", "request_path", req.Path, "error", err)
+		return nil, nil, auth, ErrInternalError
+	}
+	if auth != nil {
+		wrapInfo.WrappedEntityID = auth.EntityID
+	}
+
+	return nil, &logical.Response{WrapInfo: wrapInfo}, auth, nil
+}
+
+// createControlGroupToken creates the token that represents a held request
+// and stores the request in its cubbyhole.
+func (c *Core) createControlGroupToken(ctx context.Context, cgReq *controlGroupRequest, ttl time.Duration) (*wrapping.ResponseWrapInfo, error) {
+	te := &logical.TokenEntry{
+		Path:           cgReq.Path,
+		Policies:       []string{controlGroupPolicyName},
+		CreationTime:   cgReq.RequestTime.Unix(),
+		TTL:            ttl,
+		ExplicitMaxTTL: ttl,
+		NamespaceID:    cgReq.NamespaceID,
+	}
+	if err := c.tokenStore.create(ctx, te); err != nil {
+		return nil, errwrap.Wrapf("failed to create token: {{err}}", err)
+	}
+
+	if err := c.storeControlGroupRequest(ctx, te, cgReq); err != nil {
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, err
+	}
+
+	// Store the same lookup information as for response-wrapping tokens so
+	// that the token can be inspected with sys/wrapping/lookup
+	cubbyReq := &logical.Request{
+		Operation:   logical.CreateOperation,
+		Path:        "cubbyhole/wrapinfo",
+		ClientToken: te.ID,
+		Data: map[string]interface{}{
+			"creation_ttl":  ttl,
+			"creation_time": cgReq.RequestTime,
+			"creation_path": cgReq.Path,
+		},
+	}
+	cubbyReq.SetTokenEntry(te)
+	cubbyResp, err := c.router.Route(ctx, cubbyReq)
+	switch {
+	case err != nil:
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, errwrap.Wrapf("failed to store wrapping information: {{err}}", err)
+	case cubbyResp != nil && cubbyResp.IsError():
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, errwrap.Wrapf("failed to store wrapping information: {{err}}", cubbyResp.Error())
+	}
+
+	cgAuth := &logical.Auth{
+		ClientToken: te.ID,
+		Policies:    []string{controlGroupPolicyName},
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       te.TTL,
+			Renewable: false,
+		},
+	}
+	if err := c.expiration.RegisterAuth(ctx, te, cgAuth); err != nil {
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, errwrap.Wrapf("failed to register token lease: {{err}}", err)
+	}
+
+	metrics.IncrCounter([]string{"core", "control_group", "request"}, 1)
+
+	return &wrapping.ResponseWrapInfo{
+		TTL:          ttl,
+		Token:        te.ID,
+		Accessor:     te.Accessor,
+		CreationTime: cgReq.RequestTime,
+		CreationPath: cgReq.Path,
+	}, nil
+}
+
+func (c *Core) storeControlGroupRequest(ctx context.Context, te *logical.TokenEntry, cgReq *controlGroupRequest) error {
+	buf, err := json.Marshal(cgReq)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode control group request: {{err}}", err)
+	}
+
+	cubbyReq := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        controlGroupRequestPath,
+		ClientToken: te.ID,
+		Data: map[string]interface{}{
+			"request": string(buf),
+		},
+	}
+	cubbyReq.SetTokenEntry(te)
+	cubbyResp, err := c.router.Route(ctx, cubbyReq)
+	switch {
+	case err != nil:
+		return errwrap.Wrapf("failed to store control group request: {{err}}", err)
+	case cubbyResp != nil && cubbyResp.IsError():
+		return errwrap.Wrapf("failed to store control group request: {{err}}", cubbyResp.Error())
+	}
+
+	return nil
+}
+
+func (c *Core) loadControlGroupRequest(ctx context.Context, te *logical.TokenEntry) (*controlGroupRequest, error) {
+	cubbyReq := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        controlGroupRequestPath,
+		ClientToken: te.ID,
+	}
+	cubbyReq.SetTokenEntry(te)
+	cubbyResp, err := c.router.Route(ctx, cubbyReq)
+	switch {
+	case err != nil:
+		return nil, errwrap.Wrapf("failed to read control group request: {{err}}", err)
+	case cubbyResp == nil || cubbyResp.Data == nil:
+		return nil, nil
+	case cubbyResp.IsError():
+		return nil, errwrap.Wrapf("failed to read control group request: {{err}}", cubbyResp.Error())
+	}
+
+	raw, ok := cubbyResp.Data["request"].(string)
+	if !ok {
+		return nil, errors.New("could not decode control group request")
+	}
+
+	cgReq := new(controlGroupRequest)
+	if err := jsonutil.DecodeJSON([]byte(raw), cgReq); err != nil {
+		return nil, errwrap.Wrapf("failed to decode control group request: {{err}}", err)
+	}
+
+	return cgReq, nil
+}
+
+// controlGroupRequestByAccessor looks up the control group token with the
+// given accessor and the request it holds. The returned context carries the
+// namespace of the token. A nil token entry is returned if the accessor does
+// not belong to a control group token.
+func (c *Core) controlGroupRequestByAccessor(ctx context.Context, accessor string) (context.Context, *logical.TokenEntry, *controlGroupRequest, error) {
+	aEntry, err := c.tokenStore.lookupByAccessor(ctx, accessor, false, false)
+	if err != nil {
+		if _, ok := err.(*logical.StatusBadRequest); ok {
+			return ctx, nil, nil, nil
+		}
+		return ctx, nil, nil, err
+	}
+	if aEntry.TokenID == "" {
+		return ctx, nil, nil, nil
+	}
+
+	te, err := c.tokenStore.Lookup(ctx, aEntry.TokenID)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	if te == nil || len(te.Policies) != 1 || te.Policies[0] != controlGroupPolicyName {
+		return ctx, nil, nil, nil
+	}
+
+	tokenNS, err := NamespaceByID(ctx, te.NamespaceID, c)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	if tokenNS == nil {
+		return ctx, nil, nil, namespace.ErrNoNamespace
+	}
+	ctx = namespace.ContextWithNamespace(ctx, tokenNS)
+
+	cgReq, err := c.loadControlGroupRequest(ctx, te)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+	if cgReq == nil {
+		return ctx, nil, nil, nil
+	}
+
+	return ctx, te, cgReq, nil
+}
+
+// controlGroupEntityGroups returns the IDs and names of all groups the entity
+// is a member of, directly or through group inheritance.
+func (c *Core) controlGroupEntityGroups(entityID string) (map[string]bool, map[string]bool, error) {
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	if c.identityStore == nil {
+		return ids, names, nil
+	}
+
+	direct, inherited, err := c.identityStore.groupsByEntityID(entityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, groups := range [][]*identity.Group{direct, inherited} {
+		for _, group := range groups {
+			ids[group.ID] = true
+			names[group.Name] = true
+		}
+	}
+
+	return ids, names, nil
+}
+
+func factorMatchesGroups(factor *ControlGroupFactor, ids, names map[string]bool) bool {
+	if factor.Identity == nil {
+		return false
+	}
+	for _, id := range factor.Identity.GroupIDs {
+		if ids[id] {
+			return true
+		}
+	}
+	for _, name := range factor.Identity.GroupNames {
+		if names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// canAuthorizeControlGroup returns whether the entity is a member of the
+// groups of at least one of the factors of the request.
+func (c *Core) canAuthorizeControlGroup(cgReq *controlGroupRequest, entityID string) (bool, error) {
+	ids, names, err := c.controlGroupEntityGroups(entityID)
+	if err != nil {
+		return false, err
+	}
+	for _, factor := range cgReq.Factors {
+		if factorMatchesGroups(factor, ids, names) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// controlGroupApproved returns whether every factor of the request has
+// received the required number of approvals. Group membership is evaluated
+// at the time of the check, so authorizations from entities that have since
+// left the groups of a factor no longer count towards it.
+func (c *Core) controlGroupApproved(cgReq *controlGroupRequest) (bool, error) {
+	if len(cgReq.Factors) == 0 {
+		return false, nil
+	}
+
+	type membership struct {
+		ids   map[string]bool
+		names map[string]bool
+	}
+	members := make([]membership, 0, len(cgReq.Authorizations))
+	for _, authz := range cgReq.Authorizations {
+		ids, names, err := c.controlGroupEntityGroups(authz.EntityID)
+		if err != nil {
+			return false, err
+		}
+		members = append(members, membership{ids: ids, names: names})
+	}
+
+	for _, factor := range cgReq.Factors {
+		if factor.Identity == nil {
+			return false, nil
+		}
+		approvals := 0
+		for _, m := range members {
+			if factorMatchesGroups(factor, m.ids, m.names) {
+				approvals++
+			}
+		}
+		if approvals < factor.Identity.ApprovalsRequired {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// controlGroupUnwrap carries out the request held by the given control group
+// token once it has been approved, and returns the marshaled HTTP response.
+// The token is revoked before the request is run so that it can only be
+// carried out once. The request is audited like any other, but the use of the
+// requester's token was already counted when the request was held. If that
+// was the final use of the token, it is revoked after the request is run.
+func (b *SystemBackend) controlGroupUnwrap(ctx context.Context, te *logical.TokenEntry) (string, error) {
+	c := b.Core
+
+	c.controlGroupLock.Lock()
+	cgReq, err := c.loadControlGroupRequest(ctx, te)
+	if err != nil {
+		c.controlGroupLock.Unlock()
+		return "", err
+	}
+	if cgReq == nil {
+		c.controlGroupLock.Unlock()
+		return "no control group request found; token may have already been used", ErrInternalError
+	}
+
+	approved, err := c.controlGroupApproved(cgReq)
+	if err != nil {
+		c.controlGroupLock.Unlock()
+		return "", err
+	}
+	if !approved {
+		c.controlGroupLock.Unlock()
+		return "request needs further approval", logical.ErrPermissionDenied
+	}
+
+	err = c.tokenStore.revokeOrphan(ctx, te.ID)
+	c.controlGroupLock.Unlock()
+	if err != nil {
+		return "", errwrap.Wrapf("failed to revoke control group token: {{err}}", err)
+	}
+
+	reqNS, err := NamespaceByID(ctx, cgReq.NamespaceID, c)
+	if err != nil {
+		return "", err
+	}
+	if reqNS == nil {
+		return "", namespace.ErrNoNamespace
+	}
+
+	reqCtx := namespace.ContextWithNamespace(ctx, reqNS)
+
+	aEntry, err := c.tokenStore.lookupByAccessor(reqCtx, cgReq.ClientTokenAccessor, false, false)
+	if err != nil {
+		if _, ok := err.(*logical.StatusBadRequest); !ok {
+			return "", err
+		}
+	}
+	if aEntry.TokenID == "" {
+		return "the token of the held request is no longer valid", logical.ErrPermissionDenied
+	}
+
+	// A token that was used for the last time by the held request is kept
+	// pending revocation until now
+	lookup := c.tokenStore.Lookup
+	if cgReq.RevokeClientToken {
+		lookup = c.tokenStore.lookupTainted
+	}
+	clientTE, err := lookup(reqCtx, aEntry.TokenID)
+	if err != nil {
+		return "", err
+	}
+	if clientTE == nil {
+		return "the token of the held request is no longer valid", logical.ErrPermissionDenied
+	}
+
+	authorizations := make([]*logical.Authz, 0, len(cgReq.Authorizations))
+	for _, authz := range cgReq.Authorizations {
+		authorizations = append(authorizations, &logical.Authz{
+			AuthorizationTime: authz.AuthorizationTime,
+		})
+	}
+
+	req := &logical.Request{
+		ID:          cgReq.ID,
+		Operation:   cgReq.Operation,
+		Path:        cgReq.Path,
+		Data:        cgReq.Data,
+		Headers:     cgReq.Headers,
+		ClientToken: aEntry.TokenID,
+		Connection: &logical.Connection{
+			RemoteAddr: cgReq.RemoteAddr,
+		},
+		ControlGroup: &logical.ControlGroup{
+			Authorizations: authorizations,
+			RequestTime:    cgReq.RequestTime,
+			Approved:       true,
+			NamespaceID:    cgReq.NamespaceID,
+		},
+	}
+	req.SetTokenEntry(clientTE)
+
+	metrics.IncrCounter([]string{"core", "control_group", "unwrap"}, 1)
+
+	resp, err := c.handleCancelableRequest(reqCtx, reqNS, req)
+	if cgReq.RevokeClientToken {
+		nsActiveCtx := namespace.ContextWithNamespace(c.activeContext, reqNS)
+		leaseID, revokeErr := c.expiration.CreateOrFetchRevocationLeaseByToken(nsActiveCtx, clientTE)
+		if revokeErr == nil {
+			revokeErr = c.expiration.LazyRevoke(reqCtx, leaseID)
+		}
+		if revokeErr != nil {
+			c.logger.Error("failed to revoke token", "error", revokeErr)
+			return "", ErrInternalError
+		}
+		if err == nil && resp != nil && resp.Secret != nil && resp.Secret.LeaseID != "" {
+			return "Secret cannot be returned; token had one use left, so leased credentials were immediately revoked.", logical.ErrInvalidRequest
+		}
+	}
+	if err != nil {
+		if resp != nil && resp.IsError() {
+			return resp.Error().Error(), err
+		}
+		return "", err
+	}
+	if resp == nil {
+		return "", nil
+	}
+	if resp.IsError() {
+		return resp.Error().Error(), logical.ErrInvalidRequest
+	}
+
+	httpResponse := logical.LogicalResponseToHTTPResponse(resp)
+	httpResponse.RequestID = cgReq.ID
+	buf, err := json.Marshal(httpResponse)
+	if err != nil {
+		return "", errwrap.Wrapf("failed to marshal control group response: {{err}}", err)
+	}
+
+	return string(buf), nil
+}
+
+func (b *SystemBackend) handleControlGroupAuthorize(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), nil
+	}
+	if req.EntityID == "" {
+		return logical.ErrorResponse("control group requests can only be authorized by tokens with an entity"), nil
+	}
+
+	c := b.Core
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	cgCtx, te, cgReq, err := c.controlGroupRequestByAccessor(ctx, accessor)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return logical.ErrorResponse("no control group request found for the given accessor"), nil
+	}
+
+	if req.EntityID == cgReq.RequesterEntityID {
+		return logical.ErrorResponse("requesters cannot authorize their own requests"), nil
+	}
+
+	allowed, err := c.canAuthorizeControlGroup(cgReq, req.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	var authorized bool
+	for _, authz := range cgReq.Authorizations {
+		if authz.EntityID == req.EntityID {
+			authorized = true
+			break
+		}
+	}
+
+	if !authorized {
+		authz := &controlGroupAuthorization{
+			EntityID:          req.EntityID,
+			AuthorizationTime: time.Now(),
+		}
+		entity, err := c.identityStore.MemDBEntityByID(req.EntityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity != nil {
+			authz.EntityName = entity.Name
+		}
+		cgReq.Authorizations = append(cgReq.Authorizations, authz)
+
+		if err := c.storeControlGroupRequest(cgCtx, te, cgReq); err != nil {
+			return nil, err
+		}
+		metrics.IncrCounter([]string{"core", "control_group", "authorize"}, 1)
+	}
+
+	approved, err := c.controlGroupApproved(cgReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": approved,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleControlGroupRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), nil
+	}
+
+	c := b.Core
+	_, te, cgReq, err := c.controlGroupRequestByAccessor(ctx, accessor)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return logical.ErrorResponse("no control group request found for the given accessor"), nil
+	}
+
+	approved, err := c.controlGroupApproved(cgReq)
+	if err != nil {
+		return nil, err
+	}
+
+	requestEntity := map[string]interface{}{
+		"id":   cgReq.RequesterEntityID,
+		"name": "",
+	}
+	if cgReq.RequesterEntityID != "" && c.identityStore != nil {
+		entity, err := c.identityStore.MemDBEntityByID(cgReq.RequesterEntityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity != nil {
+			requestEntity["name"] = entity.Name
+		}
+	}
+
+	authorizations := make([]map[string]interface{}, 0, len(cgReq.Authorizations))
+	for _, authz := range cgReq.Authorizations {
+		authorizations = append(authorizations, map[string]interface{}{
+			"entity_id":          authz.EntityID,
+			"entity_name":        authz.EntityName,
+			"authorization_time": authz.AuthorizationTime.Format(time.RFC3339),
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved":       approved,
+			"request_path":   cgReq.Path,
+			"request_time":   cgReq.RequestTime.Format(time.RFC3339),
+			"request_entity": requestEntity,
+			"authorizations": authorizations,
+		},
+	}, nil
+}
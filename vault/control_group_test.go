@@ -0,0 +1,304 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quid/vault/audit"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/jsonutil"
+	"github.com/quid/vault/sdk/logical"
+)
+
+func TestControlGroup_Workflow(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	noop := &NoopAudit{}
+	c.auditBackends["noop"] = func(ctx context.Context, config *audit.BackendConfig) (audit.Backend, error) {
+		noop.Config = config
+		return noop, nil
+	}
+	if err := c.enableAudit(ctx, &MountEntry{
+		Table: auditTableType,
+		Path:  "noop",
+		Type:  "noop",
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	policies := []string{`
+name = "guarded"
+path "secret/foo" {
+	capabilities = ["read"]
+	control_group = {
+		factor "approvers" {
+			identity {
+				group_names = ["approvers"]
+				approvals = 1
+			}
+		}
+	}
+}
+path "sys/policies/acl/authorizer" {
+	capabilities = ["read"]
+	control_group = {
+		factor "approvers" {
+			identity {
+				group_names = ["approvers"]
+				approvals = 1
+			}
+		}
+	}
+}
+`, `
+name = "authorizer"
+path "sys/control-group/authorize" {
+	capabilities = ["update"]
+}
+`}
+	for _, raw := range policies {
+		policy, err := ParseACLPolicy(namespace.RootNamespace, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.policyStore.SetPolicy(ctx, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(ctx, req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	createEntity := func(name string) string {
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "entity",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"name": name,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+		}
+		return resp.Data["id"].(string)
+	}
+	requesterID := createEntity("requester")
+	approverID := createEntity("approver")
+	outsiderID := createEntity("outsider")
+
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "group",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"name":              "approvers",
+			"member_entity_ids": []string{approverID},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	for id, te := range map[string]*logical.TokenEntry{
+		"requester":  {Policies: []string{"guarded"}, EntityID: requesterID, NumUses: 3},
+		"single-use": {Policies: []string{"guarded"}, EntityID: requesterID, NumUses: 1},
+		"approver":   {Policies: []string{"guarded", "authorizer"}, EntityID: approverID},
+		"outsider":   {Policies: []string{"authorizer"}, EntityID: outsiderID},
+	} {
+		te.ID = id
+		te.Path = "auth/token/create"
+		te.TTL = time.Hour
+		testMakeTokenDirectly(t, c.tokenStore, te)
+	}
+
+	// The read is held and a control group token is returned instead
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = "requester"
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" {
+		t.Fatalf("expected wrap info, got: %#v", resp)
+	}
+	if resp.Data != nil {
+		t.Fatalf("expected no data, got: %#v", resp.Data)
+	}
+	cgToken := resp.WrapInfo.Token
+	accessor := resp.WrapInfo.Accessor
+
+	// Only the accessor of the requester's token is stored with the request
+	_, _, cgReq, err := c.controlGroupRequestByAccessor(ctx, accessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requesterEntry, err := c.tokenStore.Lookup(ctx, "requester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cgReq.ClientTokenAccessor != requesterEntry.Accessor {
+		t.Fatalf("bad: accessor: %q", cgReq.ClientTokenAccessor)
+	}
+	if buf, err := jsonutil.EncodeJSON(cgReq); err != nil || strings.Contains(string(buf), `"requester"`) {
+		t.Fatalf("expected the token not to be stored, got: %s, err: %v", buf, err)
+	}
+
+	unwrap := func() (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+		req.ClientToken = cgToken
+		return c.HandleRequest(ctx, req)
+	}
+	authorize := func(token string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+		req.ClientToken = token
+		req.Data["accessor"] = accessor
+		return c.HandleRequest(ctx, req)
+	}
+
+	// The token holder cannot get at the stored request directly
+	req = logical.TestRequest(t, logical.ReadOperation, controlGroupRequestPath)
+	req.ClientToken = cgToken
+	if _, err := c.HandleRequest(ctx, req); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+
+	if _, err := unwrap(); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied before approval, got: %v", err)
+	}
+
+	resp, err = authorize("requester")
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected requester to be unable to authorize, got: %#v", resp)
+	}
+
+	_, err = authorize("outsider")
+	if err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied for outsider, got: %v", err)
+	}
+
+	resp, err = authorize("approver")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	if !resp.Data["approved"].(bool) {
+		t.Fatalf("expected request to be approved, got: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/request")
+	req.ClientToken = root
+	req.Data["accessor"] = accessor
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	if resp.Data["request_path"] != "secret/foo" {
+		t.Fatalf("bad: request_path: %v", resp.Data["request_path"])
+	}
+	authzs := resp.Data["authorizations"].([]map[string]interface{})
+	if len(authzs) != 1 || authzs[0]["entity_name"] != "approver" {
+		t.Fatalf("bad: authorizations: %#v", authzs)
+	}
+
+	// Approval from the same entity is only counted once
+	if resp, err := authorize("approver"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	requesterEntry, err = c.tokenStore.Lookup(ctx, "requester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numUses := requesterEntry.NumUses
+
+	resp, err = unwrap()
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	httpResp := &logical.HTTPResponse{}
+	if err := jsonutil.DecodeJSON(resp.Data[logical.HTTPRawBody].([]byte), httpResp); err != nil {
+		t.Fatal(err)
+	}
+	if httpResp.Data["value"] != "bar" {
+		t.Fatalf("bad: unwrapped data: %#v", httpResp.Data)
+	}
+
+	// Carrying out the request did not count as another use of the token
+	requesterEntry, err = c.tokenStore.Lookup(ctx, "requester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requesterEntry.NumUses != numUses {
+		t.Fatalf("expected %d uses left, got %d", numUses, requesterEntry.NumUses)
+	}
+
+	// The response of the held request was audited
+	var audited bool
+	for i, req := range noop.RespReq {
+		if req.Path == "secret/foo" && req.ControlGroup != nil && noop.Resp[i] != nil && noop.Resp[i].Data["value"] == "bar" {
+			audited = true
+		}
+	}
+	if !audited {
+		t.Fatal("expected the response of the held request to be audited")
+	}
+
+	// The request can only be carried out once
+	if _, err := unwrap(); err == nil {
+		t.Fatal("expected error unwrapping a second time")
+	}
+
+	// A request held with the final use of a token can still be carried out,
+	// after which the token is revoked
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/policies/acl/authorizer")
+	req.ClientToken = "single-use"
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" {
+		t.Fatalf("expected wrap info, got: %#v", resp)
+	}
+	cgToken = resp.WrapInfo.Token
+	accessor = resp.WrapInfo.Accessor
+
+	if te, err := c.tokenStore.Lookup(ctx, "single-use"); err != nil || te != nil {
+		t.Fatalf("expected the token to be unusable while the request is held, got: %#v, err: %v", te, err)
+	}
+
+	if resp, err := authorize("approver"); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	resp, err = unwrap()
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	httpResp = &logical.HTTPResponse{}
+	if err := jsonutil.DecodeJSON(resp.Data[logical.HTTPRawBody].([]byte), httpResp); err != nil {
+		t.Fatal(err)
+	}
+	if httpResp.Data["name"] != "authorizer" {
+		t.Fatalf("bad: unwrapped data: %#v", httpResp.Data)
+	}
+
+	// The revocation is carried out in the background
+	for i := 0; ; i++ {
+		te, err := c.tokenStore.lookupTainted(ctx, "single-use")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if te == nil {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("expected the token to be revoked, got: %#v", te)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -379,6 +380,14 @@ type Core struct {
 	// wrapping information
 	wrappingJWTKey *ecdsa.PrivateKey
 
+	// controlGroupLock serializes changes to the state of pending control
+	// group requests
+	controlGroupLock sync.Mutex
+
+	// mfaUsedCodes holds the TOTP passcodes that were recently accepted for
+	// MFA so that they cannot be replayed within their validity window
+	mfaUsedCodes *cache.Cache
+
 	//
 	// Cluster information
 	//
@@ -502,8 +511,32 @@ type Core struct {
 	raftFollowerStates *raftFollowerStates
 	// Stop channel for raft TLS rotations
 	raftTLSRotationStopCh chan struct{}
+	// Promotes stable non-voters and removes dead servers on the active node
+	raftAutopilot *raftAutopilot
+	// Runs the automated raft snapshots on the active node
+	raftAutoSnapshots *raftAutoSnapshots
+	// raftSnapshotTargets is the mapping of storage types to use for the
+	// automated raft snapshots
+	raftSnapshotTargets map[string]RaftSnapshotTargetFactory
 	// Stores the pending peers we are waiting to give answers
 	pendingRaftPeers *sync.Map
+	// Serializes the updates of the raft non-voters
+	raftNonVotersLock sync.Mutex
+
+	// Stop and done channels of the automatic rotation of the barrier key
+	barrierAutoRotateStopCh chan struct{}
+	barrierAutoRotateDoneCh chan struct{}
+
+	// barrierRewrap re-encrypts the storage under the newest term
+	barrierRewrap *barrierRewrap
+
+	// sealRewrap re-wraps the seal-wrapped entries with the current key of
+	// the seal
+	sealRewrap *sealRewrap
+
+	// storageMigration is the online migration of the storage to another
+	// backend, nil unless a destination is configured
+	storageMigration *storageMigration
 
 	// rawConfig stores the config as-is from the provided server configuration.
 	rawConfig *atomic.Value
@@ -540,10 +573,19 @@ type CoreConfig struct {
 
 	AuditBackends map[string]audit.Factory
 
+	// RaftSnapshotTargets are the storage types of the automated raft
+	// snapshots, in addition to the local one
+	RaftSnapshotTargets map[string]RaftSnapshotTargetFactory
+
 	Physical physical.Backend
 
 	StorageType string
 
+	// StorageMigrationDestination is the backend the storage can be migrated
+	// to online, may be nil
+	StorageMigrationDestination     physical.Backend
+	StorageMigrationDestinationType string
+
 	// May be nil, which disables HA operations
 	HAPhysical physical.HABackend
 
@@ -617,39 +659,42 @@ type CoreConfig struct {
 
 func (c *CoreConfig) Clone() *CoreConfig {
 	return &CoreConfig{
-		DevToken:                  c.DevToken,
-		LogicalBackends:           c.LogicalBackends,
-		CredentialBackends:        c.CredentialBackends,
-		AuditBackends:             c.AuditBackends,
-		Physical:                  c.Physical,
-		HAPhysical:                c.HAPhysical,
-		ServiceRegistration:       c.ServiceRegistration,
-		Seal:                      c.Seal,
-		Logger:                    c.Logger,
-		DisableCache:              c.DisableCache,
-		DisableMlock:              c.DisableMlock,
-		CacheSize:                 c.CacheSize,
-		StorageType:               c.StorageType,
-		RedirectAddr:              c.RedirectAddr,
-		ClusterAddr:               c.ClusterAddr,
-		DefaultLeaseTTL:           c.DefaultLeaseTTL,
-		MaxLeaseTTL:               c.MaxLeaseTTL,
-		ClusterName:               c.ClusterName,
-		ClusterCipherSuites:       c.ClusterCipherSuites,
-		EnableUI:                  c.EnableUI,
-		EnableRaw:                 c.EnableRaw,
-		PluginDirectory:           c.PluginDirectory,
-		DisableSealWrap:           c.DisableSealWrap,
-		ReloadFuncs:               c.ReloadFuncs,
-		ReloadFuncsLock:           c.ReloadFuncsLock,
-		LicensingConfig:           c.LicensingConfig,
-		DevLicenseDuration:        c.DevLicenseDuration,
-		DisablePerformanceStandby: c.DisablePerformanceStandby,
-		DisableIndexing:           c.DisableIndexing,
-		AllLoggers:                c.AllLoggers,
-		CounterSyncInterval:       c.CounterSyncInterval,
-		ClusterNetworkLayer:       c.ClusterNetworkLayer,
-		entCoreConfig:             c.entCoreConfig.Clone(),
+		DevToken:                        c.DevToken,
+		LogicalBackends:                 c.LogicalBackends,
+		CredentialBackends:              c.CredentialBackends,
+		AuditBackends:                   c.AuditBackends,
+		RaftSnapshotTargets:             c.RaftSnapshotTargets,
+		Physical:                        c.Physical,
+		StorageMigrationDestination:     c.StorageMigrationDestination,
+		StorageMigrationDestinationType: c.StorageMigrationDestinationType,
+		HAPhysical:                      c.HAPhysical,
+		ServiceRegistration:             c.ServiceRegistration,
+		Seal:                            c.Seal,
+		Logger:                          c.Logger,
+		DisableCache:                    c.DisableCache,
+		DisableMlock:                    c.DisableMlock,
+		CacheSize:                       c.CacheSize,
+		StorageType:                     c.StorageType,
+		RedirectAddr:                    c.RedirectAddr,
+		ClusterAddr:                     c.ClusterAddr,
+		DefaultLeaseTTL:                 c.DefaultLeaseTTL,
+		MaxLeaseTTL:                     c.MaxLeaseTTL,
+		ClusterName:                     c.ClusterName,
+		ClusterCipherSuites:             c.ClusterCipherSuites,
+		EnableUI:                        c.EnableUI,
+		EnableRaw:                       c.EnableRaw,
+		PluginDirectory:                 c.PluginDirectory,
+		DisableSealWrap:                 c.DisableSealWrap,
+		ReloadFuncs:                     c.ReloadFuncs,
+		ReloadFuncsLock:                 c.ReloadFuncsLock,
+		LicensingConfig:                 c.LicensingConfig,
+		DevLicenseDuration:              c.DevLicenseDuration,
+		DisablePerformanceStandby:       c.DisablePerformanceStandby,
+		DisableIndexing:                 c.DisableIndexing,
+		AllLoggers:                      c.AllLoggers,
+		CounterSyncInterval:             c.CounterSyncInterval,
+		ClusterNetworkLayer:             c.ClusterNetworkLayer,
+		entCoreConfig:                   c.entCoreConfig.Clone(),
 	}
 }
 
@@ -753,6 +798,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		clusterName:                  conf.ClusterName,
 		clusterNetworkLayer:          conf.ClusterNetworkLayer,
 		clusterPeerClusterAddrsCache: cache.New(3*cluster.HeartbeatInterval, time.Second),
+		mfaUsedCodes:                 cache.New(0, 30*time.Second),
 		enableMlock:                  !conf.DisableMlock,
 		rawEnabled:                   conf.EnableRaw,
 		shutdownDoneCh:               make(chan struct{}),
@@ -843,6 +889,13 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 	c.seal.SetCore(c)
 
+	if conf.StorageMigrationDestination != nil {
+		c.storageMigration = newStorageMigration(c, conf)
+	}
+
+	c.barrierRewrap = newBarrierRewrap(c, conf)
+	c.sealRewrap = newSealRewrap(c, conf)
+
 	if err := coreInit(c, conf); err != nil {
 		return nil, err
 	}
@@ -943,6 +996,14 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 	c.auditBackends = auditBackends
 
+	raftSnapshotTargets := map[string]RaftSnapshotTargetFactory{
+		raftAutoSnapshotLocalStorage: newLocalRaftSnapshotTarget,
+	}
+	for k, f := range conf.RaftSnapshotTargets {
+		raftSnapshotTargets[k] = f
+	}
+	c.raftSnapshotTargets = raftSnapshotTargets
+
 	uiStoragePrefix := systemBarrierPrefix + "ui"
 	c.uiConfig = NewUIConfig(conf.EnableUI, physical.NewView(c.physical, uiStoragePrefix), NewBarrierView(c.barrier, uiStoragePrefix))
 
@@ -1858,6 +1919,12 @@ type UnsealStrategy interface {
 type standardUnsealStrategy struct{}
 
 func (s standardUnsealStrategy) unseal(ctx context.Context, logger log.Logger, c *Core) error {
+	// Duplicate the writes to the destination of a storage migration before
+	// anything is written
+	if err := c.setupStorageMigration(ctx); err != nil {
+		return err
+	}
+
 	// Clear forwarding clients; we're active
 	c.requestForwardingConnectionLock.Lock()
 	c.clearForwardingClients()
@@ -2023,6 +2090,14 @@ func (c *Core) postUnseal(ctx context.Context, ctxCancelFunc context.CancelFunc,
 	c.metricsCh = make(chan struct{})
 	go c.emitMetrics(c.metricsCh)
 
+	if !c.ReplicationState().HasState(consts.ReplicationPerformanceSecondary | consts.ReplicationDRSecondary) {
+		c.startBarrierAutoRotate(c.activeContext)
+
+		if err := c.startBarrierRewrap(c.activeContext); err != nil {
+			c.logger.Warn("post-unseal barrier rewrap setup failed", "error", err)
+		}
+	}
+
 	// This is intentionally the last block in this function. We want to allow
 	// writes just before allowing client requests, to ensure everything has
 	// been set up properly before any writes can have happened.
@@ -2064,6 +2139,14 @@ func (c *Core) preSeal() error {
 
 	c.stopRaftActiveNode()
 
+	c.stopBarrierAutoRotate()
+
+	c.stopBarrierRewrap()
+
+	c.stopSealRewrap()
+
+	c.stopStorageMigration()
+
 	c.clusterParamsLock.Lock()
 	if err := stopReplication(c); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error stopping replication: {{err}}", err))
@@ -2239,7 +2322,7 @@ func (c *Core) adjustForSealMigration(unwrapSeal Seal) error {
 	if unwrapSeal == nil {
 		// We have the same barrier type and the unwrap seal is nil so we're not
 		// migrating from same to same, IOW we assume it's not a migration
-		if existBarrierSealConfig.Type == barrierSeal.BarrierType() {
+		if sealTypeCompatible(barrierSeal, existBarrierSealConfig.Type) {
 			return nil
 		}
 
@@ -2539,6 +2622,176 @@ func (c *Core) ApplyRateLimitQuota(req *quotas.Request) (quotas.Response, error)
 	return quotas.Response{Allowed: true}, nil
 }
 
+// RateLimitQuotaKeyType returns what the rate limit quota applicable to the
+// request keeps separate client rate limiters for, or an empty string if no
+// quota applies. Callers use it to decide which client details to gather
+// before applying the quota.
+func (c *Core) RateLimitQuotaKeyType(req *quotas.Request) (string, error) {
+	if c.quotaManager == nil {
+		return "", nil
+	}
+
+	req.Type = quotas.TypeRateLimit
+	quota, err := c.quotaManager.QueryQuota(req)
+	if err != nil {
+		return "", err
+	}
+	if quota == nil {
+		return "", nil
+	}
+
+	return quota.(*quotas.RateLimitQuota).ClientKeyType(), nil
+}
+
+// RequestSizeQuotaLimit returns the maximum request body size allowed by the
+// request size quota rule applicable to the request, or zero if no quota
+// limits the size of request bodies.
+func (c *Core) RequestSizeQuotaLimit(req *quotas.Request) (int64, error) {
+	if c.quotaManager == nil {
+		return 0, nil
+	}
+
+	req.Type = quotas.TypeRequestSize
+	quota, err := c.quotaManager.QueryQuota(req)
+	if err != nil {
+		return 0, err
+	}
+	if quota == nil {
+		return 0, nil
+	}
+
+	return quota.(*quotas.RequestSizeQuota).MaxRequestSize, nil
+}
+
+// applyRequestSizeQuota checks the size of the given request or response data
+// against the applicable request size quota rule. The size is that of the JSON
+// encoding of the data, which is what gets written to storage or returned to
+// the client. The data is only encoded when a quota rule applies.
+func (c *Core) applyRequestSizeQuota(in *quotas.Request, data map[string]interface{}, isResponse bool) (quotas.Response, error) {
+	in.Type = quotas.TypeRequestSize
+	if c.quotaManager == nil || len(data) == 0 {
+		return quotas.Response{Allowed: true}, nil
+	}
+
+	quota, err := c.quotaManager.QueryQuota(in)
+	if err != nil {
+		return quotas.Response{}, err
+	}
+	if quota == nil {
+		return quotas.Response{Allowed: true}, nil
+	}
+
+	encoded, err := jsonutil.EncodeJSON(data)
+	if err != nil {
+		return quotas.Response{}, err
+	}
+	if isResponse {
+		in.ResponseSize = int64(len(encoded))
+	} else {
+		in.RequestSize = int64(len(encoded))
+	}
+
+	return c.quotaManager.ApplyQuota(in)
+}
+
+// applyLeaseCountQuota checks the request against the applicable lease count
+// quota rule. An allowed request must be acknowledged with ackLeaseQuota once
+// it has been handled.
+func (c *Core) applyLeaseCountQuota(in *quotas.Request) (*quotas.Response, error) {
+	in.Type = quotas.TypeLeaseCount
+	if c.quotaManager == nil {
+		return &quotas.Response{Allowed: true}, nil
+	}
+
+	resp, err := c.quotaManager.ApplyQuota(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// ackLeaseQuota releases the hold a request had on a lease count quota. A lease
+// generated by the request has already been counted when it was registered
+// with the expiration manager.
+func (c *Core) ackLeaseQuota(access quotas.Access, leaseGenerated bool) error {
+	if c.quotaManager == nil {
+		return nil
+	}
+
+	return c.quotaManager.AckLeaseQuota(access)
+}
+
+// quotaLeaseWalker calls the callback with the quota request of every lease in
+// the expiration manager until the callback returns false.
+func (c *Core) quotaLeaseWalker(ctx context.Context, callback func(request *quotas.Request) bool) error {
+	if c.expiration == nil {
+		return nil
+	}
+
+	var err error
+	c.expiration.pending.Range(func(k, v interface{}) bool {
+		var req *quotas.Request
+		req, err = c.leaseQuotaRequest(ctx, k.(string))
+		if err != nil {
+			return false
+		}
+		return callback(req)
+	})
+
+	return err
+}
+
+// quotasHandleLeases informs the quota manager of the action the expiration
+// manager took on the given leases.
+func (c *Core) quotasHandleLeases(ctx context.Context, action quotas.LeaseAction, leaseIDs []string) error {
+	if c.quotaManager == nil {
+		return nil
+	}
+
+	for _, leaseID := range leaseIDs {
+		req, err := c.leaseQuotaRequest(ctx, leaseID)
+		if err != nil {
+			return err
+		}
+		if err := c.quotaManager.HandleLeaseAction(action, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// leaseQuotaRequest builds the quota request for the request that generated the
+// given lease. The request path is the lease ID without its trailing
+// identifier.
+func (c *Core) leaseQuotaRequest(ctx context.Context, leaseID string) (*quotas.Request, error) {
+	ns := namespace.RootNamespace
+	if _, nsID := namespace.SplitIDFromString(leaseID); nsID != "" {
+		leaseNS, err := NamespaceByID(ctx, nsID, c)
+		if err != nil {
+			return nil, err
+		}
+		if leaseNS != nil {
+			ns = leaseNS
+		}
+	}
+
+	reqPath := leaseID
+	if idx := strings.LastIndex(leaseID, "/"); idx != -1 {
+		reqPath = leaseID[:idx]
+	}
+
+	mountPath := c.router.MatchingMount(namespace.ContextWithNamespace(ctx, ns), reqPath)
+
+	return &quotas.Request{
+		Type:          quotas.TypeLeaseCount,
+		Path:          reqPath,
+		NamespacePath: ns.Path,
+		MountPath:     strings.TrimPrefix(mountPath, ns.Path),
+	}, nil
+}
+
 // RateLimitAuditLoggingEnabled returns if the quota configuration allows audit
 // logging of request rejections due to rate limiting quota rule violations.
 func (c *Core) RateLimitAuditLoggingEnabled() bool {
@@ -9,7 +9,6 @@ import (
 	"github.com/quid/vault/sdk/helper/license"
 	"github.com/quid/vault/sdk/logical"
 	"github.com/quid/vault/sdk/physical"
-	"github.com/quid/vault/vault/quotas"
 	"github.com/quid/vault/vault/replication"
 )
 
@@ -26,6 +25,9 @@ type LicensingConfig struct {
 
 func coreInit(c *Core, conf *CoreConfig) error {
 	phys := conf.Physical
+	if c.storageMigration != nil {
+		phys = c.storageMigration.backend
+	}
 	_, txnOK := phys.(physical.Transactional)
 	sealUnwrapperLogger := conf.Logger.Named("storage.sealunwrapper")
 	c.allLoggers = append(c.allLoggers, sealUnwrapperLogger)
@@ -134,22 +136,6 @@ func (c *Core) initSealsForMigration() {}
 
 func (c *Core) postSealMigration(ctx context.Context) error { return nil }
 
-func (c *Core) applyLeaseCountQuota(in *quotas.Request) (*quotas.Response, error) {
-	return &quotas.Response{Allowed: true}, nil
-}
-
-func (c *Core) ackLeaseQuota(access quotas.Access, leaseGenerated bool) error {
-	return nil
-}
-
-func (c *Core) quotaLeaseWalker(ctx context.Context, callback func(request *quotas.Request) bool) error {
-	return nil
-}
-
-func (c *Core) quotasHandleLeases(ctx context.Context, action quotas.LeaseAction, leaseIDs []string) error {
-	return nil
-}
-
 func (c *Core) namespaceByPath(path string) *namespace.Namespace {
 	return namespace.RootNamespace
 }
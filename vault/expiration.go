@@ -1495,7 +1495,13 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 	m.pending.Store(le.LeaseID, pending)
 
 	if leaseCreated {
-		if err := m.core.quotasHandleLeases(m.quitContext, quotas.LeaseActionCreated, []string{le.LeaseID}); err != nil {
+		// Leases loaded from storage after unseal rebuild the lease count
+		// quota counters
+		action := quotas.LeaseActionCreated
+		if m.inRestoreMode() {
+			action = quotas.LeaseActionLoaded
+		}
+		if err := m.core.quotasHandleLeases(m.quitContext, action, []string{le.LeaseID}); err != nil {
 			m.logger.Error("failed to update quota on lease creation", "error", err)
 			return
 		}
@@ -1,7 +1,10 @@
 package quotas
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -419,3 +422,190 @@ func TestQuotas_RateLimitQuota(t *testing.T) {
 		t.Fatalf("unexpected number of failed requests: %d", numFail)
 	}
 }
+
+func TestQuotas_LeaseCountQuota_Mount(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+
+	vault.TestWaitActive(t, core)
+
+	setupMounts(t, client)
+	defer teardownMounts(t, client)
+
+	_, err := client.Logical().Write("sys/quotas/lease-count/lcq", map[string]interface{}{
+		"max_leases": 3,
+		"path":       "pki/",
+	})
+	require.NoError(t, err)
+
+	issue := func() (*api.Secret, error) {
+		return client.Logical().Write("pki/issue/test", map[string]interface{}{
+			"common_name": "foo.testvault.com",
+			"ttl":         "1h",
+		})
+	}
+
+	var leaseIDs []string
+	for i := 0; i < 3; i++ {
+		secret, err := issue()
+		require.NoError(t, err)
+		leaseIDs = append(leaseIDs, secret.LeaseID)
+	}
+
+	// the quota is exhausted, so no more leases can be generated on the mount
+	_, err = issue()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "lease count quota exceeded")
+
+	// requests that don't generate leases are unaffected
+	_, err = client.Logical().Read("pki/cert/ca_chain")
+	require.NoError(t, err)
+
+	s, err := client.Logical().Read("sys/quotas/lease-count/lcq")
+	require.NoError(t, err)
+	require.Equal(t, "pki/", s.Data["path"])
+	require.EqualValues(t, "3", s.Data["counter"].(json.Number).String())
+
+	// revoking a lease makes room for another
+	require.NoError(t, client.Sys().Revoke(leaseIDs[0]))
+	_, err = issue()
+	require.NoError(t, err)
+
+	// raising the limit allows further leases
+	_, err = client.Logical().Write("sys/quotas/lease-count/lcq", map[string]interface{}{
+		"max_leases": 4,
+		"path":       "pki/",
+	})
+	require.NoError(t, err)
+	_, err = issue()
+	require.NoError(t, err)
+	_, err = issue()
+	require.Error(t, err)
+}
+
+func TestQuotas_RateLimitQuota_Stats(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+
+	vault.TestWaitActive(t, core)
+
+	_, err := client.Logical().Write("sys/quotas/rate-limit/rlq", map[string]interface{}{
+		"rate":     1,
+		"burst":    1,
+		"path":     "secret/",
+		"key_type": "entity",
+	})
+	require.NoError(t, err)
+
+	s, err := client.Logical().Read("sys/quotas/rate-limit/rlq")
+	require.NoError(t, err)
+	require.Equal(t, "entity", s.Data["key_type"])
+
+	_, err = client.Logical().Write("sys/quotas/rate-limit/rlq", map[string]interface{}{
+		"rate":     1,
+		"burst":    1,
+		"key_type": "bogus",
+	})
+	require.Error(t, err)
+
+	// the root token has no entity, so it is limited by client IP address
+	_, err = client.Logical().List("secret/")
+	require.NoError(t, err)
+	_, err = client.Logical().List("secret/")
+	require.Error(t, err)
+
+	s, err = client.Logical().Read("sys/quotas/rate-limit/rlq/stats")
+	require.NoError(t, err)
+	clients := s.Data["clients"].([]interface{})
+	require.Len(t, clients, 1)
+	top := clients[0].(map[string]interface{})
+	require.Equal(t, "ip", top["key_type"])
+	require.Equal(t, "127.0.0.1", top["key"])
+	require.Equal(t, "1", top["rejected"].(json.Number).String())
+}
+
+func TestQuotas_RequestSizeQuota_Mount(t *testing.T) {
+	conf, opts := teststorage.ClusterSetup(coreConfig, nil, nil)
+	cluster := vault.NewTestCluster(t, conf, opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	client := cluster.Cores[0].Client
+
+	vault.TestWaitActive(t, core)
+
+	_, err := client.Logical().Write("sys/quotas/request-size/rsq", map[string]interface{}{
+		"max_request_size": 64,
+		"path":             "secret/",
+	})
+	require.NoError(t, err)
+
+	s, err := client.Logical().Read("sys/quotas/request-size/rsq")
+	require.NoError(t, err)
+	require.Equal(t, "secret/", s.Data["path"])
+	require.Equal(t, "64", s.Data["max_request_size"].(json.Number).String())
+
+	_, err = client.Logical().Write("secret/small", map[string]interface{}{
+		"value": "foo",
+	})
+	require.NoError(t, err)
+
+	_, err = client.Logical().Write("secret/large", map[string]interface{}{
+		"value": strings.Repeat("a", 128),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Code: 413")
+	require.Contains(t, err.Error(), "request size quota exceeded")
+
+	// form bodies are limited too
+	formReq := client.NewRequest("PUT", "/v1/secret/large")
+	formReq.Headers = http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}}
+	formReq.BodyBytes = []byte("value=" + strings.Repeat("a", 128))
+	_, err = client.RawRequest(formReq)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Code: 413")
+	s, err = client.Logical().Read("secret/large")
+	require.NoError(t, err)
+	require.Nil(t, s)
+
+	// other mounts are unaffected
+	_, err = client.Logical().Write("sys/policies/acl/large", map[string]interface{}{
+		"policy": fmt.Sprintf("# %s\npath \"secret/*\" {\n\tcapabilities = [\"read\"]\n}", strings.Repeat("a", 128)),
+	})
+	require.NoError(t, err)
+
+	// responses are limited once a response size is set
+	_, err = client.Logical().Write("sys/quotas/request-size/rsq", map[string]interface{}{
+		"max_request_size":  256,
+		"max_response_size": 64,
+		"path":              "secret/",
+	})
+	require.NoError(t, err)
+
+	_, err = client.Logical().Write("secret/large", map[string]interface{}{
+		"value": strings.Repeat("a", 128),
+	})
+	require.NoError(t, err)
+	_, err = client.Logical().Read("secret/small")
+	require.NoError(t, err)
+	_, err = client.Logical().Read("secret/large")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Code: 413")
+	require.Contains(t, err.Error(), "response size quota exceeded")
+
+	_, err = client.Logical().Write("sys/quotas/request-size/rsq", map[string]interface{}{
+		"path": "secret/",
+	})
+	require.Error(t, err)
+}
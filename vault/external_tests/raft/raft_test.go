@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/go-cleanhttp"
+	hclog "github.com/hashicorp/go-hclog"
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/quid/vault/api"
 	"github.com/quid/vault/helper/namespace"
@@ -20,7 +25,9 @@ import (
 	"github.com/quid/vault/helper/testhelpers/teststorage"
 	vaulthttp "github.com/quid/vault/http"
 	"github.com/quid/vault/physical/raft"
+	"github.com/quid/vault/sdk/logical"
 	"github.com/quid/vault/vault"
+	vaultseal "github.com/quid/vault/vault/seal"
 	"golang.org/x/net/http2"
 )
 
@@ -247,6 +254,64 @@ func TestRaft_Configuration(t *testing.T) {
 	}
 }
 
+func TestRaft_Suffrage(t *testing.T) {
+	cluster := raftCluster(t)
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+
+	suffrages := func() map[string]string {
+		t.Helper()
+
+		secret, err := client.Logical().Read("sys/storage/raft/configuration")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret := make(map[string]string)
+		for _, s := range secret.Data["config"].(map[string]interface{})["servers"].([]interface{}) {
+			server := s.(map[string]interface{})
+			ret[server["node_id"].(string)] = server["suffrage"].(string)
+		}
+		return ret
+	}
+
+	_, err := client.Logical().Write("sys/storage/raft/suffrage", map[string]interface{}{
+		"server_id": "core-2",
+		"suffrage":  "non-voter",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suffrage := suffrages()["core-2"]; suffrage != "non-voter" {
+		t.Fatalf("expected core-2 to be demoted, got %q", suffrage)
+	}
+
+	// The leader can't be demoted
+	_, err = client.Logical().Write("sys/storage/raft/suffrage", map[string]interface{}{
+		"server_id": "core-0",
+		"suffrage":  "non-voter",
+	})
+	if err == nil {
+		t.Fatal("expected an error demoting the leader")
+	}
+
+	_, err = client.Logical().Write("sys/storage/raft/suffrage", map[string]interface{}{
+		"server_id": "core-2",
+		"suffrage":  "voter",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"core-0": "voter",
+		"core-1": "voter",
+		"core-2": "voter",
+	}
+	if actual := suffrages(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad suffrages: %v", actual)
+	}
+}
+
 func TestRaft_ShamirUnseal(t *testing.T) {
 	cluster := raftCluster(t)
 	defer cluster.Cleanup()
@@ -847,3 +912,225 @@ func verifyRaftPeers(t *testing.T, client *api.Client, expected map[string]bool)
 		t.Fatalf("failed to read configuration successfully, expected peers no found in configuration list: %v", expected)
 	}
 }
+
+func TestRaft_SnapshotAuto(t *testing.T) {
+	cluster := raftCluster(t)
+	defer cluster.Cleanup()
+
+	dir, err := ioutil.TempDir("", "vault-test-raft-snapshot-auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := cluster.Cores[0].Client
+	_, err = client.Logical().Write("sys/storage/raft/snapshot-auto/config/hourly", map[string]interface{}{
+		"interval":    "1s",
+		"retain":      2,
+		"path_prefix": dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the oldest snapshots to be removed
+	var status *api.Secret
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		status, err = client.Logical().Read("sys/storage/raft/snapshot-auto/status/hourly")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Data["last_error"] != "" {
+			t.Fatalf("snapshot failed: %v", status.Data["last_error"])
+		}
+		if snapshots, ok := status.Data["snapshots"].([]interface{}); ok && len(snapshots) == 2 && status.Data["last_success_time"] != "" {
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) == 2 && files[0].Name() == snapshots[0] && files[1].Name() == snapshots[1] {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshots were not retained: %v", status.Data)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	for _, snapshot := range status.Data["snapshots"].([]interface{}) {
+		info, err := os.Stat(filepath.Join(dir, snapshot.(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			t.Fatalf("empty snapshot %s", snapshot)
+		}
+	}
+
+	if _, err := client.Logical().Delete("sys/storage/raft/snapshot-auto/config/hourly"); err != nil {
+		t.Fatal(err)
+	}
+	status, err = client.Logical().Read("sys/storage/raft/snapshot-auto/status/hourly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != nil {
+		t.Fatalf("expected no status after deleting the configuration: %v", status.Data)
+	}
+}
+
+func TestRaft_SnapshotExtract(t *testing.T) {
+	conf := vault.CoreConfig{
+		EnableRaw: true,
+	}
+	opts := vault.TestClusterOptions{HandlerFunc: vaulthttp.Handler}
+	teststorage.RaftBackendSetup(&conf, &opts)
+	cluster := vault.NewTestCluster(t, &conf, &opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+
+	leaderClient := cluster.Cores[0].Client
+
+	// Write a few keys
+	for i := 0; i < 10; i++ {
+		_, err := leaderClient.Logical().Write(fmt.Sprintf("secret/%d", i), map[string]interface{}{
+			"test": "data",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := leaderClient.Sys().RaftSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the keys
+	for i := 0; i < 10; i++ {
+		if _, err := leaderClient.Logical().Delete(fmt.Sprintf("secret/%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	snap, err := vault.LoadRaftSnapshot(ctx, hclog.NewNullLogger(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Metadata.Index == 0 {
+		t.Fatal("expected a snapshot index")
+	}
+
+	unsealKeys := make([]string, 0, len(cluster.BarrierKeys))
+	for _, key := range cluster.BarrierKeys {
+		unsealKeys = append(unsealKeys, base64.StdEncoding.EncodeToString(key))
+	}
+
+	// The master key can't be recovered from too few keys
+	if err := snap.Unseal(ctx, unsealKeys[:1]); err == nil {
+		t.Fatal("expected an error with a single unseal key")
+	}
+	if err := snap.Unseal(ctx, unsealKeys); err != nil {
+		t.Fatal(err)
+	}
+
+	mount, err := snap.Mount(ctx, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mount.Type != "kv" || mount.Prefix != "logical/"+mount.UUID+"/" {
+		t.Fatalf("bad mount: %#v", mount)
+	}
+
+	// Restore the keys of the mount through sys/raw
+	var keys []string
+	err = snap.ReadMount(ctx, mount, func(entry *logical.StorageEntry) error {
+		keys = append(keys, entry.Key)
+		_, err := leaderClient.Logical().Write("sys/raw/"+mount.Prefix+entry.Key, map[string]interface{}{
+			"value":    base64.StdEncoding.EncodeToString(entry.Value),
+			"encoding": "base64",
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 10 {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	secret, err := leaderClient.Logical().Read("secret/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Data["test"] != "data" {
+		t.Fatalf("bad restored secret: %v", secret)
+	}
+}
+
+func TestRaft_SnapshotExtract_AutoSeal(t *testing.T) {
+	var conf vault.CoreConfig
+	opts := vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+		NumCores:    1,
+		SealFunc: func() vault.Seal {
+			return vault.NewAutoSeal(vaultseal.NewTestSeal(nil))
+		},
+	}
+	teststorage.RaftBackendSetup(&conf, &opts)
+	cluster := vault.NewTestCluster(t, &conf, &opts)
+	cluster.Start()
+	defer cluster.Cleanup()
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+
+	leaderClient := cluster.Cores[0].Client
+	if _, err := leaderClient.Logical().Write("secret/foo", map[string]interface{}{
+		"test": "data",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := leaderClient.Sys().RaftSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	snap, err := vault.LoadRaftSnapshot(ctx, hclog.NewNullLogger(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The recovery keys can't decrypt the master key
+	recoveryKeys := make([]string, 0, len(cluster.RecoveryKeys))
+	for _, key := range cluster.RecoveryKeys {
+		recoveryKeys = append(recoveryKeys, base64.StdEncoding.EncodeToString(key))
+	}
+	if err := snap.Unseal(ctx, recoveryKeys); err == nil {
+		t.Fatal("expected an error unsealing with the recovery keys")
+	}
+
+	if err := snap.UnsealWithSeal(ctx, vaultseal.NewTestSeal(nil).Wrapper); err != nil {
+		t.Fatal(err)
+	}
+
+	mount, err := snap.Mount(ctx, "secret/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	err = snap.ReadMount(ctx, mount, func(entry *logical.StorageEntry) error {
+		keys = append(keys, entry.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"foo"}) {
+		t.Fatalf("bad keys: %v", keys)
+	}
+}
@@ -802,6 +802,7 @@ func joinRaftFollowers(t *testing.T, cluster *vault.TestCluster, useStoredKeys b
 	}
 
 	testhelpers.WaitForNCoresUnsealed(t, cluster, len(cluster.Cores))
+	testhelpers.WaitForRaftVoters(t, leader, len(cluster.Cores))
 }
 
 func awaitUnsealWithStoredKeys(t *testing.T, core *vault.TestClusterCore) {
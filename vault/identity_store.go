@@ -83,6 +83,9 @@ func NewIdentityStore(ctx context.Context, core *Core, config *logical.BackendCo
 		PathsSpecial: &logical.Paths{
 			Unauthenticated: []string{
 				"oidc/.well-known/*",
+				"oidc/provider/+/.well-known/*",
+				"oidc/provider/+/token",
+				"oidc/provider/+/userinfo",
 			},
 		},
 		PeriodicFunc: func(ctx context.Context, req *logical.Request) error {
@@ -93,6 +96,8 @@ func NewIdentityStore(ctx context.Context, core *Core, config *logical.BackendCo
 	}
 
 	iStore.oidcCache = newOIDCCache()
+	iStore.oidcAuthCodeCache = newOIDCProviderCache()
+	iStore.oidcAccessTokenCache = newOIDCProviderCache()
 
 	err = iStore.Setup(ctx, config)
 	if err != nil {
@@ -111,6 +116,7 @@ func (i *IdentityStore) paths() []*framework.Path {
 		lookupPaths(i),
 		upgradePaths(i),
 		oidcPaths(i),
+		oidcProviderPaths(i),
 	)
 }
 
@@ -317,7 +323,7 @@ func (i *IdentityStore) Invalidate(ctx context.Context, key string) {
 		txn.Commit()
 		return
 
-	case strings.HasPrefix(key, oidcTokensPrefix):
+	case strings.HasPrefix(key, oidcTokensPrefix), strings.HasPrefix(key, oidcProviderPrefix):
 		ns, err := namespace.FromContext(ctx)
 		if err != nil {
 			i.logger.Error("error retrieving namespace", "error", err)
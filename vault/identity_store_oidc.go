@@ -596,6 +596,32 @@ func (i *IdentityStore) pathOIDCDeleteKey(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
 	}
 
+	// the same goes for a key that is referenced by a provider client
+	clientNames, err := req.Storage.List(ctx, clientPath)
+	if err != nil {
+		i.oidcLock.Unlock()
+		return nil, err
+	}
+
+	clientsReferencingTargetKeyName := make([]string, 0)
+	for _, clientName := range clientNames {
+		client, err := i.getOIDCClient(ctx, req.Storage, clientName)
+		if err != nil {
+			i.oidcLock.Unlock()
+			return nil, err
+		}
+		if client != nil && client.Key == targetKeyName {
+			clientsReferencingTargetKeyName = append(clientsReferencingTargetKeyName, clientName)
+		}
+	}
+
+	if len(clientsReferencingTargetKeyName) > 0 {
+		errorMessage := fmt.Sprintf("unable to delete key %q because it is currently referenced by these clients: %s",
+			targetKeyName, strings.Join(clientsReferencingTargetKeyName, ", "))
+		i.oidcLock.Unlock()
+		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
+	}
+
 	// key can safely be deleted now
 	err = req.Storage.Delete(ctx, namedKeyConfigPath+targetKeyName)
 	if err != nil {
@@ -1627,6 +1653,14 @@ func newOIDCCache() *oidcCache {
 	}
 }
 
+// newOIDCProviderCache returns a cache for items that are set with their own
+// expiration, which are periodically removed once expired.
+func newOIDCProviderCache() *oidcCache {
+	return &oidcCache{
+		c: cache.New(cache.NoExpiration, time.Minute),
+	}
+}
+
 func (c *oidcCache) nskey(ns *namespace.Namespace, key string) string {
 	return fmt.Sprintf("v0:%s:%s", ns.ID, key)
 }
@@ -1648,6 +1682,24 @@ func (c *oidcCache) SetDefault(ns *namespace.Namespace, key string, obj interfac
 	return nil
 }
 
+func (c *oidcCache) Set(ns *namespace.Namespace, key string, obj interface{}, d time.Duration) error {
+	if ns == nil {
+		return errNilNamespace
+	}
+	c.c.Set(c.nskey(ns, key), obj, d)
+
+	return nil
+}
+
+func (c *oidcCache) Delete(ns *namespace.Namespace, key string) error {
+	if ns == nil {
+		return errNilNamespace
+	}
+	c.c.Delete(c.nskey(ns, key))
+
+	return nil
+}
+
 func (c *oidcCache) Flush(ns *namespace.Namespace) error {
 	if ns == nil {
 		return errNilNamespace
@@ -0,0 +1,1565 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/quid/vault/helper/identity"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/helper/base62"
+	"github.com/quid/vault/sdk/helper/identitytpl"
+	"github.com/quid/vault/sdk/helper/strutil"
+	"github.com/quid/vault/sdk/logical"
+)
+
+// provider is an OIDC provider that relying parties can use to authenticate
+// Vault identities through the authorization code flow.
+type provider struct {
+	Issuer           string   `json:"issuer"`
+	AllowedClientIDs []string `json:"allowed_client_ids"`
+	ScopesSupported  []string `json:"scopes_supported"`
+
+	// effectiveIssuer is a calculated field and will be either Issuer (if
+	// that's set) or the Vault instance's api_addr, followed by the path of
+	// the provider.
+	effectiveIssuer string
+}
+
+// scope is a set of claims that relying parties can request from a provider.
+// The claims are rendered from a template against the authenticated entity.
+type scope struct {
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
+
+// client is a relying party registered to use the OIDC providers.
+type client struct {
+	RedirectURIs   []string      `json:"redirect_uris"`
+	Key            string        `json:"key"`
+	IDTokenTTL     time.Duration `json:"id_token_ttl"`
+	AccessTokenTTL time.Duration `json:"access_token_ttl"`
+	ClientID       string        `json:"client_id"`
+	ClientSecret   string        `json:"client_secret"`
+}
+
+// authCodeEntry holds the details of an authorization request until its code
+// is exchanged for tokens.
+type authCodeEntry struct {
+	provider            string
+	clientID            string
+	entityID            string
+	redirectURI         string
+	nonce               string
+	scopes              []string
+	codeChallenge       string
+	codeChallengeMethod string
+	authTime            time.Time
+}
+
+// accessTokenEntry holds the details of an issued access token for the
+// userinfo endpoint.
+type accessTokenEntry struct {
+	provider string
+	clientID string
+	entityID string
+	scopes   []string
+}
+
+// providerDiscovery contains the provider metadata published on the
+// provider's .well-known endpoint.
+//
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type providerDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	Keys                  string   `json:"jwks_uri"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	ResponseTypes         []string `json:"response_types_supported"`
+	GrantTypes            []string `json:"grant_types_supported"`
+	Scopes                []string `json:"scopes_supported"`
+	Subjects              []string `json:"subject_types_supported"`
+	IDTokenAlgs           []string `json:"id_token_signing_alg_values_supported"`
+	AuthMethods           []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+const (
+	oidcProviderPrefix = "oidc_provider/"
+	providerPath       = oidcProviderPrefix + "provider/"
+	clientPath         = oidcProviderPrefix + "client/"
+	clientIDPath       = oidcProviderPrefix + "client_id/"
+	scopePath          = oidcProviderPrefix + "scope/"
+
+	// openIDScope is the scope every authorization request must include. It
+	// is built in and cannot be created as a scope.
+	openIDScope = "openid"
+
+	// authCodeTTL is how long an authorization code can be exchanged for
+	// tokens.
+	authCodeTTL = 5 * time.Minute
+
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
+)
+
+// reservedClaims are the claims set by the provider itself, which scope
+// templates cannot override.
+var reservedClaims = []string{"iat", "aud", "exp", "iss", "sub", "namespace", "nonce", "auth_time", "at_hash", "c_hash"}
+
+func oidcProviderPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "oidc/scope/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the scope",
+				},
+				"template": {
+					Type:        framework.TypeString,
+					Description: "The template string to use for the claims of the scope. This may be in string-ified JSON or base64 format.",
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: "The description of the scope",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateScope,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateScope,
+				logical.ReadOperation:   i.pathOIDCReadScope,
+				logical.DeleteOperation: i.pathOIDCDeleteScope,
+			},
+			ExistenceCheck:  i.pathOIDCScopeExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC scopes.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC scopes. A scope maps entity information to the claims returned to relying parties that request it.",
+		},
+		{
+			Pattern: "oidc/scope/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListScope,
+			},
+			HelpSynopsis:    "List OIDC scopes",
+			HelpDescription: "List all configured OIDC scopes in the identity backend.",
+		},
+		{
+			Pattern: "oidc/client/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the client",
+				},
+				"redirect_uris": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of redirect URIs the client may use in authorization requests.",
+				},
+				"key": {
+					Type:        framework.TypeString,
+					Description: "The OIDC key to use for signing the ID tokens of the client. The specified key must already exist.",
+				},
+				"id_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the ID tokens issued to the client.",
+					Default:     "24h",
+				},
+				"access_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the access tokens issued to the client.",
+					Default:     "24h",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateClient,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateClient,
+				logical.ReadOperation:   i.pathOIDCReadClient,
+				logical.DeleteOperation: i.pathOIDCDeleteClient,
+			},
+			ExistenceCheck:  i.pathOIDCClientExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC clients.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC clients. A client is a relying party that authenticates Vault identities through an OIDC provider. The client ID and secret are generated when the client is created.",
+		},
+		{
+			Pattern: "oidc/client/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListClient,
+			},
+			HelpSynopsis:    "List OIDC clients",
+			HelpDescription: "List all configured OIDC clients in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "Issuer URL to be used in the iss claim of the token. If not set, Vault's app_addr will be used.",
+				},
+				"allowed_client_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of client IDs allowed to use the provider. If empty no clients are allowed. If \"*\" all clients are allowed.",
+				},
+				"scopes_supported": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the scopes the provider offers in addition to the openid scope. The specified scopes must already exist.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.ReadOperation:   i.pathOIDCReadProvider,
+				logical.DeleteOperation: i.pathOIDCDeleteProvider,
+			},
+			ExistenceCheck:  i.pathOIDCProviderExistenceCheck,
+			HelpSynopsis:    "CRUD operations for OIDC providers.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC providers. A provider authenticates Vault identities for its allowed clients using the OIDC authorization code flow.",
+		},
+		{
+			Pattern: "oidc/provider/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProvider,
+			},
+			HelpSynopsis:    "List OIDC providers",
+			HelpDescription: "List all configured OIDC providers in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/openid-configuration/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCProviderDiscovery,
+			},
+			HelpSynopsis:    "Query OIDC provider configuration",
+			HelpDescription: "Query this path to retrieve the metadata of the provider, including its authorization, token and userinfo endpoints.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/keys/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCReadPublicKeys,
+			},
+			HelpSynopsis:    "Retrieve public keys",
+			HelpDescription: "Query this path to retrieve the public portion of keys used to sign ID tokens.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/authorize/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the requesting client.",
+				},
+				"scope": {
+					Type:        framework.TypeString,
+					Description: "A space-delimited list of scopes to be requested. The 'openid' scope is required.",
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The redirection URI to which the response will be sent.",
+				},
+				"response_type": {
+					Type:        framework.TypeString,
+					Description: "The OIDC authentication flow to be used. The following response types are supported: 'code'",
+				},
+				"state": {
+					Type:        framework.TypeString,
+					Description: "The value used to maintain state between the authentication request and client.",
+				},
+				"nonce": {
+					Type:        framework.TypeString,
+					Description: "The value that will be returned in the ID token nonce claim after a token exchange.",
+				},
+				"code_challenge": {
+					Type:        framework.TypeString,
+					Description: "The PKCE code challenge derived from the client's code verifier.",
+				},
+				"code_challenge_method": {
+					Type:        framework.TypeString,
+					Description: "The method used to derive the PKCE code challenge. The following methods are supported: 'S256', 'plain'. Defaults to 'plain'.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:                    i.pathOIDCAuthorize,
+					ForwardPerformanceSecondary: true,
+					ForwardPerformanceStandby:   true,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:                    i.pathOIDCAuthorize,
+					ForwardPerformanceSecondary: true,
+					ForwardPerformanceStandby:   true,
+				},
+			},
+			HelpSynopsis:    "Provides the OIDC Authorization Endpoint.",
+			HelpDescription: "The OIDC Authorization Endpoint issues an authorization code for the entity of the request's token, to be exchanged for tokens by the client. Codes are only kept in the memory of the active node.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/token/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"grant_type": {
+					Type:        framework.TypeString,
+					Description: "The authorization grant type. The following grant types are supported: 'authorization_code'.",
+				},
+				"code": {
+					Type:        framework.TypeString,
+					Description: "The authorization code received from the provider's authorization endpoint.",
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The callback location where the authentication response was sent.",
+				},
+				"code_verifier": {
+					Type:        framework.TypeString,
+					Description: "The PKCE code verifier, required if a code challenge was sent to the authorization endpoint.",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the requesting client, when not using the Authorization header.",
+				},
+				"client_secret": {
+					Type:        framework.TypeString,
+					Description: "The secret of the requesting client, when not using the Authorization header.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:                    i.pathOIDCToken,
+					ForwardPerformanceSecondary: true,
+					ForwardPerformanceStandby:   true,
+				},
+			},
+			HelpSynopsis:    "Provides the OIDC Token Endpoint.",
+			HelpDescription: "The OIDC Token Endpoint exchanges an authorization code for an ID token and an access token. Access tokens are only kept in the memory of the active node.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/userinfo/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:                    i.pathOIDCUserInfo,
+					ForwardPerformanceSecondary: true,
+					ForwardPerformanceStandby:   true,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:                    i.pathOIDCUserInfo,
+					ForwardPerformanceSecondary: true,
+					ForwardPerformanceStandby:   true,
+				},
+			},
+			HelpSynopsis:    "Provides the OIDC UserInfo Endpoint.",
+			HelpDescription: "The OIDC UserInfo Endpoint returns the claims of the scopes granted to the access token sent in the Authorization header.",
+		},
+	}
+}
+
+func (i *IdentityStore) pathOIDCScopeExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	entry, err := req.Storage.Get(ctx, scopePath+d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+// pathOIDCCreateUpdateScope is used to create a new scope or update an
+// existing one
+func (i *IdentityStore) pathOIDCCreateUpdateScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == openIDScope {
+		return logical.ErrorResponse("the %q scope name is reserved", openIDScope), nil
+	}
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var scope scope
+	if req.Operation == logical.UpdateOperation {
+		entry, err := req.Storage.Get(ctx, scopePath+name)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			if err := entry.DecodeJSON(&scope); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if descriptionRaw, ok := d.GetOk("description"); ok {
+		scope.Description = descriptionRaw.(string)
+	}
+
+	if templateRaw, ok := d.GetOk("template"); ok {
+		scope.Template = templateRaw.(string)
+	}
+
+	// Attempt to decode as base64 and use that if it works
+	if decoded, err := base64.StdEncoding.DecodeString(scope.Template); err == nil {
+		scope.Template = string(decoded)
+	}
+
+	// Validate that template can be parsed and results in valid JSON
+	if scope.Template != "" {
+		_, populatedTemplate, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			Mode:   identitytpl.JSONTemplating,
+			String: scope.Template,
+			Entity: new(logical.Entity),
+			Groups: make([]*logical.Group, 0),
+		})
+		if err != nil {
+			return logical.ErrorResponse("error parsing template: %s", err.Error()), nil
+		}
+
+		var tmp map[string]interface{}
+		if err := json.Unmarshal([]byte(populatedTemplate), &tmp); err != nil {
+			return logical.ErrorResponse("error parsing template JSON: %s", err.Error()), nil
+		}
+
+		for key := range tmp {
+			if strutil.StrListContains(reservedClaims, key) {
+				return logical.ErrorResponse(`top level key %q not allowed. Restricted keys: %s`,
+					key, strings.Join(reservedClaims, ", ")), nil
+			}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(scopePath+name, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadScope is used to read an existing scope
+func (i *IdentityStore) pathOIDCReadScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	scope, err := i.getOIDCScope(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"template":    scope.Template,
+			"description": scope.Description,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) getOIDCScope(ctx context.Context, s logical.Storage, name string) (*scope, error) {
+	entry, err := s.Get(ctx, scopePath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var scope scope
+	if err := entry.DecodeJSON(&scope); err != nil {
+		return nil, err
+	}
+
+	return &scope, nil
+}
+
+// pathOIDCDeleteScope is used to delete a scope that no provider offers
+func (i *IdentityStore) pathOIDCDeleteScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	providerNames, err := req.Storage.List(ctx, providerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var providersReferencingScope []string
+	for _, providerName := range providerNames {
+		provider, err := i.getOIDCProvider(ctx, req.Storage, providerName)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil && strutil.StrListContains(provider.ScopesSupported, name) {
+			providersReferencingScope = append(providersReferencingScope, providerName)
+		}
+	}
+
+	if len(providersReferencingScope) > 0 {
+		return logical.ErrorResponse("unable to delete scope %q because it is currently referenced by these providers: %s",
+			name, strings.Join(providersReferencingScope, ", ")), logical.ErrInvalidRequest
+	}
+
+	if err := req.Storage.Delete(ctx, scopePath+name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCListScope is used to list scopes
+func (i *IdentityStore) pathOIDCListScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	scopes, err := req.Storage.List(ctx, scopePath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(scopes), nil
+}
+
+func (i *IdentityStore) pathOIDCClientExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	entry, err := req.Storage.Get(ctx, clientPath+d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+// pathOIDCCreateUpdateClient is used to register a new client or update an
+// existing one. The client ID and secret are generated on registration.
+func (i *IdentityStore) pathOIDCCreateUpdateClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var client client
+	if req.Operation == logical.UpdateOperation {
+		entry, err := req.Storage.Get(ctx, clientPath+name)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			if err := entry.DecodeJSON(&client); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if redirectURIsRaw, ok := d.GetOk("redirect_uris"); ok {
+		client.RedirectURIs = redirectURIsRaw.([]string)
+	}
+
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return logical.ErrorResponse("invalid redirect URI %q, which must be an absolute URI without a fragment", redirectURI), nil
+		}
+	}
+
+	if keyRaw, ok := d.GetOk("key"); ok {
+		client.Key = keyRaw.(string)
+	}
+	if client.Key == "" {
+		return logical.ErrorResponse("the key parameter is required"), nil
+	}
+
+	keyEntry, err := req.Storage.Get(ctx, namedKeyConfigPath+client.Key)
+	if err != nil {
+		return nil, err
+	}
+	if keyEntry == nil {
+		return logical.ErrorResponse("key %q does not exist", client.Key), nil
+	}
+
+	if idTokenTTLRaw, ok := d.GetOk("id_token_ttl"); ok {
+		client.IDTokenTTL = time.Duration(idTokenTTLRaw.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		client.IDTokenTTL = time.Duration(d.Get("id_token_ttl").(int)) * time.Second
+	}
+
+	if accessTokenTTLRaw, ok := d.GetOk("access_token_ttl"); ok {
+		client.AccessTokenTTL = time.Duration(accessTokenTTLRaw.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		client.AccessTokenTTL = time.Duration(d.Get("access_token_ttl").(int)) * time.Second
+	}
+
+	if client.ClientID == "" {
+		clientID, err := base62.Random(32)
+		if err != nil {
+			return nil, err
+		}
+		client.ClientID = clientID
+	}
+
+	if client.ClientSecret == "" {
+		clientSecret, err := base62.Random(64)
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecret = clientSecret
+	}
+
+	entry, err := logical.StorageEntryJSON(clientPath+name, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	// Index the client by its ID for the authorize and token endpoints
+	if err := req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   clientIDPath + client.ClientID,
+		Value: []byte(name),
+	}); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadClient is used to read an existing client
+func (i *IdentityStore) pathOIDCReadClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	client, err := i.getOIDCClient(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"redirect_uris":    client.RedirectURIs,
+			"key":              client.Key,
+			"id_token_ttl":     int64(client.IDTokenTTL.Seconds()),
+			"access_token_ttl": int64(client.AccessTokenTTL.Seconds()),
+			"client_id":        client.ClientID,
+			"client_secret":    client.ClientSecret,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) getOIDCClient(ctx context.Context, s logical.Storage, name string) (*client, error) {
+	entry, err := s.Get(ctx, clientPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var client client
+	if err := entry.DecodeJSON(&client); err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// getOIDCClientByID returns the client with the given client ID, or nil if
+// there is none
+func (i *IdentityStore) getOIDCClientByID(ctx context.Context, s logical.Storage, clientID string) (*client, error) {
+	entry, err := s.Get(ctx, clientIDPath+clientID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	client, err := i.getOIDCClient(ctx, s, string(entry.Value))
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.ClientID), []byte(clientID)) != 1 {
+		return nil, nil
+	}
+
+	return client, nil
+}
+
+// pathOIDCDeleteClient is used to delete a client
+func (i *IdentityStore) pathOIDCDeleteClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	client, err := i.getOIDCClient(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+
+	if err := req.Storage.Delete(ctx, clientIDPath+client.ClientID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, clientPath+name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// pathOIDCListClient is used to list clients
+func (i *IdentityStore) pathOIDCListClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	clients, err := req.Storage.List(ctx, clientPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(clients), nil
+}
+
+func (i *IdentityStore) pathOIDCProviderExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	entry, err := req.Storage.Get(ctx, providerPath+d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+// pathOIDCCreateUpdateProvider is used to create a new provider or update an
+// existing one
+func (i *IdentityStore) pathOIDCCreateUpdateProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var provider provider
+	if req.Operation == logical.UpdateOperation {
+		entry, err := req.Storage.Get(ctx, providerPath+name)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			if err := entry.DecodeJSON(&provider); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if issuerRaw, ok := d.GetOk("issuer"); ok {
+		provider.Issuer = issuerRaw.(string)
+	}
+
+	if provider.Issuer != "" {
+		// verify that issuer is the correct format:
+		//   - http or https
+		//   - host name
+		//   - optional port
+		//   - nothing more
+		valid := false
+		if u, err := url.Parse(provider.Issuer); err == nil {
+			u2 := url.URL{
+				Scheme: u.Scheme,
+				Host:   u.Host,
+			}
+			valid = (*u == u2) &&
+				(u.Scheme == "http" || u.Scheme == "https") &&
+				u.Host != ""
+		}
+
+		if !valid {
+			return logical.ErrorResponse(
+				"invalid issuer, which must include only a scheme, host, " +
+					"and optional port (e.g. https://example.com:8200)"), nil
+		}
+	}
+
+	if allowedClientIDsRaw, ok := d.GetOk("allowed_client_ids"); ok {
+		provider.AllowedClientIDs = allowedClientIDsRaw.([]string)
+	}
+
+	if scopesSupportedRaw, ok := d.GetOk("scopes_supported"); ok {
+		provider.ScopesSupported = scopesSupportedRaw.([]string)
+	}
+
+	for _, scopeName := range provider.ScopesSupported {
+		scope, err := i.getOIDCScope(ctx, req.Storage, scopeName)
+		if err != nil {
+			return nil, err
+		}
+		if scope == nil {
+			return logical.ErrorResponse("scope %q does not exist", scopeName), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(providerPath+name, provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	if err := i.oidcCache.Flush(ns); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCReadProvider is used to read an existing provider
+func (i *IdentityStore) pathOIDCReadProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":             provider.effectiveIssuer,
+			"allowed_client_ids": provider.AllowedClientIDs,
+			"scopes_supported":   provider.ScopesSupported,
+		},
+	}, nil
+}
+
+// getOIDCProvider returns the named provider with its effective issuer set,
+// or nil if there is none
+func (i *IdentityStore) getOIDCProvider(ctx context.Context, s logical.Storage, name string) (*provider, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.Get(ctx, providerPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var provider provider
+	if err := entry.DecodeJSON(&provider); err != nil {
+		return nil, err
+	}
+
+	provider.effectiveIssuer = provider.Issuer
+	if provider.effectiveIssuer == "" {
+		provider.effectiveIssuer = i.core.redirectAddr
+	}
+
+	provider.effectiveIssuer += "/v1/" + ns.Path + issuerPath + "/provider/" + name
+
+	return &provider, nil
+}
+
+// pathOIDCDeleteProvider is used to delete a provider
+func (i *IdentityStore) pathOIDCDeleteProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	if err := req.Storage.Delete(ctx, providerPath+d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	if err := i.oidcCache.Flush(ns); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// pathOIDCListProvider is used to list providers
+func (i *IdentityStore) pathOIDCListProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	providers, err := req.Storage.List(ctx, providerPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(providers), nil
+}
+
+func (i *IdentityStore) pathOIDCProviderDiscovery(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var data []byte
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+
+	v, ok, err := i.oidcCache.Get(ns, "providerDiscoveryResponse/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		data = v.([]byte)
+	} else {
+		i.oidcLock.RLock()
+		p, err := i.getOIDCProvider(ctx, req.Storage, name)
+		i.oidcLock.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, nil
+		}
+
+		disc := providerDiscovery{
+			Issuer:                p.effectiveIssuer,
+			Keys:                  p.effectiveIssuer + "/.well-known/keys",
+			AuthorizationEndpoint: p.effectiveIssuer + "/authorize",
+			TokenEndpoint:         p.effectiveIssuer + "/token",
+			UserinfoEndpoint:      p.effectiveIssuer + "/userinfo",
+			ResponseTypes:         []string{"code"},
+			GrantTypes:            []string{"authorization_code"},
+			Scopes:                append([]string{openIDScope}, p.ScopesSupported...),
+			Subjects:              []string{"public"},
+			IDTokenAlgs:           supportedAlgs,
+			AuthMethods:           []string{"client_secret_basic", "client_secret_post"},
+			CodeChallengeMethods:  []string{codeChallengeMethodS256, codeChallengeMethodPlain},
+		}
+
+		data, err = json.Marshal(disc)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := i.oidcCache.SetDefault(ns, "providerDiscoveryResponse/"+name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      200,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: "max-age=3600",
+		},
+	}
+
+	return resp, nil
+}
+
+// pathOIDCAuthorize issues an authorization code for the entity of the
+// request's token. Errors are returned in the format of the OAuth 2.0
+// authorization error response, so that the caller can relay them to the
+// client's redirect URI.
+func (i *IdentityStore) pathOIDCAuthorize(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+	state := d.Get("state").(string)
+
+	i.oidcLock.RLock()
+	defer i.oidcLock.RUnlock()
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return logical.ErrorResponse("provider %q not found", name), nil
+	}
+
+	clientID := d.Get("client_id").(string)
+	if clientID == "" {
+		return authResponse("", state, authErrInvalidRequest, "client_id parameter is required")
+	}
+	client, err := i.getOIDCClientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return authResponse("", state, authErrInvalidClientID, "client with client_id not found")
+	}
+	if !provider.allowedClientID(clientID) {
+		return authResponse("", state, authErrUnauthorizedClient, "client is not authorized to use the provider")
+	}
+
+	// The redirect URI must be registered with the client, since the codes
+	// sent to it grant access to the entity's identity
+	redirectURI := d.Get("redirect_uri").(string)
+	if redirectURI == "" {
+		return authResponse("", state, authErrInvalidRequest, "redirect_uri parameter is required")
+	}
+	if !strutil.StrListContains(client.RedirectURIs, redirectURI) {
+		return authResponse("", state, authErrInvalidRedirectURI, "redirect_uri is not allowed for the client")
+	}
+
+	if responseType := d.Get("response_type").(string); responseType != "code" {
+		return authResponse("", state, authErrUnsupportedResponseType, "unsupported response_type value")
+	}
+
+	scopes := strutil.ParseDedupAndSortStrings(d.Get("scope").(string), " ")
+	if !strutil.StrListContains(scopes, openIDScope) {
+		return authResponse("", state, authErrInvalidScope, "scope parameter must contain the \"openid\" value")
+	}
+
+	// Scopes the provider doesn't offer are ignored, as allowed by the spec
+	var grantedScopes []string
+	for _, scope := range scopes {
+		if scope == openIDScope || strutil.StrListContains(provider.ScopesSupported, scope) {
+			grantedScopes = append(grantedScopes, scope)
+		}
+	}
+
+	codeChallenge := d.Get("code_challenge").(string)
+	codeChallengeMethod := d.Get("code_challenge_method").(string)
+	if codeChallenge != "" {
+		switch codeChallengeMethod {
+		case "":
+			codeChallengeMethod = codeChallengeMethodPlain
+		case codeChallengeMethodPlain, codeChallengeMethodS256:
+		default:
+			return authResponse("", state, authErrInvalidRequest, "unsupported code_challenge_method value")
+		}
+		// RFC 7636 requires challenges of 43 to 128 characters
+		if len(codeChallenge) < 43 || len(codeChallenge) > 128 {
+			return authResponse("", state, authErrInvalidRequest, "invalid code_challenge value")
+		}
+	} else if codeChallengeMethod != "" {
+		return authResponse("", state, authErrInvalidRequest, "code_challenge parameter is required when code_challenge_method is set")
+	}
+
+	if req.EntityID == "" {
+		return authResponse("", state, authErrAccessDenied, "no entity associated with the request's token")
+	}
+	entity, err := i.MemDBEntityByID(req.EntityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return authResponse("", state, authErrAccessDenied, "the entity of the request's token is not active")
+	}
+
+	code, err := base62.Random(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.oidcAuthCodeCache.Set(ns, code, &authCodeEntry{
+		provider:            name,
+		clientID:            clientID,
+		entityID:            req.EntityID,
+		redirectURI:         redirectURI,
+		nonce:               d.Get("nonce").(string),
+		scopes:              grantedScopes,
+		codeChallenge:       codeChallenge,
+		codeChallengeMethod: codeChallengeMethod,
+		authTime:            time.Now(),
+	}, authCodeTTL); err != nil {
+		return nil, err
+	}
+
+	return authResponse(code, state, "", "")
+}
+
+// pathOIDCToken exchanges an authorization code for an ID token and an access
+// token. The client authenticates with its secret, either with HTTP basic
+// authentication or in the request body.
+func (i *IdentityStore) pathOIDCToken(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+
+	// The write lock makes taking the code and deleting it atomic, so that a
+	// code can't be exchanged twice by concurrent requests
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	provider, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return tokenResponse(nil, tokenErrInvalidRequest, fmt.Sprintf("provider %q not found", name))
+	}
+
+	clientID, clientSecret, ok := clientCredentials(req.Headers)
+	if !ok {
+		clientID = d.Get("client_id").(string)
+		clientSecret = d.Get("client_secret").(string)
+	}
+	if clientID == "" {
+		return tokenResponse(nil, tokenErrInvalidClient, "client failed to authenticate")
+	}
+	client, err := i.getOIDCClientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) != 1 {
+		return tokenResponse(nil, tokenErrInvalidClient, "client failed to authenticate")
+	}
+	if !provider.allowedClientID(clientID) {
+		return tokenResponse(nil, tokenErrUnauthorizedClient, "client is not authorized to use the provider")
+	}
+
+	if grantType := d.Get("grant_type").(string); grantType != "authorization_code" {
+		return tokenResponse(nil, tokenErrUnsupportedGrantType, "unsupported grant_type value")
+	}
+
+	code := d.Get("code").(string)
+	if code == "" {
+		return tokenResponse(nil, tokenErrInvalidRequest, "code parameter is required")
+	}
+
+	// Codes can only be exchanged once, so remove it whatever the outcome
+	v, ok, err := i.oidcAuthCodeCache.Get(ns, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return tokenResponse(nil, tokenErrInvalidGrant, "authorization grant is invalid or expired")
+	}
+	if err := i.oidcAuthCodeCache.Delete(ns, code); err != nil {
+		return nil, err
+	}
+	authCode := v.(*authCodeEntry)
+
+	if authCode.provider != name || authCode.clientID != clientID {
+		return tokenResponse(nil, tokenErrInvalidGrant, "authorization grant was issued to another client or provider")
+	}
+	if authCode.redirectURI != d.Get("redirect_uri").(string) {
+		return tokenResponse(nil, tokenErrInvalidGrant, "redirect_uri does not match the one of the authorization request")
+	}
+
+	codeVerifier := d.Get("code_verifier").(string)
+	switch {
+	case authCode.codeChallenge == "" && codeVerifier != "":
+		return tokenResponse(nil, tokenErrInvalidRequest, "code_verifier parameter sent without a code challenge")
+	case authCode.codeChallenge != "" && codeVerifier == "":
+		return tokenResponse(nil, tokenErrInvalidRequest, "code_verifier parameter is required")
+	case authCode.codeChallenge != "":
+		if !verifyCodeChallenge(authCode.codeChallengeMethod, authCode.codeChallenge, codeVerifier) {
+			return tokenResponse(nil, tokenErrInvalidGrant, "invalid code_verifier for the code challenge")
+		}
+	}
+
+	entity, err := i.MemDBEntityByID(authCode.entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return tokenResponse(nil, tokenErrInvalidGrant, "the entity of the authorization grant is not active")
+	}
+
+	key, err := i.getNamedKeyForClient(ctx, req.Storage, client)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return tokenResponse(nil, tokenErrServerError, fmt.Sprintf("key %q of the client is not usable", client.Key))
+	}
+
+	claims, err := i.scopeClaims(ctx, req.Storage, authCode.scopes, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claims["iss"] = provider.effectiveIssuer
+	claims["namespace"] = ns.ID
+	claims["sub"] = entity.ID
+	claims["aud"] = clientID
+	claims["exp"] = now.Add(client.IDTokenTTL).Unix()
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = authCode.authTime.Unix()
+	if authCode.nonce != "" {
+		claims["nonce"] = authCode.nonce
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := key.signPayload(payload)
+	if err != nil {
+		return nil, errwrap.Wrapf("error signing OIDC token: {{err}}", err)
+	}
+
+	accessToken, err := base62.Random(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.oidcAccessTokenCache.Set(ns, accessToken, &accessTokenEntry{
+		provider: name,
+		clientID: clientID,
+		entityID: entity.ID,
+		scopes:   authCode.scopes,
+	}, client.AccessTokenTTL); err != nil {
+		return nil, err
+	}
+
+	return tokenResponse(map[string]interface{}{
+		"token_type":   "Bearer",
+		"access_token": accessToken,
+		"id_token":     idToken,
+		"expires_in":   int64(client.AccessTokenTTL.Seconds()),
+	}, "", "")
+}
+
+// pathOIDCUserInfo returns the claims of the scopes granted to the access
+// token sent in the Authorization header.
+func (i *IdentityStore) pathOIDCUserInfo(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, ok := bearerToken(req.Headers)
+	if !ok {
+		return userInfoResponse(nil, userInfoErrInvalidRequest, "access token is required in the Authorization header")
+	}
+
+	v, ok, err := i.oidcAccessTokenCache.Get(ns, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || v.(*accessTokenEntry).provider != d.Get("name").(string) {
+		return userInfoResponse(nil, userInfoErrInvalidToken, "access token is invalid or expired")
+	}
+	token := v.(*accessTokenEntry)
+
+	entity, err := i.MemDBEntityByID(token.entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return userInfoResponse(nil, userInfoErrInvalidToken, "the entity of the access token is not active")
+	}
+
+	i.oidcLock.RLock()
+	claims, err := i.scopeClaims(ctx, req.Storage, token.scopes, entity)
+	i.oidcLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	claims["sub"] = entity.ID
+
+	return userInfoResponse(claims, "", "")
+}
+
+// scopeClaims renders the templates of the given scopes against the entity
+// and merges the resulting claims. Scopes that no longer exist are skipped.
+func (i *IdentityStore) scopeClaims(ctx context.Context, s logical.Storage, scopes []string, entity *identity.Entity) (map[string]interface{}, error) {
+	groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+	if err != nil {
+		return nil, err
+	}
+	groups = append(groups, inheritedGroups...)
+
+	claims := make(map[string]interface{})
+	for _, scopeName := range scopes {
+		if scopeName == openIDScope {
+			continue
+		}
+
+		scope, err := i.getOIDCScope(ctx, s, scopeName)
+		if err != nil {
+			return nil, err
+		}
+		if scope == nil || scope.Template == "" {
+			continue
+		}
+
+		// As with role templates, runtime errors are logged rather than
+		// failing the request, so that the required claims are still issued
+		_, populatedTemplate, err := identitytpl.PopulateString(identitytpl.PopulateStringInput{
+			Mode:   identitytpl.JSONTemplating,
+			String: scope.Template,
+			Entity: identity.ToSDKEntity(entity),
+			Groups: identity.ToSDKGroups(groups),
+		})
+		if err != nil {
+			i.Logger().Warn("error populating OIDC scope template", "scope", scopeName, "error", err)
+			continue
+		}
+
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(populatedTemplate), &parsed); err != nil {
+			i.Logger().Warn("error parsing OIDC scope template", "scope", scopeName, "error", err)
+			continue
+		}
+
+		for k, v := range parsed {
+			if strutil.StrListContains(reservedClaims, k) {
+				i.Logger().Warn("invalid top level OIDC scope template key", "scope", scopeName, "key", k)
+				continue
+			}
+			claims[k] = v
+		}
+	}
+
+	return claims, nil
+}
+
+// getNamedKeyForClient returns the key the client's ID tokens are signed
+// with, or nil if it doesn't exist or doesn't allow the client to use it
+func (i *IdentityStore) getNamedKeyForClient(ctx context.Context, s logical.Storage, client *client) (*namedKey, error) {
+	entry, err := s.Get(ctx, namedKeyConfigPath+client.Key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var key namedKey
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+
+	if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, client.ClientID) {
+		return nil, nil
+	}
+
+	return &key, nil
+}
+
+func (p *provider) allowedClientID(clientID string) bool {
+	return strutil.StrListContains(p.AllowedClientIDs, "*") || strutil.StrListContains(p.AllowedClientIDs, clientID)
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the challenge
+// sent in the authorization request, as described in RFC 7636.
+func verifyCodeChallenge(method, challenge, verifier string) bool {
+	switch method {
+	case codeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	case codeChallengeMethodPlain:
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(verifier)) == 1
+}
+
+// clientCredentials returns the client ID and secret sent with HTTP basic
+// authentication, if any
+func clientCredentials(headers map[string][]string) (string, string, bool) {
+	for _, v := range authorizationHeaders(headers) {
+		if !strings.HasPrefix(v, "Basic ") {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v[6:]))
+		if err != nil {
+			return "", "", false
+		}
+
+		// The credentials are form-encoded before being joined, per RFC 6749
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", false
+		}
+		clientID, err := url.QueryUnescape(parts[0])
+		if err != nil {
+			return "", "", false
+		}
+		clientSecret, err := url.QueryUnescape(parts[1])
+		if err != nil {
+			return "", "", false
+		}
+
+		return clientID, clientSecret, true
+	}
+
+	return "", "", false
+}
+
+// bearerToken returns the access token sent in the Authorization header, if
+// any
+func bearerToken(headers map[string][]string) (string, bool) {
+	for _, v := range authorizationHeaders(headers) {
+		if strings.HasPrefix(v, "Bearer ") {
+			return strings.TrimSpace(v[7:]), true
+		}
+	}
+
+	return "", false
+}
+
+func authorizationHeaders(headers map[string][]string) []string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "Authorization") {
+			return v
+		}
+	}
+	return nil
+}
+
+// OAuth 2.0 error codes of the authorization endpoint
+// https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+const (
+	authErrInvalidRequest          = "invalid_request"
+	authErrUnauthorizedClient      = "unauthorized_client"
+	authErrAccessDenied            = "access_denied"
+	authErrUnsupportedResponseType = "unsupported_response_type"
+	authErrInvalidScope            = "invalid_scope"
+
+	// The client ID and redirect URI errors are not relayed to the client,
+	// since the redirect URI can't be trusted
+	authErrInvalidClientID    = "invalid_client_id"
+	authErrInvalidRedirectURI = "invalid_redirect_uri"
+)
+
+// OAuth 2.0 error codes of the token endpoint
+// https://tools.ietf.org/html/rfc6749#section-5.2
+const (
+	tokenErrInvalidRequest       = "invalid_request"
+	tokenErrInvalidClient        = "invalid_client"
+	tokenErrInvalidGrant         = "invalid_grant"
+	tokenErrUnauthorizedClient   = "unauthorized_client"
+	tokenErrUnsupportedGrantType = "unsupported_grant_type"
+	tokenErrServerError          = "server_error"
+)
+
+// OAuth 2.0 error codes of the userinfo endpoint
+// https://tools.ietf.org/html/rfc6750#section-3.1
+const (
+	userInfoErrInvalidRequest = "invalid_request"
+	userInfoErrInvalidToken   = "invalid_token"
+)
+
+func authResponse(code, state, errorCode, errorDescription string) (*logical.Response, error) {
+	statusCode := 200
+	response := map[string]interface{}{
+		"code": code,
+	}
+	if errorCode != "" {
+		statusCode = 400
+		response = map[string]interface{}{
+			"error":             errorCode,
+			"error_description": errorDescription,
+		}
+	}
+
+	// The state is returned to the client on success and on error
+	if state != "" {
+		response["state"] = state
+	}
+
+	return rawOIDCResponse(statusCode, response, "no-store")
+}
+
+func tokenResponse(response map[string]interface{}, errorCode, errorDescription string) (*logical.Response, error) {
+	statusCode := 200
+	if errorCode != "" {
+		statusCode = 400
+		switch errorCode {
+		case tokenErrInvalidClient:
+			statusCode = 401
+		case tokenErrServerError:
+			statusCode = 500
+		}
+		response = map[string]interface{}{
+			"error":             errorCode,
+			"error_description": errorDescription,
+		}
+	}
+
+	return rawOIDCResponse(statusCode, response, "no-store")
+}
+
+func userInfoResponse(claims map[string]interface{}, errorCode, errorDescription string) (*logical.Response, error) {
+	statusCode := 200
+	if errorCode != "" {
+		statusCode = 400
+		if errorCode == userInfoErrInvalidToken {
+			statusCode = 401
+		}
+		claims = map[string]interface{}{
+			"error":             errorCode,
+			"error_description": errorDescription,
+		}
+	}
+
+	return rawOIDCResponse(statusCode, claims, "no-store")
+}
+
+func rawOIDCResponse(statusCode int, body map[string]interface{}, cacheControl string) (*logical.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      statusCode,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: cacheControl,
+		},
+	}, nil
+}
@@ -0,0 +1,337 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quid/vault/helper/identity"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// TestOIDC_Path_OIDCScope tests CRUD operations for scopes
+func TestOIDC_Path_OIDCScope(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	// The openid scope is built in
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/openid",
+		Operation: logical.CreateOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+
+	// Templates can't set the claims of the provider
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"template": `{"sub": {{identity.entity.id}}}`,
+		},
+		Storage: storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"template":    `{"email": {{identity.entity.metadata.email}}}`,
+			"description": "email address",
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if resp.Data["description"] != "email address" {
+		t.Fatalf("bad description: %#v", resp.Data)
+	}
+
+	// A provider offering the scope keeps it from being deleted
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.CreateOperation,
+		Data: map[string]interface{}{
+			"scopes_supported": "test-scope",
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/scope/test-scope",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+}
+
+// TestOIDC_Path_OIDCProvider_Flow tests the authorization code flow of a
+// provider from authorization to userinfo
+func TestOIDC_Path_OIDCProvider_Flow(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	testEntity := &identity.Entity{
+		Name:      "test-entity-name",
+		ID:        "test-entity-id",
+		BucketKey: "test-entity-bucket-key",
+		Metadata: map[string]string{
+			"email": "test@example.com",
+		},
+	}
+
+	txn := c.identityStore.db.Txn(true)
+	defer txn.Abort()
+	err := c.identityStore.upsertEntityInTxn(ctx, txn, testEntity, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Commit()
+
+	requests := []*logical.Request{
+		{
+			Path:      "oidc/key/test-key",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"allowed_client_ids": "*",
+			},
+		},
+		{
+			Path:      "oidc/scope/email",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"template": `{"email": {{identity.entity.metadata.email}}}`,
+			},
+		},
+		{
+			Path:      "oidc/client/test-client",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"key":           "test-key",
+				"redirect_uris": "https://app.example.com/callback",
+			},
+		},
+		{
+			Path:      "oidc/provider/test-provider",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"allowed_client_ids": "*",
+				"scopes_supported":   "email",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.Storage = storage
+		resp, err := c.identityStore.HandleRequest(ctx, req)
+		expectSuccess(t, resp, err)
+	}
+
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	clientID := resp.Data["client_id"].(string)
+	clientSecret := resp.Data["client_secret"].(string)
+
+	// The key is in use by the client
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/key/test-key",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectError(t, resp, err)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func(redirectURI string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/authorize",
+			Operation: logical.ReadOperation,
+			EntityID:  testEntity.ID,
+			Data: map[string]interface{}{
+				"client_id":             clientID,
+				"scope":                 "openid email",
+				"redirect_uri":          redirectURI,
+				"response_type":         "code",
+				"state":                 "test-state",
+				"nonce":                 "test-nonce",
+				"code_challenge":        challenge,
+				"code_challenge_method": "S256",
+			},
+			Storage: storage,
+		})
+		expectSuccess(t, resp, err)
+		return parseRawOIDCResponse(t, resp)
+	}
+
+	// The redirect URI must be registered with the client
+	if status, _ := authorize("https://evil.example.com/callback"); status != 400 {
+		t.Fatalf("expected status 400 for an unregistered redirect URI, got %d", status)
+	}
+
+	status, body := authorize("https://app.example.com/callback")
+	if status != 200 || body["state"] != "test-state" {
+		t.Fatalf("bad authorize response: %d %#v", status, body)
+	}
+	code := body["code"].(string)
+
+	exchange := func(codeVerifier string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/token",
+			Operation: logical.UpdateOperation,
+			Headers: map[string][]string{
+				"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte(clientID+":"+clientSecret))},
+			},
+			Data: map[string]interface{}{
+				"grant_type":    "authorization_code",
+				"code":          code,
+				"redirect_uri":  "https://app.example.com/callback",
+				"code_verifier": codeVerifier,
+			},
+			Storage: storage,
+		})
+		expectSuccess(t, resp, err)
+		return parseRawOIDCResponse(t, resp)
+	}
+
+	// A wrong verifier uses up the code
+	if status, body := exchange("wrong-verifier-wrong-verifier-wrong-verifier"); status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("expected an invalid_grant error, got: %d %#v", status, body)
+	}
+	if status, _ := exchange(verifier); status != 400 {
+		t.Fatalf("expected a used code to be rejected, got status %d", status)
+	}
+
+	// Concurrent exchanges of the same code only succeed once
+	_, body = authorize("https://app.example.com/callback")
+	code = body["code"].(string)
+	var wg sync.WaitGroup
+	var exchanged int32
+	for j := 0; j < 10; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+				Path:      "oidc/provider/test-provider/token",
+				Operation: logical.UpdateOperation,
+				Headers: map[string][]string{
+					"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte(clientID+":"+clientSecret))},
+				},
+				Data: map[string]interface{}{
+					"grant_type":    "authorization_code",
+					"code":          code,
+					"redirect_uri":  "https://app.example.com/callback",
+					"code_verifier": verifier,
+				},
+				Storage: storage,
+			})
+			if err == nil && resp != nil && resp.Data[logical.HTTPStatusCode] == 200 {
+				atomic.AddInt32(&exchanged, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if exchanged != 1 {
+		t.Fatalf("expected the code to be exchanged once, got %d exchanges", exchanged)
+	}
+
+	_, body = authorize("https://app.example.com/callback")
+	code = body["code"].(string)
+
+	status, body = exchange(verifier)
+	if status != 200 || body["token_type"] != "Bearer" {
+		t.Fatalf("bad token response: %d %#v", status, body)
+	}
+
+	parsedToken, err := jwt.ParseSigned(body["id_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := make(map[string]interface{})
+	if err := parsedToken.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatal(err)
+	}
+	expectedClaims := map[string]interface{}{
+		"sub":   testEntity.ID,
+		"aud":   clientID,
+		"nonce": "test-nonce",
+		"email": "test@example.com",
+	}
+	for k, v := range expectedClaims {
+		if claims[k] != v {
+			t.Fatalf("bad claim %q, expected %v, got %v", k, v, claims[k])
+		}
+	}
+
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/userinfo",
+		Operation: logical.ReadOperation,
+		Headers: map[string][]string{
+			"Authorization": {"Bearer " + body["access_token"].(string)},
+		},
+		Storage: storage,
+	})
+	expectSuccess(t, resp, err)
+	status, body = parseRawOIDCResponse(t, resp)
+	if status != 200 || body["sub"] != testEntity.ID || body["email"] != "test@example.com" {
+		t.Fatalf("bad userinfo response: %d %#v", status, body)
+	}
+
+	// A deleted client is no longer found by its ID
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.DeleteOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	if status, body := authorize("https://app.example.com/callback"); status != 400 || body["error"] != "invalid_client_id" {
+		t.Fatalf("expected an unknown client to be rejected, got: %d %#v", status, body)
+	}
+	if keys, err := storage.List(ctx, clientIDPath); err != nil || len(keys) != 0 {
+		t.Fatalf("expected the client ID index to be empty, got: %v, err: %v", keys, err)
+	}
+}
+
+func parseRawOIDCResponse(t *testing.T, resp *logical.Response) (int, map[string]interface{}) {
+	t.Helper()
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data[logical.HTTPStatusCode].(int), body
+}
@@ -63,6 +63,13 @@ type IdentityStore struct {
 	// will invalidate the cache.
 	oidcCache *oidcCache
 
+	// oidcAuthCodeCache and oidcAccessTokenCache hold the authorization codes
+	// and access tokens issued by the OIDC providers until they expire. They
+	// are kept apart from oidcCache so that configuration changes don't flush
+	// them.
+	oidcAuthCodeCache    *oidcCache
+	oidcAccessTokenCache *oidcCache
+
 	// logger is the server logger copied over from core
 	logger log.Logger
 
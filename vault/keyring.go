@@ -19,15 +19,17 @@ import (
 // when a new key is added to the keyring, we can encrypt with the master key
 // and write out the new keyring.
 type Keyring struct {
-	masterKey  []byte
-	keys       map[uint32]*Key
-	activeTerm uint32
+	masterKey      []byte
+	keys           map[uint32]*Key
+	activeTerm     uint32
+	rotationConfig KeyRotationConfig
 }
 
 // EncodedKeyring is used for serialization of the keyring
 type EncodedKeyring struct {
-	MasterKey []byte
-	Keys      []*Key
+	MasterKey      []byte
+	Keys           []*Key
+	RotationConfig KeyRotationConfig
 }
 
 // Key represents a single term, along with the key used.
@@ -36,6 +38,28 @@ type Key struct {
 	Version     int
 	Value       []byte
 	InstallTime time.Time
+
+	// Encryptions is the number of encryptions made with the key, as last
+	// persisted
+	Encryptions int64
+}
+
+// KeyRotationConfig is the configuration of the automatic rotation of the
+// active key
+type KeyRotationConfig struct {
+	Disabled bool
+
+	// MaxOperations is the number of encryptions after which the key is
+	// rotated, absoluteOperationMaximum if zero
+	MaxOperations int64
+
+	// Interval is the time after which the key is rotated, zero to only rotate
+	// it on the number of encryptions
+	Interval time.Duration
+
+	// Rewrap is whether the storage is re-encrypted under the new key after
+	// each rotation, manual or automatic, so that the older keys can be pruned
+	Rewrap bool
 }
 
 // Serialize is used to create a byte encoded key
@@ -64,9 +88,10 @@ func NewKeyring() *Keyring {
 // Clone returns a new copy of the keyring
 func (k *Keyring) Clone() *Keyring {
 	clone := &Keyring{
-		masterKey:  k.masterKey,
-		keys:       make(map[uint32]*Key, len(k.keys)),
-		activeTerm: k.activeTerm,
+		masterKey:      k.masterKey,
+		keys:           make(map[uint32]*Key, len(k.keys)),
+		activeTerm:     k.activeTerm,
+		rotationConfig: k.rotationConfig,
 	}
 	for idx, key := range k.keys {
 		clone.keys[idx] = key
@@ -135,6 +160,32 @@ func (k *Keyring) TermKey(term uint32) *Key {
 	return k.keys[term]
 }
 
+// RotationConfig returns the configuration of the automatic rotation of the
+// active key
+func (k *Keyring) RotationConfig() KeyRotationConfig {
+	return k.rotationConfig
+}
+
+// SetRotationConfig returns a new keyring with the given rotation
+// configuration
+func (k *Keyring) SetRotationConfig(config KeyRotationConfig) *Keyring {
+	clone := k.Clone()
+	clone.rotationConfig = config
+	return clone
+}
+
+// AddEncryptions returns a new keyring with the given number of encryptions
+// added to the active key
+func (k *Keyring) AddEncryptions(count int64) *Keyring {
+	clone := k.Clone()
+	if active, ok := clone.keys[clone.activeTerm]; ok {
+		key := *active
+		key.Encryptions += count
+		clone.keys[clone.activeTerm] = &key
+	}
+	return clone
+}
+
 // SetMasterKey is used to update the master key
 func (k *Keyring) SetMasterKey(val []byte) *Keyring {
 	valCopy := make([]byte, len(val))
@@ -153,7 +204,8 @@ func (k *Keyring) MasterKey() []byte {
 func (k *Keyring) Serialize() ([]byte, error) {
 	// Create the encoded entry
 	enc := EncodedKeyring{
-		MasterKey: k.masterKey,
+		MasterKey:      k.masterKey,
+		RotationConfig: k.rotationConfig,
 	}
 	for _, key := range k.keys {
 		enc.Keys = append(enc.Keys, key)
@@ -175,6 +227,7 @@ func DeserializeKeyring(buf []byte) (*Keyring, error) {
 	// Create a new keyring
 	k := NewKeyring()
 	k.masterKey = enc.MasterKey
+	k.rotationConfig = enc.RotationConfig
 	for _, key := range enc.Keys {
 		k.keys[key.Term] = key
 		if key.Term > k.activeTerm {
@@ -178,6 +178,42 @@ func TestKeyring_Serialize(t *testing.T) {
 	}
 }
 
+func TestKeyring_SerializeRotation(t *testing.T) {
+	k := NewKeyring()
+	k = k.SetMasterKey([]byte("test"))
+	k, _ = k.AddKey(&Key{Term: 1, Version: 1, Value: []byte("testing"), InstallTime: time.Now()})
+
+	config := KeyRotationConfig{
+		MaxOperations: 2000000,
+		Interval:      48 * time.Hour,
+	}
+	k = k.SetRotationConfig(config)
+	k2 := k.AddEncryptions(10)
+	k2 = k2.AddEncryptions(5)
+
+	// The original keyring is not modified
+	if k.ActiveKey().Encryptions != 0 {
+		t.Fatalf("bad: %d", k.ActiveKey().Encryptions)
+	}
+
+	buf, err := k2.Serialize()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	k3, err := DeserializeKeyring(buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if k3.RotationConfig() != config {
+		t.Fatalf("bad: %#v", k3.RotationConfig())
+	}
+	if k3.ActiveKey().Encryptions != 15 {
+		t.Fatalf("bad: %d", k3.ActiveKey().Encryptions)
+	}
+}
+
 func TestKey_Serialize(t *testing.T) {
 	k := &Key{
 		Term:        10,
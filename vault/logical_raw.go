@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -112,10 +113,22 @@ func (b *RawBackend) handleRawWrite(ctx context.Context, req *logical.Request, d
 		}
 	}
 
-	value := data.Get("value").(string)
+	value := []byte(data.Get("value").(string))
+	switch encoding := data.Get("encoding").(string); encoding {
+	case "":
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(string(value))
+		if err != nil {
+			return logical.ErrorResponse("failed to decode the base64 value: %s", err), logical.ErrInvalidRequest
+		}
+		value = decoded
+	default:
+		return logical.ErrorResponse("unsupported encoding %q", encoding), logical.ErrInvalidRequest
+	}
+
 	entry := &logical.StorageEntry{
 		Key:   path,
-		Value: []byte(value),
+		Value: value,
 	}
 	if err := b.barrier.Put(ctx, entry); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -189,6 +202,9 @@ func rawPaths(prefix string, r *RawBackend) []*framework.Path {
 				"value": &framework.FieldSchema{
 					Type: framework.TypeString,
 				},
+				"encoding": &framework.FieldSchema{
+					Type: framework.TypeString,
+				},
 			},
 
 			Operations: map[logical.Operation]framework.OperationHandler{
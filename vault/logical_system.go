@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"hash"
 	"net/http"
+	"net/textproto"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -91,6 +92,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 				"replication/dr/reindex",
 				"replication/performance/reindex",
 				"rotate",
+				"rotate/config",
 				"config/cors",
 				"config/auditing/*",
 				"config/ui/headers/*",
@@ -100,6 +102,9 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 				"leases/revoke-prefix/*",
 				"leases/revoke-force/*",
 				"leases/lookup/*",
+				"storage/migration",
+				"storage/migration/cutover",
+				"sealwrap/rewrap",
 			},
 
 			Unauthenticated: []string{
@@ -155,6 +160,8 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.leasePaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.policyPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.wrappingPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.controlGroupPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.mfaPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.toolsPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.capabilitiesPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.internalPaths()...)
@@ -164,6 +171,8 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.monitorPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.hostInfoPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.quotasPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.storageMigrationPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.sealWrapRewrapPaths()...)
 
 	if core.rawEnabled {
 		b.Backend.Paths = append(b.Backend.Paths, b.rawPaths()...)
@@ -607,6 +616,188 @@ func (b *SystemBackend) handleCapabilities(ctx context.Context, req *logical.Req
 	return ret, nil
 }
 
+// handlePoliciesSimulate evaluates a hypothetical request against a set of
+// ACL policies and explains which rule and which check decided the outcome.
+// The policies are either named directly or derived from a token accessor or
+// an entity.
+func (b *SystemBackend) handlePoliciesSimulate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names := d.Get("policies").([]string)
+	accessor := d.Get("accessor").(string)
+	entityID := d.Get("entity_id").(string)
+
+	var sources int
+	for _, set := range []bool{len(names) > 0, accessor != "", entityID != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return logical.ErrorResponse("exactly one of 'policies', 'accessor' or 'entity_id' must be supplied"), nil
+	}
+
+	path := strings.TrimPrefix(d.Get("path").(string), "/")
+	if path == "" {
+		return logical.ErrorResponse("'path' must be supplied"), nil
+	}
+
+	op := logical.Operation(strings.ToLower(d.Get("operation").(string)))
+	switch op {
+	case logical.CreateOperation, logical.ReadOperation, logical.UpdateOperation, logical.DeleteOperation,
+		logical.ListOperation, logical.RevokeOperation, logical.RenewOperation, logical.RollbackOperation:
+	default:
+		return logical.ErrorResponse("invalid operation %q", op), nil
+	}
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ACL is constructed in the namespace that owns the policies, which
+	// for a token is the token's namespace.
+	aclNS := ns
+	var entity *identity.Entity
+	policyNames := make(map[string][]string)
+	switch {
+	case len(names) > 0:
+		for _, name := range names {
+			policyNames[ns.ID] = append(policyNames[ns.ID], strings.ToLower(strings.TrimSpace(name)))
+		}
+
+	case accessor != "":
+		aEntry, err := b.Core.tokenStore.lookupByAccessor(ctx, accessor, false, false)
+		if err != nil {
+			return nil, err
+		}
+		if aEntry.TokenID == "" {
+			return logical.ErrorResponse("invalid accessor"), logical.ErrInvalidRequest
+		}
+		te, err := b.Core.tokenStore.Lookup(ctx, aEntry.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		if te == nil {
+			return logical.ErrorResponse("invalid accessor"), logical.ErrInvalidRequest
+		}
+		aclNS, entity, policyNames, err = b.Core.tokenEntryPolicyNames(ctx, te)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		var identityPolicies map[string][]string
+		entity, identityPolicies, err = b.Core.fetchEntityAndDerivedPolicies(ctx, ns, entityID)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			return logical.ErrorResponse("entity %q not found", entityID), nil
+		}
+		for nsID, nsPolicies := range identityPolicies {
+			policyNames[nsID] = append(policyNames[nsID], nsPolicies...)
+		}
+	}
+
+	aclCtx := namespace.ContextWithNamespace(ctx, aclNS)
+	policies, err := b.Core.policyStore.resolvePolicies(aclCtx, entity, policyNames)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := NewACL(aclCtx, policies)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	simReq := &logical.Request{
+		Path:      path,
+		Operation: op,
+		Data:      d.Get("data").(map[string]interface{}),
+	}
+	if wrapTTL := d.Get("wrap_ttl").(int); wrapTTL > 0 {
+		simReq.WrapInfo = &logical.RequestWrapInfo{
+			TTL: time.Duration(wrapTTL) * time.Second,
+		}
+	}
+	if remoteAddr := d.Get("remote_addr").(string); remoteAddr != "" {
+		simReq.Connection = &logical.Connection{
+			RemoteAddr: remoteAddr,
+		}
+	}
+	if headers := d.Get("headers").(map[string]string); len(headers) > 0 {
+		simReq.Headers = make(map[string][]string, len(headers))
+		for k, v := range headers {
+			simReq.Headers[textproto.CanonicalMIMEHeaderKey(k)] = []string{v}
+		}
+	}
+
+	results, explanation := acl.ExplainOperation(ctx, simReq)
+
+	var policyList []string
+	for _, p := range policies {
+		policyList = append(policyList, p.Name)
+	}
+	sort.Strings(policyList)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"path":      path,
+			"operation": string(op),
+			"policies":  policyList,
+			"allowed":   results.Allowed,
+			"root":      results.IsRoot,
+			"sudo":      results.RootPrivs,
+		},
+	}
+	if results.IsRoot {
+		return resp, nil
+	}
+
+	if explanation.Permissions != nil {
+		resp.Data["matched_rule"] = map[string]interface{}{
+			"path":         explanation.MatchedPath,
+			"type":         explanation.MatchType,
+			"capabilities": capabilitiesFromBitmap(explanation.Permissions.CapabilitiesBitmap),
+			"policies":     policyRuleCapabilities(policies, explanation),
+		}
+	}
+	if explanation.DeniedBy != "" {
+		resp.Data["denied_by"] = explanation.DeniedBy
+	}
+	if explanation.DeniedParameter != "" {
+		resp.Data["denied_parameter"] = explanation.DeniedParameter
+	}
+
+	return resp, nil
+}
+
+// policyRuleCapabilities returns, for every policy that contributed to the
+// rule selected in the explanation, the capabilities that policy granted on
+// the rule's path.
+func policyRuleCapabilities(policies []*Policy, explanation *ACLExplanation) map[string][]string {
+	ret := make(map[string][]string)
+	for _, p := range policies {
+		if p == nil || p.Type != PolicyTypeACL {
+			continue
+		}
+		for _, pc := range p.Paths {
+			matchedPath := pc.Path
+			matchType := aclMatchExact
+			switch {
+			case pc.HasSegmentWildcards:
+				matchType = aclMatchSegmentWildcard
+			case pc.IsPrefix:
+				matchType = aclMatchPrefix
+				matchedPath += "*"
+			}
+			if matchType != explanation.MatchType || matchedPath != explanation.MatchedPath {
+				continue
+			}
+			ret[p.Name] = strutil.RemoveDuplicates(append(ret[p.Name], pc.Capabilities...), true)
+		}
+	}
+	return ret
+}
+
 // handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
 // rekey operation
 func (b *SystemBackend) handleRekeyRetrieve(
@@ -2075,13 +2266,123 @@ func (b *SystemBackend) handlePoliciesSet(policyType PolicyType) framework.Opera
 		}
 
 		// Update the policy
-		if err := b.Core.policyStore.SetPolicy(ctx, policy); err != nil {
+		update, err := b.Core.policyStore.SetPolicyWithAuthor(ctx, policy, &PolicyAuthor{
+			Accessor: req.ClientTokenAccessor,
+			EntityID: req.EntityID,
+		})
+		if err != nil {
 			return handleError(err)
 		}
+
+		// Return the resulting version and what changed, so that policy edits
+		// can be reviewed from the audit log. The deprecated policy/ endpoint
+		// keeps its empty response.
+		if update != nil && !strings.HasPrefix(req.Path, "policy") {
+			if resp == nil {
+				resp = &logical.Response{}
+			}
+			resp.Data = map[string]interface{}{
+				"version": update.Version,
+			}
+			if diff := update.Diff(policy.Name, policy.Raw); diff != "" {
+				resp.Data["diff"] = diff
+			}
+		}
 		return resp, nil
 	}
 }
 
+// handlePoliciesVersions returns the version history of an ACL policy
+func (b *SystemBackend) handlePoliciesVersions(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	history, err := b.Core.policyStore.GetPolicyVersions(ctx, data.Get("name").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	if history == nil {
+		return nil, nil
+	}
+
+	versions := make([]map[string]interface{}, 0, len(history.Versions))
+	for _, v := range history.Versions {
+		var createdTime string
+		if !v.CreatedTime.IsZero() {
+			createdTime = v.CreatedTime.Format(time.RFC3339Nano)
+		}
+		versions = append(versions, map[string]interface{}{
+			"version":      v.Version,
+			"policy":       v.Raw,
+			"created_time": createdTime,
+			"accessor":     v.Accessor,
+			"entity_id":    v.EntityID,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"current_version": history.CurrentVersion,
+			"versions":        versions,
+		},
+	}, nil
+}
+
+// handlePoliciesRollback restores an ACL policy to the text of an earlier
+// version. The rollback is itself recorded as a new version.
+func (b *SystemBackend) handlePoliciesRollback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(data.Get("name").(string))
+	version := data.Get("version").(int)
+	if version <= 0 {
+		return logical.ErrorResponse("a positive version must be provided"), nil
+	}
+
+	history, err := b.Core.policyStore.GetPolicyVersions(ctx, name)
+	if err != nil {
+		return handleError(err)
+	}
+	if history == nil {
+		return logical.ErrorResponse(fmt.Sprintf("no version history found for policy %q", name)), nil
+	}
+	target := history.Version(version)
+	if target == nil {
+		return logical.ErrorResponse(fmt.Sprintf("version %d of policy %q is not in its history", version, name)), nil
+	}
+
+	p, err := ParseACLPolicy(ns, target.Raw)
+	if err != nil {
+		return handleError(err)
+	}
+	policy := &Policy{
+		Name:      name,
+		Raw:       target.Raw,
+		Type:      PolicyTypeACL,
+		Paths:     p.Paths,
+		Templated: p.Templated,
+		namespace: ns,
+	}
+
+	update, err := b.Core.policyStore.SetPolicyWithAuthor(ctx, policy, &PolicyAuthor{
+		Accessor: req.ClientTokenAccessor,
+		EntityID: req.EntityID,
+	})
+	if err != nil {
+		return handleError(err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"version": update.Version,
+		},
+	}
+	if diff := update.Diff(policy.Name, policy.Raw); diff != "" {
+		resp.Data["diff"] = diff
+	}
+	return resp, nil
+}
+
 func (b *SystemBackend) handlePoliciesDelete(policyType PolicyType) framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 		name := data.Get("name").(string)
@@ -2286,6 +2587,15 @@ func (b *SystemBackend) handleAuditTable(ctx context.Context, req *logical.Reque
 			"options":     entry.Options,
 			"local":       entry.Local,
 		}
+		if entry.AuditFilter != nil {
+			info["filter"] = map[string]interface{}{
+				"mount_paths":  entry.AuditFilter.MountPaths,
+				"operations":   entry.AuditFilter.Operations,
+				"namespaces":   entry.AuditFilter.Namespaces,
+				"auth_methods": entry.AuditFilter.AuthMethods,
+				"errors_only":  entry.AuditFilter.ErrorsOnly,
+			}
+		}
 		resp.Data[entry.Path] = info
 	}
 	return resp, nil
@@ -2332,6 +2642,11 @@ func (b *SystemBackend) handleEnableAudit(ctx context.Context, req *logical.Requ
 	description := data.Get("description").(string)
 	options := data.Get("options").(map[string]string)
 
+	filter, err := parseAuditFilter(data.Get("filter").(map[string]interface{}))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	// Create the mount entry
 	me := &MountEntry{
 		Table:       auditTableType,
@@ -2340,6 +2655,7 @@ func (b *SystemBackend) handleEnableAudit(ctx context.Context, req *logical.Requ
 		Description: description,
 		Options:     options,
 		Local:       local,
+		AuditFilter: filter,
 	}
 
 	// Attempt enabling
@@ -2473,6 +2789,7 @@ func (b *SystemBackend) handleKeyStatus(ctx context.Context, req *logical.Reques
 		Data: map[string]interface{}{
 			"term":         info.Term,
 			"install_time": info.InstallTime.Format(time.RFC3339Nano),
+			"encryptions":  info.Encryptions,
 		},
 	}
 	return resp, nil
@@ -2485,40 +2802,124 @@ func (b *SystemBackend) handleRotate(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("cannot rotate on a replication secondary"), nil
 	}
 
-	// Rotate to the new term
-	newTerm, err := b.Core.barrier.Rotate(ctx, b.Core.secureRandomReader)
-	if err != nil {
-		b.Backend.Logger().Error("failed to create new encryption key", "error", err)
+	if _, err := b.Core.rotateBarrierKey(ctx); err != nil {
 		return handleError(err)
 	}
-	b.Backend.Logger().Info("installed new encryption key")
 
-	// In HA mode, we need to an upgrade path for the standby instances
-	if b.Core.ha != nil {
-		// Create the upgrade path to the new term
-		if err := b.Core.barrier.CreateUpgrade(ctx, newTerm); err != nil {
-			b.Backend.Logger().Error("failed to create new upgrade", "term", newTerm, "error", err)
+	return nil, nil
+}
+
+// handleRewrapStatus returns the progress of the re-encryption of the storage
+// under the newest term
+func (b *SystemBackend) handleRewrapStatus(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	status := b.Core.barrierRewrap.getStatus()
+	if status == nil {
+		var err error
+		status, err = b.Core.loadBarrierRewrapStatus(ctx)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		// Schedule the destroy of the upgrade path
-		time.AfterFunc(KeyRotateGracePeriod, func() {
-			b.Backend.Logger().Debug("cleaning up upgrade keys", "waited", KeyRotateGracePeriod)
-			if err := b.Core.barrier.DestroyUpgrade(b.Core.activeContext, newTerm); err != nil {
-				b.Backend.Logger().Error("failed to destroy upgrade", "term", newTerm, "error", err)
+	keyring, err := b.Core.barrier.Keyring()
+	if err != nil {
+		return nil, err
+	}
+	terms := make([]int, 0, len(keyring.keys))
+	for term := range keyring.keys {
+		terms = append(terms, int(term))
+	}
+	sort.Ints(terms)
+
+	respData := map[string]interface{}{
+		"state": "",
+		"terms": terms,
+	}
+	if status != nil {
+		respData["state"] = status.State
+		respData["term"] = status.Term
+		respData["checkpoint"] = status.Checkpoint
+		respData["keys_scanned"] = status.KeysScanned
+		respData["keys_rewrapped"] = status.KeysRewrapped
+		respData["pruned_terms"] = status.PrunedTerms
+		respData["last_error"] = status.LastError
+		for key, t := range map[string]time.Time{
+			"start_time":     status.StartTime,
+			"rewrapped_time": status.RewrappedTime,
+			"complete_time":  status.CompleteTime,
+		} {
+			respData[key] = ""
+			if !t.IsZero() {
+				respData[key] = t.Format(time.RFC3339Nano)
 			}
-		})
+		}
+	}
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// handleRotateConfigRead returns the configuration of the automatic rotation
+// of the encryption key
+func (b *SystemBackend) handleRotateConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Core.barrier.RotationConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	// Write to the canary path, which will force a synchronous truing during
-	// replication
-	if err := b.Core.barrier.Put(ctx, &logical.StorageEntry{
-		Key:   coreKeyringCanaryPath,
-		Value: []byte(fmt.Sprintf("new-rotation-term-%d", newTerm)),
-	}); err != nil {
-		b.Core.logger.Error("error saving keyring canary", "error", err)
-		return nil, errwrap.Wrapf("failed to save keyring canary: {{err}}", err)
+	maxOperations := config.MaxOperations
+	if maxOperations == 0 {
+		maxOperations = absoluteOperationMaximum
 	}
 
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":        !config.Disabled,
+			"max_operations": maxOperations,
+			"interval":       int64(config.Interval.Seconds()),
+			"rewrap":         config.Rewrap,
+		},
+	}, nil
+}
+
+// handleRotateConfigUpdate updates the configuration of the automatic rotation
+// of the encryption key
+func (b *SystemBackend) handleRotateConfigUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	repState := b.Core.ReplicationState()
+	if repState.HasState(consts.ReplicationPerformanceSecondary) {
+		return logical.ErrorResponse("cannot configure the rotation on a replication secondary"), nil
+	}
+
+	config, err := b.Core.barrier.RotationConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Disabled = !enabledRaw.(bool)
+	}
+	if maxOperationsRaw, ok := data.GetOk("max_operations"); ok {
+		maxOperations := int64(maxOperationsRaw.(int))
+		if maxOperations < absoluteOperationMinimum || maxOperations > absoluteOperationMaximum {
+			return logical.ErrorResponse(fmt.Sprintf("max_operations must be between %d and %d", absoluteOperationMinimum, absoluteOperationMaximum)), logical.ErrInvalidRequest
+		}
+		config.MaxOperations = maxOperations
+	}
+	if intervalRaw, ok := data.GetOk("interval"); ok {
+		interval := time.Duration(intervalRaw.(int)) * time.Second
+		if interval != 0 && interval < minimumRotationInterval {
+			return logical.ErrorResponse(fmt.Sprintf("interval must be 0 or at least %s", minimumRotationInterval)), logical.ErrInvalidRequest
+		}
+		config.Interval = interval
+	}
+	if rewrapRaw, ok := data.GetOk("rewrap"); ok {
+		config.Rewrap = rewrapRaw.(bool)
+	}
+
+	if err := b.Core.barrier.SetRotationConfig(ctx, config); err != nil {
+		return handleError(err)
+	}
 	return nil, nil
 }
 
@@ -2593,7 +2994,7 @@ func (b *SystemBackend) handleWrappingUnwrap(ctx context.Context, req *logical.R
 	var response string
 	switch te.Policies[0] {
 	case controlGroupPolicyName:
-		response, err = controlGroupUnwrap(unwrapCtx, b, token, thirdParty)
+		response, err = b.controlGroupUnwrap(unwrapCtx, te)
 	case responseWrappingPolicyName:
 		response, err = b.responseWrappingUnwrap(unwrapCtx, te, thirdParty)
 	}
@@ -4038,6 +4439,39 @@ or delete a policy.
 		`,
 	},
 
+	"policy-versions": {
+		"Read the version history of an ACL policy.",
+		`Returns the most recent versions of the named ACL policy, along with the
+accessor and entity of the token that wrote each version and when it was
+written. The history is kept when the policy is deleted.`,
+	},
+
+	"policy-rollback": {
+		"Restore an ACL policy to an earlier version.",
+		`Writes the text of the given version of the named ACL policy back as its
+current text. The rollback is recorded as a new version. Rolling back a deleted
+policy recreates it.`,
+	},
+
+	"policy-version": {
+		"The version of the policy to restore.",
+		"",
+	},
+
+	"policy-simulate": {
+		`Explain how a set of ACL policies would decide a request.`,
+		`
+Evaluates a hypothetical request against the ACL policies named in
+'policies', or those attached to the token identified by 'accessor' or to the
+entity identified by 'entity_id'. The response reports whether the request
+would be allowed, which rule matched and how (exact, prefix or
+segment-wildcard), the capabilities each contributing policy granted on that
+rule, and which check rejected the request if it was denied. Path conditions
+are evaluated at the current time against 'remote_addr' and 'headers'. No
+request is actually performed.
+		`,
+	},
+
 	"policy-name": {
 		`The name of the policy. Example: "ops"`,
 		"",
@@ -4104,6 +4538,11 @@ This path responds to the following HTTP methods.
 		"",
 	},
 
+	"audit_filter": {
+		`Restricts the requests and responses logged by the audit backend. Supports "mount_paths", "operations", "namespaces", "auth_methods" and "errors_only".`,
+		"",
+	},
+
 	"audit": {
 		`Enable or disable audit backends.`,
 		`
@@ -4127,6 +4566,27 @@ Enable a new audit backend or disable an existing backend.
 		`,
 	},
 
+	"rotate-config": {
+		"Configures the automatic rotation of the backend encryption key.",
+		`
+		The active node rotates the backend encryption key once it has been
+		used for max_operations encryptions, or once it has been installed for
+		longer than the interval. The number of encryptions is estimated, and
+		persisted every few minutes. If rewrap is set, the storage is
+		re-encrypted under the new key after each rotation.
+		`,
+	},
+
+	"rotate-rewrap-status": {
+		"Returns the progress of the re-encryption of the storage under the newest backend encryption key.",
+		`
+		If rewrap is set in the rotation configuration, after a rotation the
+		active node re-encrypts the entries of the storage under the new key in
+		the background, then prunes the older keys from the keyring once they
+		were retired for longer than the maximum lease TTL.
+		`,
+	},
+
 	"rekey_backup": {
 		"Allows fetching or deleting the backup of the rotated unseal keys.",
 		"",
@@ -4186,6 +4646,61 @@ it.`,
 		`Rotates a response-wrapped token; the output is a new token with the same
 		response wrapped inside and the same creation TTL. The original token is revoked.`,
 	},
+
+	"control-group-authorize": {
+		"Approves a request held by a control group.",
+		`Records the calling entity's approval of the request held by the control
+group token with the given accessor. The caller must be a member of one of the
+identity groups named in the control group's factors and cannot approve its
+own request. Once every factor has received the required number of approvals,
+the requester can unwrap the token to carry out the request.`,
+	},
+
+	"control-group-request": {
+		"Looks up the status of a request held by a control group.",
+		`Returns the path of the request held by the control group token with the
+given accessor, the entity that made it, the approvals it has received so far
+and whether it has been approved.`,
+	},
+
+	"control-group-accessor": {
+		"The accessor of the control group token that holds the request.",
+		"",
+	},
+	"mfa-method-totp": {
+		"Configures a TOTP MFA method.",
+		`Defines an MFA method of type TOTP under the given name. Policies can
+require a passcode generated from the method's secret by listing the name in
+the mfa_methods of a path. Method names are shared across all MFA types.`,
+	},
+
+	"mfa-method-duo": {
+		"Configures a Duo MFA method.",
+		`Defines an MFA method of type Duo under the given name. The entity of the
+requesting token is mapped to a Duo username using its alias on the configured
+mount and the username format. Policies can require a Duo push or passcode by
+listing the name in the mfa_methods of a path.`,
+	},
+
+	"mfa-method-totp-generate": {
+		"Generates a TOTP secret for the entity of the calling token.",
+		`Generates a secret for the given TOTP MFA method and stores it on the
+entity of the calling token, if one doesn't exist already. The returned URL and
+QR code can be loaded into an authenticator application.`,
+	},
+
+	"mfa-method-totp-admin-generate": {
+		"Generates a TOTP secret for the given entity.",
+		`Generates a secret for the given TOTP MFA method and stores it on the
+given entity, if one doesn't exist already.`,
+	},
+
+	"mfa-method-totp-admin-destroy": {
+		"Removes the TOTP secret from the given entity.",
+		`Deletes the secret of the given TOTP MFA method from the given entity.
+An existing secret has to be removed before a new one can be generated.`,
+	},
+
 	"audited-headers-name": {
 		"Configures the headers sent to the audit logs.",
 		`
@@ -510,6 +510,10 @@ func (b *SystemBackend) auditPaths() []*framework.Path {
 					Type:        framework.TypeKVPairs,
 					Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
 				},
+				"filter": &framework.FieldSchema{
+					Type:        framework.TypeMap,
+					Description: strings.TrimSpace(sysHelp["audit_filter"][0]),
+				},
 				"local": &framework.FieldSchema{
 					Type:        framework.TypeBool,
 					Default:     false,
@@ -602,6 +606,58 @@ func (b *SystemBackend) sealPaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysHelp["rotate"][0]),
 			HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
 		},
+
+		{
+			Pattern: "rotate/config$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"enabled": &framework.FieldSchema{
+					Type:        framework.TypeBool,
+					Default:     true,
+					Description: "Whether the encryption key is rotated automatically.",
+				},
+				"max_operations": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The number of encryptions after which the encryption key is rotated.",
+				},
+				"interval": &framework.FieldSchema{
+					Type:        framework.TypeDurationSecond,
+					Description: "The time after which the encryption key is rotated, 0 to only rotate it on the number of encryptions.",
+				},
+				"rewrap": &framework.FieldSchema{
+					Type:        framework.TypeBool,
+					Description: "Whether the storage is re-encrypted under the new encryption key after each rotation, so that the older keys can be pruned.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRotateConfigRead,
+					Summary:  "Returns the configuration of the automatic rotation of the encryption key.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRotateConfigUpdate,
+					Summary:  "Configures the automatic rotation of the encryption key.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["rotate-config"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["rotate-config"][1]),
+		},
+
+		{
+			Pattern: "rotate/rewrap-status$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRewrapStatus,
+					Summary:  "Returns the progress of the re-encryption of the storage under the newest encryption key.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["rotate-rewrap-status"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["rotate-rewrap-status"][1]),
+		},
 	}
 }
 
@@ -1435,6 +1491,106 @@ func (b *SystemBackend) policyPaths() []*framework.Path {
 			HelpDescription: strings.TrimSpace(sysHelp["policy-list"][1]),
 		},
 
+		{
+			Pattern: "policies/simulate/acl$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"policies": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Names of the ACL policies to evaluate the request against.",
+				},
+				"accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Accessor of a token whose policies should be evaluated.",
+				},
+				"entity_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "ID of an entity whose policies should be evaluated.",
+				},
+				"path": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Request path to simulate.",
+				},
+				"operation": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Default:     "read",
+					Description: "Operation to simulate, e.g. read, list, create, update or delete.",
+				},
+				"data": &framework.FieldSchema{
+					Type:        framework.TypeMap,
+					Description: "Request body to check against parameter constraints.",
+				},
+				"wrap_ttl": &framework.FieldSchema{
+					Type:        framework.TypeDurationSecond,
+					Description: "Response-wrapping TTL to check against wrapping TTL constraints.",
+				},
+				"remote_addr": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Client address to check against source_cidrs conditions.",
+				},
+				"headers": &framework.FieldSchema{
+					Type:        framework.TypeKVPairs,
+					Description: "Request headers to check against required_headers conditions.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handlePoliciesSimulate,
+					Summary:  "Explain how ACL policies would decide a request.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["policy-simulate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["policy-simulate"][1]),
+		},
+
+		{
+			Pattern: "policies/acl/(?P<name>.+)/versions$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handlePoliciesVersions,
+					Summary:  "Retrieve the version history of the named ACL policy.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["policy-versions"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["policy-versions"][1]),
+		},
+
+		{
+			Pattern: "policies/acl/(?P<name>.+)/rollback$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+				},
+				"version": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: strings.TrimSpace(sysHelp["policy-version"][0]),
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handlePoliciesRollback,
+					Summary:  "Restore the named ACL policy to an earlier version.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["policy-rollback"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["policy-rollback"][1]),
+		},
+
 		{
 			Pattern: "policies/acl/(?P<name>.+)",
 
@@ -1598,6 +1754,243 @@ func (b *SystemBackend) wrappingPaths() []*framework.Path {
 	}
 }
 
+func (b *SystemBackend) controlGroupPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "control-group/authorize$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleControlGroupAuthorize,
+					Summary:  "Approve a request held by a control group.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-authorize"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["control-group-authorize"][1]),
+		},
+
+		{
+			Pattern: "control-group/request$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["control-group-accessor"][0]),
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleControlGroupRequest,
+					Summary:  "Look up the status of a request held by a control group.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-request"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["control-group-request"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) mfaPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"issuer": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the key's issuing organization.",
+				},
+				"period": &framework.FieldSchema{
+					Type:        framework.TypeDurationSecond,
+					Default:     30,
+					Description: "The length of time used to generate a counter for the TOTP token calculation.",
+				},
+				"key_size": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Default:     20,
+					Description: "Determines the size in bytes of the generated key.",
+				},
+				"qr_size": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Default:     200,
+					Description: "The pixel size of the generated square QR code.",
+				},
+				"algorithm": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Default:     "SHA1",
+					Description: `The hashing algorithm used to generate the TOTP token. Options include SHA1, SHA256 and SHA512.`,
+				},
+				"digits": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Default:     6,
+					Description: "The number of digits in the generated TOTP token. This value can either be 6 or 8.",
+				},
+				"skew": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Default:     1,
+					Description: "The number of delay periods that are allowed when validating a TOTP token. This value can either be 0 or 1.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodRead(mfaMethodTypeTOTP),
+					Summary:  "Read the configuration of a TOTP MFA method.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodTOTPUpdate,
+					Summary:  "Configure a TOTP MFA method.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodDelete(mfaMethodTypeTOTP),
+					Summary:  "Delete a TOTP MFA method.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-totp"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-totp"][1]),
+		},
+
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/generate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleMFAGenerateTOTPSecret,
+					Summary:  "Generate a TOTP secret for the entity of the calling token.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-totp-generate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-totp-generate"][1]),
+		},
+
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-generate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"entity_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Entity ID on which the generated secret needs to get stored.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMFAAdminGenerateTOTPSecret,
+					Summary:  "Generate a TOTP secret for the given entity.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-totp-admin-generate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-totp-admin-generate"][1]),
+		},
+
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-destroy$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"entity_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Entity ID from which the MFA secret should be removed.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMFAAdminDestroyTOTPSecret,
+					Summary:  "Remove the TOTP secret from the given entity.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-totp-admin-destroy"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-totp-admin-destroy"][1]),
+		},
+
+		{
+			Pattern: "mfa/method/duo/" + framework.GenericNameRegex("name") + "$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"mount_accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The mount whose aliases are used to map entities to Duo usernames.",
+				},
+				"username_format": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: `A format string for mapping identity names to Duo usernames, e.g. "{{alias.name}}@example.com". If blank, the alias name is used as-is.`,
+				},
+				"secret_key": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Secret key for Duo.",
+				},
+				"integration_key": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Integration key for Duo.",
+				},
+				"api_hostname": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "API hostname for Duo.",
+				},
+				"push_info": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Push information for Duo.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodRead(mfaMethodTypeDuo),
+					Summary:  "Read the configuration of a Duo MFA method.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodDuoUpdate,
+					Summary:  "Configure a Duo MFA method.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleMFAMethodDelete(mfaMethodTypeDuo),
+					Summary:  "Delete a Duo MFA method.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-duo"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-duo"][1]),
+		},
+	}
+}
+
 func (b *SystemBackend) mountPaths() []*framework.Path {
 	return []*framework.Path{
 		{
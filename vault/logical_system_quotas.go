@@ -3,9 +3,11 @@ package vault
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/quid/vault/helper/namespace"
 	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/helper/strutil"
 	"github.com/quid/vault/sdk/logical"
 	"github.com/quid/vault/vault/quotas"
 )
@@ -73,6 +75,12 @@ rule. There is a one-to-one mapping between requests and tokens in the rate limi
 may perform up to 'burst' requests at once, at which they they may invoke additional requests at
 'rate' per-second.`,
 				},
+				"key_type": {
+					Type: framework.TypeString,
+					Description: `What separate rate limiters are kept for: "ip" for each client IP address,
+"entity" for each identity entity, or "role" for each auth role named in login requests.
+Requests that lack an entity or role are limited by client IP address. Defaults to "ip".`,
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.UpdateOperation: &framework.PathOperation{
@@ -88,6 +96,123 @@ may perform up to 'burst' requests at once, at which they they may invoke additi
 			HelpSynopsis:    strings.TrimSpace(quotasHelp["rate-limit"][0]),
 			HelpDescription: strings.TrimSpace(quotasHelp["rate-limit"][1]),
 		},
+		{
+			Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name") + "/stats$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota rule.",
+				},
+				"limit": {
+					Type:        framework.TypeInt,
+					Default:     10,
+					Description: "Maximum number of clients to report.",
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasStats(),
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["rate-limit-stats"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["rate-limit-stats"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasList(),
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["lease-count-list"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["lease-count-list"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:        framework.TypeString,
+					Description: "Type of the quota rule.",
+				},
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota rule.",
+				},
+				"path": {
+					Type: framework.TypeString,
+					Description: `Path of the mount or namespace to apply the quota. A blank path configures a
+global quota. For example namespace1/ adds a quota to a full namespace,
+namespace1/auth/userpass adds a quota to userpass in namespace1.`,
+				},
+				"max_leases": {
+					Type:        framework.TypeInt,
+					Description: `The maximum number of leases to be allowed by the quota rule. The 'max_leases' must be positive.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasUpdate(),
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasRead(),
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasDelete(),
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["lease-count"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["lease-count"][1]),
+		},
+		{
+			Pattern: "quotas/request-size/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleRequestSizeQuotasList(),
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["request-size-list"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["request-size-list"][1]),
+		},
+		{
+			Pattern: "quotas/request-size/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"type": {
+					Type:        framework.TypeString,
+					Description: "Type of the quota rule.",
+				},
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the quota rule.",
+				},
+				"path": {
+					Type: framework.TypeString,
+					Description: `Path of the mount or namespace to apply the quota. A blank path configures a
+global quota. For example namespace1/ adds a quota to a full namespace,
+namespace1/auth/userpass adds a quota to userpass in namespace1.`,
+				},
+				"max_request_size": {
+					Type:        framework.TypeInt,
+					Description: `The maximum size in bytes of request bodies allowed by the quota rule. Zero leaves request bodies unlimited.`,
+				},
+				"max_response_size": {
+					Type:        framework.TypeInt,
+					Description: `The maximum size in bytes of response payloads allowed by the quota rule. Zero leaves response payloads unlimited.`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRequestSizeQuotasUpdate(),
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRequestSizeQuotasRead(),
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleRequestSizeQuotasDelete(),
+				},
+			},
+			HelpSynopsis:    strings.TrimSpace(quotasHelp["request-size"][0]),
+			HelpDescription: strings.TrimSpace(quotasHelp["request-size"][1]),
+		},
 	}
 }
 
@@ -149,6 +274,15 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 			return logical.ErrorResponse("'burst' must be greater than or equal to 'rate' as an integer value"), nil
 		}
 
+		keyTypeRaw, keyTypeOk := d.GetOk("key_type")
+		keyType := quotas.RateLimitKeyClientIP
+		if keyTypeOk {
+			keyType = keyTypeRaw.(string)
+			if !strutil.StrListContains(quotas.RateLimitKeyTypes(), keyType) {
+				return logical.ErrorResponse("'key_type' must be one of %q", quotas.RateLimitKeyTypes()), nil
+			}
+		}
+
 		mountPath := sanitizePath(d.Get("path").(string))
 		ns := b.Core.namespaceByPath(mountPath)
 		if ns.ID != namespace.RootNamespaceID {
@@ -180,13 +314,18 @@ func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
 				return logical.ErrorResponse("quota rule with similar properties exists under the name %q", quotaByFactors.QuotaName()), nil
 			}
 
-			quota = quotas.NewRateLimitQuota(name, ns.Path, mountPath, rate, burst)
+			rlq := quotas.NewRateLimitQuota(name, ns.Path, mountPath, rate, burst)
+			rlq.KeyType = keyType
+			quota = rlq
 		default:
 			rlq := quota.(*quotas.RateLimitQuota)
 			rlq.NamespacePath = ns.Path
 			rlq.MountPath = mountPath
 			rlq.Rate = rate
 			rlq.Burst = burst
+			if keyTypeOk {
+				rlq.KeyType = keyType
+			}
 		}
 
 		entry, err := logical.StorageEntryJSON(quotas.QuotaStoragePath(qType, name), quota)
@@ -227,11 +366,12 @@ func (b *SystemBackend) handleRateLimitQuotasRead() framework.OperationFunc {
 		}
 
 		data := map[string]interface{}{
-			"type":  qType,
-			"name":  rlq.Name,
-			"path":  nsPath + rlq.MountPath,
-			"rate":  rlq.Rate,
-			"burst": rlq.Burst,
+			"type":     qType,
+			"name":     rlq.Name,
+			"path":     nsPath + rlq.MountPath,
+			"rate":     rlq.Rate,
+			"burst":    rlq.Burst,
+			"key_type": rlq.ClientKeyType(),
 		}
 
 		return &logical.Response{
@@ -240,6 +380,47 @@ func (b *SystemBackend) handleRateLimitQuotasRead() framework.OperationFunc {
 	}
 }
 
+func (b *SystemBackend) handleRateLimitQuotasStats() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeRateLimit.String()
+
+		limit := d.Get("limit").(int)
+		if limit <= 0 {
+			return logical.ErrorResponse("'limit' must be positive"), nil
+		}
+
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, nil
+		}
+
+		rlq := quota.(*quotas.RateLimitQuota)
+
+		clients := make([]map[string]interface{}, 0, limit)
+		for _, stats := range rlq.Stats(limit) {
+			clients = append(clients, map[string]interface{}{
+				"key":       stats.Key,
+				"key_type":  stats.KeyType,
+				"allowed":   stats.Allowed,
+				"rejected":  stats.Rejected,
+				"last_seen": stats.LastSeen.Format(time.RFC3339Nano),
+			})
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":     rlq.Name,
+				"key_type": rlq.ClientKeyType(),
+				"clients":  clients,
+			},
+		}, nil
+	}
+}
+
 func (b *SystemBackend) handleRateLimitQuotasDelete() framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 		name := d.Get("name").(string)
@@ -257,6 +438,270 @@ func (b *SystemBackend) handleRateLimitQuotasDelete() framework.OperationFunc {
 	}
 }
 
+func (b *SystemBackend) handleLeaseCountQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeLeaseCount)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		qType := quotas.TypeLeaseCount.String()
+		maxLeases := d.Get("max_leases").(int)
+		if maxLeases <= 0 {
+			return logical.ErrorResponse("'max_leases' is invalid"), nil
+		}
+
+		mountPath := sanitizePath(d.Get("path").(string))
+		ns := b.Core.namespaceByPath(mountPath)
+		if ns.ID != namespace.RootNamespaceID {
+			mountPath = strings.TrimPrefix(mountPath, ns.Path)
+		}
+
+		if mountPath != "" {
+			match := b.Core.router.MatchingMount(namespace.ContextWithNamespace(ctx, ns), mountPath)
+			if match == "" {
+				return logical.ErrorResponse("invalid mount path %q", mountPath), nil
+			}
+		}
+
+		// If a quota already exists, fetch and update it.
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quota == nil:
+			// Disallow creation of new quota that has properties similar to an
+			// existing quota.
+			quotaByFactors, err := b.Core.quotaManager.QuotaByFactors(ctx, qType, ns.Path, mountPath)
+			if err != nil {
+				return nil, err
+			}
+			if quotaByFactors != nil && quotaByFactors.QuotaName() != name {
+				return logical.ErrorResponse("quota rule with similar properties exists under the name %q", quotaByFactors.QuotaName()), nil
+			}
+
+			quota = quotas.NewLeaseCountQuota(name, ns.Path, mountPath, maxLeases)
+		default:
+			lcq := quota.(*quotas.LeaseCountQuota)
+			lcq.NamespacePath = ns.Path
+			lcq.MountPath = mountPath
+			lcq.MaxLeases = maxLeases
+		}
+
+		entry, err := logical.StorageEntryJSON(quotas.QuotaStoragePath(qType, name), quota)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.SetQuota(ctx, qType, quota, false); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeLeaseCount.String()
+
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, nil
+		}
+
+		lcq := quota.(*quotas.LeaseCountQuota)
+
+		nsPath := lcq.NamespacePath
+		if lcq.NamespacePath == "root" {
+			nsPath = ""
+		}
+
+		data := map[string]interface{}{
+			"type":       qType,
+			"name":       lcq.Name,
+			"path":       nsPath + lcq.MountPath,
+			"max_leases": lcq.MaxLeases,
+			"counter":    lcq.Counter(),
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeLeaseCount.String()
+
+		if err := req.Storage.Delete(ctx, quotas.QuotaStoragePath(qType, name)); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.DeleteQuota(ctx, qType, name); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRequestSizeQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.quotaManager.QuotaNames(quotas.TypeRequestSize)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleRequestSizeQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		qType := quotas.TypeRequestSize.String()
+		maxRequestSize := int64(d.Get("max_request_size").(int))
+		if maxRequestSize < 0 {
+			return logical.ErrorResponse("'max_request_size' is invalid"), nil
+		}
+		maxResponseSize := int64(d.Get("max_response_size").(int))
+		if maxResponseSize < 0 {
+			return logical.ErrorResponse("'max_response_size' is invalid"), nil
+		}
+		if maxRequestSize == 0 && maxResponseSize == 0 {
+			return logical.ErrorResponse("at least one of 'max_request_size' or 'max_response_size' must be set"), nil
+		}
+
+		mountPath := sanitizePath(d.Get("path").(string))
+		ns := b.Core.namespaceByPath(mountPath)
+		if ns.ID != namespace.RootNamespaceID {
+			mountPath = strings.TrimPrefix(mountPath, ns.Path)
+		}
+
+		if mountPath != "" {
+			match := b.Core.router.MatchingMount(namespace.ContextWithNamespace(ctx, ns), mountPath)
+			if match == "" {
+				return logical.ErrorResponse("invalid mount path %q", mountPath), nil
+			}
+		}
+
+		// If a quota already exists, fetch and update it.
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case quota == nil:
+			// Disallow creation of new quota that has properties similar to an
+			// existing quota.
+			quotaByFactors, err := b.Core.quotaManager.QuotaByFactors(ctx, qType, ns.Path, mountPath)
+			if err != nil {
+				return nil, err
+			}
+			if quotaByFactors != nil && quotaByFactors.QuotaName() != name {
+				return logical.ErrorResponse("quota rule with similar properties exists under the name %q", quotaByFactors.QuotaName()), nil
+			}
+
+			quota = quotas.NewRequestSizeQuota(name, ns.Path, mountPath, maxRequestSize, maxResponseSize)
+		default:
+			rsq := quota.(*quotas.RequestSizeQuota)
+			rsq.NamespacePath = ns.Path
+			rsq.MountPath = mountPath
+			rsq.MaxRequestSize = maxRequestSize
+			rsq.MaxResponseSize = maxResponseSize
+		}
+
+		entry, err := logical.StorageEntryJSON(quotas.QuotaStoragePath(qType, name), quota)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.SetQuota(ctx, qType, quota, false); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRequestSizeQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeRequestSize.String()
+
+		quota, err := b.Core.quotaManager.QuotaByName(qType, name)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, nil
+		}
+
+		rsq := quota.(*quotas.RequestSizeQuota)
+
+		nsPath := rsq.NamespacePath
+		if rsq.NamespacePath == "root" {
+			nsPath = ""
+		}
+
+		data := map[string]interface{}{
+			"type":              qType,
+			"name":              rsq.Name,
+			"path":              nsPath + rsq.MountPath,
+			"max_request_size":  rsq.MaxRequestSize,
+			"max_response_size": rsq.MaxResponseSize,
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleRequestSizeQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		qType := quotas.TypeRequestSize.String()
+
+		if err := req.Storage.Delete(ctx, quotas.QuotaStoragePath(qType, name)); err != nil {
+			return nil, err
+		}
+
+		if err := b.Core.quotaManager.DeleteQuota(ctx, qType, name); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
 var quotasHelp = map[string][2]string{
 	"quotas-config": {
 		"Create, update and read the quota configuration.",
@@ -267,12 +712,45 @@ var quotasHelp = map[string][2]string{
 mount.`,
 		`A rate limit quota will enforce rate limiting using a token bucket algorithm. A
 rate limit quota can be created at the root level or defined on a namespace or
-mount by specifying a 'path'. The rate limiter is applied to each unique client
-IP address. A client may invoke 'burst' requests at any given second, after
-which they may invoke additional requests at 'rate' per-second.`,
+mount by specifying a 'path'. By default, the rate limiter is applied to each
+unique client IP address; setting 'key_type' applies it to each identity entity
+or auth role instead. A client may invoke 'burst' requests at any given second,
+after which they may invoke additional requests at 'rate' per-second.`,
+	},
+	"rate-limit-stats": {
+		"Report the clients with the most requests against a rate limit quota.",
+		`Clients are listed by the number of their requests that were rejected by
+the quota, followed by the number that were allowed. Counts are kept for as long
+as the client keeps making requests; clients that have been idle for a few
+minutes are forgotten.`,
 	},
 	"rate-limit-list": {
 		"Lists the names of all the rate limit quotas.",
 		"This list contains quota definitions from all the namespaces.",
 	},
+	"lease-count": {
+		`Get, create or update lease count quota for an optional namespace or mount.`,
+		`A lease count quota limits the number of leases that can exist at any given
+time. A lease count quota can be created at the root level or defined on a
+namespace or mount by specifying a 'path'. Once the number of leases the quota
+applies to reaches 'max_leases', requests that would generate new leases are
+rejected until existing leases are revoked or expire.`,
+	},
+	"lease-count-list": {
+		"Lists the names of all the lease count quotas.",
+		"This list contains quota definitions from all the namespaces.",
+	},
+	"request-size": {
+		`Get, create or update request size quota for an optional namespace or mount.`,
+		`A request size quota limits the size of request bodies and of response
+payloads. A request size quota can be created at the root level or defined on a
+namespace or mount by specifying a 'path'. Requests with a body larger than
+'max_request_size' are rejected before they are handled, and requests whose
+response would be larger than 'max_response_size' are rejected once handled.
+Rejected requests receive a 413 status code.`,
+	},
+	"request-size-list": {
+		"Lists the names of all the request size quotas.",
+		"This list contains quota definitions from all the namespaces.",
+	},
 }
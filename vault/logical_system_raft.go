@@ -5,7 +5,9 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/quid/vault/sdk/framework"
 	"github.com/quid/vault/sdk/logical"
@@ -87,6 +89,31 @@ func (b *SystemBackend) raftStoragePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-remove-peer"][0]),
 			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-remove-peer"][1]),
 		},
+		{
+			Pattern: "storage/raft/suffrage",
+
+			Fields: map[string]*framework.FieldSchema{
+				"server_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the server to promote or demote.",
+				},
+				"suffrage": {
+					Type:          framework.TypeString,
+					Description:   `Suffrage of the server, "voter" or "non-voter".`,
+					AllowedValues: []interface{}{raft.SuffrageVoter, raft.SuffrageNonVoter},
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRaftSuffrageUpdate(),
+					Summary:  "Promotes a non-voter of the raft cluster to a voter, or demotes a voter to a non-voter.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-suffrage"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-suffrage"][1]),
+		},
 		{
 			Pattern: "storage/raft/configuration",
 
@@ -128,6 +155,153 @@ func (b *SystemBackend) raftStoragePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot-force"][0]),
 			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot-force"][1]),
 		},
+		{
+			Pattern: "storage/raft/autopilot/state",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftAutopilotState(),
+					Summary:  "Returns the health of the raft cluster as seen by autopilot.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-autopilot-state"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-autopilot-state"][1]),
+		},
+		{
+			Pattern: "storage/raft/autopilot/configuration",
+
+			Fields: map[string]*framework.FieldSchema{
+				"cleanup_dead_servers": {
+					Type:        framework.TypeBool,
+					Description: "Whether to remove the servers dead for longer than dead_server_last_contact_threshold.",
+				},
+				"last_contact_threshold": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time since the last heartbeat of a server after which it is unhealthy.",
+				},
+				"dead_server_last_contact_threshold": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time since the last heartbeat of a server after which it is dead.",
+				},
+				"max_trailing_logs": {
+					Type:        framework.TypeInt,
+					Description: "Number of log entries a server can trail the leader by while being healthy.",
+				},
+				"min_quorum": {
+					Type:        framework.TypeInt,
+					Description: "Number of voters below which dead servers are not removed.",
+				},
+				"server_stabilization_time": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time a new server must be healthy for before it is promoted to a voter.",
+				},
+				"stage_new_servers": {
+					Type:        framework.TypeBool,
+					Description: "Whether to add the servers joining as voters as non-voters until they are stable.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftAutopilotConfigRead(),
+					Summary:  "Returns the autopilot configuration.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftAutopilotConfigUpdate(),
+					Summary:  "Updates the autopilot configuration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-autopilot-configuration"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-autopilot-configuration"][1]),
+		},
+		{
+			Pattern: "storage/raft/snapshot-auto/config/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoConfigList(),
+					Summary:  "Lists the automated snapshot configurations.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-config-list"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-config-list"][1]),
+		},
+		{
+			Pattern: "storage/raft/snapshot-auto/config/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the automated snapshot configuration.",
+				},
+				"interval": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time between snapshots.",
+				},
+				"retain": {
+					Type:        framework.TypeInt,
+					Default:     1,
+					Description: "Number of snapshots to keep, the oldest ones are removed.",
+				},
+				"storage_type": {
+					Type:        framework.TypeString,
+					Default:     raftAutoSnapshotLocalStorage,
+					Description: "Where the snapshots are written.",
+				},
+				"path_prefix": {
+					Type:        framework.TypeString,
+					Description: "Location of the snapshots within the storage, the directory for local snapshots.",
+				},
+				"file_name_template": {
+					Type:        framework.TypeString,
+					Default:     raftAutoSnapshotDefaultFileNameTemplate,
+					Description: "Template of the snapshot file names, with the fields Name, Timestamp, Unix and Index.",
+				},
+				"storage_config": {
+					Type:        framework.TypeKVPairs,
+					Description: "Configuration of the storage, specific to the storage type.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoConfigRead(),
+					Summary:  "Returns an automated snapshot configuration.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoConfigUpdate(),
+					Summary:  "Creates or updates an automated snapshot configuration.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoConfigDelete(),
+					Summary:  "Deletes an automated snapshot configuration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-config"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-config"][1]),
+		},
+		{
+			Pattern: "storage/raft/snapshot-auto/status/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the automated snapshot configuration.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageRaftSnapshotAutoStatusRead(),
+					Summary:  "Returns the status of an automated snapshot configuration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-status"][0]),
+			HelpDescription: strings.TrimSpace(sysRaftHelp["raft-snapshot-auto-status"][1]),
+		},
 	}
 }
 
@@ -169,6 +343,66 @@ func (b *SystemBackend) handleRaftRemovePeerUpdate() framework.OperationFunc {
 		if b.Core.raftFollowerStates != nil {
 			b.Core.raftFollowerStates.delete(serverID)
 		}
+		if err := b.Core.setRaftNonVoter(ctx, serverID, false); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRaftSuffrageUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		serverID := d.Get("server_id").(string)
+		if len(serverID) == 0 {
+			return logical.ErrorResponse("no server id provided"), logical.ErrInvalidRequest
+		}
+		suffrage := d.Get("suffrage").(string)
+		if suffrage != raft.SuffrageVoter && suffrage != raft.SuffrageNonVoter {
+			return logical.ErrorResponse(fmt.Sprintf("suffrage must be %q or %q", raft.SuffrageVoter, raft.SuffrageNonVoter)), logical.ErrInvalidRequest
+		}
+
+		raftBackend := b.Core.getRaftBackend()
+		if raftBackend == nil {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		config, err := raftBackend.GetConfiguration(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var server *raft.RaftServer
+		for _, s := range config.Servers {
+			if s.NodeID == serverID {
+				server = s
+				break
+			}
+		}
+		if server == nil {
+			return logical.ErrorResponse("no server with the given id in the raft cluster"), logical.ErrInvalidRequest
+		}
+
+		if suffrage == raft.SuffrageNonVoter && server.Leader {
+			return logical.ErrorResponse("the leader can't be demoted"), logical.ErrInvalidRequest
+		}
+
+		// Record the suffrage first so that autopilot doesn't promote a server
+		// being demoted
+		if err := b.Core.setRaftNonVoter(ctx, serverID, suffrage == raft.SuffrageNonVoter); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case suffrage == raft.SuffrageVoter && !server.Voter:
+			b.logger.Info("promoting raft peer to voter", "server_id", serverID)
+			err = raftBackend.AddPeer(ctx, serverID, server.Address)
+		case suffrage == raft.SuffrageNonVoter && server.Voter:
+			b.logger.Info("demoting raft peer to non-voter", "server_id", serverID)
+			err = raftBackend.DemotePeer(ctx, serverID)
+		}
+		if err != nil {
+			return nil, err
+		}
 
 		return nil, nil
 	}
@@ -269,8 +503,16 @@ func (b *SystemBackend) handleRaftBootstrapAnswerWrite() framework.OperationFunc
 			return nil, errors.New("could not decode raft TLS configuration")
 		}
 
-		switch nonVoter {
-		case true:
+		if err := b.Core.setRaftNonVoter(ctx, serverID, nonVoter); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case nonVoter:
+			err = raftBackend.AddNonVotingPeer(ctx, serverID, clusterAddr)
+		case b.Core.raftAutopilot != nil && b.Core.raftAutopilot.getConfig().StageNewServers:
+			// Autopilot promotes the server to a voter once it is stable
+			b.logger.Info("staging raft peer as a non-voter", "follower_server_id", serverID)
 			err = raftBackend.AddNonVotingPeer(ctx, serverID, clusterAddr)
 		default:
 			err = raftBackend.AddPeer(ctx, serverID, clusterAddr)
@@ -432,6 +674,270 @@ func (b *SystemBackend) handleStorageRaftSnapshotWrite(force bool) framework.Ope
 	}
 }
 
+func (b *SystemBackend) handleStorageRaftAutopilotState() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.raftAutopilot == nil {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		state := b.Core.raftAutopilot.getState()
+		if state == nil {
+			return logical.ErrorResponse("autopilot has not computed the state of the cluster yet"), logical.ErrInvalidRequest
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"healthy":           state.Healthy,
+				"failure_tolerance": state.FailureTolerance,
+				"leader":            state.Leader,
+				"voters":            state.Voters,
+				"servers":           state.Servers,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftAutopilotConfigRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.raftAutopilot == nil {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		config := b.Core.raftAutopilot.getConfig()
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"cleanup_dead_servers":               config.CleanupDeadServers,
+				"last_contact_threshold":             int64(config.LastContactThreshold.Seconds()),
+				"dead_server_last_contact_threshold": int64(config.DeadServerLastContactThreshold.Seconds()),
+				"max_trailing_logs":                  config.MaxTrailingLogs,
+				"min_quorum":                         config.MinQuorum,
+				"server_stabilization_time":          int64(config.ServerStabilizationTime.Seconds()),
+				"stage_new_servers":                  config.StageNewServers,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftAutopilotConfigUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.raftAutopilot == nil {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		config := b.Core.raftAutopilot.getConfig()
+		if cleanupDeadServers, ok := d.GetOk("cleanup_dead_servers"); ok {
+			config.CleanupDeadServers = cleanupDeadServers.(bool)
+		}
+		if threshold, ok := d.GetOk("last_contact_threshold"); ok {
+			config.LastContactThreshold = time.Duration(threshold.(int)) * time.Second
+		}
+		if threshold, ok := d.GetOk("dead_server_last_contact_threshold"); ok {
+			config.DeadServerLastContactThreshold = time.Duration(threshold.(int)) * time.Second
+		}
+		if maxTrailingLogs, ok := d.GetOk("max_trailing_logs"); ok {
+			if maxTrailingLogs.(int) < 0 {
+				return logical.ErrorResponse("max_trailing_logs can't be negative"), logical.ErrInvalidRequest
+			}
+			config.MaxTrailingLogs = uint64(maxTrailingLogs.(int))
+		}
+		if minQuorum, ok := d.GetOk("min_quorum"); ok {
+			config.MinQuorum = minQuorum.(int)
+		}
+		if stabilizationTime, ok := d.GetOk("server_stabilization_time"); ok {
+			config.ServerStabilizationTime = time.Duration(stabilizationTime.(int)) * time.Second
+		}
+		if stageNewServers, ok := d.GetOk("stage_new_servers"); ok {
+			config.StageNewServers = stageNewServers.(bool)
+		}
+
+		if config.LastContactThreshold <= 0 {
+			return logical.ErrorResponse("last_contact_threshold must be greater than zero"), logical.ErrInvalidRequest
+		}
+		if config.DeadServerLastContactThreshold < config.LastContactThreshold {
+			return logical.ErrorResponse("dead_server_last_contact_threshold can't be less than last_contact_threshold"), logical.ErrInvalidRequest
+		}
+		if config.MinQuorum < 1 {
+			return logical.ErrorResponse("min_quorum must be at least 1"), logical.ErrInvalidRequest
+		}
+		if config.ServerStabilizationTime < 0 {
+			return logical.ErrorResponse("server_stabilization_time can't be negative"), logical.ErrInvalidRequest
+		}
+
+		if err := b.Core.raftAutopilot.setConfig(ctx, config); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftSnapshotAutoConfigList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := b.Core.barrier.List(ctx, raftAutoSnapshotConfigPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftSnapshotAutoConfigRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		config, err := b.Core.raftAutoSnapshotConfig(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"interval":           int64(config.Interval.Seconds()),
+				"retain":             config.Retain,
+				"storage_type":       config.StorageType,
+				"path_prefix":        config.PathPrefix,
+				"file_name_template": config.FileNameTemplate,
+				"storage_config":     config.StorageConfig,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftSnapshotAutoConfigUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if _, ok := b.Core.underlyingPhysical.(*raft.RaftBackend); !ok {
+			return logical.ErrorResponse("raft storage is not in use"), logical.ErrInvalidRequest
+		}
+
+		name := d.Get("name").(string)
+		config, err := b.Core.raftAutoSnapshotConfig(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			config = &raftAutoSnapshotConfig{
+				Name:             name,
+				Retain:           d.Get("retain").(int),
+				StorageType:      d.Get("storage_type").(string),
+				FileNameTemplate: d.Get("file_name_template").(string),
+			}
+		}
+
+		if interval, ok := d.GetOk("interval"); ok {
+			config.Interval = time.Duration(interval.(int)) * time.Second
+		}
+		if retain, ok := d.GetOk("retain"); ok {
+			config.Retain = retain.(int)
+		}
+		if storageType, ok := d.GetOk("storage_type"); ok {
+			config.StorageType = storageType.(string)
+		}
+		if pathPrefix, ok := d.GetOk("path_prefix"); ok {
+			config.PathPrefix = pathPrefix.(string)
+		}
+		if fileNameTemplate, ok := d.GetOk("file_name_template"); ok {
+			config.FileNameTemplate = fileNameTemplate.(string)
+		}
+		if storageConfig, ok := d.GetOk("storage_config"); ok {
+			config.StorageConfig = storageConfig.(map[string]string)
+		}
+
+		if config.Interval <= 0 {
+			return logical.ErrorResponse("interval must be greater than zero"), logical.ErrInvalidRequest
+		}
+		if config.Retain < 1 {
+			return logical.ErrorResponse("retain must be at least 1"), logical.ErrInvalidRequest
+		}
+		if _, err := config.fileName(time.Now(), 0); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid file_name_template: %s", err)), logical.ErrInvalidRequest
+		}
+		if _, err := b.Core.raftSnapshotTarget(ctx, config); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		entry, err := logical.StorageEntryJSON(raftAutoSnapshotConfigPath+name, config)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Core.barrier.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		if b.Core.raftAutoSnapshots != nil {
+			b.Core.raftAutoSnapshots.schedule(config)
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftSnapshotAutoConfigDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		if b.Core.raftAutoSnapshots != nil {
+			b.Core.raftAutoSnapshots.unschedule(name)
+		}
+
+		if err := b.Core.barrier.Delete(ctx, raftAutoSnapshotConfigPath+name); err != nil {
+			return nil, err
+		}
+		if err := b.Core.barrier.Delete(ctx, raftAutoSnapshotStatusPath+name); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageRaftSnapshotAutoStatusRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		config, err := b.Core.raftAutoSnapshotConfig(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			return nil, nil
+		}
+
+		status, err := b.Core.raftAutoSnapshotStatus(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if status == nil {
+			status = new(raftAutoSnapshotStatus)
+		}
+
+		data := map[string]interface{}{
+			"last_snapshot_name":   status.LastSnapshotName,
+			"last_error":           status.LastError,
+			"consecutive_failures": status.ConsecutiveFailures,
+			"snapshots":            status.Snapshots,
+		}
+		for key, t := range map[string]time.Time{
+			"last_attempt_time": status.LastAttemptTime,
+			"last_success_time": status.LastSuccessTime,
+			"last_failure_time": status.LastFailureTime,
+		} {
+			data[key] = ""
+			if !t.IsZero() {
+				data[key] = t.Format(time.RFC3339Nano)
+			}
+		}
+		if !status.LastAttemptTime.IsZero() {
+			data["next_attempt_time"] = status.LastAttemptTime.Add(config.Interval).Format(time.RFC3339Nano)
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
 var sysRaftHelp = map[string][2]string{
 	"raft-bootstrap-challenge": {
 		"Creates a challenge for the new peer to be joined to the raft cluster.",
@@ -449,6 +955,14 @@ var sysRaftHelp = map[string][2]string{
 		"Removes a peer from the raft cluster.",
 		"",
 	},
+	"raft-suffrage": {
+		"Promotes or demotes a peer of the raft cluster.",
+		`
+Non-voters receive the data replication stream without taking part in the
+quorum. A peer demoted to a non-voter, or that joined as one, is not promoted
+by autopilot.
+		`,
+	},
 	"raft-snapshot": {
 		"Restores and saves snapshots from the raft cluster.",
 		"",
@@ -457,4 +971,32 @@ var sysRaftHelp = map[string][2]string{
 		"Force restore a raft cluster snapshot",
 		"",
 	},
+	"raft-autopilot-state": {
+		"Returns the health of the raft cluster as seen by autopilot.",
+		`
+Autopilot tracks the health of the raft peers from the heartbeats of the
+standby nodes. It promotes the peers that joined as non-voters once they have
+been healthy for the stabilization time, and removes the peers dead for longer
+than the dead server threshold if enabled.
+		`,
+	},
+	"raft-autopilot-configuration": {
+		"Configures autopilot.",
+		"",
+	},
+	"raft-snapshot-auto-config-list": {
+		"Lists the automated raft snapshot configurations.",
+		"",
+	},
+	"raft-snapshot-auto-config": {
+		"Configures raft snapshots taken on an interval by the active node.",
+		`
+The active node takes a snapshot every interval and writes it to the storage
+of the configuration, keeping the given number of snapshots.
+		`,
+	},
+	"raft-snapshot-auto-status": {
+		"Returns the status of the automated raft snapshots of a configuration.",
+		"",
+	},
 }
@@ -0,0 +1,102 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/logical"
+)
+
+// sealWrapRewrapPaths returns paths that rewrap the seal-wrapped entries
+func (b *SystemBackend) sealWrapRewrapPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "sealwrap/rewrap$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleSealWrapRewrapRead(),
+					Summary:  "Returns the progress of the rewrap of the seal-wrapped entries.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleSealWrapRewrapStart(),
+					Summary:  "Starts rewrapping the seal-wrapped entries with the current key of the seal.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysSealWrapHelp["sealwrap-rewrap"][0]),
+			HelpDescription: strings.TrimSpace(sysSealWrapHelp["sealwrap-rewrap"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) handleSealWrapRewrapRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		return b.sealWrapRewrapResponse(), nil
+	}
+}
+
+func (b *SystemBackend) handleSealWrapRewrapStart() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		started, err := b.Core.sealRewrap.begin(b.Core.activeContext)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		if !started {
+			return b.sealWrapRewrapResponse(), nil
+		}
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) sealWrapRewrapResponse() *logical.Response {
+	status := b.Core.sealRewrap.getStatus()
+	if status == nil {
+		status = &sealRewrapStatus{}
+	}
+
+	keyIDs := make(map[string]interface{}, len(status.KeyIDs))
+	for keyID, count := range status.KeyIDs {
+		keyIDs[keyID] = count
+	}
+
+	data := map[string]interface{}{
+		"is_running": status.Running,
+		"entries": map[string]interface{}{
+			"processed": status.Processed,
+			"succeeded": status.Succeeded,
+			"failed":    status.Failed,
+		},
+		"key_id":     b.Core.seal.GetAccess().KeyID(),
+		"key_ids":    keyIDs,
+		"last_error": status.LastError,
+	}
+	for key, t := range map[string]time.Time{
+		"start_time":    status.StartTime,
+		"complete_time": status.CompleteTime,
+	} {
+		data[key] = ""
+		if !t.IsZero() {
+			data[key] = t.Format(time.RFC3339Nano)
+		}
+	}
+
+	return &logical.Response{
+		Data: data,
+	}
+}
+
+var sysSealWrapHelp = map[string][2]string{
+	"sealwrap-rewrap": {
+		"Starts or returns the progress of the rewrap of the seal-wrapped entries.",
+		`When the key of the KMS behind the auto-seal is rotated, the seal-wrapped
+entries, the stored keys and the recovery key remain wrapped with the previous
+key version. The rewrap runs in the background on the active node and wraps
+them again with the current key of the seal, so that the previous key versions
+can be destroyed once none of them is reported as still in use.
+
+The rewrap stops if the node is sealed, it must then be started again.`,
+	},
+}
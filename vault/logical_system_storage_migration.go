@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/logical"
+)
+
+var errStorageMigrationNotConfigured = logical.CodedError(http.StatusBadRequest, "no storage_migration destination is configured on the active node")
+
+// storageMigrationPaths returns paths that manage the online storage migration
+func (b *SystemBackend) storageMigrationPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "storage/migration$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleStorageMigrationRead(),
+					Summary:  "Returns the status of the online storage migration.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleStorageMigrationStart(),
+					Summary:  "Starts copying the storage to the configured destination.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleStorageMigrationAbort(),
+					Summary:  "Aborts the online storage migration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysStorageMigrationHelp["storage-migration"][0]),
+			HelpDescription: strings.TrimSpace(sysStorageMigrationHelp["storage-migration"][1]),
+		},
+		{
+			Pattern: "storage/migration/cutover$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleStorageMigrationCutover(),
+					Summary:  "Moves the reads to the destination of the storage migration.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysStorageMigrationHelp["storage-migration-cutover"][0]),
+			HelpDescription: strings.TrimSpace(sysStorageMigrationHelp["storage-migration-cutover"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) handleStorageMigrationRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		m := b.Core.storageMigration
+
+		var status *storageMigrationStatus
+		if m != nil {
+			status = m.getStatus()
+		} else {
+			var err error
+			status, err = b.Core.loadStorageMigrationStatus(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		data := map[string]interface{}{
+			"configured":       m != nil,
+			"state":            "",
+			"destination_type": "",
+		}
+		if m != nil {
+			data["destination_type"] = m.destinationType
+			data["pending_keys"] = len(m.dualWrite.Pending())
+		}
+		if status != nil {
+			data["state"] = status.State
+			data["destination_type"] = status.DestinationType
+			data["node"] = status.Node
+			data["checkpoint"] = status.Checkpoint
+			data["keys_copied"] = status.KeysCopied
+			data["last_error"] = status.LastError
+			for key, t := range map[string]time.Time{
+				"start_time":    status.StartTime,
+				"copied_time":   status.CopiedTime,
+				"cut_over_time": status.CutOverTime,
+			} {
+				data[key] = ""
+				if !t.IsZero() {
+					data[key] = t.Format(time.RFC3339Nano)
+				}
+			}
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageMigrationStart() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.storageMigration == nil {
+			return nil, errStorageMigrationNotConfigured
+		}
+
+		if err := b.Core.storageMigration.begin(ctx); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageMigrationCutover() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.storageMigration == nil {
+			return nil, errStorageMigrationNotConfigured
+		}
+
+		if err := b.Core.storageMigration.cutOver(ctx); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleStorageMigrationAbort() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if b.Core.storageMigration == nil {
+			// Clear the status of a migration started by another node
+			if err := b.Core.barrier.Delete(ctx, storageMigrationStatusPath); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+
+		if err := b.Core.storageMigration.abort(ctx); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+var sysStorageMigrationHelp = map[string][2]string{
+	"storage-migration": {
+		"Starts, aborts or returns the status of the online storage migration.",
+		`The online storage migration moves the storage to the backend configured
+in the 'storage_migration' stanza of the active node, without downtime. Once
+started, the writes of the active node are duplicated to the destination while
+the existing keys are copied in the background. The copy resumes from its last
+checkpoint if the node is sealed or restarted. The migration fails if another
+node becomes active before the cut over, as its writes are missing from the
+destination.
+
+Aborting the migration stops duplicating the writes and goes back to the
+source backend, including after the cut over.`,
+	},
+	"storage-migration-cutover": {
+		"Moves the reads to the destination of the storage migration.",
+		`Once all the keys are copied, the active node reads from the destination
+and keeps writing to the source backend, so that the cut over can be aborted.
+The nodes must then be restarted with the destination as their 'storage' and
+without the 'storage_migration' stanza.`,
+	},
+}
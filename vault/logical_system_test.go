@@ -47,6 +47,7 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"replication/dr/reindex",
 		"replication/performance/reindex",
 		"rotate",
+		"rotate/config",
 		"config/cors",
 		"config/auditing/*",
 		"config/ui/headers/*",
@@ -56,6 +57,9 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"leases/revoke-prefix/*",
 		"leases/revoke-force/*",
 		"leases/lookup/*",
+		"storage/migration",
+		"storage/migration/cutover",
+		"sealwrap/rewrap",
 	}
 
 	b := testSystemBackend(t)
@@ -206,9 +210,10 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"accessor":                resp.Data["identity/"].(map[string]interface{})["accessor"],
 			"uuid":                    resp.Data["identity/"].(map[string]interface{})["uuid"],
 			"config": map[string]interface{}{
-				"default_lease_ttl": resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-				"max_lease_ttl":     resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-				"force_no_cache":    false,
+				"default_lease_ttl":           resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+				"max_lease_ttl":               resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"force_no_cache":              false,
+				"passthrough_request_headers": []string{"Authorization"},
 			},
 			"local":     false,
 			"seal_wrap": false,
@@ -307,9 +312,10 @@ func TestSystemBackend_mount(t *testing.T) {
 			"accessor":                resp.Data["identity/"].(map[string]interface{})["accessor"],
 			"uuid":                    resp.Data["identity/"].(map[string]interface{})["uuid"],
 			"config": map[string]interface{}{
-				"default_lease_ttl": resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-				"max_lease_ttl":     resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-				"force_no_cache":    false,
+				"default_lease_ttl":           resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+				"max_lease_ttl":               resp.Data["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"force_no_cache":              false,
+				"passthrough_request_headers": []string{"Authorization"},
 			},
 			"local":     false,
 			"seal_wrap": false,
@@ -1746,6 +1752,144 @@ func TestSystemBackend_policyCRUD(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_policyRollback(t *testing.T) {
+	b := testSystemBackend(t)
+	ctx := namespace.RootContext(nil)
+
+	write := func(raw string) *logical.Response {
+		req := logical.TestRequest(t, logical.UpdateOperation, "policies/acl/dev")
+		req.Data["policy"] = raw
+		resp, err := b.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v %#v", err, resp)
+		}
+		return resp
+	}
+
+	v1 := `path "secret/a" { capabilities = ["read"] }`
+	v2 := `path "secret/b" { capabilities = ["read"] }`
+	write(v1)
+	resp := write(v2)
+	if resp.Data["version"] != 2 {
+		t.Fatalf("bad: version: %#v", resp.Data)
+	}
+	if diff := resp.Data["diff"].(string); !strings.Contains(diff, `-path "secret/a"`) || !strings.Contains(diff, `+path "secret/b"`) {
+		t.Fatalf("bad: diff: %s", diff)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "policies/acl/dev/versions")
+	resp, err := b.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	versions := resp.Data["versions"].([]map[string]interface{})
+	if resp.Data["current_version"] != 2 || len(versions) != 2 || versions[0]["policy"] != v1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policies/acl/dev/rollback")
+	req.Data["version"] = 1
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Data["version"] != 3 {
+		t.Fatalf("bad: version: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/acl/dev")
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Data["policy"] != v1 {
+		t.Fatalf("bad: policy: %#v", resp.Data["policy"])
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policies/acl/dev/rollback")
+	req.Data["version"] = 5
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error rolling back to an unknown version, got: %#v", resp)
+	}
+}
+
+func TestSystemBackend_policySimulate(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policies/acl/dev")
+	req.Data["policy"] = `
+path "secret/*" {
+	capabilities = ["read", "update"]
+	denied_parameters = {
+		"ttl" = []
+	}
+}
+`
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policies/simulate/acl")
+	req.Data["policies"] = "dev,default"
+	req.Data["path"] = "secret/foo"
+	req.Data["operation"] = "update"
+	req.Data["data"] = map[string]interface{}{"ttl": "1h"}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	if resp.Data["allowed"].(bool) {
+		t.Fatalf("expected request to be denied: %#v", resp.Data)
+	}
+	if resp.Data["denied_by"] != aclDeniedDeniedParameters || resp.Data["denied_parameter"] != "ttl" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	expRule := map[string]interface{}{
+		"path":         "secret/*",
+		"type":         aclMatchPrefix,
+		"capabilities": []string{ReadCapability, UpdateCapability},
+		"policies": map[string][]string{
+			"dev": []string{"read", "update"},
+		},
+	}
+	if !reflect.DeepEqual(resp.Data["matched_rule"], expRule) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data["matched_rule"], expRule)
+	}
+
+	// Exactly one policy source must be given
+	req = logical.TestRequest(t, logical.UpdateOperation, "policies/simulate/acl")
+	req.Data["path"] = "secret/foo"
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: %#v", resp)
+	}
+
+	// A policy may be named like the simulation endpoint
+	req = logical.TestRequest(t, logical.UpdateOperation, "policies/acl/simulate")
+	req.Data["policy"] = `path "secret/*" { capabilities = ["read"] }`
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/acl/simulate")
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Data["name"] != "simulate" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 func TestSystemBackend_enableAudit(t *testing.T) {
 	c, b, _ := testCoreSystemBackend(t)
 	c.auditBackends["noop"] = func(ctx context.Context, config *audit.BackendConfig) (audit.Backend, error) {
@@ -2011,6 +2155,7 @@ func TestSystemBackend_keyStatus(t *testing.T) {
 		"term": 1,
 	}
 	delete(resp.Data, "install_time")
+	delete(resp.Data, "encryptions")
 	if !reflect.DeepEqual(resp.Data, exp) {
 		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
 	}
@@ -2038,6 +2183,69 @@ func TestSystemBackend_rotate(t *testing.T) {
 		"term": 2,
 	}
 	delete(resp.Data, "install_time")
+	delete(resp.Data, "encryptions")
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+}
+
+func TestSystemBackend_rotateConfig(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "rotate/config")
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	exp := map[string]interface{}{
+		"enabled":        true,
+		"max_operations": absoluteOperationMaximum,
+		"interval":       int64(0),
+		"rewrap":         false,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"max_operations": 10},
+		{"max_operations": absoluteOperationMaximum + 1},
+		{"interval": "1h"},
+	} {
+		req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+		req.Data = data
+		resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+		if err != logical.ErrInvalidRequest {
+			t.Fatalf("expected an invalid request for %v, got: %v, %#v", data, err, resp)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+	req.Data["enabled"] = false
+	req.Data["max_operations"] = 2000000
+	req.Data["interval"] = "48h"
+	req.Data["rewrap"] = true
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "rotate/config")
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	exp = map[string]interface{}{
+		"enabled":        false,
+		"max_operations": int64(2000000),
+		"interval":       int64(48 * 60 * 60),
+		"rewrap":         true,
+	}
 	if !reflect.DeepEqual(resp.Data, exp) {
 		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
 	}
@@ -2400,9 +2608,10 @@ func TestSystemBackend_InternalUIMounts(t *testing.T) {
 				"accessor":                resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["accessor"],
 				"uuid":                    resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["uuid"],
 				"config": map[string]interface{}{
-					"default_lease_ttl": resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-					"max_lease_ttl":     resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-					"force_no_cache":    false,
+					"default_lease_ttl":           resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+					"max_lease_ttl":               resp.Data["secret"].(map[string]interface{})["identity/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+					"force_no_cache":              false,
+					"passthrough_request_headers": []string{"Authorization"},
 				},
 				"local":     false,
 				"seal_wrap": false,
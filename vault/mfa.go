@@ -0,0 +1,614 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+	"github.com/quid/vault/helper/identity"
+	"github.com/quid/vault/helper/identity/mfa"
+	"github.com/quid/vault/helper/mfa/duo"
+	"github.com/quid/vault/sdk/framework"
+	"github.com/quid/vault/sdk/logical"
+)
+
+const (
+	// mfaMethodPrefix is the storage prefix, in the system view, under which
+	// MFA method configurations are stored by name
+	mfaMethodPrefix = "mfa/method/"
+
+	mfaMethodTypeTOTP = "totp"
+	mfaMethodTypeDuo  = "duo"
+)
+
+// mfaUsernameFormatRe matches the fields substituted in the username format
+// of an MFA method, e.g. "{{alias.name}}@example.com"
+var mfaUsernameFormatRe = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// mfaMethodConfig loads the configuration of the MFA method with the given
+// name. A nil config is returned if the method does not exist.
+func (c *Core) mfaMethodConfig(ctx context.Context, name string) (*mfa.Config, error) {
+	entry, err := c.systemBarrierView.Get(ctx, mfaMethodPrefix+name)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read MFA method configuration: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	config := new(mfa.Config)
+	if err := proto.Unmarshal(entry.Value, config); err != nil {
+		return nil, errwrap.Wrapf("failed to decode MFA method configuration: {{err}}", err)
+	}
+
+	return config, nil
+}
+
+func (c *Core) setMFAMethodConfig(ctx context.Context, config *mfa.Config) error {
+	value, err := proto.Marshal(config)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode MFA method configuration: {{err}}", err)
+	}
+
+	return c.systemBarrierView.Put(ctx, &logical.StorageEntry{
+		Key:   mfaMethodPrefix + config.Name,
+		Value: value,
+	})
+}
+
+// validateMFA checks the credentials supplied in the X-Vault-MFA header of
+// the request against each of the given MFA methods. All of the methods must
+// be satisfied for the request to proceed.
+func (c *Core) validateMFA(ctx context.Context, req *logical.Request, entity *identity.Entity, methodNames []string) error {
+	if entity == nil {
+		return errors.New("MFA validation requires the token to be associated with an entity")
+	}
+
+	for _, name := range methodNames {
+		config, err := c.mfaMethodConfig(ctx, name)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			return fmt.Errorf("MFA method %q is not configured", name)
+		}
+
+		creds, ok := req.MFACreds[name]
+		if !ok {
+			return fmt.Errorf("MFA credentials not supplied for method %q", name)
+		}
+
+		switch config.Type {
+		case mfaMethodTypeTOTP:
+			err = c.validateTOTP(entity, config, creds)
+		case mfaMethodTypeDuo:
+			err = c.validateDuo(req, entity, config, creds)
+		default:
+			err = fmt.Errorf("unsupported MFA method type %q", config.Type)
+		}
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("MFA validation failed for method %q: {{err}}", name), err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Core) validateTOTP(entity *identity.Entity, config *mfa.Config, creds []string) error {
+	if len(creds) == 0 || creds[0] == "" {
+		return errors.New("missing TOTP passcode")
+	}
+	code := creds[0]
+
+	secret := entity.MFASecrets[config.ID].GetTOTPSecret()
+	if secret == nil {
+		return errors.New("entity does not have a TOTP secret generated for this method")
+	}
+
+	usedName := fmt.Sprintf("%s_%s_%s", config.ID, entity.ID, code)
+	if _, ok := c.mfaUsedCodes.Get(usedName); ok {
+		return errors.New("code already used; wait until the next time period")
+	}
+
+	valid, err := totplib.ValidateCustom(code, secret.Key, time.Now(), totplib.ValidateOpts{
+		Period:    uint(secret.Period),
+		Skew:      uint(secret.Skew),
+		Digits:    otplib.Digits(secret.Digits),
+		Algorithm: otplib.Algorithm(secret.Algorithm),
+	})
+	if err != nil && err != otplib.ErrValidateInputInvalidLength {
+		return errwrap.Wrapf("error validating TOTP passcode: {{err}}", err)
+	}
+	if !valid {
+		return errors.New("failed to validate TOTP passcode")
+	}
+
+	// Take the key skew, add two for behind and in front, and multiply that by
+	// the period to cover the full possibility of the validity of the key
+	err = c.mfaUsedCodes.Add(usedName, nil, time.Duration(
+		int64(time.Second)*
+			int64(secret.Period)*
+			int64((2+secret.Skew))))
+	if err != nil {
+		return errwrap.Wrapf("error adding code to used cache: {{err}}", err)
+	}
+
+	return nil
+}
+
+func (c *Core) validateDuo(req *logical.Request, entity *identity.Entity, config *mfa.Config, creds []string) error {
+	duoConfig := config.GetDuoConfig()
+	if duoConfig == nil {
+		return errors.New("missing Duo configuration")
+	}
+
+	username, err := mfaUsername(entity, config)
+	if err != nil {
+		return err
+	}
+
+	// Without a passcode Duo falls back to a push to the user's device
+	var passcode string
+	for _, cred := range creds {
+		if strings.HasPrefix(cred, "passcode=") {
+			passcode = strings.TrimPrefix(cred, "passcode=")
+		}
+	}
+
+	client, err := duo.NewDuoAuthClient(&duo.DuoAccess{
+		IKey: duoConfig.IntegrationKey,
+		SKey: duoConfig.SecretKey,
+		Host: duoConfig.APIHostname,
+	}, "")
+	if err != nil {
+		return err
+	}
+
+	var ipAddr string
+	if req.Connection != nil {
+		ipAddr = req.Connection.RemoteAddr
+	}
+
+	return duo.Authenticate(&duo.DuoConfig{
+		PushInfo: duoConfig.PushInfo,
+	}, client, username, "", passcode, ipAddr)
+}
+
+// mfaUsername maps the entity to the username known to the MFA provider,
+// using the entity's alias on the mount the method is tied to.
+func mfaUsername(entity *identity.Entity, config *mfa.Config) (string, error) {
+	var alias *identity.Alias
+	for _, a := range entity.Aliases {
+		if a.MountAccessor == config.MountAccessor {
+			alias = a
+			break
+		}
+	}
+
+	if config.UsernameFormat == "" {
+		if alias == nil {
+			return "", fmt.Errorf("entity does not have an alias on mount %q", config.MountAccessor)
+		}
+		return alias.Name, nil
+	}
+
+	var retErr error
+	username := mfaUsernameFormatRe.ReplaceAllStringFunc(config.UsernameFormat, func(match string) string {
+		field := strings.TrimSpace(match[2 : len(match)-2])
+		switch {
+		case field == "entity.name":
+			return entity.Name
+		case strings.HasPrefix(field, "entity.metadata."):
+			return entity.Metadata[strings.TrimPrefix(field, "entity.metadata.")]
+		case alias == nil:
+			retErr = fmt.Errorf("entity does not have an alias on mount %q", config.MountAccessor)
+		case field == "alias.name":
+			return alias.Name
+		case strings.HasPrefix(field, "alias.metadata."):
+			return alias.Metadata[strings.TrimPrefix(field, "alias.metadata.")]
+		default:
+			retErr = fmt.Errorf("unsupported field %q in username format", field)
+		}
+		return ""
+	})
+	if retErr != nil {
+		return "", retErr
+	}
+
+	return username, nil
+}
+
+func validateMFAUsernameFormat(format string) error {
+	for _, match := range mfaUsernameFormatRe.FindAllStringSubmatch(format, -1) {
+		field := strings.TrimSpace(match[1])
+		switch {
+		case field == "entity.name", field == "alias.name":
+		case strings.HasPrefix(field, "entity.metadata."), strings.HasPrefix(field, "alias.metadata."):
+		default:
+			return fmt.Errorf("unsupported field %q in username format", field)
+		}
+	}
+	return nil
+}
+
+// mfaMethodConfigForUpdate returns the stored configuration of the named
+// method so it can be updated, or a new one if it does not exist yet. Method
+// names are shared by all types, so an existing method of a different type
+// results in an error response.
+func (b *SystemBackend) mfaMethodConfigForUpdate(ctx context.Context, name, methodType string) (*mfa.Config, *logical.Response, error) {
+	config, err := b.Core.mfaMethodConfig(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config == nil {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, nil, err
+		}
+		return &mfa.Config{
+			Type: methodType,
+			Name: name,
+			ID:   id,
+		}, nil, nil
+	}
+	if config.Type != methodType {
+		return nil, logical.ErrorResponse(fmt.Sprintf("MFA method %q is of type %q", name, config.Type)), nil
+	}
+
+	return config, nil, nil
+}
+
+func (b *SystemBackend) handleMFAMethodRead(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		b.mfaLock.RLock()
+		defer b.mfaLock.RUnlock()
+
+		config, err := b.Core.mfaMethodConfig(ctx, data.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if config == nil || config.Type != methodType {
+			return nil, nil
+		}
+
+		respData := map[string]interface{}{
+			"type": config.Type,
+			"name": config.Name,
+			"id":   config.ID,
+		}
+
+		switch methodType {
+		case mfaMethodTypeTOTP:
+			totpConfig := config.GetTOTPConfig()
+			respData["issuer"] = totpConfig.Issuer
+			respData["period"] = totpConfig.Period
+			respData["algorithm"] = otplib.Algorithm(totpConfig.Algorithm).String()
+			respData["digits"] = totpConfig.Digits
+			respData["skew"] = totpConfig.Skew
+			respData["key_size"] = totpConfig.KeySize
+			respData["qr_size"] = totpConfig.QRSize
+		case mfaMethodTypeDuo:
+			duoConfig := config.GetDuoConfig()
+			respData["mount_accessor"] = config.MountAccessor
+			respData["username_format"] = config.UsernameFormat
+			respData["integration_key"] = duoConfig.IntegrationKey
+			respData["secret_key"] = duoConfig.SecretKey
+			respData["api_hostname"] = duoConfig.APIHostname
+			respData["push_info"] = duoConfig.PushInfo
+		}
+
+		return &logical.Response{
+			Data: respData,
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleMFAMethodDelete(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+
+		b.mfaLock.Lock()
+		defer b.mfaLock.Unlock()
+
+		config, err := b.Core.mfaMethodConfig(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			return nil, nil
+		}
+		if config.Type != methodType {
+			return logical.ErrorResponse(fmt.Sprintf("MFA method %q is of type %q", name, config.Type)), nil
+		}
+
+		if err := b.Core.systemBarrierView.Delete(ctx, mfaMethodPrefix+name); err != nil {
+			return nil, err
+		}
+
+		b.mfaLogger.Info("deleted MFA method", "name", name, "type", methodType)
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleMFAMethodTOTPUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	issuer := data.Get("issuer").(string)
+	if issuer == "" {
+		return logical.ErrorResponse("missing issuer"), nil
+	}
+
+	period := data.Get("period").(int)
+	if period <= 0 {
+		return logical.ErrorResponse("the period value must be greater than zero"), nil
+	}
+
+	keySize := data.Get("key_size").(int)
+	if keySize <= 0 {
+		return logical.ErrorResponse("the key_size value must be greater than zero"), nil
+	}
+
+	// QR size can be zero but it shouldn't be negative
+	qrSize := data.Get("qr_size").(int)
+	if qrSize < 0 {
+		return logical.ErrorResponse("the qr_size value must be greater than or equal to zero"), nil
+	}
+
+	var algorithm otplib.Algorithm
+	switch data.Get("algorithm").(string) {
+	case "SHA1":
+		algorithm = otplib.AlgorithmSHA1
+	case "SHA256":
+		algorithm = otplib.AlgorithmSHA256
+	case "SHA512":
+		algorithm = otplib.AlgorithmSHA512
+	default:
+		return logical.ErrorResponse("the algorithm value is not valid"), nil
+	}
+
+	var digits otplib.Digits
+	switch data.Get("digits").(int) {
+	case 6:
+		digits = otplib.DigitsSix
+	case 8:
+		digits = otplib.DigitsEight
+	default:
+		return logical.ErrorResponse("the digits value can only be 6 or 8"), nil
+	}
+
+	skew := data.Get("skew").(int)
+	switch skew {
+	case 0:
+	case 1:
+	default:
+		return logical.ErrorResponse("the skew value must be 0 or 1"), nil
+	}
+
+	b.mfaLock.Lock()
+	defer b.mfaLock.Unlock()
+
+	config, resp, err := b.mfaMethodConfigForUpdate(ctx, name, mfaMethodTypeTOTP)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	config.Config = &mfa.Config_TOTPConfig{
+		TOTPConfig: &mfa.TOTPConfig{
+			Issuer:    issuer,
+			Period:    uint32(period),
+			Algorithm: int32(algorithm),
+			Digits:    int32(digits),
+			Skew:      uint32(skew),
+			KeySize:   uint32(keySize),
+			QRSize:    int32(qrSize),
+		},
+	}
+
+	if err := b.Core.setMFAMethodConfig(ctx, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleMFAMethodDuoUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	mountAccessor := data.Get("mount_accessor").(string)
+	if mountAccessor == "" {
+		return logical.ErrorResponse("missing mount_accessor"), nil
+	}
+	if b.Core.router.MatchingMountByAccessor(mountAccessor) == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid mount accessor %q", mountAccessor)), nil
+	}
+
+	usernameFormat := data.Get("username_format").(string)
+	if err := validateMFAUsernameFormat(usernameFormat); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	b.mfaLock.Lock()
+	defer b.mfaLock.Unlock()
+
+	config, resp, err := b.mfaMethodConfigForUpdate(ctx, name, mfaMethodTypeDuo)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	config.MountAccessor = mountAccessor
+	config.UsernameFormat = usernameFormat
+	config.Config = &mfa.Config_DuoConfig{
+		DuoConfig: &mfa.DuoConfig{
+			IntegrationKey: data.Get("integration_key").(string),
+			SecretKey:      data.Get("secret_key").(string),
+			APIHostname:    data.Get("api_hostname").(string),
+			PushInfo:       data.Get("push_info").(string),
+		},
+	}
+
+	if err := b.Core.setMFAMethodConfig(ctx, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleMFAGenerateTOTPSecret(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.EntityID == "" {
+		return logical.ErrorResponse("TOTP secrets can only be generated for tokens with an entity"), nil
+	}
+
+	return b.mfaGenerateTOTPSecret(ctx, data.Get("name").(string), req.EntityID)
+}
+
+func (b *SystemBackend) handleMFAAdminGenerateTOTPSecret(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing entity_id"), nil
+	}
+
+	return b.mfaGenerateTOTPSecret(ctx, data.Get("name").(string), entityID)
+}
+
+func (b *SystemBackend) mfaGenerateTOTPSecret(ctx context.Context, name, entityID string) (*logical.Response, error) {
+	b.mfaLock.RLock()
+	defer b.mfaLock.RUnlock()
+
+	config, err := b.Core.mfaMethodConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Type != mfaMethodTypeTOTP {
+		return logical.ErrorResponse(fmt.Sprintf("TOTP MFA method %q not found", name)), nil
+	}
+	totpConfig := config.GetTOTPConfig()
+
+	i := b.Core.identityStore
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity, err := i.MemDBEntityByID(entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("entity not found"), nil
+	}
+
+	if entity.MFASecrets[config.ID] != nil {
+		resp := &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("Entity already has a secret for MFA method %q", name))
+		return resp, nil
+	}
+
+	keyObject, err := totplib.Generate(totplib.GenerateOpts{
+		Issuer:      totpConfig.Issuer,
+		AccountName: entity.ID,
+		Period:      uint(totpConfig.Period),
+		Digits:      otplib.Digits(totpConfig.Digits),
+		Algorithm:   otplib.Algorithm(totpConfig.Algorithm),
+		SecretSize:  uint(totpConfig.KeySize),
+		Rand:        b.Core.secureRandomReader,
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to generate TOTP key: {{err}}", err)
+	}
+
+	if entity.MFASecrets == nil {
+		entity.MFASecrets = make(map[string]*mfa.Secret)
+	}
+	entity.MFASecrets[config.ID] = &mfa.Secret{
+		MethodName: config.Name,
+		Value: &mfa.Secret_TOTPSecret{
+			TOTPSecret: &mfa.TOTPSecret{
+				Issuer:      totpConfig.Issuer,
+				Period:      totpConfig.Period,
+				Algorithm:   totpConfig.Algorithm,
+				Digits:      totpConfig.Digits,
+				Skew:        totpConfig.Skew,
+				KeySize:     totpConfig.KeySize,
+				AccountName: entity.ID,
+				Key:         keyObject.Secret(),
+			},
+		},
+	}
+
+	if err := i.upsertEntity(ctx, entity, nil, true); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"url": keyObject.String(),
+		},
+	}
+
+	// Don't include QR code if size is set to zero
+	if totpConfig.QRSize > 0 {
+		barcode, err := keyObject.Image(int(totpConfig.QRSize), int(totpConfig.QRSize))
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to generate QR code image: {{err}}", err)
+		}
+
+		var buff bytes.Buffer
+		if err := png.Encode(&buff, barcode); err != nil {
+			return nil, errwrap.Wrapf("failed to encode QR code image: {{err}}", err)
+		}
+		resp.Data["barcode"] = base64.StdEncoding.EncodeToString(buff.Bytes())
+	}
+
+	return resp, nil
+}
+
+func (b *SystemBackend) handleMFAAdminDestroyTOTPSecret(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing entity_id"), nil
+	}
+
+	b.mfaLock.RLock()
+	defer b.mfaLock.RUnlock()
+
+	config, err := b.Core.mfaMethodConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Type != mfaMethodTypeTOTP {
+		return logical.ErrorResponse(fmt.Sprintf("TOTP MFA method %q not found", name)), nil
+	}
+
+	i := b.Core.identityStore
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity, err := i.MemDBEntityByID(entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("entity not found"), nil
+	}
+
+	if entity.MFASecrets[config.ID] == nil {
+		return nil, nil
+	}
+	delete(entity.MFASecrets, config.ID)
+
+	if err := i.upsertEntity(ctx, entity, nil, true); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/logical"
+)
+
+func TestMFA_TOTPStepUp(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	policy, err := ParseACLPolicy(namespace.RootNamespace, `
+name = "guarded"
+path "secret/foo" {
+	capabilities = ["read"]
+	mfa_methods = ["my_totp"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.policyStore.SetPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(ctx, req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/my_totp")
+	req.ClientToken = root
+	req.Data["issuer"] = "vault"
+	req.Data["skew"] = 0
+	if resp, err := c.HandleRequest(ctx, req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	// Names are shared across method types
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/mfa/method/duo/my_totp")
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(ctx, req); err != nil || resp != nil {
+		t.Fatalf("expected no duo method, got resp: %#v, err: %v", resp, err)
+	}
+
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "entity",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"name": "testentity",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	entityID := resp.Data["id"].(string)
+
+	testMakeTokenDirectly(t, c.tokenStore, &logical.TokenEntry{
+		ID:       "guarded",
+		Path:     "auth/token/create",
+		Policies: []string{"guarded"},
+		EntityID: entityID,
+		TTL:      time.Hour,
+	})
+
+	read := func(creds logical.MFACreds) error {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = "guarded"
+		req.MFACreds = creds
+		_, err := c.HandleRequest(ctx, req)
+		return err
+	}
+
+	// The entity has no secret yet
+	if err := read(logical.MFACreds{"my_totp": {"123456"}}); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/my_totp/admin-generate")
+	req.ClientToken = root
+	req.Data["entity_id"] = entityID
+	resp, err = c.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+	if resp.Data["barcode"] == "" {
+		t.Fatal("expected a barcode")
+	}
+	keyURL, err := url.Parse(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := keyURL.Query().Get("secret")
+
+	if err := read(nil); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied without credentials, got: %v", err)
+	}
+
+	code, err := totplib.GenerateCodeCustom(key, time.Now(), totplib.ValidateOpts{
+		Period:    30,
+		Digits:    otplib.DigitsSix,
+		Algorithm: otplib.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+
+	if err := read(logical.MFACreds{"my_totp": {wrongCode}}); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied with a wrong passcode, got: %v", err)
+	}
+
+	if err := read(logical.MFACreds{"my_totp": {code}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Passcodes cannot be replayed
+	if err := read(logical.MFACreds{"my_totp": {code}}); err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied for a reused passcode, got: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/my_totp/admin-destroy")
+	req.ClientToken = root
+	req.Data["entity_id"] = entityID
+	if resp, err := c.HandleRequest(ctx, req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+	}
+
+	entity, err := c.identityStore.MemDBEntityByID(entityID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.MFASecrets) != 0 {
+		t.Fatalf("expected secret to be removed, got: %#v", entity.MFASecrets)
+	}
+}
@@ -222,6 +222,7 @@ type MountEntry struct {
 	SealWrap              bool              `json:"seal_wrap"`               // Whether to wrap CSPs
 	ExternalEntropyAccess bool              `json:"external_entropy_access"` // Whether to allow external entropy source access
 	Tainted               bool              `json:"tainted,omitempty"`       // Set as a Write-Ahead flag for unmount/remount
+	AuditFilter           *AuditFilter      `json:"audit_filter,omitempty"`  // Restricts what an audit device logs
 	NamespaceID           string            `json:"namespace_id"`
 
 	// namespace contains the populated namespace
@@ -950,6 +951,13 @@ func (c *Core) loadMounts(ctx context.Context) error {
 		for _, coreMount := range c.mounts.Entries {
 			if coreMount.Type == requiredMount.Type {
 				foundRequired = true
+
+				// Upgrade identity mounts that predate the OIDC provider, which
+				// needs the Authorization header passed through
+				if coreMount.Type == identityMountType && !strutil.StrListContains(coreMount.Config.PassthroughRequestHeaders, "Authorization") {
+					needPersist = true
+				}
+
 				coreMount.Config = requiredMount.Config
 				break
 			}
@@ -1411,6 +1419,9 @@ func (c *Core) requiredMountTable() *MountTable {
 		UUID:             identityUUID,
 		Accessor:         identityAccessor,
 		BackendAwareUUID: identityBackendUUID,
+		Config: MountConfig{
+			PassthroughRequestHeaders: []string{"Authorization"},
+		},
 	}
 
 	table.Entries = append(table.Entries, cubbyholeMount)
@@ -507,6 +507,49 @@ func TestDefaultMountTable(t *testing.T) {
 	verifyDefaultTable(t, table, 3)
 }
 
+func TestCore_MountTable_UpgradeIdentityPassthroughHeaders(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	// Persist the identity mount as it was before the OIDC provider
+	c.mountsLock.Lock()
+	for _, entry := range c.mounts.Entries {
+		if entry.Type == identityMountType {
+			entry.Config.PassthroughRequestHeaders = nil
+		}
+	}
+	err := c.persistMounts(ctx, c.mounts, nil)
+	c.mountsLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.loadMounts(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := c.barrier.Get(ctx, coreMountConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt, err := c.decodeMountTable(ctx, raw.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, entry := range mt.Entries {
+		if entry.Type == identityMountType {
+			found = true
+			if !reflect.DeepEqual(entry.Config.PassthroughRequestHeaders, []string{"Authorization"}) {
+				t.Fatalf("bad: passthrough request headers: %v", entry.Config.PassthroughRequestHeaders)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("identity mount not found")
+	}
+}
+
 func TestCore_MountTable_UpgradeToTyped(t *testing.T) {
 	c, _, _ := TestCoreUnsealed(t)
 
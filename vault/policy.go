@@ -3,11 +3,13 @@ package vault
 import (
 	"errors"
 	"fmt"
+	"net/textproto"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/errwrap"
 	multierror "github.com/hashicorp/go-multierror"
+	sockaddr "github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/quid/vault/helper/identity"
@@ -129,6 +131,48 @@ type PathRules struct {
 	RequiredParametersHCL []string                 `hcl:"required_parameters"`
 	MFAMethodsHCL         []string                 `hcl:"mfa_methods"`
 	ControlGroupHCL       *ControlGroupHCL         `hcl:"control_group"`
+	ConditionsHCL         *PathConditionsHCL       `hcl:"conditions"`
+	FilterListResultsHCL  bool                     `hcl:"filter_list_results"`
+}
+
+// PathConditionsHCL is the HCL representation of a conditions block, which
+// restricts when a path rule applies based on the context of the request.
+type PathConditionsHCL struct {
+	SourceCIDRs     []string            `hcl:"source_cidrs"`
+	TimeWindows     []*TimeWindowHCL    `hcl:"-"`
+	RequiredHeaders map[string][]string `hcl:"required_headers"`
+}
+
+type TimeWindowHCL struct {
+	Timezone string   `hcl:"timezone"`
+	Days     []string `hcl:"days"`
+	Start    string   `hcl:"start"`
+	End      string   `hcl:"end"`
+}
+
+// PathConditions holds the parsed form of a conditions block. A request must
+// satisfy every populated condition for the rule to grant access. Once
+// parsed, conditions are never modified and may be shared between ACLs.
+type PathConditions struct {
+	// SourceCIDRs restricts the client address of the request
+	SourceCIDRs []*sockaddr.SockAddrMarshaler
+
+	// TimeWindows restricts the time of the request; any window may match
+	TimeWindows []*TimeWindow
+
+	// RequiredHeaders maps canonical header names to their allowed values.
+	// An empty list allows any value as long as the header is present.
+	RequiredHeaders map[string][]string
+}
+
+// TimeWindow is a daily window of time, in a given location, on a set of days
+// of the week. Start and End are offsets from midnight; if End is before Start
+// the window spans midnight.
+type TimeWindow struct {
+	Location *time.Location
+	Days     []time.Weekday
+	Start    time.Duration
+	End      time.Duration
 }
 
 type ControlGroupHCL struct {
@@ -161,6 +205,21 @@ type ACLPermissions struct {
 	RequiredParameters []string
 	MFAMethods         []string
 	ControlGroup       *ControlGroup
+	Conditions         []*PathConditions
+	FilterListResults  bool
+
+	// Once rules are merged into an ACL, the capabilities of rules with
+	// conditions are kept in ConditionalGrants and only apply to requests
+	// satisfying them, while UnconditionalBitmap holds the capabilities of
+	// the other rules. CapabilitiesBitmap still holds all of them.
+	ConditionalGrants   []*ACLConditionalGrant
+	UnconditionalBitmap uint32
+}
+
+// ACLConditionalGrant holds the capabilities granted by a rule with conditions
+type ACLConditionalGrant struct {
+	CapabilitiesBitmap uint32
+	Conditions         []*PathConditions
 }
 
 func (p *ACLPermissions) Clone() (*ACLPermissions, error) {
@@ -169,6 +228,7 @@ func (p *ACLPermissions) Clone() (*ACLPermissions, error) {
 		MinWrappingTTL:     p.MinWrappingTTL,
 		MaxWrappingTTL:     p.MaxWrappingTTL,
 		RequiredParameters: p.RequiredParameters[:],
+		FilterListResults:  p.FilterListResults,
 	}
 
 	switch {
@@ -217,6 +277,16 @@ func (p *ACLPermissions) Clone() (*ACLPermissions, error) {
 		ret.ControlGroup = clonedControlGroup.(*ControlGroup)
 	}
 
+	// Conditions are immutable once parsed, and contain values such as time
+	// locations that cannot be deep copied, so only the slice is copied
+	if p.Conditions != nil {
+		ret.Conditions = append([]*PathConditions{}, p.Conditions...)
+	}
+	if p.ConditionalGrants != nil {
+		ret.ConditionalGrants = append([]*ACLConditionalGrant{}, p.ConditionalGrants...)
+		ret.UnconditionalBitmap = p.UnconditionalBitmap
+	}
+
 	return ret, nil
 }
 
@@ -318,6 +388,8 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 			"max_wrapping_ttl",
 			"mfa_methods",
 			"control_group",
+			"conditions",
+			"filter_list_results",
 		}
 		if err := hclutil.CheckHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
@@ -333,6 +405,11 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 		if err := hcl.DecodeObject(&pc, item.Val); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
 		}
+		if pc.ConditionsHCL != nil {
+			if err := decodeConditionsHCL(item.Val, pc.ConditionsHCL); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
+			}
+		}
 
 		// Strip a leading '/' as paths in Vault start after the / in the API path
 		if len(pc.Path) > 0 && pc.Path[0] == '/' {
@@ -382,6 +459,9 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 			switch cap {
 			// If it's deny, don't include any other capability
 			case DenyCapability:
+				if pc.ConditionsHCL != nil {
+					return fmt.Errorf("path %q: conditions cannot be used with the deny capability", key)
+				}
 				pc.Capabilities = []string{DenyCapability}
 				pc.Permissions.CapabilitiesBitmap = DenyCapabilityInt
 				goto PathFinished
@@ -419,6 +499,7 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 			}
 			pc.Permissions.MaxWrappingTTL = dur
 		}
+		pc.Permissions.FilterListResults = pc.FilterListResultsHCL
 		if pc.MFAMethodsHCL != nil {
 			pc.Permissions.MFAMethods = make([]string, len(pc.MFAMethodsHCL))
 			for idx, item := range pc.MFAMethodsHCL {
@@ -460,6 +541,13 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 			}
 			pc.Permissions.ControlGroup.Factors = factors
 		}
+		if pc.ConditionsHCL != nil {
+			conditions, err := parsePathConditions(pc.ConditionsHCL)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("path %q: conditions:", key))
+			}
+			pc.Permissions.Conditions = []*PathConditions{conditions}
+		}
 		if pc.Permissions.MinWrappingTTL != 0 &&
 			pc.Permissions.MaxWrappingTTL != 0 &&
 			pc.Permissions.MaxWrappingTTL < pc.Permissions.MinWrappingTTL {
@@ -476,3 +564,154 @@ func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, en
 	result.Paths = paths
 	return nil
 }
+
+// decodeConditionsHCL validates the keys used within the conditions block of
+// a path stanza and decodes its time_window blocks, which the HCL decoder
+// cannot map onto a slice of structs by itself.
+func decodeConditionsHCL(node ast.Node, conditions *PathConditionsHCL) error {
+	obj, ok := node.(*ast.ObjectType)
+	if !ok {
+		return nil
+	}
+
+	items := obj.List.Filter("conditions").Items
+	if len(items) > 1 {
+		return errors.New("only one conditions block may be provided")
+	}
+
+	for _, item := range items {
+		valid := []string{
+			"source_cidrs",
+			"time_window",
+			"required_headers",
+		}
+		if err := hclutil.CheckHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, "conditions:")
+		}
+
+		condObj, ok := item.Val.(*ast.ObjectType)
+		if !ok {
+			continue
+		}
+		for _, tw := range condObj.List.Filter("time_window").Items {
+			valid := []string{
+				"timezone",
+				"days",
+				"start",
+				"end",
+			}
+			if err := hclutil.CheckHCLKeys(tw.Val, valid); err != nil {
+				return multierror.Prefix(err, "conditions: time_window:")
+			}
+
+			var window TimeWindowHCL
+			if err := hcl.DecodeObject(&window, tw.Val); err != nil {
+				return multierror.Prefix(err, "conditions: time_window:")
+			}
+			conditions.TimeWindows = append(conditions.TimeWindows, &window)
+		}
+	}
+
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parsePathConditions validates a conditions block and converts it into the
+// form evaluated by the ACL.
+func parsePathConditions(hclConditions *PathConditionsHCL) (*PathConditions, error) {
+	conditions := new(PathConditions)
+
+	if len(hclConditions.SourceCIDRs) > 0 {
+		cidrs, err := parseutil.ParseAddrs(hclConditions.SourceCIDRs)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing source_cidrs: {{err}}", err)
+		}
+		conditions.SourceCIDRs = cidrs
+	}
+
+	for _, hclWindow := range hclConditions.TimeWindows {
+		window, err := parseTimeWindow(hclWindow)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing time_window: {{err}}", err)
+		}
+		conditions.TimeWindows = append(conditions.TimeWindows, window)
+	}
+
+	if len(hclConditions.RequiredHeaders) > 0 {
+		conditions.RequiredHeaders = make(map[string][]string, len(hclConditions.RequiredHeaders))
+		for header, values := range hclConditions.RequiredHeaders {
+			if header == "" {
+				return nil, errors.New("required_headers: header name cannot be empty")
+			}
+			conditions.RequiredHeaders[textproto.CanonicalMIMEHeaderKey(header)] = values
+		}
+	}
+
+	if len(conditions.SourceCIDRs) == 0 && len(conditions.TimeWindows) == 0 && len(conditions.RequiredHeaders) == 0 {
+		return nil, errors.New("at least one of source_cidrs, time_window or required_headers must be provided")
+	}
+
+	return conditions, nil
+}
+
+func parseTimeWindow(hclWindow *TimeWindowHCL) (*TimeWindow, error) {
+	window := &TimeWindow{
+		Location: time.UTC,
+	}
+
+	if hclWindow.Timezone != "" {
+		loc, err := time.LoadLocation(hclWindow.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", hclWindow.Timezone)
+		}
+		window.Location = loc
+	}
+
+	for _, day := range hclWindow.Days {
+		weekday, ok := weekdays[strings.ToLower(strings.TrimSpace(day))]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", day)
+		}
+		window.Days = append(window.Days, weekday)
+	}
+
+	var err error
+	if window.Start, err = parseTimeOfDay(hclWindow.Start); err != nil {
+		return nil, errwrap.Wrapf("invalid start: {{err}}", err)
+	}
+	if window.End, err = parseTimeOfDay(hclWindow.End); err != nil {
+		return nil, errwrap.Wrapf("invalid end: {{err}}", err)
+	}
+	if window.Start == window.End {
+		return nil, errors.New("start and end cannot be the same")
+	}
+
+	return window, nil
+}
+
+// parseTimeOfDay parses a time of day in the form HH:MM into an offset from
+// midnight. "24:00" is accepted to denote the end of the day.
+func parseTimeOfDay(in string) (time.Duration, error) {
+	if in == "" {
+		return 0, errors.New("time of day must be provided")
+	}
+	if in == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse("15:04", in)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day in the form HH:MM", in)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
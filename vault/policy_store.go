@@ -27,6 +27,14 @@ const (
 	policyRGPSubPath = "policy-rgp/"
 	policyEGPSubPath = "policy-egp/"
 
+	// policyVersionsSubPath is the sub-path, nested under the system view,
+	// holding the version history of each ACL policy
+	policyVersionsSubPath = "policy-versions/"
+
+	// maxPolicyVersions is the number of versions kept in the history of an
+	// ACL policy
+	maxPolicyVersions = 10
+
 	// policyCacheSize is the number of policies that are kept cached
 	policyCacheSize = 1024
 
@@ -171,10 +179,11 @@ var (
 type PolicyStore struct {
 	entPolicyStore
 
-	core    *Core
-	aclView *BarrierView
-	rgpView *BarrierView
-	egpView *BarrierView
+	core            *Core
+	aclView         *BarrierView
+	rgpView         *BarrierView
+	egpView         *BarrierView
+	aclVersionsView *BarrierView
 
 	tokenPoliciesLRU *lru.TwoQueueCache
 	egpLRU           *lru.TwoQueueCache
@@ -205,12 +214,13 @@ type PolicyEntry struct {
 // using a given view. It used used to durable store and manage named policy.
 func NewPolicyStore(ctx context.Context, core *Core, baseView *BarrierView, system logical.SystemView, logger log.Logger) (*PolicyStore, error) {
 	ps := &PolicyStore{
-		aclView:    baseView.SubView(policyACLSubPath),
-		rgpView:    baseView.SubView(policyRGPSubPath),
-		egpView:    baseView.SubView(policyEGPSubPath),
-		modifyLock: new(sync.RWMutex),
-		logger:     logger,
-		core:       core,
+		aclView:         baseView.SubView(policyACLSubPath),
+		rgpView:         baseView.SubView(policyRGPSubPath),
+		egpView:         baseView.SubView(policyEGPSubPath),
+		aclVersionsView: baseView.SubView(policyVersionsSubPath),
+		modifyLock:      new(sync.RWMutex),
+		logger:          logger,
+		core:            core,
 	}
 
 	ps.extraInit()
@@ -334,34 +344,42 @@ func (ps *PolicyStore) invalidate(ctx context.Context, name string, policyType P
 
 // SetPolicy is used to create or update the given policy
 func (ps *PolicyStore) SetPolicy(ctx context.Context, p *Policy) error {
+	_, err := ps.SetPolicyWithAuthor(ctx, p, nil)
+	return err
+}
+
+// SetPolicyWithAuthor is used to create or update the given policy. For ACL
+// policies the change is recorded in the policy's version history, along
+// with the token that made it, and the resulting version is returned.
+func (ps *PolicyStore) SetPolicyWithAuthor(ctx context.Context, p *Policy, author *PolicyAuthor) (*PolicyVersionUpdate, error) {
 	defer metrics.MeasureSince([]string{"policy", "set_policy"}, time.Now())
 	if p == nil {
-		return fmt.Errorf("nil policy passed in for storage")
+		return nil, fmt.Errorf("nil policy passed in for storage")
 	}
 	if p.Name == "" {
-		return fmt.Errorf("policy name missing")
+		return nil, fmt.Errorf("policy name missing")
 	}
 	// Policies are normalized to lower-case
 	p.Name = ps.sanitizeName(p.Name)
 	if strutil.StrListContains(immutablePolicies, p.Name) {
-		return fmt.Errorf("cannot update %q policy", p.Name)
+		return nil, fmt.Errorf("cannot update %q policy", p.Name)
 	}
 
-	return ps.setPolicyInternal(ctx, p)
+	return ps.setPolicyInternal(ctx, p, author)
 }
 
-func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
+func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy, author *PolicyAuthor) (*PolicyVersionUpdate, error) {
 	ps.modifyLock.Lock()
 	defer ps.modifyLock.Unlock()
 
 	// Get the appropriate view based on policy type and namespace
 	view := ps.getBarrierView(p.namespace, p.Type)
 	if view == nil {
-		return fmt.Errorf("unable to get the barrier subview for policy type %q", p.Type)
+		return nil, fmt.Errorf("unable to get the barrier subview for policy type %q", p.Type)
 	}
 
 	if err := ps.parseEGPPaths(p); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create the entry
@@ -373,7 +391,7 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 		sentinelPolicy: p.sentinelPolicy,
 	})
 	if err != nil {
-		return errwrap.Wrapf("failed to create entry: {{err}}", err)
+		return nil, errwrap.Wrapf("failed to create entry: {{err}}", err)
 	}
 
 	// Construct the cache key
@@ -384,14 +402,29 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 		rgpView := ps.getRGPView(p.namespace)
 		rgp, err := rgpView.Get(ctx, entry.Key)
 		if err != nil {
-			return errwrap.Wrapf("failed looking up conflicting policy: {{err}}", err)
+			return nil, errwrap.Wrapf("failed looking up conflicting policy: {{err}}", err)
 		}
 		if rgp != nil {
-			return fmt.Errorf("cannot reuse policy names between ACLs and RGPs")
+			return nil, fmt.Errorf("cannot reuse policy names between ACLs and RGPs")
+		}
+
+		// Keep hold of the current text so that policies written before
+		// versions were kept don't lose it from their history
+		var existingRaw string
+		existing, err := view.Get(ctx, entry.Key)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to read existing policy: {{err}}", err)
+		}
+		if existing != nil {
+			existingEntry := new(PolicyEntry)
+			if err := existing.DecodeJSON(existingEntry); err != nil {
+				return nil, errwrap.Wrapf("failed to parse existing policy: {{err}}", err)
+			}
+			existingRaw = existingEntry.Raw
 		}
 
 		if err := view.Put(ctx, entry); err != nil {
-			return errwrap.Wrapf("failed to persist policy: {{err}}", err)
+			return nil, errwrap.Wrapf("failed to persist policy: {{err}}", err)
 		}
 
 		ps.policyTypeMap.Store(index, PolicyTypeACL)
@@ -400,18 +433,24 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 			ps.tokenPoliciesLRU.Add(index, p)
 		}
 
+		update, err := ps.recordPolicyVersion(ctx, p, existingRaw, author)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to record policy version: {{err}}", err)
+		}
+		return update, nil
+
 	case PolicyTypeRGP:
 		aclView := ps.getACLView(p.namespace)
 		acl, err := aclView.Get(ctx, entry.Key)
 		if err != nil {
-			return errwrap.Wrapf("failed looking up conflicting policy: {{err}}", err)
+			return nil, errwrap.Wrapf("failed looking up conflicting policy: {{err}}", err)
 		}
 		if acl != nil {
-			return fmt.Errorf("cannot reuse policy names between ACLs and RGPs")
+			return nil, fmt.Errorf("cannot reuse policy names between ACLs and RGPs")
 		}
 
 		if err := ps.handleSentinelPolicy(ctx, p, view, entry); err != nil {
-			return err
+			return nil, err
 		}
 
 		ps.policyTypeMap.Store(index, PolicyTypeRGP)
@@ -424,7 +463,7 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 
 	case PolicyTypeEGP:
 		if err := ps.handleSentinelPolicy(ctx, p, view, entry); err != nil {
-			return err
+			return nil, err
 		}
 
 		// We load here after successfully loading into Sentinel so that on
@@ -434,10 +473,10 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 		}
 
 	default:
-		return fmt.Errorf("unknown policy type, cannot set")
+		return nil, fmt.Errorf("unknown policy type, cannot set")
 	}
 
-	return nil
+	return nil, nil
 }
 
 // GetPolicy is used to fetch the named policy
@@ -751,6 +790,23 @@ func (t *TemplateError) Error() string {
 // ACL is used to return an ACL which is built using the
 // named policies.
 func (ps *PolicyStore) ACL(ctx context.Context, entity *identity.Entity, policyNames map[string][]string) (*ACL, error) {
+	policies, err := ps.resolvePolicies(ctx, entity, policyNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct the ACL
+	acl, err := NewACL(ctx, policies)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to construct ACL: {{err}}", err)
+	}
+
+	return acl, nil
+}
+
+// resolvePolicies fetches the named policies from the store, rendering any
+// templated ACL policies against the given entity.
+func (ps *PolicyStore) resolvePolicies(ctx context.Context, entity *identity.Entity, policyNames map[string][]string) ([]*Policy, error) {
 	var policies []*Policy
 	// Fetch the policies
 	for nsID, nsPolicyNames := range policyNames {
@@ -796,13 +852,7 @@ func (ps *PolicyStore) ACL(ctx context.Context, entity *identity.Entity, policyN
 		}
 	}
 
-	// Construct the ACL
-	acl, err := NewACL(ctx, policies)
-	if err != nil {
-		return nil, errwrap.Wrapf("failed to construct ACL: {{err}}", err)
-	}
-
-	return acl, nil
+	return policies, nil
 }
 
 // loadACLPolicy is used to load default ACL policies. The default policies will
@@ -841,7 +891,8 @@ func (ps *PolicyStore) loadACLPolicyInternal(ctx context.Context, policyName, po
 
 	policy.Name = policyName
 	policy.Type = PolicyTypeACL
-	return ps.setPolicyInternal(ctx, policy)
+	_, err = ps.setPolicyInternal(ctx, policy, nil)
+	return err
 }
 
 func (ps *PolicyStore) sanitizeName(name string) string {
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -274,3 +275,83 @@ func testPolicyStoreACL(t *testing.T, ps *PolicyStore, ns *namespace.Namespace)
 	}
 	testLayeredACL(t, acl, ns)
 }
+
+func TestPolicyStore_Versions(t *testing.T) {
+	_, ps := mockPolicyWithCore(t, false)
+	ctx := namespace.RootContext(nil)
+
+	raws := []string{
+		`path "secret/a" { capabilities = ["read"] }`,
+		`path "secret/b" { capabilities = ["read"] }`,
+	}
+	for i, raw := range raws {
+		policy, err := ParseACLPolicy(namespace.RootNamespace, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy.Name = "dev"
+		update, err := ps.SetPolicyWithAuthor(ctx, policy, &PolicyAuthor{
+			Accessor: "accessor",
+			EntityID: "entity",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if update.Version != i+1 {
+			t.Fatalf("bad: version: %d", update.Version)
+		}
+	}
+
+	// Writing the same text again doesn't create a version
+	policy, _ := ParseACLPolicy(namespace.RootNamespace, raws[1])
+	policy.Name = "dev"
+	update, err := ps.SetPolicyWithAuthor(ctx, policy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Version != 2 || update.Diff(policy.Name, policy.Raw) != "" {
+		t.Fatalf("bad: update: %#v", update)
+	}
+
+	history, err := ps.GetPolicyVersions(ctx, "DEV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.CurrentVersion != 2 || len(history.Versions) != 2 {
+		t.Fatalf("bad: history: %#v", history)
+	}
+	if v := history.Version(1); v.Raw != raws[0] || v.Accessor != "accessor" || v.EntityID != "entity" || v.CreatedTime.IsZero() {
+		t.Fatalf("bad: version 1: %#v", v)
+	}
+
+	// Only the most recent versions are kept
+	for i := 0; i < maxPolicyVersions; i++ {
+		policy, _ := ParseACLPolicy(namespace.RootNamespace, fmt.Sprintf(`path "secret/%d" { capabilities = ["read"] }`, i))
+		policy.Name = "dev"
+		if err := ps.SetPolicy(ctx, policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err = ps.GetPolicyVersions(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.CurrentVersion != maxPolicyVersions+2 || len(history.Versions) != maxPolicyVersions {
+		t.Fatalf("bad: history: %#v", history)
+	}
+	if history.Version(2) != nil || history.Version(3) == nil {
+		t.Fatalf("bad: versions: %#v", history.Versions)
+	}
+
+	// The history outlives the policy
+	if err := ps.DeletePolicy(ctx, "dev", PolicyTypeACL); err != nil {
+		t.Fatal(err)
+	}
+	history, err = ps.GetPolicyVersions(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history == nil || history.CurrentVersion != maxPolicyVersions+2 {
+		t.Fatalf("bad: history: %#v", history)
+	}
+}
@@ -28,6 +28,10 @@ func (ps *PolicyStore) getEGPView(ns *namespace.Namespace) *BarrierView {
 	return ps.egpView
 }
 
+func (ps *PolicyStore) getACLVersionsView(ns *namespace.Namespace) *BarrierView {
+	return ps.aclVersionsView
+}
+
 func (ps *PolicyStore) getBarrierView(ns *namespace.Namespace, _ PolicyType) *BarrierView {
 	return ps.getACLView(ns)
 }
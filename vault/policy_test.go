@@ -429,3 +429,148 @@ path "foo/+*" {
 		t.Errorf("bad error: %s", err)
 	}
 }
+
+func TestPolicy_ParseConditions(t *testing.T) {
+	p, err := ParseACLPolicy(namespace.RootNamespace, strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["create", "update"]
+	conditions {
+		source_cidrs = ["10.20.0.0/16", "192.168.1.1"]
+		time_window {
+			timezone = "America/New_York"
+			days     = ["mon", "Tue"]
+			start    = "09:00"
+			end      = "17:30"
+		}
+		time_window {
+			start = "22:00"
+			end   = "02:00"
+		}
+		required_headers = {
+			"x-deploy-id" = []
+		}
+	}
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := p.Paths[0].Permissions.Conditions
+	if len(conditions) != 1 {
+		t.Fatalf("expected one set of conditions, got %d", len(conditions))
+	}
+	cond := conditions[0]
+
+	if len(cond.SourceCIDRs) != 2 {
+		t.Fatalf("bad source cidrs: %v", cond.SourceCIDRs)
+	}
+	if len(cond.TimeWindows) != 2 {
+		t.Fatalf("bad time windows: %v", cond.TimeWindows)
+	}
+	w := cond.TimeWindows[0]
+	if w.Location.String() != "America/New_York" {
+		t.Fatalf("bad location: %s", w.Location)
+	}
+	if diff := deep.Equal(w.Days, []time.Weekday{time.Monday, time.Tuesday}); diff != nil {
+		t.Fatal(diff)
+	}
+	if w.Start != 9*time.Hour || w.End != 17*time.Hour+30*time.Minute {
+		t.Fatalf("bad window: %s - %s", w.Start, w.End)
+	}
+	if cond.TimeWindows[1].Location != time.UTC {
+		t.Fatalf("expected UTC by default, got %s", cond.TimeWindows[1].Location)
+	}
+	if _, ok := cond.RequiredHeaders["X-Deploy-Id"]; !ok {
+		t.Fatalf("expected canonical header name: %v", cond.RequiredHeaders)
+	}
+}
+
+func TestPolicy_ParseBadConditions(t *testing.T) {
+	tcases := map[string]struct {
+		conditions string
+		err        string
+	}{
+		"empty": {
+			`conditions {}`,
+			"at least one of source_cidrs, time_window or required_headers",
+		},
+		"invalid key": {
+			`conditions {
+		source_cidr = ["10.0.0.0/8"]
+	}`,
+			`invalid key "source_cidr"`,
+		},
+		"invalid window key": {
+			`conditions {
+		time_window {
+			start = "09:00"
+			end   = "17:00"
+			tz    = "UTC"
+		}
+	}`,
+			`invalid key "tz"`,
+		},
+		"bad cidr": {
+			`conditions {
+		source_cidrs = ["banana"]
+	}`,
+			"error parsing source_cidrs",
+		},
+		"bad day": {
+			`conditions {
+		time_window {
+			days  = ["someday"]
+			start = "09:00"
+			end   = "17:00"
+		}
+	}`,
+			`invalid day "someday"`,
+		},
+		"bad start": {
+			`conditions {
+		time_window {
+			start = "9am"
+			end   = "17:00"
+		}
+	}`,
+			"invalid start",
+		},
+		"empty window": {
+			`conditions {
+		time_window {
+			start = "09:00"
+			end   = "09:00"
+		}
+	}`,
+			"start and end cannot be the same",
+		},
+	}
+
+	for name, tc := range tcases {
+		_, err := ParseACLPolicy(namespace.RootNamespace, `
+path "secret/*" {
+	capabilities = ["read"]
+	`+tc.conditions+`
+}
+`)
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: bad error: %s", name, err)
+		}
+	}
+
+	_, err := ParseACLPolicy(namespace.RootNamespace, `
+path "secret/*" {
+	capabilities = ["deny"]
+	conditions {
+		source_cidrs = ["10.0.0.0/8"]
+	}
+}
+`)
+	if err == nil || !strings.Contains(err.Error(), "conditions cannot be used with the deny capability") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
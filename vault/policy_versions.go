@@ -0,0 +1,176 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/logical"
+)
+
+// PolicyAuthor identifies the token that made a change to a policy
+type PolicyAuthor struct {
+	Accessor string
+	EntityID string
+}
+
+// PolicyVersion is a single revision of an ACL policy
+type PolicyVersion struct {
+	Version     int       `json:"version"`
+	Raw         string    `json:"raw"`
+	CreatedTime time.Time `json:"created_time"`
+	Accessor    string    `json:"accessor,omitempty"`
+	EntityID    string    `json:"entity_id,omitempty"`
+}
+
+// PolicyVersionHistory holds the most recent revisions of an ACL policy,
+// oldest first. The history outlives the policy itself so that a deleted
+// policy can be restored by rolling back to one of its versions.
+type PolicyVersionHistory struct {
+	CurrentVersion int              `json:"current_version"`
+	Versions       []*PolicyVersion `json:"versions"`
+}
+
+// Version returns the given revision, or nil if it is no longer kept
+func (h *PolicyVersionHistory) Version(version int) *PolicyVersion {
+	for _, v := range h.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// PolicyVersionUpdate describes the version of an ACL policy that resulted
+// from a write
+type PolicyVersionUpdate struct {
+	Version int
+
+	// Previous is the version that was current before the write, if any
+	Previous *PolicyVersion
+}
+
+// Diff returns a unified diff from the previous version of the policy to the
+// given text, which is empty if the text did not change.
+func (u *PolicyVersionUpdate) Diff(name, raw string) string {
+	var fromRaw, fromFile string
+	if u.Previous != nil {
+		if u.Previous.Version == u.Version {
+			return ""
+		}
+		fromRaw = u.Previous.Raw
+		fromFile = fmt.Sprintf("%s (version %d)", name, u.Previous.Version)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromRaw),
+		B:        difflib.SplitLines(raw),
+		FromFile: fromFile,
+		ToFile:   fmt.Sprintf("%s (version %d)", name, u.Version),
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// GetPolicyVersions returns the version history of the named ACL policy, or
+// nil if there is none.
+func (ps *PolicyStore) GetPolicyVersions(ctx context.Context, name string) (*PolicyVersionHistory, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.modifyLock.RLock()
+	defer ps.modifyLock.RUnlock()
+
+	return ps.policyVersionHistory(ctx, ns, ps.sanitizeName(name))
+}
+
+func (ps *PolicyStore) policyVersionHistory(ctx context.Context, ns *namespace.Namespace, name string) (*PolicyVersionHistory, error) {
+	view := ps.getACLVersionsView(ns)
+	if view == nil {
+		return nil, fmt.Errorf("unable to get the barrier subview for policy versions")
+	}
+
+	entry, err := view.Get(ctx, name)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read policy versions: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	history := new(PolicyVersionHistory)
+	if err := entry.DecodeJSON(history); err != nil {
+		return nil, errwrap.Wrapf("failed to parse policy versions: {{err}}", err)
+	}
+
+	return history, nil
+}
+
+// recordPolicyVersion adds the text of the policy to its version history.
+// existingRaw is the text the policy had before the write; it seeds the
+// history of policies written before versions were kept. Writes that don't
+// change the text don't create a new version. The caller must hold the
+// modify lock.
+func (ps *PolicyStore) recordPolicyVersion(ctx context.Context, p *Policy, existingRaw string, author *PolicyAuthor) (*PolicyVersionUpdate, error) {
+	history, err := ps.policyVersionHistory(ctx, p.namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = new(PolicyVersionHistory)
+		if existingRaw != "" {
+			history.CurrentVersion = 1
+			history.Versions = []*PolicyVersion{
+				{
+					Version: 1,
+					Raw:     existingRaw,
+				},
+			}
+		}
+	}
+
+	previous := history.Version(history.CurrentVersion)
+	if previous != nil && previous.Raw == p.Raw {
+		return &PolicyVersionUpdate{
+			Version:  previous.Version,
+			Previous: previous,
+		}, nil
+	}
+
+	version := &PolicyVersion{
+		Version:     history.CurrentVersion + 1,
+		Raw:         p.Raw,
+		CreatedTime: time.Now().UTC(),
+	}
+	if author != nil {
+		version.Accessor = author.Accessor
+		version.EntityID = author.EntityID
+	}
+
+	history.CurrentVersion = version.Version
+	history.Versions = append(history.Versions, version)
+	if len(history.Versions) > maxPolicyVersions {
+		history.Versions = history.Versions[len(history.Versions)-maxPolicyVersions:]
+	}
+
+	entry, err := logical.StorageEntryJSON(p.Name, history)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to create entry: {{err}}", err)
+	}
+	if err := ps.getACLVersionsView(p.namespace).Put(ctx, entry); err != nil {
+		return nil, errwrap.Wrapf("failed to persist policy versions: {{err}}", err)
+	}
+
+	return &PolicyVersionUpdate{
+		Version:  version.Version,
+		Previous: previous,
+	}, nil
+}
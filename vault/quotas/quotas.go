@@ -23,6 +23,10 @@ const (
 
 	// TypeLeaseCount represents the lease count limiting quota type
 	TypeLeaseCount Type = "lease-count"
+
+	// TypeRequestSize represents the request and response size limiting quota
+	// type
+	TypeRequestSize Type = "request-size"
 )
 
 // LeaseAction is the action taken by the expiration manager on the lease. The
@@ -74,6 +78,8 @@ func (q Type) String() string {
 		return "lease-count"
 	case TypeRateLimit:
 		return "rate-limit"
+	case TypeRequestSize:
+		return "request-size"
 	}
 	return "unknown"
 }
@@ -103,6 +109,14 @@ var (
 	// ErrRateLimitQuotaExceeded is returned when a request is rejected due to a
 	// rate limit quota being exceeded.
 	ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+	// ErrRequestSizeQuotaExceeded is returned when a request is rejected due
+	// to its body exceeding a request size quota.
+	ErrRequestSizeQuotaExceeded = errors.New("request size quota exceeded")
+
+	// ErrResponseSizeQuotaExceeded is returned when a request is rejected due
+	// to its response exceeding a request size quota.
+	ErrResponseSizeQuotaExceeded = errors.New("response size quota exceeded")
 )
 
 // Access provides information to reach back to the quota checker.
@@ -204,6 +218,27 @@ type Request struct {
 	// ClientAddress is client unique addressable string (e.g. IP address). It can
 	// be empty if the quota type does not need it.
 	ClientAddress string
+
+	// EntityID is the identity entity of the client token. It is only set
+	// when the applicable rate limit quota is keyed by entity.
+	EntityID string
+
+	// Role identifies the auth role a login request is made against. It is
+	// only set when the applicable rate limit quota is keyed by role.
+	Role string
+
+	// RoleID is the role ID a login request is made against, if it names no
+	// role. A role ID is part of the credentials of the client, so it is only
+	// used as a client key once hashed.
+	RoleID string
+
+	// RequestSize is the size in bytes of the request data. It is only set
+	// when checking a request against a request size quota.
+	RequestSize int64
+
+	// ResponseSize is the size in bytes of the response data. It is only set
+	// when checking a response against a request size quota.
+	ResponseSize int64
 }
 
 // NewManager creates and initializes a new quota manager to hold all the quota
@@ -705,6 +740,8 @@ func Load(ctx context.Context, storage logical.Storage, qType, name string) (Quo
 		quota = &RateLimitQuota{}
 	case TypeLeaseCount.String():
 		quota = &LeaseCountQuota{}
+	case TypeRequestSize.String():
+		quota = &RequestSizeQuota{}
 	default:
 		return nil, fmt.Errorf("unsupported type: %v", qType)
 	}
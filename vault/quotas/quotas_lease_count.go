@@ -0,0 +1,303 @@
+package quotas
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/armon/go-metrics"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-memdb"
+	"github.com/hashicorp/go-uuid"
+	"github.com/quid/vault/helper/metricsutil"
+)
+
+// Ensure that LeaseCountQuota implements the Quota interface
+var _ Quota = (*LeaseCountQuota)(nil)
+
+// LeaseCountQuota represents the quota rule properties that is used to limit
+// the number of live leases for a namespace or mount.
+type LeaseCountQuota struct {
+	// ID is the identifier of the quota
+	ID string `json:"id"`
+
+	// Type of quota this represents
+	Type Type `json:"type"`
+
+	// Name of the quota rule
+	Name string `json:"name"`
+
+	// NamespacePath is the path of the namespace to which this quota is
+	// applicable.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the path of the mount to which this quota is applicable
+	MountPath string `json:"mount_path"`
+
+	// MaxLeases is the maximum number of leases allowed by the quota rule
+	MaxLeases int `json:"max_leases"`
+
+	lock       *sync.Mutex
+	logger     log.Logger
+	metricSink *metricsutil.ClusterMetricSink
+
+	// counter is the number of leases in the expiration manager that the
+	// quota applies to.
+	counter int
+
+	// pending is the number of requests that have been allowed by the quota
+	// but have not yet been acknowledged. They are counted against the limit
+	// since each of them may generate a lease.
+	pending int
+}
+
+// NewLeaseCountQuota creates a quota checker for imposing limits on the number
+// of leases.
+func NewLeaseCountQuota(name, nsPath, mountPath string, maxLeases int) *LeaseCountQuota {
+	return &LeaseCountQuota{
+		Name:          name,
+		Type:          TypeLeaseCount,
+		NamespacePath: nsPath,
+		MountPath:     mountPath,
+		MaxLeases:     maxLeases,
+	}
+}
+
+// initialize ensures the namespace and max leases are initialized and sets the
+// ID if it's currently empty. The counters are left untouched; they are rebuilt
+// by the quota manager whenever the quota rules change.
+func (lcq *LeaseCountQuota) initialize(logger log.Logger, ms *metricsutil.ClusterMetricSink) error {
+	if lcq.lock == nil {
+		lcq.lock = new(sync.Mutex)
+	}
+
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	// Memdb requires a non-empty value for indexing
+	if lcq.NamespacePath == "" {
+		lcq.NamespacePath = "root"
+	}
+
+	if lcq.MaxLeases <= 0 {
+		return fmt.Errorf("invalid max leases: %v", lcq.MaxLeases)
+	}
+
+	if logger != nil {
+		lcq.logger = logger
+	}
+
+	if lcq.metricSink == nil {
+		lcq.metricSink = ms
+	}
+
+	if lcq.ID == "" {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+
+		lcq.ID = id
+	}
+
+	lcq.metricSink.SetGaugeWithLabels([]string{"quota", "lease_count", "max"}, float32(lcq.MaxLeases), []metrics.Label{{"name", lcq.Name}})
+	lcq.emitCounterMetric()
+
+	return nil
+}
+
+// quotaID returns the identifier of the quota rule
+func (lcq *LeaseCountQuota) quotaID() string {
+	return lcq.ID
+}
+
+// QuotaName returns the name of the quota rule
+func (lcq *LeaseCountQuota) QuotaName() string {
+	return lcq.Name
+}
+
+// Counter returns the number of leases the quota applies to
+func (lcq *LeaseCountQuota) Counter() int {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+	return lcq.counter
+}
+
+// allow decides if the request is allowed by the quota. A request is allowed
+// if the leases it could generate, together with the existing leases and
+// those of the requests still in flight, fit within the limit. An allowed
+// request holds on to its place until it is acknowledged.
+func (lcq *LeaseCountQuota) allow(req *Request) (Response, error) {
+	var resp Response
+
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	if lcq.counter+lcq.pending >= lcq.MaxLeases {
+		lcq.metricSink.IncrCounterWithLabels([]string{"quota", "lease_count", "violation"}, 1, []metrics.Label{{"name", lcq.Name}})
+		return resp, nil
+	}
+
+	lcq.updateCounterLocked(LeaseActionAllow)
+
+	resp.Allowed = true
+	resp.Access = &access{
+		quotaID: lcq.ID,
+	}
+	return resp, nil
+}
+
+// ack releases the place held by a request that was allowed by the quota. If
+// the request generated a lease, it has already been counted through the
+// expiration manager.
+func (lcq *LeaseCountQuota) ack() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+
+	if lcq.pending > 0 {
+		lcq.pending--
+	}
+}
+
+// updateCounter adjusts the counters of the quota for the given action
+func (lcq *LeaseCountQuota) updateCounter(action LeaseAction) {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+	lcq.updateCounterLocked(action)
+}
+
+func (lcq *LeaseCountQuota) updateCounterLocked(action LeaseAction) {
+	switch action {
+	case LeaseActionAllow:
+		lcq.pending++
+		return
+	case LeaseActionLoaded, LeaseActionCreated:
+		lcq.counter++
+	case LeaseActionDeleted:
+		// The lease may have been counted against a different quota rule
+		// before the rules were last recomputed
+		if lcq.counter > 0 {
+			lcq.counter--
+		}
+	}
+	lcq.emitCounterMetric()
+}
+
+// resetCounter clears the lease counter ahead of it being recomputed
+func (lcq *LeaseCountQuota) resetCounter() {
+	lcq.lock.Lock()
+	defer lcq.lock.Unlock()
+	lcq.counter = 0
+	lcq.emitCounterMetric()
+}
+
+func (lcq *LeaseCountQuota) emitCounterMetric() {
+	lcq.metricSink.SetGaugeWithLabels([]string{"quota", "lease_count", "counter"}, float32(lcq.counter), []metrics.Label{{"name", lcq.Name}})
+}
+
+// close is a no-op for lease count quotas
+func (lcq *LeaseCountQuota) close() error {
+	return nil
+}
+
+func (lcq *LeaseCountQuota) handleRemount(toPath string) {
+	lcq.MountPath = toPath
+}
+
+// HandleLeaseAction updates the lease count quota that applies to the lease
+// described by the request. Leases that are loaded or created also teach the
+// manager that their request path generates leases.
+func (m *Manager) HandleLeaseAction(action LeaseAction, req *Request) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	switch action {
+	case LeaseActionLoaded, LeaseActionCreated:
+		m.addLeasePath(req.Path)
+	case LeaseActionDeleted:
+	default:
+		return fmt.Errorf("unsupported lease action %q", action)
+	}
+
+	req.Type = TypeLeaseCount
+	quota, err := m.queryQuota(nil, req)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		return nil
+	}
+
+	quota.(*LeaseCountQuota).updateCounter(action)
+	return nil
+}
+
+// AckLeaseQuota acknowledges a request that was allowed by a lease count
+// quota, once it is known whether the request generated a lease.
+func (m *Manager) AckLeaseQuota(acc Access) error {
+	quota, err := m.QuotaByID(TypeLeaseCount.String(), acc.QuotaID())
+	if err != nil {
+		return err
+	}
+
+	// The quota rule may have been deleted while the request was in flight
+	if quota == nil {
+		return nil
+	}
+
+	quota.(*LeaseCountQuota).ack()
+	return nil
+}
+
+// recomputeLeaseCounts rebuilds the counters of all the lease count quotas by
+// walking the leases in the expiration manager. It should be called with the
+// manager's lock held, using the transaction holding the updated quota rules.
+func (m *Manager) recomputeLeaseCounts(ctx context.Context, txn *memdb.Txn) error {
+	iter, err := txn.Get(TypeLeaseCount.String(), indexID)
+	if err != nil {
+		return err
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		raw.(*LeaseCountQuota).resetCounter()
+	}
+
+	if m.walkFunc == nil {
+		return nil
+	}
+
+	var walkErr error
+	err = m.walkFunc(ctx, func(req *Request) bool {
+		m.addLeasePath(req.Path)
+
+		req.Type = TypeLeaseCount
+		quota, err := m.queryQuota(txn, req)
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if quota != nil {
+			quota.(*LeaseCountQuota).updateCounter(LeaseActionLoaded)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return walkErr
+}
+
+// addLeasePath records a request path that is known to generate leases
+func (m *Manager) addLeasePath(path string) {
+	m.leasePathsLock.Lock()
+	defer m.leasePathsLock.Unlock()
+	m.leasePaths[path] = struct{}{}
+}
+
+// inLeasePathCache returns if the request path is known to generate leases
+func (m *Manager) inLeasePathCache(path string) bool {
+	m.leasePathsLock.RLock()
+	defer m.leasePathsLock.RUnlock()
+	_, ok := m.leasePaths[path]
+	return ok
+}
@@ -0,0 +1,144 @@
+package quotas
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/helper/metricsutil"
+	"github.com/quid/vault/sdk/helper/logging"
+)
+
+func TestLeaseCountQuota_Allow(t *testing.T) {
+	lcq := NewLeaseCountQuota("test-lease-count", "", "pki/", 2)
+	if err := lcq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()); err != nil {
+		t.Fatal(err)
+	}
+
+	allow := func() Response {
+		t.Helper()
+		resp, err := lcq.allow(&Request{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Requests in flight count against the limit until acknowledged
+	first := allow()
+	second := allow()
+	if !first.Allowed || !second.Allowed || first.Access == nil {
+		t.Fatalf("expected requests to be allowed, got: %#v, %#v", first, second)
+	}
+	if allow().Allowed {
+		t.Fatal("expected request to be rejected while others are in flight")
+	}
+
+	// The first request generated a lease, the second did not
+	lcq.updateCounter(LeaseActionCreated)
+	lcq.ack()
+	lcq.ack()
+
+	if lcq.Counter() != 1 {
+		t.Fatalf("expected counter to be 1, got: %d", lcq.Counter())
+	}
+	if !allow().Allowed {
+		t.Fatal("expected request to be allowed")
+	}
+	lcq.updateCounter(LeaseActionCreated)
+	lcq.ack()
+
+	if allow().Allowed {
+		t.Fatal("expected request to be rejected at the limit")
+	}
+
+	lcq.updateCounter(LeaseActionDeleted)
+	if !allow().Allowed {
+		t.Fatal("expected request to be allowed after a lease was deleted")
+	}
+}
+
+func TestLeaseCountQuota_Manager(t *testing.T) {
+	leases := []*Request{
+		{Path: "pki/issue/test", NamespacePath: "root", MountPath: "pki/"},
+		{Path: "pki/issue/test", NamespacePath: "root", MountPath: "pki/"},
+		{Path: "auth/userpass/login/foo", NamespacePath: "root", MountPath: "auth/userpass/"},
+	}
+	walkFunc := func(ctx context.Context, cb func(*Request) bool) error {
+		for _, lease := range leases {
+			req := *lease
+			if !cb(&req) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	qm, err := NewManager(logging.NewVaultLogger(log.Trace), walkFunc, metricsutil.BlackholeSink())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := NewLeaseCountQuota("global", "", "", 10)
+	if err := qm.SetQuota(context.Background(), TypeLeaseCount.String(), global, false); err != nil {
+		t.Fatal(err)
+	}
+	if global.Counter() != 3 {
+		t.Fatalf("expected global counter to be 3, got: %d", global.Counter())
+	}
+
+	// A mount quota takes over the leases of its mount
+	pki := NewLeaseCountQuota("pki", "", "pki/", 2)
+	if err := qm.SetQuota(context.Background(), TypeLeaseCount.String(), pki, false); err != nil {
+		t.Fatal(err)
+	}
+	if global.Counter() != 1 || pki.Counter() != 2 {
+		t.Fatalf("bad: global counter: %d, pki counter: %d", global.Counter(), pki.Counter())
+	}
+
+	apply := func(path, mountPath string) bool {
+		t.Helper()
+		resp, err := qm.ApplyQuota(&Request{
+			Type:      TypeLeaseCount,
+			Path:      path,
+			MountPath: mountPath,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Access != nil {
+			if err := qm.AckLeaseQuota(resp.Access); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Allowed
+	}
+
+	if apply("pki/issue/test", "pki/") {
+		t.Fatal("expected request to be rejected by the pki quota")
+	}
+
+	// Paths that have not generated leases are not limited
+	if !apply("pki/cert/ca", "pki/") {
+		t.Fatal("expected request on a path without leases to be allowed")
+	}
+
+	err = qm.HandleLeaseAction(LeaseActionDeleted, &Request{Path: "pki/issue/test", MountPath: "pki/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pki.Counter() != 1 {
+		t.Fatalf("expected pki counter to be 1, got: %d", pki.Counter())
+	}
+	if !apply("pki/issue/test", "pki/") {
+		t.Fatal("expected request to be allowed after a lease was deleted")
+	}
+
+	// Deleting the mount quota hands its leases back to the global quota
+	if err := qm.DeleteQuota(context.Background(), TypeLeaseCount.String(), "pki"); err != nil {
+		t.Fatal(err)
+	}
+	if global.Counter() != 3 {
+		t.Fatalf("expected global counter to be 3, got: %d", global.Counter())
+	}
+}
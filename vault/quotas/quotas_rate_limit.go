@@ -1,9 +1,15 @@
 package quotas
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -11,6 +17,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/quid/vault/helper/metricsutil"
 	"github.com/quid/vault/sdk/helper/pathmanager"
+	"github.com/quid/vault/sdk/helper/strutil"
 	"golang.org/x/time/rate"
 )
 
@@ -24,11 +31,41 @@ const (
 	// DefaultRateLimitStaleAge defines the default stale age of a client limiter.
 	DefaultRateLimitStaleAge = 3 * time.Minute
 
+	// DefaultRateLimitMaxClients defines the default number of client rate
+	// limiters a RateLimitQuota keeps for entities or roles. Once reached,
+	// requests of entities or roles without a limiter are limited by client
+	// IP address instead.
+	DefaultRateLimitMaxClients = 10000
+
 	// EnvVaultEnableRateLimitAuditLogging is used to enable audit logging of
 	// requests that get rejected due to rate limit quota violations.
 	EnvVaultEnableRateLimitAuditLogging = "VAULT_ENABLE_RATE_LIMIT_AUDIT_LOGGING"
 )
 
+const (
+	// RateLimitKeyClientIP keys the client rate limiters of a RateLimitQuota by
+	// the IP address of the client. This is the default.
+	RateLimitKeyClientIP = "ip"
+
+	// RateLimitKeyEntity keys the client rate limiters of a RateLimitQuota by
+	// the identity entity of the client token.
+	RateLimitKeyEntity = "entity"
+
+	// RateLimitKeyRole keys the client rate limiters of a RateLimitQuota by the
+	// auth role a login request is made against.
+	RateLimitKeyRole = "role"
+)
+
+// RateLimitKeyTypes returns the supported ways of keying the client rate
+// limiters of a RateLimitQuota.
+func RateLimitKeyTypes() []string {
+	return []string{
+		RateLimitKeyClientIP,
+		RateLimitKeyEntity,
+		RateLimitKeyRole,
+	}
+}
+
 func init() {
 	rateLimitExemptPaths.AddPaths([]string{
 		"/v1/sys/generate-recovery-token/attempt",
@@ -45,6 +82,12 @@ func init() {
 // addressable client (e.g. IP address). Whenever this client attempts to make
 // a request, the lastSeen value will be updated.
 type ClientRateLimiter struct {
+	// allowed and rejected count the requests of the client that were allowed
+	// and rejected by the limiter. They must be accessed atomically, and are
+	// kept first for 64-bit alignment.
+	allowed  uint64
+	rejected uint64
+
 	// lastSeen defines the UNIX timestamp the client last made a request.
 	lastSeen time.Time
 
@@ -52,6 +95,22 @@ type ClientRateLimiter struct {
 	limiter *rate.Limiter
 }
 
+// RateLimitClientStats reports the requests a client of a RateLimitQuota made
+// since it was last purged as stale.
+type RateLimitClientStats struct {
+	// Key identifies the client, e.g. an IP address, entity ID or role
+	Key string
+
+	// KeyType is the way Key identifies the client. It can differ from the
+	// key type of the quota for requests that lacked the key, which are
+	// limited by client IP address instead.
+	KeyType string
+
+	Allowed  uint64
+	Rejected uint64
+	LastSeen time.Time
+}
+
 // newClientRateLimiter returns a token bucket based rate limiter for a client
 // that is uniquely addressable, where maxRequests defines the requests-per-second
 // and burstSize defines the maximum burst allowed. A caller may provide -1 for
@@ -96,6 +155,10 @@ type RateLimitQuota struct {
 	// Burst defines maximum number of requests at any given moment to be allowed.
 	Burst int `json:"burst"`
 
+	// KeyType defines what separate client rate limiters are kept for. An
+	// empty value is the same as RateLimitKeyClientIP.
+	KeyType string `json:"key_type"`
+
 	lock         *sync.RWMutex
 	logger       log.Logger
 	metricSink   *metricsutil.ClusterMetricSink
@@ -112,6 +175,19 @@ type RateLimitQuota struct {
 	// this value.
 	staleAge time.Duration
 
+	// maxClients defines the number of client rate limiters that are kept for
+	// entities or roles. These keys are taken from the request, so they are
+	// bounded to keep clients from growing the rateQuotas mapping at will.
+	maxClients int
+
+	// numKeyedClients is the number of client rate limiters in the rateQuotas
+	// mapping that are kept for entities or roles.
+	numKeyedClients int
+
+	// roleIDSalt is the key role IDs are hashed with before they are used as
+	// client keys, since a role ID is part of the credentials of a client.
+	roleIDSalt []byte
+
 	// rateQuotas contains a mapping from a unique addressable client (e.g. IP address)
 	// to a clientRateLimiter reference. Every purgeInterval seconds, the RateLimitQuota
 	// will attempt to remove stale entries from the mapping.
@@ -128,9 +204,18 @@ func NewRateLimitQuota(name, nsPath, mountPath string, rate float64, burst int)
 		MountPath:     mountPath,
 		Rate:          rate,
 		Burst:         burst,
+		KeyType:       RateLimitKeyClientIP,
 	}
 }
 
+// ClientKeyType returns what separate client rate limiters are kept for
+func (rlq *RateLimitQuota) ClientKeyType() string {
+	if rlq.KeyType == "" {
+		return RateLimitKeyClientIP
+	}
+	return rlq.KeyType
+}
+
 // initialize ensures the namespace and max requests are initialized, sets the ID
 // if it's currently empty, sets the purge interval and stale age to default
 // values, and finally starts the client purge go routine if it has been started
@@ -156,6 +241,10 @@ func (rlq *RateLimitQuota) initialize(logger log.Logger, ms *metricsutil.Cluster
 		return fmt.Errorf("burst size (%v) must be greater than or equal to average rps (%v)", rlq.Burst, rlq.Rate)
 	}
 
+	if !strutil.StrListContains(RateLimitKeyTypes(), rlq.ClientKeyType()) {
+		return fmt.Errorf("invalid key type: %q", rlq.KeyType)
+	}
+
 	if logger != nil {
 		rlq.logger = logger
 	}
@@ -173,9 +262,20 @@ func (rlq *RateLimitQuota) initialize(logger log.Logger, ms *metricsutil.Cluster
 		rlq.ID = id
 	}
 
+	if rlq.roleIDSalt == nil {
+		salt, err := uuid.GenerateRandomBytes(32)
+		if err != nil {
+			return err
+		}
+
+		rlq.roleIDSalt = salt
+	}
+
 	rlq.purgeInterval = DefaultRateLimitPurgeInterval
 	rlq.staleAge = DefaultRateLimitStaleAge
+	rlq.maxClients = DefaultRateLimitMaxClients
 	rlq.rateQuotas = make(map[string]*ClientRateLimiter)
+	rlq.numKeyedClients = 0
 
 	if !rlq.purgeEnabled {
 		rlq.purgeEnabled = true
@@ -233,6 +333,9 @@ func (rlq *RateLimitQuota) purgeClientsLoop() {
 			for client, crl := range rlq.rateQuotas {
 				if t.UTC().Sub(crl.lastSeen) >= rlq.staleAge {
 					delete(rlq.rateQuotas, client)
+					if strings.Contains(client, "/") {
+						rlq.numKeyedClients--
+					}
 				}
 			}
 
@@ -249,19 +352,28 @@ func (rlq *RateLimitQuota) purgeClientsLoop() {
 }
 
 // clientRateLimiter returns a reference to a ClientRateLimiter based on a
-// provided client address (e.g. IP address). If the ClientRateLimiter does not
+// provided client key (e.g. IP address). If the ClientRateLimiter does not
 // exist in the RateLimitQuota's mapping, one will be created and set. The
 // created RateLimitQuota will have its requests-per-second set to
 // RateLimitQuota.AverageRps. If the ClientRateLimiter already exists, the
-// lastSeen timestamp will be updated.
-func (rlq *RateLimitQuota) clientRateLimiter(addr string) *ClientRateLimiter {
+// lastSeen timestamp will be updated. The client address is used as the key
+// instead if a new limiter is needed for an entity or role while the quota
+// already keeps maxClients of them.
+func (rlq *RateLimitQuota) clientRateLimiter(key, keyType, addr string) *ClientRateLimiter {
 	rlq.lock.Lock()
 	defer rlq.lock.Unlock()
 
-	crl, ok := rlq.rateQuotas[addr]
+	crl, ok := rlq.rateQuotas[key]
+	if !ok && keyType != RateLimitKeyClientIP && addr != "" && rlq.numKeyedClients >= rlq.maxClients {
+		key, keyType = addr, RateLimitKeyClientIP
+		crl, ok = rlq.rateQuotas[key]
+	}
 	if !ok {
+		if keyType != RateLimitKeyClientIP {
+			rlq.numKeyedClients++
+		}
 		limiter := newClientRateLimiter(rlq.Rate, rlq.Burst)
-		rlq.rateQuotas[addr] = limiter
+		rlq.rateQuotas[key] = limiter
 		return limiter
 	}
 
@@ -269,10 +381,38 @@ func (rlq *RateLimitQuota) clientRateLimiter(addr string) *ClientRateLimiter {
 	return crl
 }
 
+// clientKey returns the key of the client rate limiter for the request, along
+// with the way the key identifies the client. Requests that lack the value the
+// quota is keyed by are limited by client IP address.
+func (rlq *RateLimitQuota) clientKey(req *Request) (string, string) {
+	switch rlq.ClientKeyType() {
+	case RateLimitKeyEntity:
+		if req.EntityID != "" {
+			return RateLimitKeyEntity + "/" + req.EntityID, RateLimitKeyEntity
+		}
+	case RateLimitKeyRole:
+		if req.Role != "" {
+			return RateLimitKeyRole + "/" + req.Role, RateLimitKeyRole
+		}
+		if req.RoleID != "" {
+			return RateLimitKeyRole + "/" + req.Path + ":" + rlq.hashRoleID(req.RoleID), RateLimitKeyRole
+		}
+	}
+	return req.ClientAddress, RateLimitKeyClientIP
+}
+
+// hashRoleID returns the salted hash of a role ID that is used in its place
+// in client keys, so that role IDs are neither kept nor reported by Stats.
+func (rlq *RateLimitQuota) hashRoleID(roleID string) string {
+	mac := hmac.New(sha256.New, rlq.roleIDSalt)
+	mac.Write([]byte(roleID))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // allow decides if the request is allowed by the quota. An error will be
 // returned if the request ID or address is empty. If the path is exempt, the
 // quota will not be evaluated. Otherwise, the client rate limiter is retrieved
-// by address and the rate limit quota is checked against that limiter.
+// by the client key and the rate limit quota is checked against that limiter.
 func (rlq *RateLimitQuota) allow(req *Request) (Response, error) {
 	var resp Response
 
@@ -282,18 +422,61 @@ func (rlq *RateLimitQuota) allow(req *Request) (Response, error) {
 		return resp, nil
 	}
 
-	if req.ClientAddress == "" {
+	key, keyType := rlq.clientKey(req)
+	if key == "" {
 		return resp, fmt.Errorf("missing request client address in quota request")
 	}
 
-	resp.Allowed = rlq.clientRateLimiter(req.ClientAddress).limiter.Allow()
+	crl := rlq.clientRateLimiter(key, keyType, req.ClientAddress)
+	resp.Allowed = crl.limiter.Allow()
 	if !resp.Allowed {
+		atomic.AddUint64(&crl.rejected, 1)
 		rlq.metricSink.IncrCounterWithLabels([]string{"quota", "rate_limit", "violation"}, 1, []metrics.Label{{"name", rlq.Name}})
+	} else {
+		atomic.AddUint64(&crl.allowed, 1)
 	}
 
 	return resp, nil
 }
 
+// Stats returns the request counts of the clients with the most rejected
+// requests, followed by those with the most allowed requests. At most limit
+// clients are returned.
+func (rlq *RateLimitQuota) Stats(limit int) []*RateLimitClientStats {
+	rlq.lock.RLock()
+	stats := make([]*RateLimitClientStats, 0, len(rlq.rateQuotas))
+	for key, crl := range rlq.rateQuotas {
+		keyType := RateLimitKeyClientIP
+		if idx := strings.Index(key, "/"); idx != -1 {
+			keyType = key[:idx]
+			key = key[idx+1:]
+		}
+		stats = append(stats, &RateLimitClientStats{
+			Key:      key,
+			KeyType:  keyType,
+			Allowed:  atomic.LoadUint64(&crl.allowed),
+			Rejected: atomic.LoadUint64(&crl.rejected),
+			LastSeen: crl.lastSeen,
+		})
+	}
+	rlq.lock.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Rejected != stats[j].Rejected {
+			return stats[i].Rejected > stats[j].Rejected
+		}
+		if stats[i].Allowed != stats[j].Allowed {
+			return stats[i].Allowed > stats[j].Allowed
+		}
+		return stats[i].Key < stats[j].Key
+	})
+
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
 // close stops the current running client purge loop.
 func (rlq *RateLimitQuota) close() error {
 	close(rlq.closeCh)
@@ -2,6 +2,7 @@ package quotas
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -170,3 +171,102 @@ func TestRateLimitQuota_Allow(t *testing.T) {
 		}
 	}
 }
+
+func TestRateLimitQuota_KeyType(t *testing.T) {
+	rlq := NewRateLimitQuota("test-rate-limiter", "qa", "/foo/bar", 1, 1)
+	rlq.KeyType = RateLimitKeyEntity
+	if err := rlq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()); err != nil {
+		t.Fatal(err)
+	}
+	defer rlq.close()
+
+	allow := func(req *Request) bool {
+		t.Helper()
+		resp, err := rlq.allow(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Allowed
+	}
+
+	// Each entity gets its own bucket, even from the same address
+	if !allow(&Request{ClientAddress: "127.0.0.1", EntityID: "entity1"}) {
+		t.Fatal("expected first request of entity1 to be allowed")
+	}
+	if allow(&Request{ClientAddress: "127.0.0.1", EntityID: "entity1"}) {
+		t.Fatal("expected second request of entity1 to be rejected")
+	}
+	if !allow(&Request{ClientAddress: "127.0.0.1", EntityID: "entity2"}) {
+		t.Fatal("expected first request of entity2 to be allowed")
+	}
+
+	// Requests without an entity fall back to the client address
+	if !allow(&Request{ClientAddress: "127.0.0.1"}) {
+		t.Fatal("expected first request without an entity to be allowed")
+	}
+
+	stats := rlq.Stats(2)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 clients, got: %d", len(stats))
+	}
+	if stats[0].Key != "entity1" || stats[0].KeyType != RateLimitKeyEntity || stats[0].Allowed != 1 || stats[0].Rejected != 1 {
+		t.Fatalf("bad: top client: %#v", stats[0])
+	}
+	if stats[1].Rejected != 0 || stats[1].Allowed != 1 {
+		t.Fatalf("bad: second client: %#v", stats[1])
+	}
+
+	rlq.KeyType = "bogus"
+	if err := rlq.initialize(nil, nil); err == nil {
+		t.Fatal("expected error for an invalid key type")
+	}
+}
+
+func TestRateLimitQuota_KeyTypeRole(t *testing.T) {
+	rlq := NewRateLimitQuota("test-rate-limiter", "qa", "/foo/bar", 1, 1)
+	rlq.KeyType = RateLimitKeyRole
+	if err := rlq.initialize(logging.NewVaultLogger(log.Trace), metricsutil.BlackholeSink()); err != nil {
+		t.Fatal(err)
+	}
+	defer rlq.close()
+	rlq.maxClients = 2
+
+	allow := func(req *Request) bool {
+		t.Helper()
+		resp, err := rlq.allow(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Allowed
+	}
+
+	// Role IDs are hashed before they are used as a key
+	roleID := "bdb6c3ef-1d07-1fc7-0c29-7a1b3a3c3d0b"
+	req := &Request{ClientAddress: "127.0.0.1", Path: "auth/approle/login", RoleID: roleID}
+	if !allow(req) {
+		t.Fatal("expected first request of the role ID to be allowed")
+	}
+	if allow(req) {
+		t.Fatal("expected second request of the role ID to be rejected")
+	}
+	for _, stats := range rlq.Stats(0) {
+		if strings.Contains(stats.Key, roleID) {
+			t.Fatalf("expected the role ID not to be reported: %#v", stats)
+		}
+	}
+
+	// Once the maximum number of roles is tracked, new roles are limited by
+	// client address
+	if !allow(&Request{ClientAddress: "127.0.0.1", Role: "auth/approle/login:role1"}) {
+		t.Fatal("expected first request of role1 to be allowed")
+	}
+	if !allow(&Request{ClientAddress: "127.0.0.1"}) {
+		t.Fatal("expected first request without a role to be allowed")
+	}
+	if allow(&Request{ClientAddress: "127.0.0.1", Role: "auth/approle/login:role2"}) {
+		t.Fatal("expected request of role2 to share the limiter of the client address")
+	}
+	if rlq.numClients() != 3 || !rlq.hasClient("127.0.0.1") {
+		t.Fatalf("expected 2 roles and 1 client address to be tracked, got: %d clients", rlq.numClients())
+	}
+}
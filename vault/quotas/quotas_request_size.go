@@ -0,0 +1,140 @@
+package quotas
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/armon/go-metrics"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-uuid"
+	"github.com/quid/vault/helper/metricsutil"
+)
+
+// Ensure that RequestSizeQuota implements the Quota interface
+var _ Quota = (*RequestSizeQuota)(nil)
+
+// RequestSizeQuota represents the quota rule properties that is used to limit
+// the size of the request bodies accepted and of the response payloads
+// returned for a namespace or mount.
+type RequestSizeQuota struct {
+	// ID is the identifier of the quota
+	ID string `json:"id"`
+
+	// Type of quota this represents
+	Type Type `json:"type"`
+
+	// Name of the quota rule
+	Name string `json:"name"`
+
+	// NamespacePath is the path of the namespace to which this quota is
+	// applicable.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the path of the mount to which this quota is applicable
+	MountPath string `json:"mount_path"`
+
+	// MaxRequestSize is the maximum size in bytes of a request body. A value
+	// of zero leaves request bodies unlimited by the quota rule.
+	MaxRequestSize int64 `json:"max_request_size"`
+
+	// MaxResponseSize is the maximum size in bytes of a response payload. A
+	// value of zero leaves response payloads unlimited by the quota rule.
+	MaxResponseSize int64 `json:"max_response_size"`
+
+	logger     log.Logger
+	metricSink *metricsutil.ClusterMetricSink
+}
+
+// NewRequestSizeQuota creates a quota checker for imposing limits on the size
+// of requests and responses.
+func NewRequestSizeQuota(name, nsPath, mountPath string, maxRequestSize, maxResponseSize int64) *RequestSizeQuota {
+	return &RequestSizeQuota{
+		Name:            name,
+		Type:            TypeRequestSize,
+		NamespacePath:   nsPath,
+		MountPath:       mountPath,
+		MaxRequestSize:  maxRequestSize,
+		MaxResponseSize: maxResponseSize,
+	}
+}
+
+// initialize ensures the namespace and size limits are initialized and sets
+// the ID if it's currently empty.
+func (rsq *RequestSizeQuota) initialize(logger log.Logger, ms *metricsutil.ClusterMetricSink) error {
+	// Memdb requires a non-empty value for indexing
+	if rsq.NamespacePath == "" {
+		rsq.NamespacePath = "root"
+	}
+
+	if rsq.MaxRequestSize < 0 {
+		return fmt.Errorf("invalid max request size: %v", rsq.MaxRequestSize)
+	}
+	if rsq.MaxResponseSize < 0 {
+		return fmt.Errorf("invalid max response size: %v", rsq.MaxResponseSize)
+	}
+	if rsq.MaxRequestSize == 0 && rsq.MaxResponseSize == 0 {
+		return errors.New("at least one of max request size or max response size must be set")
+	}
+
+	if logger != nil {
+		rsq.logger = logger
+	}
+
+	if rsq.metricSink == nil {
+		rsq.metricSink = ms
+	}
+
+	if rsq.ID == "" {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+
+		rsq.ID = id
+	}
+
+	rsq.metricSink.SetGaugeWithLabels([]string{"quota", "request_size", "max_request_size"}, float32(rsq.MaxRequestSize), []metrics.Label{{"name", rsq.Name}})
+	rsq.metricSink.SetGaugeWithLabels([]string{"quota", "request_size", "max_response_size"}, float32(rsq.MaxResponseSize), []metrics.Label{{"name", rsq.Name}})
+
+	return nil
+}
+
+// quotaID returns the identifier of the quota rule
+func (rsq *RequestSizeQuota) quotaID() string {
+	return rsq.ID
+}
+
+// QuotaName returns the name of the quota rule
+func (rsq *RequestSizeQuota) QuotaName() string {
+	return rsq.Name
+}
+
+// allow decides if the request is allowed by the quota. The request size and
+// the response size of the request are each checked against their limit when
+// set, so the same quota rule is applied before a request is handled and again
+// once its response is known.
+func (rsq *RequestSizeQuota) allow(req *Request) (Response, error) {
+	var resp Response
+
+	if rsq.MaxRequestSize > 0 && req.RequestSize > rsq.MaxRequestSize {
+		rsq.metricSink.IncrCounterWithLabels([]string{"quota", "request_size", "violation"}, 1, []metrics.Label{{"name", rsq.Name}, {"kind", "request"}})
+		return resp, nil
+	}
+
+	if rsq.MaxResponseSize > 0 && req.ResponseSize > rsq.MaxResponseSize {
+		rsq.metricSink.IncrCounterWithLabels([]string{"quota", "request_size", "violation"}, 1, []metrics.Label{{"name", rsq.Name}, {"kind", "response"}})
+		return resp, nil
+	}
+
+	resp.Allowed = true
+	return resp, nil
+}
+
+// close is a no-op for request size quotas
+func (rsq *RequestSizeQuota) close() error {
+	return nil
+}
+
+func (rsq *RequestSizeQuota) handleRemount(toPath string) {
+	rsq.MountPath = toPath
+}
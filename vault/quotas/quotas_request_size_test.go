@@ -0,0 +1,55 @@
+package quotas
+
+import (
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/helper/metricsutil"
+	"github.com/quid/vault/sdk/helper/logging"
+)
+
+func TestRequestSizeQuota_Allow(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Trace)
+
+	if err := NewRequestSizeQuota("invalid", "", "", 0, 0).initialize(logger, metricsutil.BlackholeSink()); err == nil {
+		t.Fatal("expected an error without any limit")
+	}
+	if err := NewRequestSizeQuota("invalid", "", "", -1, 10).initialize(logger, metricsutil.BlackholeSink()); err == nil {
+		t.Fatal("expected an error with a negative limit")
+	}
+
+	rsq := NewRequestSizeQuota("test-request-size", "", "secret/", 100, 0)
+	if err := rsq.initialize(logger, metricsutil.BlackholeSink()); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		req     *Request
+		allowed bool
+	}{
+		{"small request", &Request{RequestSize: 50}, true},
+		{"request at the limit", &Request{RequestSize: 100}, true},
+		{"large request", &Request{RequestSize: 101}, false},
+		{"unlimited response", &Request{ResponseSize: 1 << 20}, true},
+	}
+
+	for _, tc := range testCases {
+		resp, err := rsq.allow(tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Allowed != tc.allowed {
+			t.Fatalf("%s: expected allowed to be %t", tc.name, tc.allowed)
+		}
+	}
+
+	rsq.MaxResponseSize = 10
+	resp, err := rsq.allow(&Request{ResponseSize: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Allowed {
+		t.Fatal("expected large response to be rejected")
+	}
+}
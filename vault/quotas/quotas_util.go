@@ -3,63 +3,40 @@
 package quotas
 
 import (
-	"context"
-
-	log "github.com/hashicorp/go-hclog"
-	"github.com/quid/vault/helper/metricsutil"
-
-	memdb "github.com/hashicorp/go-memdb"
+	"sync"
 )
 
 func quotaTypes() []string {
 	return []string{
+		TypeLeaseCount.String(),
 		TypeRateLimit.String(),
+		TypeRequestSize.String(),
 	}
 }
 
-func (m *Manager) init(walkFunc leaseWalkFunc) {}
-
-func (m *Manager) recomputeLeaseCounts(ctx context.Context, txn *memdb.Txn) error {
-	return nil
+func (m *Manager) init(walkFunc leaseWalkFunc) {
+	m.walkFunc = walkFunc
+	m.leasePaths = make(map[string]struct{})
 }
 
 func (m *Manager) setIsPerfStandby(quota Quota) {}
 
-func (m *Manager) inLeasePathCache(path string) bool {
-	return false
-}
-
 type entManager struct {
 	isPerfStandby bool
-}
-
-func (*entManager) Reset() error {
-	return nil
-}
 
-type LeaseCountQuota struct {
-}
-
-func (l LeaseCountQuota) allow(request *Request) (Response, error) {
-	panic("implement me")
-}
-
-func (l LeaseCountQuota) quotaID() string {
-	panic("implement me")
-}
+	// walkFunc walks the leases in the expiration manager to rebuild the
+	// lease count quota counters
+	walkFunc leaseWalkFunc
 
-func (l LeaseCountQuota) QuotaName() string {
-	panic("implement me")
+	// leasePaths holds the request paths that are known to generate leases.
+	// Lease count quotas are only applied to requests on these paths.
+	leasePaths     map[string]struct{}
+	leasePathsLock sync.RWMutex
 }
 
-func (l LeaseCountQuota) initialize(logger log.Logger, sink *metricsutil.ClusterMetricSink) error {
-	panic("implement me")
-}
-
-func (l LeaseCountQuota) close() error {
-	panic("implement me")
-}
-
-func (l LeaseCountQuota) handleRemount(s string) {
-	panic("implement me")
+func (e *entManager) Reset() error {
+	e.leasePathsLock.Lock()
+	defer e.leasePathsLock.Unlock()
+	e.leasePaths = make(map[string]struct{})
+	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,31 +34,67 @@ var (
 	raftTLSStoragePath    = "core/raft/tls"
 	raftTLSRotationPeriod = 24 * time.Hour
 
+	// raftNonVotersStoragePath stores the IDs of the servers that are
+	// non-voters on purpose, which autopilot doesn't promote
+	raftNonVotersStoragePath = "core/raft/non-voters"
+
 	// TestingUpdateClusterAddr is used in tests to override the cluster address
 	TestingUpdateClusterAddr uint32
 )
 
 type raftFollowerStates struct {
 	l         sync.RWMutex
-	followers map[string]uint64
+	followers map[string]*raftFollowerState
+}
+
+// raftFollowerState is the state of a standby node, as of its last heartbeat
+type raftFollowerState struct {
+	AppliedIndex  uint64
+	LastHeartbeat time.Time
 }
 
 func (s *raftFollowerStates) update(nodeID string, appliedIndex uint64) {
 	s.l.Lock()
-	s.followers[nodeID] = appliedIndex
+	if state, ok := s.followers[nodeID]; ok {
+		state.AppliedIndex = appliedIndex
+	} else {
+		s.followers[nodeID] = &raftFollowerState{
+			AppliedIndex: appliedIndex,
+		}
+	}
+	s.l.Unlock()
+}
+func (s *raftFollowerStates) heartbeat(nodeID string, appliedIndex uint64) {
+	s.l.Lock()
+	s.followers[nodeID] = &raftFollowerState{
+		AppliedIndex:  appliedIndex,
+		LastHeartbeat: time.Now(),
+	}
 	s.l.Unlock()
 }
 func (s *raftFollowerStates) delete(nodeID string) {
-	s.l.RLock()
+	s.l.Lock()
 	delete(s.followers, nodeID)
-	s.l.RUnlock()
+	s.l.Unlock()
 }
 func (s *raftFollowerStates) get(nodeID string) uint64 {
 	s.l.RLock()
-	index := s.followers[nodeID]
+	var index uint64
+	if state, ok := s.followers[nodeID]; ok {
+		index = state.AppliedIndex
+	}
 	s.l.RUnlock()
 	return index
 }
+func (s *raftFollowerStates) state(nodeID string) (raftFollowerState, bool) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	state, ok := s.followers[nodeID]
+	if !ok {
+		return raftFollowerState{}, false
+	}
+	return *state, true
+}
 func (s *raftFollowerStates) minIndex() uint64 {
 	var min uint64 = math.MaxUint64
 	minFunc := func(a, b uint64) uint64 {
@@ -68,8 +105,8 @@ func (s *raftFollowerStates) minIndex() uint64 {
 	}
 
 	s.l.RLock()
-	for _, i := range s.followers {
-		min = minFunc(min, i)
+	for _, state := range s.followers {
+		min = minFunc(min, state.AppliedIndex)
 	}
 	s.l.RUnlock()
 
@@ -197,12 +234,73 @@ func (c *Core) startRaftBackend(ctx context.Context) (retErr error) {
 
 func (c *Core) setupRaftActiveNode(ctx context.Context) error {
 	c.pendingRaftPeers = &sync.Map{}
-	return c.startPeriodicRaftTLSRotate(ctx)
+	if err := c.startPeriodicRaftTLSRotate(ctx); err != nil {
+		return err
+	}
+	if err := c.startRaftAutopilot(ctx); err != nil {
+		return err
+	}
+	return c.startRaftAutoSnapshots(ctx)
 }
 
 func (c *Core) stopRaftActiveNode() {
 	c.pendingRaftPeers = nil
+	c.stopRaftAutopilot()
 	c.stopPeriodicRaftTLSRotate()
+	c.stopRaftAutoSnapshots()
+}
+
+// raftNonVoters returns the IDs of the servers that are non-voters on purpose
+func (c *Core) raftNonVoters(ctx context.Context) (map[string]bool, error) {
+	entry, err := c.barrier.Get(ctx, raftNonVotersStoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if entry != nil {
+		if err := entry.DecodeJSON(&ids); err != nil {
+			return nil, err
+		}
+	}
+
+	nonVoters := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		nonVoters[id] = true
+	}
+	return nonVoters, nil
+}
+
+// setRaftNonVoter records whether a server is a non-voter on purpose
+func (c *Core) setRaftNonVoter(ctx context.Context, nodeID string, nonVoter bool) error {
+	c.raftNonVotersLock.Lock()
+	defer c.raftNonVotersLock.Unlock()
+
+	nonVoters, err := c.raftNonVoters(ctx)
+	if err != nil {
+		return err
+	}
+	if nonVoters[nodeID] == nonVoter {
+		return nil
+	}
+
+	if nonVoter {
+		nonVoters[nodeID] = true
+	} else {
+		delete(nonVoters, nodeID)
+	}
+
+	ids := make([]string, 0, len(nonVoters))
+	for id := range nonVoters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	entry, err := logical.StorageEntryJSON(raftNonVotersStoragePath, ids)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(ctx, entry)
 }
 
 func (c *Core) startPeriodicRaftTLSRotate(ctx context.Context) error {
@@ -333,7 +431,7 @@ func (c *Core) raftTLSRotateDirect(ctx context.Context, logger hclog.Logger, sto
 // is allowed for this same reason (max keyring size of 2).
 func (c *Core) raftTLSRotatePhased(ctx context.Context, logger hclog.Logger, raftBackend *raft.RaftBackend, stopCh chan struct{}) error {
 	followerStates := &raftFollowerStates{
-		followers: make(map[string]uint64),
+		followers: make(map[string]*raftFollowerState),
 	}
 
 	// Pre-populate the follower list with the set of peers.
@@ -848,7 +946,7 @@ func (c *Core) JoinRaftCluster(ctx context.Context, leaderInfos []*raft.LeaderJo
 				return err
 			}
 
-			if sealConfig.Type != c.seal.BarrierType() {
+			if !sealTypeCompatible(c.seal, sealConfig.Type) {
 				return fmt.Errorf("mismatching seal types between raft leader (%s) and follower (%s)", sealConfig.Type, c.seal.BarrierType())
 			}
 
@@ -869,7 +967,7 @@ func (c *Core) JoinRaftCluster(ctx context.Context, leaderInfos []*raft.LeaderJo
 				challenge:           eBlob,
 				leaderClient:        apiClient,
 				leaderBarrierConfig: &sealConfig,
-				nonVoter:            nonVoter,
+				nonVoter:            nonVoter || leaderInfo.NonVoter,
 			}
 
 			// If we're using Shamir and using raft for both physical and HA, we
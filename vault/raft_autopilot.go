@@ -0,0 +1,408 @@
+package vault
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/physical/raft"
+	"github.com/quid/vault/sdk/logical"
+)
+
+const (
+	// raftAutopilotConfigPath is the storage path of the autopilot
+	// configuration
+	raftAutopilotConfigPath = "core/raft/autopilot/configuration"
+
+	raftAutopilotStatusLeader   = "leader"
+	raftAutopilotStatusVoter    = "voter"
+	raftAutopilotStatusNonVoter = "non-voter"
+)
+
+// raftAutopilotInterval is the time between two reconciliations of the raft
+// configuration by autopilot
+var raftAutopilotInterval = 5 * time.Second
+
+// raftAutopilotConfig configures how autopilot manages the raft peers
+type raftAutopilotConfig struct {
+	// CleanupDeadServers enables the removal of the servers dead for longer
+	// than DeadServerLastContactThreshold
+	CleanupDeadServers bool `json:"cleanup_dead_servers"`
+
+	// LastContactThreshold is the time since the last heartbeat of a server
+	// after which it is unhealthy
+	LastContactThreshold time.Duration `json:"last_contact_threshold"`
+
+	// DeadServerLastContactThreshold is the time since the last heartbeat of a
+	// server after which it is considered dead
+	DeadServerLastContactThreshold time.Duration `json:"dead_server_last_contact_threshold"`
+
+	// MaxTrailingLogs is the number of log entries a server can trail the
+	// leader by while being healthy
+	MaxTrailingLogs uint64 `json:"max_trailing_logs"`
+
+	// MinQuorum is the number of voters below which dead servers are not
+	// removed
+	MinQuorum int `json:"min_quorum"`
+
+	// ServerStabilizationTime is the time a new server must be healthy for
+	// before it is promoted to a voter
+	ServerStabilizationTime time.Duration `json:"server_stabilization_time"`
+
+	// StageNewServers enables adding the servers joining as voters as
+	// non-voters first, until they are stable
+	StageNewServers bool `json:"stage_new_servers"`
+}
+
+// defaultRaftAutopilotConfig returns the configuration used until it is set,
+// with the minimum quorum being the number of voters of the cluster when
+// autopilot first starts
+func defaultRaftAutopilotConfig(voters int) *raftAutopilotConfig {
+	if voters < 1 {
+		voters = 1
+	}
+
+	return &raftAutopilotConfig{
+		CleanupDeadServers:             false,
+		LastContactThreshold:           10 * time.Second,
+		DeadServerLastContactThreshold: 24 * time.Hour,
+		MaxTrailingLogs:                1000,
+		MinQuorum:                      voters,
+		ServerStabilizationTime:        10 * time.Second,
+		StageNewServers:                false,
+	}
+}
+
+// raftAutopilotState is the health of the raft cluster as seen by autopilot
+type raftAutopilotState struct {
+	Healthy          bool                                 `json:"healthy"`
+	FailureTolerance int                                  `json:"failure_tolerance"`
+	Leader           string                               `json:"leader"`
+	Voters           []string                             `json:"voters"`
+	Servers          map[string]*raftAutopilotServerState `json:"servers"`
+}
+
+// raftAutopilotServerState is the health of a raft peer
+type raftAutopilotServerState struct {
+	ID          string    `json:"id"`
+	Address     string    `json:"address"`
+	Status      string    `json:"status"`
+	Healthy     bool      `json:"healthy"`
+	StableSince time.Time `json:"stable_since"`
+	LastContact string    `json:"last_contact"`
+	LastIndex   uint64    `json:"last_index"`
+
+	// lastHeartbeat is the time of the last heartbeat of the server, or the
+	// time autopilot started if it never sent one
+	lastHeartbeat time.Time
+}
+
+// raftAutopilot promotes the servers that joined the cluster as non-voters
+// once they are stable, and removes the dead servers. It runs on the active
+// node, using the heartbeats of the standbys to track their health.
+type raftAutopilot struct {
+	core           *Core
+	logger         hclog.Logger
+	raftBackend    *raft.RaftBackend
+	followerStates *raftFollowerStates
+	startTime      time.Time
+
+	l      sync.RWMutex
+	config *raftAutopilotConfig
+	state  *raftAutopilotState
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// startRaftAutopilot starts autopilot. It is a no-op unless raft is the storage
+// backend.
+func (c *Core) startRaftAutopilot(ctx context.Context) error {
+	raftBackend, ok := c.underlyingPhysical.(*raft.RaftBackend)
+	if !ok || c.raftFollowerStates == nil {
+		return nil
+	}
+
+	config, err := c.loadRaftAutopilotConfig(ctx, raftBackend)
+	if err != nil {
+		return err
+	}
+
+	autopilot := &raftAutopilot{
+		core:           c,
+		logger:         c.logger.Named("raft.autopilot"),
+		raftBackend:    raftBackend,
+		followerStates: c.raftFollowerStates,
+		startTime:      time.Now(),
+		config:         config,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	c.raftAutopilot = autopilot
+
+	go autopilot.run(ctx)
+
+	return nil
+}
+
+// stopRaftAutopilot stops autopilot, waiting for a reconciliation in progress
+func (c *Core) stopRaftAutopilot() {
+	if c.raftAutopilot == nil {
+		return
+	}
+
+	close(c.raftAutopilot.stopCh)
+	<-c.raftAutopilot.doneCh
+	c.raftAutopilot = nil
+}
+
+// loadRaftAutopilotConfig reads the autopilot configuration. The first time
+// autopilot starts, the default configuration is stored, so that its minimum
+// quorum remains the size of the cluster at that time.
+func (c *Core) loadRaftAutopilotConfig(ctx context.Context, raftBackend *raft.RaftBackend) (*raftAutopilotConfig, error) {
+	entry, err := c.barrier.Get(ctx, raftAutopilotConfigPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read autopilot configuration: {{err}}", err)
+	}
+	if entry != nil {
+		config := defaultRaftAutopilotConfig(1)
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, errwrap.Wrapf("failed to decode autopilot configuration: {{err}}", err)
+		}
+		return config, nil
+	}
+
+	raftConfig, err := raftBackend.GetConfiguration(ctx)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read the raft configuration: {{err}}", err)
+	}
+	voters := 0
+	for _, server := range raftConfig.Servers {
+		if server.Voter {
+			voters++
+		}
+	}
+
+	config := defaultRaftAutopilotConfig(voters)
+	entry, err = logical.StorageEntryJSON(raftAutopilotConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.barrier.Put(ctx, entry); err != nil {
+		return nil, errwrap.Wrapf("failed to store autopilot configuration: {{err}}", err)
+	}
+	return config, nil
+}
+
+// setConfig persists a new configuration, used from the next reconciliation
+func (a *raftAutopilot) setConfig(ctx context.Context, config *raftAutopilotConfig) error {
+	entry, err := logical.StorageEntryJSON(raftAutopilotConfigPath, config)
+	if err != nil {
+		return err
+	}
+	if err := a.core.barrier.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	a.l.Lock()
+	a.config = config
+	a.l.Unlock()
+	return nil
+}
+
+func (a *raftAutopilot) getConfig() *raftAutopilotConfig {
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	config := *a.config
+	return &config
+}
+
+// getState returns the state computed by the last reconciliation, nil until the
+// first one
+func (a *raftAutopilot) getState() *raftAutopilotState {
+	a.l.RLock()
+	defer a.l.RUnlock()
+	return a.state
+}
+
+func (a *raftAutopilot) run(ctx context.Context) {
+	defer close(a.doneCh)
+
+	ticker := time.NewTicker(raftAutopilotInterval)
+	defer ticker.Stop()
+
+	a.reconcile(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			a.reconcile(ctx)
+		case <-a.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcile updates the state of the servers, then promotes the stable
+// non-voters and removes the dead servers
+func (a *raftAutopilot) reconcile(ctx context.Context) {
+	raftConfig, err := a.raftBackend.GetConfiguration(ctx)
+	if err != nil {
+		a.logger.Error("failed to read the raft configuration", "error", err)
+		return
+	}
+
+	config := a.getConfig()
+	now := time.Now()
+
+	a.l.Lock()
+	a.state = a.updateState(config, a.state, raftConfig, a.raftBackend.AppliedIndex(), now)
+	state := a.state
+	a.l.Unlock()
+
+	nonVoters, err := a.core.raftNonVoters(ctx)
+	if err != nil {
+		a.logger.Error("failed to read the raft non-voters", "error", err)
+		return
+	}
+
+	promote, remove := a.plan(config, state, nonVoters, now)
+
+	for _, id := range promote {
+		server := state.Servers[id]
+		a.logger.Info("promoting stable server to voter", "node_id", id)
+		if err := a.raftBackend.AddPeer(ctx, id, server.Address); err != nil {
+			a.logger.Error("failed to promote server", "node_id", id, "error", err)
+		}
+	}
+
+	for _, id := range remove {
+		a.logger.Info("removing dead server", "node_id", id, "last_contact", state.Servers[id].LastContact)
+		if err := a.raftBackend.RemovePeer(ctx, id); err != nil {
+			a.logger.Error("failed to remove dead server", "node_id", id, "error", err)
+			continue
+		}
+		a.followerStates.delete(id)
+	}
+}
+
+// updateState computes the health of the servers of the raft configuration
+// from the heartbeats of the standbys. A server is healthy if it sent a
+// heartbeat recently and doesn't trail the leader by too many log entries.
+func (a *raftAutopilot) updateState(config *raftAutopilotConfig, prev *raftAutopilotState, raftConfig *raft.RaftConfigurationResponse, leaderIndex uint64, now time.Time) *raftAutopilotState {
+	state := &raftAutopilotState{
+		Healthy: true,
+		Servers: make(map[string]*raftAutopilotServerState, len(raftConfig.Servers)),
+	}
+
+	healthyVoters := 0
+	for _, server := range raftConfig.Servers {
+		serverState := &raftAutopilotServerState{
+			ID:      server.NodeID,
+			Address: server.Address,
+			Status:  raftAutopilotStatusNonVoter,
+		}
+		if server.Voter {
+			serverState.Status = raftAutopilotStatusVoter
+		}
+
+		if server.Leader {
+			state.Leader = server.NodeID
+			serverState.Status = raftAutopilotStatusLeader
+			serverState.Healthy = true
+			serverState.LastIndex = leaderIndex
+			serverState.lastHeartbeat = now
+		} else {
+			serverState.lastHeartbeat = a.startTime
+			if follower, ok := a.followerStates.state(server.NodeID); ok {
+				serverState.LastIndex = follower.AppliedIndex
+				if !follower.LastHeartbeat.IsZero() {
+					serverState.lastHeartbeat = follower.LastHeartbeat
+				}
+			}
+
+			trailingLogs := uint64(0)
+			if leaderIndex > serverState.LastIndex {
+				trailingLogs = leaderIndex - serverState.LastIndex
+			}
+			serverState.Healthy = serverState.LastIndex > 0 &&
+				now.Sub(serverState.lastHeartbeat) <= config.LastContactThreshold &&
+				trailingLogs <= config.MaxTrailingLogs
+		}
+		serverState.LastContact = now.Sub(serverState.lastHeartbeat).Truncate(time.Millisecond).String()
+
+		// Keep the time since which the server has had the same health
+		serverState.StableSince = now
+		if prev != nil {
+			if prevState, ok := prev.Servers[server.NodeID]; ok && prevState.Healthy == serverState.Healthy {
+				serverState.StableSince = prevState.StableSince
+			}
+		}
+
+		if !serverState.Healthy {
+			state.Healthy = false
+		}
+		if server.Voter {
+			state.Voters = append(state.Voters, server.NodeID)
+			if serverState.Healthy {
+				healthyVoters++
+			}
+		}
+
+		state.Servers[server.NodeID] = serverState
+	}
+	sort.Strings(state.Voters)
+
+	// The cluster can lose the healthy voters beyond the quorum
+	quorum := len(state.Voters)/2 + 1
+	if healthyVoters < quorum {
+		state.Healthy = false
+	} else {
+		state.FailureTolerance = healthyVoters - quorum
+	}
+
+	return state
+}
+
+// plan returns the non-voters to promote, those that were healthy for the
+// stabilization time unless they are non-voters on purpose, and the servers to
+// remove, those dead for longer than the dead server threshold. Voters are not
+// removed below the minimum quorum.
+func (a *raftAutopilot) plan(config *raftAutopilotConfig, state *raftAutopilotState, nonVoters map[string]bool, now time.Time) (promote []string, remove []string) {
+	voters := len(state.Voters)
+
+	ids := make([]string, 0, len(state.Servers))
+	for id := range state.Servers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		server := state.Servers[id]
+		switch {
+		case server.Status == raftAutopilotStatusLeader:
+
+		case server.Healthy:
+			if server.Status == raftAutopilotStatusNonVoter && !nonVoters[id] && now.Sub(server.StableSince) >= config.ServerStabilizationTime {
+				promote = append(promote, id)
+			}
+
+		case config.CleanupDeadServers && now.Sub(server.lastHeartbeat) > config.DeadServerLastContactThreshold:
+			if server.Status == raftAutopilotStatusVoter {
+				if voters-1 < config.MinQuorum {
+					a.logger.Warn("not removing dead server, the cluster would fall below the minimum quorum", "node_id", id, "min_quorum", config.MinQuorum)
+					continue
+				}
+				voters--
+			}
+			remove = append(remove, id)
+		}
+	}
+
+	return promote, remove
+}
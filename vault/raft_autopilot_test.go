@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/physical/raft"
+	"github.com/quid/vault/sdk/helper/logging"
+)
+
+func TestRaftAutopilot_Plan(t *testing.T) {
+	now := time.Now()
+	followerStates := &raftFollowerStates{
+		followers: make(map[string]*raftFollowerState),
+	}
+	autopilot := &raftAutopilot{
+		logger:         logging.NewVaultLogger(log.Trace),
+		followerStates: followerStates,
+		startTime:      now.Add(-48 * time.Hour),
+	}
+
+	raftConfig := &raft.RaftConfigurationResponse{
+		Servers: []*raft.RaftServer{
+			{NodeID: "core-0", Address: "127.0.0.1:8201", Leader: true, Voter: true},
+			{NodeID: "core-1", Address: "127.0.0.1:8202", Voter: true},
+			{NodeID: "core-2", Address: "127.0.0.1:8203", Voter: true},
+			{NodeID: "core-3", Address: "127.0.0.1:8204", Voter: true},
+			{NodeID: "core-4", Address: "127.0.0.1:8205"},
+			{NodeID: "core-5", Address: "127.0.0.1:8206"},
+		},
+	}
+
+	// core-3 never sent a heartbeat, and core-5 is far behind the leader
+	followerStates.heartbeat("core-1", 5000)
+	followerStates.heartbeat("core-2", 4990)
+	followerStates.heartbeat("core-4", 5000)
+	followerStates.heartbeat("core-5", 10)
+
+	config := defaultRaftAutopilotConfig(3)
+	config.CleanupDeadServers = true
+
+	state := autopilot.updateState(config, nil, raftConfig, 5000, now)
+	if state.Leader != "core-0" {
+		t.Fatalf("bad leader: %q", state.Leader)
+	}
+	if expected := []string{"core-0", "core-1", "core-2", "core-3"}; !reflect.DeepEqual(state.Voters, expected) {
+		t.Fatalf("bad voters: %v", state.Voters)
+	}
+	for id, healthy := range map[string]bool{
+		"core-0": true,
+		"core-1": true,
+		"core-2": true,
+		"core-3": false,
+		"core-4": true,
+		"core-5": false,
+	} {
+		if state.Servers[id].Healthy != healthy {
+			t.Fatalf("expected %s healthy to be %t", id, healthy)
+		}
+	}
+	if state.Healthy {
+		t.Fatal("expected the cluster to be unhealthy")
+	}
+	if state.FailureTolerance != 0 {
+		t.Fatalf("bad failure tolerance: %d", state.FailureTolerance)
+	}
+
+	// Nothing is stable yet, but core-3 has been dead since autopilot started
+	promote, remove := autopilot.plan(config, state, nil, now)
+	if len(promote) != 0 {
+		t.Fatalf("expected no promotion: %v", promote)
+	}
+	if expected := []string{"core-3"}; !reflect.DeepEqual(remove, expected) {
+		t.Fatalf("bad removals: %v", remove)
+	}
+
+	// core-4 is promoted once it was healthy for the stabilization time
+	later := now.Add(config.ServerStabilizationTime)
+	followerStates.heartbeat("core-1", 5000)
+	followerStates.heartbeat("core-2", 5000)
+	followerStates.heartbeat("core-4", 5000)
+	state = autopilot.updateState(config, state, raftConfig, 5000, later)
+	if !state.Servers["core-4"].StableSince.Equal(now) {
+		t.Fatalf("bad stable since: %v", state.Servers["core-4"].StableSince)
+	}
+	promote, _ = autopilot.plan(config, state, nil, later)
+	if expected := []string{"core-4"}; !reflect.DeepEqual(promote, expected) {
+		t.Fatalf("bad promotions: %v", promote)
+	}
+
+	// Servers that are non-voters on purpose are never promoted
+	promote, _ = autopilot.plan(config, state, map[string]bool{"core-4": true}, later)
+	if len(promote) != 0 {
+		t.Fatalf("expected no promotion: %v", promote)
+	}
+
+	// Dead voters aren't removed below the minimum quorum
+	config.MinQuorum = 4
+	_, remove = autopilot.plan(config, state, nil, later)
+	if len(remove) != 0 {
+		t.Fatalf("expected no removal: %v", remove)
+	}
+}
@@ -0,0 +1,434 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/physical/raft"
+	"github.com/quid/vault/sdk/logical"
+)
+
+const (
+	// raftAutoSnapshotConfigPath is the storage prefix of the automated
+	// snapshot configurations
+	raftAutoSnapshotConfigPath = "core/raft/snapshot-auto/config/"
+
+	// raftAutoSnapshotStatusPath is the storage prefix of the status of the
+	// automated snapshots, kept in storage so that it survives leadership
+	// changes
+	raftAutoSnapshotStatusPath = "core/raft/snapshot-auto/status/"
+
+	raftAutoSnapshotLocalStorage = "local"
+
+	raftAutoSnapshotDefaultFileNameTemplate = "vault-snapshot-{{.Name}}-{{.Timestamp}}.snap"
+
+	// raftAutoSnapshotTimestampFormat is the format of the Timestamp field of
+	// the file name templates, which sorts chronologically
+	raftAutoSnapshotTimestampFormat = "20060102T150405Z"
+)
+
+// RaftSnapshotTarget stores the snapshots taken automatically by the active
+// node.
+type RaftSnapshotTarget interface {
+	// Write stores a snapshot under the given name
+	Write(ctx context.Context, name string, snap io.Reader) error
+
+	// Delete removes a snapshot previously written, once it is beyond the
+	// number of snapshots to retain
+	Delete(ctx context.Context, name string) error
+}
+
+// RaftSnapshotTargetFactory creates the snapshot target of an automated
+// snapshot configuration, from its path prefix and its storage config.
+type RaftSnapshotTargetFactory func(ctx context.Context, pathPrefix string, config map[string]string) (RaftSnapshotTarget, error)
+
+// raftAutoSnapshotConfig configures snapshots taken on an interval
+type raftAutoSnapshotConfig struct {
+	Name             string            `json:"name"`
+	Interval         time.Duration     `json:"interval"`
+	Retain           int               `json:"retain"`
+	StorageType      string            `json:"storage_type"`
+	PathPrefix       string            `json:"path_prefix"`
+	FileNameTemplate string            `json:"file_name_template"`
+	StorageConfig    map[string]string `json:"storage_config"`
+}
+
+// raftAutoSnapshotStatus reports on the snapshots of a configuration
+type raftAutoSnapshotStatus struct {
+	LastAttemptTime     time.Time `json:"last_attempt_time"`
+	LastSuccessTime     time.Time `json:"last_success_time"`
+	LastSnapshotName    string    `json:"last_snapshot_name"`
+	LastFailureTime     time.Time `json:"last_failure_time"`
+	LastError           string    `json:"last_error"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+
+	// Snapshots are the names of the retained snapshots, oldest first
+	Snapshots []string `json:"snapshots"`
+}
+
+// raftAutoSnapshotFileName holds the fields of the file name templates
+type raftAutoSnapshotFileName struct {
+	Name      string
+	Timestamp string
+	Unix      int64
+	Index     uint64
+}
+
+// fileName renders the file name template of the configuration
+func (config *raftAutoSnapshotConfig) fileName(now time.Time, index uint64) (string, error) {
+	tpl, err := template.New("file_name").Option("missingkey=error").Parse(config.FileNameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &raftAutoSnapshotFileName{
+		Name:      config.Name,
+		Timestamp: now.UTC().Format(raftAutoSnapshotTimestampFormat),
+		Unix:      now.Unix(),
+		Index:     index,
+	}); err != nil {
+		return "", err
+	}
+
+	name := buf.String()
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid snapshot file name %q", name)
+	}
+	return name, nil
+}
+
+// localRaftSnapshotTarget writes the snapshots to a local directory of the
+// active node
+type localRaftSnapshotTarget struct {
+	dir string
+}
+
+func newLocalRaftSnapshotTarget(_ context.Context, pathPrefix string, _ map[string]string) (RaftSnapshotTarget, error) {
+	if pathPrefix == "" {
+		return nil, errors.New("path_prefix is required for local snapshots")
+	}
+	return &localRaftSnapshotTarget{
+		dir: pathPrefix,
+	}, nil
+}
+
+// Write writes the snapshot to a temporary file first, so that a partial
+// snapshot never has the name of a complete one
+func (t *localRaftSnapshotTarget) Write(_ context.Context, name string, snap io.Reader) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(t.dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+}
+
+func (t *localRaftSnapshotTarget) Delete(_ context.Context, name string) error {
+	err := os.Remove(filepath.Join(t.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// raftAutoSnapshots runs the automated snapshot configurations on the active
+// node, each in its own goroutine
+type raftAutoSnapshots struct {
+	core   *Core
+	ctx    context.Context
+	logger hclog.Logger
+
+	l       sync.Mutex
+	stopChs map[string]chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startRaftAutoSnapshots schedules the automated snapshots. It is a no-op
+// unless raft is the storage backend.
+func (c *Core) startRaftAutoSnapshots(ctx context.Context) error {
+	if _, ok := c.underlyingPhysical.(*raft.RaftBackend); !ok {
+		return nil
+	}
+
+	snapshots := &raftAutoSnapshots{
+		core:    c,
+		ctx:     ctx,
+		logger:  c.logger.Named("raft.snapshot-auto"),
+		stopChs: make(map[string]chan struct{}),
+	}
+
+	names, err := c.barrier.List(ctx, raftAutoSnapshotConfigPath)
+	if err != nil {
+		return errwrap.Wrapf("failed to list automated snapshot configurations: {{err}}", err)
+	}
+	for _, name := range names {
+		config, err := c.raftAutoSnapshotConfig(ctx, name)
+		if err != nil {
+			return err
+		}
+		if config != nil {
+			snapshots.schedule(config)
+		}
+	}
+
+	c.raftAutoSnapshots = snapshots
+	return nil
+}
+
+// stopRaftAutoSnapshots stops the automated snapshots, waiting for those in
+// progress
+func (c *Core) stopRaftAutoSnapshots() {
+	if c.raftAutoSnapshots == nil {
+		return
+	}
+
+	snapshots := c.raftAutoSnapshots
+	c.raftAutoSnapshots = nil
+
+	snapshots.l.Lock()
+	for name, stopCh := range snapshots.stopChs {
+		close(stopCh)
+		delete(snapshots.stopChs, name)
+	}
+	snapshots.l.Unlock()
+
+	snapshots.wg.Wait()
+}
+
+// schedule starts taking the snapshots of a configuration, replacing the
+// previous schedule of a configuration with the same name
+func (s *raftAutoSnapshots) schedule(config *raftAutoSnapshotConfig) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if stopCh, ok := s.stopChs[config.Name]; ok {
+		close(stopCh)
+	}
+	stopCh := make(chan struct{})
+	s.stopChs[config.Name] = stopCh
+
+	s.wg.Add(1)
+	go s.run(config, stopCh)
+}
+
+// unschedule stops taking the snapshots of a configuration
+func (s *raftAutoSnapshots) unschedule(name string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if stopCh, ok := s.stopChs[name]; ok {
+		close(stopCh)
+		delete(s.stopChs, name)
+	}
+}
+
+func (s *raftAutoSnapshots) run(config *raftAutoSnapshotConfig, stopCh chan struct{}) {
+	defer s.wg.Done()
+
+	// Keep the interval across leadership changes and configuration updates
+	next := time.Now().Add(config.Interval)
+	status, err := s.core.raftAutoSnapshotStatus(s.ctx, config.Name)
+	if err != nil {
+		s.logger.Error("failed to read the automated snapshot status", "name", config.Name, "error", err)
+	}
+	if status != nil && !status.LastAttemptTime.IsZero() {
+		next = status.LastAttemptTime.Add(config.Interval)
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		s.snapshot(config)
+		next = time.Now().Add(config.Interval)
+	}
+}
+
+// snapshot takes a snapshot of a configuration, removes the snapshots beyond
+// the ones to retain and records the outcome in the status
+func (s *raftAutoSnapshots) snapshot(config *raftAutoSnapshotConfig) {
+	start := time.Now()
+	labels := []metrics.Label{{"name", config.Name}}
+	defer s.core.MetricSink().MeasureSinceWithLabels([]string{"raft", "snapshot_auto", "duration"}, start, labels)
+
+	status, err := s.core.raftAutoSnapshotStatus(s.ctx, config.Name)
+	if err != nil {
+		s.logger.Error("failed to read the automated snapshot status", "name", config.Name, "error", err)
+	}
+	if status == nil {
+		status = new(raftAutoSnapshotStatus)
+	}
+	status.LastAttemptTime = start
+
+	name, err := s.write(config, start)
+	if err != nil {
+		s.logger.Error("failed to take automated snapshot", "name", config.Name, "error", err)
+		s.core.MetricSink().IncrCounterWithLabels([]string{"raft", "snapshot_auto", "failure"}, 1, labels)
+
+		status.LastFailureTime = start
+		status.LastError = err.Error()
+		status.ConsecutiveFailures++
+	} else {
+		s.logger.Info("took automated snapshot", "name", config.Name, "snapshot", name)
+		s.core.MetricSink().IncrCounterWithLabels([]string{"raft", "snapshot_auto", "success"}, 1, labels)
+
+		status.LastSuccessTime = start
+		status.LastSnapshotName = name
+		status.ConsecutiveFailures = 0
+		status.Snapshots = append(status.Snapshots, name)
+
+		status.Snapshots = s.removeOldSnapshots(config, status.Snapshots)
+	}
+
+	entry, err := logical.StorageEntryJSON(raftAutoSnapshotStatusPath+config.Name, status)
+	if err == nil {
+		err = s.core.barrier.Put(s.ctx, entry)
+	}
+	if err != nil {
+		s.logger.Error("failed to write the automated snapshot status", "name", config.Name, "error", err)
+	}
+}
+
+// write takes a snapshot and writes it to the target of the configuration,
+// returning its name
+func (s *raftAutoSnapshots) write(config *raftAutoSnapshotConfig, now time.Time) (string, error) {
+	raftBackend, ok := s.core.underlyingPhysical.(*raft.RaftBackend)
+	if !ok {
+		return "", errors.New("raft storage is not in use")
+	}
+
+	target, err := s.core.raftSnapshotTarget(s.ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := config.fileName(now, raftBackend.AppliedIndex())
+	if err != nil {
+		return "", err
+	}
+
+	// Stream the snapshot to the target rather than holding it in memory
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(raftBackend.SnapshotToWriter(pw, s.core.seal.GetAccess()))
+	}()
+
+	err = target.Write(s.ctx, name, pr)
+
+	// Unblock the snapshot if the target stopped reading early
+	pr.Close()
+
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// removeOldSnapshots deletes the oldest snapshots beyond the ones to retain,
+// returning the snapshots that are left. A snapshot that fails to be deleted is
+// kept so that it is tried again after the next snapshot.
+func (s *raftAutoSnapshots) removeOldSnapshots(config *raftAutoSnapshotConfig, snapshots []string) []string {
+	if len(snapshots) <= config.Retain {
+		return snapshots
+	}
+
+	target, err := s.core.raftSnapshotTarget(s.ctx, config)
+	if err != nil {
+		s.logger.Error("failed to remove old automated snapshots", "name", config.Name, "error", err)
+		return snapshots
+	}
+
+	for len(snapshots) > config.Retain {
+		if err := target.Delete(s.ctx, snapshots[0]); err != nil {
+			s.logger.Error("failed to remove old automated snapshot", "name", config.Name, "snapshot", snapshots[0], "error", err)
+			break
+		}
+		snapshots = snapshots[1:]
+	}
+	return snapshots
+}
+
+// raftSnapshotTarget creates the target of an automated snapshot
+// configuration
+func (c *Core) raftSnapshotTarget(ctx context.Context, config *raftAutoSnapshotConfig) (RaftSnapshotTarget, error) {
+	factory, ok := c.raftSnapshotTargets[config.StorageType]
+	if !ok {
+		return nil, fmt.Errorf("unknown snapshot storage type %q", config.StorageType)
+	}
+	return factory(ctx, config.PathPrefix, config.StorageConfig)
+}
+
+// raftAutoSnapshotConfig reads an automated snapshot configuration, returning
+// nil if it doesn't exist
+func (c *Core) raftAutoSnapshotConfig(ctx context.Context, name string) (*raftAutoSnapshotConfig, error) {
+	entry, err := c.barrier.Get(ctx, raftAutoSnapshotConfigPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var config raftAutoSnapshotConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// raftAutoSnapshotStatus reads the status of an automated snapshot
+// configuration, returning nil if no snapshot was attempted
+func (c *Core) raftAutoSnapshotStatus(ctx context.Context, name string) (*raftAutoSnapshotStatus, error) {
+	entry, err := c.barrier.Get(ctx, raftAutoSnapshotStatusPath+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var status raftAutoSnapshotStatus
+	if err := entry.DecodeJSON(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
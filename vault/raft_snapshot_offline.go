@@ -0,0 +1,274 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	aeadwrapper "github.com/hashicorp/go-kms-wrapping/wrappers/aead"
+	raftlib "github.com/hashicorp/raft"
+	"github.com/quid/vault/physical/raft"
+	"github.com/quid/vault/sdk/helper/jsonutil"
+	"github.com/quid/vault/sdk/logical"
+	"github.com/quid/vault/sdk/physical"
+	"github.com/quid/vault/sdk/physical/inmem"
+	"github.com/quid/vault/sdk/plugin/pb"
+	"github.com/quid/vault/shamir"
+	vaultseal "github.com/quid/vault/vault/seal"
+)
+
+// RaftSnapshotData holds the storage entries of a raft snapshot read outside of
+// a running cluster. The entries are kept in memory, encrypted. Once unsealed
+// with the unseal keys of the cluster the snapshot was taken from, the data of
+// the mounts can be read through the barrier.
+type RaftSnapshotData struct {
+	Metadata *raftlib.SnapshotMeta
+
+	storage physical.Backend
+	barrier *AESGCMBarrier
+}
+
+// SnapshotMount is a mount found in the mount tables of a snapshot
+type SnapshotMount struct {
+	// Path is the path of the mount, prefixed with "auth/" for auth methods
+	Path string
+	Type string
+	UUID string
+
+	// Prefix is the storage prefix of the data of the mount, logical/<uuid>/
+	// for secret engines and auth/<uuid>/ for auth methods
+	Prefix string
+}
+
+// LoadRaftSnapshot reads a snapshot archive into memory
+func LoadRaftSnapshot(ctx context.Context, logger log.Logger, in io.Reader) (*RaftSnapshotData, error) {
+	storage, err := inmem.NewInmem(nil, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := raft.ReadSnapshot(logger, in, func(entry *pb.StorageEntry) error {
+		return storage.Put(ctx, &physical.Entry{
+			Key:   entry.Key,
+			Value: entry.Value,
+		})
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read snapshot: {{err}}", err)
+	}
+
+	barrier, err := NewAESGCMBarrier(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RaftSnapshotData{
+		Metadata: metadata,
+		storage:  storage,
+		barrier:  barrier,
+	}, nil
+}
+
+// SealConfig returns the seal configuration of the cluster the snapshot was
+// taken from
+func (s *RaftSnapshotData) SealConfig(ctx context.Context) (*SealConfig, error) {
+	pe, err := s.storage.Get(ctx, barrierSealConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if pe == nil {
+		return nil, errors.New("snapshot has no seal configuration, the cluster was not initialized")
+	}
+
+	var config SealConfig
+	if err := jsonutil.DecodeJSON(pe.Value, &config); err != nil {
+		return nil, errwrap.Wrapf("failed to decode seal configuration: {{err}}", err)
+	}
+	if config.Type == "" {
+		config.Type = wrapping.Shamir
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errwrap.Wrapf("invalid seal configuration: {{err}}", err)
+	}
+
+	return &config, nil
+}
+
+// Unseal combines the hex or base64 encoded unseal keys into the master key,
+// and unseals the barrier with it. Only snapshots of clusters using the Shamir
+// seal can be unsealed with unseal keys: with an auto-unseal the master key is
+// encrypted by the seal, and the recovery keys can't decrypt it, see
+// UnsealWithSeal.
+func (s *RaftSnapshotData) Unseal(ctx context.Context, unsealKeys []string) error {
+	config, err := s.SealConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config.Type != wrapping.Shamir {
+		return fmt.Errorf("snapshot was taken from a cluster using the %q seal, it can only be unsealed with that seal", config.Type)
+	}
+	if len(unsealKeys) < config.SecretThreshold {
+		return fmt.Errorf("%d unseal keys are required, got %d", config.SecretThreshold, len(unsealKeys))
+	}
+
+	min, max := s.barrier.KeyLength()
+	max += shamir.ShareOverhead
+
+	parts := make([][]byte, 0, len(unsealKeys))
+	for _, unsealKey := range unsealKeys {
+		// We check min and max here to ensure that a string that is base64
+		// encoded but also valid hex will not be valid and we instead base64
+		// decode it
+		key, err := hex.DecodeString(unsealKey)
+		if err != nil || len(key) < min || len(key) > max {
+			key, err = base64.StdEncoding.DecodeString(unsealKey)
+			if err != nil {
+				return errors.New("unseal keys must be valid hex or base64 strings")
+			}
+		}
+		parts = append(parts, key)
+	}
+
+	var recoveredKey []byte
+	if config.SecretThreshold == 1 {
+		recoveredKey = parts[0]
+	} else {
+		recoveredKey, err = shamir.Combine(parts)
+		if err != nil {
+			return errwrap.Wrapf("failed to compute master key: {{err}}", err)
+		}
+	}
+
+	// With a legacy Shamir seal the combined key is the master key, otherwise
+	// it is the key of the seal, which decrypts the stored master key
+	masterKey := recoveredKey
+	if config.StoredShares > 0 {
+		wrapper := aeadwrapper.NewShamirWrapper(&wrapping.WrapperOptions{
+			Logger: log.NewNullLogger(),
+		})
+		if err := wrapper.SetAESGCMKeyBytes(recoveredKey); err != nil {
+			return errwrap.Wrapf("failed to set the key of the seal: {{err}}", err)
+		}
+
+		storedKeys, err := readStoredKeys(ctx, s.storage, &vaultseal.Access{Wrapper: wrapper})
+		if err != nil {
+			return errwrap.Wrapf("failed to decrypt the master key, possibly the unseal keys don't belong to the snapshot: {{err}}", err)
+		}
+		if len(storedKeys) == 0 {
+			return errors.New("shamir seal with stored keys configured but no stored keys found")
+		}
+		masterKey = storedKeys[0]
+	}
+
+	if err := s.barrier.Unseal(ctx, masterKey); err != nil {
+		return errwrap.Wrapf("failed to unseal the snapshot: {{err}}", err)
+	}
+	return nil
+}
+
+// UnsealWithSeal decrypts the stored master key with the auto-unseal of the
+// cluster the snapshot was taken from, and unseals the barrier with it. The
+// wrapper must be initialized.
+func (s *RaftSnapshotData) UnsealWithSeal(ctx context.Context, wrapper wrapping.Wrapper) error {
+	config, err := s.SealConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config.Type == wrapping.Shamir {
+		return errors.New("snapshot was taken from a cluster using the Shamir seal, it can only be unsealed with unseal keys")
+	}
+	if config.Type != wrapper.Type() {
+		return fmt.Errorf("snapshot was taken from a cluster using the %q seal, got a %q seal", config.Type, wrapper.Type())
+	}
+
+	storedKeys, err := readStoredKeys(ctx, s.storage, &vaultseal.Access{Wrapper: wrapper})
+	if err != nil {
+		return errwrap.Wrapf("failed to decrypt the master key, possibly the seal doesn't belong to the snapshot: {{err}}", err)
+	}
+	if len(storedKeys) == 0 {
+		return errors.New("auto-unseal configured but no stored keys found")
+	}
+
+	if err := s.barrier.Unseal(ctx, storedKeys[0]); err != nil {
+		return errwrap.Wrapf("failed to unseal the snapshot: {{err}}", err)
+	}
+	return nil
+}
+
+// Mount returns the mount of the snapshot with the given path or UUID. The
+// paths of auth methods are prefixed with "auth/".
+func (s *RaftSnapshotData) Mount(ctx context.Context, pathOrUUID string) (*SnapshotMount, error) {
+	tables := []struct {
+		storagePath string
+		pathPrefix  string
+		prefix      string
+	}{
+		{coreMountConfigPath, "", backendBarrierPrefix},
+		{coreLocalMountConfigPath, "", backendBarrierPrefix},
+		{coreAuthConfigPath, credentialRoutePrefix, credentialBarrierPrefix},
+		{coreLocalAuthConfigPath, credentialRoutePrefix, credentialBarrierPrefix},
+	}
+
+	path := strings.TrimSuffix(pathOrUUID, "/") + "/"
+	for _, table := range tables {
+		raw, err := s.barrier.Get(ctx, table.storagePath)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to read %q: {{err}}", table.storagePath), err)
+		}
+		if raw == nil {
+			continue
+		}
+
+		var mountTable MountTable
+		if err := jsonutil.DecodeJSON(raw.Value, &mountTable); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to decode %q: {{err}}", table.storagePath), err)
+		}
+
+		for _, entry := range mountTable.Entries {
+			if table.pathPrefix+entry.Path != path && entry.UUID != pathOrUUID {
+				continue
+			}
+			return &SnapshotMount{
+				Path:   table.pathPrefix + entry.Path,
+				Type:   entry.Type,
+				UUID:   entry.UUID,
+				Prefix: table.prefix + entry.UUID + "/",
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no mount found at %q in the snapshot", pathOrUUID)
+}
+
+// ReadMount calls fn for each of the decrypted entries of a mount, with their
+// keys relative to the storage prefix of the mount
+func (s *RaftSnapshotData) ReadMount(ctx context.Context, mount *SnapshotMount, fn func(*logical.StorageEntry) error) error {
+	view := NewBarrierView(s.barrier, mount.Prefix)
+
+	keys, err := logical.CollectKeys(ctx, view)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		entry, err := view.Get(ctx, key)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to read %q: {{err}}", mount.Prefix+key), err)
+		}
+		if entry == nil {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
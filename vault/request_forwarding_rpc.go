@@ -73,7 +73,7 @@ func (s *forwardedRequestRPCServer) Echo(ctx context.Context, in *EchoRequest) (
 	}
 
 	if in.RaftAppliedIndex > 0 && len(in.RaftNodeID) > 0 && s.raftFollowerStates != nil {
-		s.raftFollowerStates.update(in.RaftNodeID, in.RaftAppliedIndex)
+		s.raftFollowerStates.heartbeat(in.RaftNodeID, in.RaftAppliedIndex)
 	}
 
 	reply := &EchoReply{
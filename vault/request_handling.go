@@ -229,7 +229,10 @@ func (c *Core) fetchACLTokenEntryAndEntity(ctx context.Context, req *logical.Req
 	return acl, te, entity, identityPolicies, nil
 }
 
-func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool) (*logical.Auth, *logical.TokenEntry, error) {
+// checkToken validates the token on the request and checks it against the
+// policies that apply. If the rule that allowed a list request asks for the
+// results to be filtered, the ACL to filter them with is also returned.
+func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool) (*logical.Auth, *logical.TokenEntry, *ACL, error) {
 	defer metrics.MeasureSince([]string{"core", "check_token"}, time.Now())
 
 	var acl *ACL
@@ -247,36 +250,39 @@ func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool
 		// unauth, we just have no information to attach to the request, so
 		// ignore errors...this was best-effort anyways
 		if err != nil && !unauth {
-			return nil, te, err
+			return nil, te, nil, err
 		}
 	}
 
 	if entity != nil && entity.Disabled {
 		c.logger.Warn("permission denied as the entity on the token is disabled")
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, nil, logical.ErrPermissionDenied
 	}
 	if te != nil && te.EntityID != "" && entity == nil {
 		if c.perfStandby {
-			return nil, nil, logical.ErrPerfStandbyPleaseForward
+			return nil, nil, nil, logical.ErrPerfStandbyPleaseForward
 		}
 		c.logger.Warn("permission denied as the entity on the token is invalid")
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, nil, logical.ErrPermissionDenied
 	}
 
 	// Check if this is a root protected path
 	rootPath := c.router.RootPath(ctx, req.Path)
 
 	if rootPath && unauth {
-		return nil, nil, errors.New("cannot access root path in unauthenticated request")
+		return nil, nil, nil, errors.New("cannot access root path in unauthenticated request")
 	}
 
 	// At this point we won't be forwarding a raw request; we should delete
-	// authorization headers as appropriate
+	// authorization headers as appropriate. A bearer token that isn't a Vault
+	// token is kept for the unauthenticated OIDC provider paths, since it is
+	// an access token meant for the identity store.
+	keepBearer := unauth && te == nil && strings.HasPrefix(req.Path, "identity/oidc/provider/")
 	switch req.ClientTokenSource {
 	case logical.ClientTokenFromVaultHeader:
 		delete(req.Headers, consts.AuthHeaderName)
 	case logical.ClientTokenFromAuthzHeader:
-		if headers, ok := req.Headers["Authorization"]; ok {
+		if headers, ok := req.Headers["Authorization"]; ok && !keepBearer {
 			retHeaders := make([]string, 0, len(headers))
 			for _, v := range headers {
 				if strings.HasPrefix(v, "Bearer ") {
@@ -301,15 +307,15 @@ func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool
 			checkExists = false
 		case nil:
 			if existsResp != nil && existsResp.IsError() {
-				return nil, te, existsResp.Error()
+				return nil, te, nil, existsResp.Error()
 			}
 			// Otherwise, continue on
 		default:
 			c.logger.Error("failed to run existence check", "error", err)
 			if _, ok := err.(errutil.UserError); ok {
-				return nil, te, err
+				return nil, te, nil, err
 			} else {
-				return nil, te, ErrInternalError
+				return nil, te, nil, ErrInternalError
 			}
 		}
 
@@ -374,16 +380,20 @@ func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool
 			}
 			// We also return the appropriate error so that the caller can forward the
 			// request to the active node
-			return auth, te, logical.ErrPerfStandbyPleaseForward
+			return auth, te, nil, logical.ErrPerfStandbyPleaseForward
 		}
 
 		if authResults.Error.ErrorOrNil() == nil || authResults.DeniedError {
 			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
 		}
-		return auth, te, retErr
+		return auth, te, nil, retErr
 	}
 
-	return auth, te, nil
+	if req.Operation == logical.ListOperation && authResults.ACLResults != nil && authResults.ACLResults.FilterListResults {
+		return auth, te, acl, nil
+	}
+
+	return auth, te, nil, nil
 }
 
 // HandleRequest is used to handle a new incoming request
@@ -539,23 +549,27 @@ func (c *Core) handleCancelableRequest(ctx context.Context, ns *namespace.Namesp
 		}
 	}
 
+	// Policy diffs are logged in the clear so that policy edits can be
+	// reviewed from the audit log
+	if auditResp != nil && auditResp.Data["diff"] != nil && strings.HasPrefix(req.Path, "sys/policies/acl/") {
+		nonHMACRespDataKeys = append(nonHMACRespDataKeys[:len(nonHMACRespDataKeys):len(nonHMACRespDataKeys)], "diff")
+	}
+
 	// Create an audit trail of the response
-	if !isControlGroupRun(req) {
-		switch req.Path {
-		case "sys/replication/dr/status", "sys/replication/performance/status", "sys/replication/status":
-		default:
-			logInput := &logical.LogInput{
-				Auth:                auth,
-				Request:             req,
-				Response:            auditResp,
-				OuterErr:            err,
-				NonHMACReqDataKeys:  nonHMACReqDataKeys,
-				NonHMACRespDataKeys: nonHMACRespDataKeys,
-			}
-			if auditErr := c.auditBroker.LogResponse(ctx, logInput, c.auditedHeaders); auditErr != nil {
-				c.logger.Error("failed to audit response", "request_path", req.Path, "error", auditErr)
-				return nil, ErrInternalError
-			}
+	switch req.Path {
+	case "sys/replication/dr/status", "sys/replication/performance/status", "sys/replication/status":
+	default:
+		logInput := &logical.LogInput{
+			Auth:                auth,
+			Request:             req,
+			Response:            auditResp,
+			OuterErr:            err,
+			NonHMACReqDataKeys:  nonHMACReqDataKeys,
+			NonHMACRespDataKeys: nonHMACRespDataKeys,
+		}
+		if auditErr := c.auditBroker.LogResponse(ctx, logInput, c.auditedHeaders); auditErr != nil {
+			c.logger.Error("failed to audit response", "request_path", req.Path, "error", auditErr)
+			return nil, ErrInternalError
 		}
 	}
 
@@ -598,11 +612,15 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	}
 
 	// Validate the token
-	auth, te, ctErr := c.checkToken(ctx, req, false)
+	auth, te, listACL, ctErr := c.checkToken(ctx, req, false)
 	if ctErr == logical.ErrPerfStandbyPleaseForward {
 		return nil, nil, ctErr
 	}
 
+	// A token whose final use is a request held for control group approval
+	// is only revoked once the held request is carried out
+	var heldFinalUse bool
+
 	// We run this logic first because we want to decrement the use count even
 	// in the case of an error (assuming we can successfully look up; if we
 	// need to forward, we exit before now)
@@ -625,6 +643,9 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 			// valid request (this is the token's final use). We pass the ID in
 			// directly just to be safe in case something else modifies te later.
 			defer func(id string) {
+				if heldFinalUse {
+					return
+				}
 				nsActiveCtx := namespace.ContextWithNamespace(c.activeContext, ns)
 				leaseID, err := c.expiration.CreateOrFetchRevocationLeaseByToken(nsActiveCtx, te)
 				if err == nil {
@@ -647,7 +668,8 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	}
 
 	if ctErr != nil {
-		newCtErr, cgResp, cgAuth, cgRetErr := checkNeedsCG(ctx, c, req, auth, ctErr, nonHMACReqDataKeys)
+		finalUse := te != nil && te.NumUses == tokenRevocationPending
+		newCtErr, cgResp, cgAuth, cgRetErr := checkNeedsCG(ctx, c, req, auth, ctErr, finalUse, nonHMACReqDataKeys)
 		switch {
 		case newCtErr != nil:
 			ctErr = newCtErr
@@ -655,6 +677,7 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 			if cgRetErr != nil {
 				retErr = multierror.Append(retErr, cgRetErr)
 			}
+			heldFinalUse = finalUse && cgResp != nil
 			return cgResp, cgAuth, retErr
 		}
 
@@ -675,16 +698,14 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 			retErr = multierror.Append(retErr, logical.ErrInvalidRequest)
 		}
 
-		if !isControlGroupRun(req) {
-			logInput := &logical.LogInput{
-				Auth:               auth,
-				Request:            req,
-				OuterErr:           ctErr,
-				NonHMACReqDataKeys: nonHMACReqDataKeys,
-			}
-			if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
-				c.logger.Error("failed to audit request", "path", req.Path, "error", err)
-			}
+		logInput := &logical.LogInput{
+			Auth:               auth,
+			Request:            req,
+			OuterErr:           ctErr,
+			NonHMACReqDataKeys: nonHMACReqDataKeys,
+		}
+		if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
+			c.logger.Error("failed to audit request", "path", req.Path, "error", err)
 		}
 
 		if errwrap.Contains(retErr, ErrInternalError.Error()) {
@@ -697,15 +718,32 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	req.DisplayName = auth.DisplayName
 
 	// Create an audit trail of the request
-	if !isControlGroupRun(req) {
-		logInput := &logical.LogInput{
-			Auth:               auth,
-			Request:            req,
-			NonHMACReqDataKeys: nonHMACReqDataKeys,
+	logInput := &logical.LogInput{
+		Auth:               auth,
+		Request:            req,
+		NonHMACReqDataKeys: nonHMACReqDataKeys,
+	}
+	if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
+		c.logger.Error("failed to audit request", "path", req.Path, "error", err)
+		retErr = multierror.Append(retErr, ErrInternalError)
+		return nil, auth, retErr
+	}
+
+	// Reject oversized writes before they reach storage
+	sizeQuotaReq := &quotas.Request{
+		Path:          req.Path,
+		MountPath:     strings.TrimPrefix(c.router.MatchingMount(ctx, req.Path), ns.Path),
+		NamespacePath: ns.Path,
+	}
+	if req.Operation == logical.CreateOperation || req.Operation == logical.UpdateOperation {
+		sizeResp, err := c.applyRequestSizeQuota(sizeQuotaReq, req.Data, false)
+		if err != nil {
+			c.logger.Error("failed to apply quota", "path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, err)
+			return nil, auth, retErr
 		}
-		if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
-			c.logger.Error("failed to audit request", "path", req.Path, "error", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
+		if !sizeResp.Allowed {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("request path %q: {{err}}", req.Path), quotas.ErrRequestSizeQuotaExceeded))
 			return nil, auth, retErr
 		}
 	}
@@ -713,7 +751,7 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	leaseGenerated := false
 	quotaResp, quotaErr := c.applyLeaseCountQuota(&quotas.Request{
 		Path:          req.Path,
-		MountPath:     strings.TrimPrefix(req.MountPoint, ns.Path),
+		MountPath:     strings.TrimPrefix(c.router.MatchingMount(ctx, req.Path), ns.Path),
 		NamespacePath: ns.Path,
 	})
 	if quotaErr != nil {
@@ -742,8 +780,24 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 
 	// Route the request
 	resp, routeErr := c.doRouting(ctx, req)
-	if resp != nil {
 
+	// Drop the keys the token could not read from list responses governed by
+	// a rule with filter_list_results set
+	if listACL != nil && resp != nil && resp.Data != nil {
+		if keys, ok := resp.Data["keys"].([]string); ok {
+			keys = listACL.FilterListKeys(ctx, req, keys)
+			resp.Data["keys"] = keys
+			if keyInfo, ok := resp.Data["key_info"].(map[string]interface{}); ok {
+				for key := range keyInfo {
+					if !strutil.StrListContains(keys, key) {
+						delete(keyInfo, key)
+					}
+				}
+			}
+		}
+	}
+
+	if resp != nil {
 		// If wrapping is used, use the shortest between the request and response
 		var wrapTTL time.Duration
 		var wrapFormat, creationPath string
@@ -788,11 +842,12 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 
 	// If there is a secret, we must register it with the expiration manager.
 	// We exclude renewal of a lease, since it does not need to be re-registered
+	var registerLease bool
 	if resp != nil && resp.Secret != nil && !strings.HasPrefix(req.Path, "sys/renew") &&
 		!strings.HasPrefix(req.Path, "sys/leases/renew") {
 		// KV mounts should return the TTL but not register
 		// for a lease as this provides a massive slowdown
-		registerLease := true
+		registerLease = true
 
 		matchingMountEntry := c.router.MatchingMountEntry(ctx, req.Path)
 		if matchingMountEntry == nil {
@@ -830,65 +885,83 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 				resp.Secret.Renewable = false
 			}
 		}
+	}
+
+	// Only the responses of reads are limited, since the changes a write made
+	// are already persisted by now. Responses carrying a secret that gets a
+	// lease or auth are let through, since dropping them would leave behind
+	// credentials that are never registered for revocation.
+	isRead := req.Operation == logical.ReadOperation || req.Operation == logical.ListOperation
+	if resp != nil && isRead && !registerLease && resp.Auth == nil {
+		sizeResp, err := c.applyRequestSizeQuota(sizeQuotaReq, resp.Data, true)
+		if err != nil {
+			c.logger.Error("failed to apply quota", "path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, err)
+			return nil, auth, retErr
+		}
+		if !sizeResp.Allowed {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("request path %q: {{err}}", req.Path), quotas.ErrResponseSizeQuotaExceeded))
+			return nil, auth, retErr
+		}
+	}
 
-		if registerLease {
-			sysView := c.router.MatchingSystemView(ctx, req.Path)
-			if sysView == nil {
-				c.logger.Error("unable to look up sys view for login path", "request_path", req.Path)
-				return nil, nil, ErrInternalError
-			}
+	if registerLease {
+		sysView := c.router.MatchingSystemView(ctx, req.Path)
+		if sysView == nil {
+			c.logger.Error("unable to look up sys view for login path", "request_path", req.Path)
+			return nil, nil, ErrInternalError
+		}
 
-			ttl, warnings, err := framework.CalculateTTL(sysView, 0, resp.Secret.TTL, 0, resp.Secret.MaxTTL, 0, time.Time{})
-			if err != nil {
-				return nil, nil, err
-			}
-			for _, warning := range warnings {
-				resp.AddWarning(warning)
-			}
-			resp.Secret.TTL = ttl
+		ttl, warnings, err := framework.CalculateTTL(sysView, 0, resp.Secret.TTL, 0, resp.Secret.MaxTTL, 0, time.Time{})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, warning := range warnings {
+			resp.AddWarning(warning)
+		}
+		resp.Secret.TTL = ttl
 
-			registerFunc, funcGetErr := getLeaseRegisterFunc(c)
-			if funcGetErr != nil {
-				retErr = multierror.Append(retErr, funcGetErr)
-				return nil, auth, retErr
-			}
+		registerFunc, funcGetErr := getLeaseRegisterFunc(c)
+		if funcGetErr != nil {
+			retErr = multierror.Append(retErr, funcGetErr)
+			return nil, auth, retErr
+		}
 
-			leaseID, err := registerFunc(ctx, req, resp)
-			if err != nil {
-				c.logger.Error("failed to register lease", "request_path", req.Path, "error", err)
-				retErr = multierror.Append(retErr, ErrInternalError)
-				return nil, auth, retErr
-			}
-			leaseGenerated = true
-			resp.Secret.LeaseID = leaseID
+		leaseID, err := registerFunc(ctx, req, resp)
+		if err != nil {
+			c.logger.Error("failed to register lease", "request_path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
+		}
+		leaseGenerated = true
+		resp.Secret.LeaseID = leaseID
 
-			// Get the actual time of the lease
-			le, err := c.expiration.FetchLeaseTimes(ctx, leaseID)
-			if err != nil {
-				c.logger.Error("failed to fetch updated lease time", "request_path", req.Path, "error", err)
-				retErr = multierror.Append(retErr, ErrInternalError)
-				return nil, auth, retErr
-			}
-			// We round here because the clock will have already started
-			// ticking, so we'll end up always returning 299 instead of 300 or
-			// 26399 instead of 26400, say, even if it's just a few
-			// microseconds. This provides a nicer UX.
-			resp.Secret.TTL = le.ExpireTime.Sub(time.Now()).Round(time.Second)
-
-			// Count the lease creation
-			ttl_label := metricsutil.TTLBucket(resp.Secret.TTL)
-			mountPointWithoutNs := ns.TrimmedPath(req.MountPoint)
-			c.MetricSink().IncrCounterWithLabels(
-				[]string{"secret", "lease", "creation"},
-				1,
-				[]metrics.Label{
-					metricsutil.NamespaceLabel(ns),
-					{"secret_engine", req.MountType},
-					{"mount_point", mountPointWithoutNs},
-					{"creation_ttl", ttl_label},
-				},
-			)
+		// Get the actual time of the lease
+		le, err := c.expiration.FetchLeaseTimes(ctx, leaseID)
+		if err != nil {
+			c.logger.Error("failed to fetch updated lease time", "request_path", req.Path, "error", err)
+			retErr = multierror.Append(retErr, ErrInternalError)
+			return nil, auth, retErr
 		}
+		// We round here because the clock will have already started
+		// ticking, so we'll end up always returning 299 instead of 300 or
+		// 26399 instead of 26400, say, even if it's just a few
+		// microseconds. This provides a nicer UX.
+		resp.Secret.TTL = le.ExpireTime.Sub(time.Now()).Round(time.Second)
+
+		// Count the lease creation
+		ttl_label := metricsutil.TTLBucket(resp.Secret.TTL)
+		mountPointWithoutNs := ns.TrimmedPath(req.MountPoint)
+		c.MetricSink().IncrCounterWithLabels(
+			[]string{"secret", "lease", "creation"},
+			1,
+			[]metrics.Label{
+				metricsutil.NamespaceLabel(ns),
+				{"secret_engine", req.MountType},
+				{"mount_point", mountPointWithoutNs},
+				{"creation_ttl", ttl_label},
+			},
+		)
 	}
 
 	// Only the token store is allowed to return an auth block, for any
@@ -1001,7 +1074,7 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 	// Do an unauth check. This will cause EGP policies to be checked
 	var auth *logical.Auth
 	var ctErr error
-	auth, _, ctErr = c.checkToken(ctx, req, true)
+	auth, _, _, ctErr = c.checkToken(ctx, req, true)
 	if ctErr == logical.ErrPerfStandbyPleaseForward {
 		return nil, nil, ctErr
 	}
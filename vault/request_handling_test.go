@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -340,3 +341,88 @@ func TestRequestHandling_SecretLeaseMetric(t *testing.T) {
 		},
 	)
 }
+
+func TestRequestHandling_FilterListResults(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	for _, path := range []string{"secret/a", "secret/b", "secret/dir/c"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data["value"] = "foo"
+		req.ClientToken = root
+		if resp, err := core.HandleRequest(ctx, req); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+		}
+	}
+
+	policy, err := ParseACLPolicy(namespace.RootNamespace, `
+name = "filtered"
+path "secret/" {
+	capabilities = ["list"]
+	filter_list_results = true
+}
+path "secret/a" {
+	capabilities = ["read"]
+}
+path "secret/b" {
+	capabilities = ["read"]
+	conditions {
+		source_cidrs = ["10.0.0.0/8"]
+	}
+}
+path "secret/dir/" {
+	capabilities = ["list"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := core.policyStore.SetPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	policy, err = ParseACLPolicy(namespace.RootNamespace, `
+name = "unfiltered"
+path "secret/" {
+	capabilities = ["list"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := core.policyStore.SetPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{"filtered", "unfiltered"} {
+		testMakeTokenDirectly(t, core.tokenStore, &logical.TokenEntry{
+			ID:       policy,
+			Path:     "auth/token/create",
+			Policies: []string{policy},
+			TTL:      time.Hour,
+		})
+	}
+
+	list := func(token, remoteAddr string) []string {
+		req := logical.TestRequest(t, logical.ListOperation, "secret/")
+		req.ClientToken = token
+		req.Connection.RemoteAddr = remoteAddr
+		resp, err := core.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v, err: %v", resp, err)
+		}
+		return resp.Data["keys"].([]string)
+	}
+
+	if keys := list("unfiltered", "127.0.0.1"); !reflect.DeepEqual(keys, []string{"a", "b", "dir/"}) {
+		t.Fatalf("bad: keys: %#v", keys)
+	}
+	if keys := list("filtered", "127.0.0.1"); !reflect.DeepEqual(keys, []string{"a", "dir/"}) {
+		t.Fatalf("bad: keys: %#v", keys)
+	}
+
+	// Keys readable through a rule with conditions are only listed to
+	// requests satisfying them
+	if keys := list("filtered", "10.1.2.3"); !reflect.DeepEqual(keys, []string{"a", "b", "dir/"}) {
+		t.Fatalf("bad: keys: %#v", keys)
+	}
+}
@@ -11,14 +11,6 @@ import (
 
 func waitForReplicationState(context.Context, *Core, *logical.Request) error { return nil }
 
-func checkNeedsCG(context.Context, *Core, *logical.Request, *logical.Auth, error, []string) (error, *logical.Response, *logical.Auth, error) {
-	return nil, nil, nil, nil
-}
-
-func checkErrControlGroupTokenNeedsCreated(err error) bool {
-	return false
-}
-
 func shouldForward(c *Core, resp *logical.Response, err error) bool {
 	return false
 }
@@ -139,7 +139,7 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 		storageView:   storageView,
 	}
 	re.rootPaths.Store(pathsToRadix(paths.Root))
-	re.loginPaths.Store(pathsToRadix(paths.Unauthenticated))
+	re.loginPaths.Store(parseUnauthenticatedPaths(paths.Unauthenticated))
 
 	switch {
 	case prefix == "":
@@ -799,20 +799,99 @@ func (r *Router) LoginPath(ctx context.Context, path string) bool {
 	remain := strings.TrimPrefix(adjustedPath, mount)
 
 	// Check the loginPaths of this backend
-	loginPaths := re.loginPaths.Load().(*radix.Tree)
-	match, raw, ok := loginPaths.LongestPrefix(remain)
-	if !ok {
+	loginPaths := re.loginPaths.Load().(*loginPathsEntry)
+	if match, raw, ok := loginPaths.paths.LongestPrefix(remain); ok {
+		prefixMatch := raw.(bool)
+
+		// Handle the prefix match case
+		if prefixMatch && strings.HasPrefix(remain, match) {
+			return true
+		}
+
+		// Handle the exact match case
+		if match == remain {
+			return true
+		}
+	}
+
+	// Check the paths with single segment wildcards
+	for _, w := range loginPaths.wildcardPaths {
+		if w.matches(remain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loginPathsEntry holds the unauthenticated paths of a backend. Paths that
+// contain a "+" segment wildcard can't be matched through the radix tree and
+// are kept aside.
+type loginPathsEntry struct {
+	paths         *radix.Tree
+	wildcardPaths []wildcardPath
+}
+
+// wildcardPath is an unauthenticated path containing "+" segments, each of
+// which matches any single path segment
+type wildcardPath struct {
+	segments []string
+	isPrefix bool
+}
+
+// matches returns if the path matches the wildcard path
+func (w wildcardPath) matches(path string) bool {
+	pathSegments := strings.Split(path, "/")
+	if len(pathSegments) < len(w.segments) || (!w.isPrefix && len(pathSegments) != len(w.segments)) {
 		return false
 	}
-	prefixMatch := raw.(bool)
 
-	// Handle the prefix match case
-	if prefixMatch {
-		return strings.HasPrefix(remain, match)
+	for i, segment := range w.segments {
+		last := i == len(w.segments)-1
+		switch {
+		case segment == "+":
+			if pathSegments[i] == "" {
+				return false
+			}
+		case last && w.isPrefix:
+			// The trailing segment of a prefix path matches as a prefix of
+			// the remaining path
+			return strings.HasPrefix(strings.Join(pathSegments[i:], "/"), segment)
+		case segment != pathSegments[i]:
+			return false
+		}
 	}
 
-	// Handle the exact match case
-	return match == remain
+	return true
+}
+
+// parseUnauthenticatedPaths converts a list of unauthenticated paths to a
+// loginPathsEntry.
+func parseUnauthenticatedPaths(paths []string) *loginPathsEntry {
+	var exactPaths []string
+	var wildcardPaths []wildcardPath
+	for _, path := range paths {
+		if !strings.Contains(path, "+") {
+			exactPaths = append(exactPaths, path)
+			continue
+		}
+
+		// Check if this is a prefix or exact match
+		isPrefix := len(path) >= 1 && path[len(path)-1] == '*'
+		if isPrefix {
+			path = path[:len(path)-1]
+		}
+
+		wildcardPaths = append(wildcardPaths, wildcardPath{
+			segments: strings.Split(path, "/"),
+			isPrefix: isPrefix,
+		})
+	}
+
+	return &loginPathsEntry{
+		paths:         pathsToRadix(exactPaths),
+		wildcardPaths: wildcardPaths,
+	}
 }
 
 // pathsToRadix converts a list of special paths to a radix tree.
@@ -348,6 +348,8 @@ func TestRouter_LoginPath(t *testing.T) {
 		Login: []string{
 			"login",
 			"oauth/*",
+			"oidc/+/token",
+			"oidc/+/.well-known/*",
 		},
 	}
 	err = r.Mount(n, "auth/foo/", &MountEntry{UUID: meUUID, Accessor: "authfooaccessor", NamespaceID: namespace.RootNamespaceID, namespace: namespace.RootNamespace}, view)
@@ -365,6 +367,14 @@ func TestRouter_LoginPath(t *testing.T) {
 		{"auth/foo/login", true},
 		{"auth/foo/oauth", false},
 		{"auth/foo/oauth/redirect", true},
+		{"auth/foo/oidc/token", false},
+		{"auth/foo/oidc/bar/token", true},
+		{"auth/foo/oidc//token", false},
+		{"auth/foo/oidc/bar/baz/token", false},
+		{"auth/foo/oidc/bar/token/extra", false},
+		{"auth/foo/oidc/bar/.well-known", false},
+		{"auth/foo/oidc/bar/.well-known/keys", true},
+		{"auth/foo/oidc/bar/.well-known/openid-configuration", true},
 	}
 
 	for _, tc := range tcases {
@@ -11,6 +11,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/hashicorp/errwrap"
 	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/quid/vault/helper/pgpkeys"
 	"github.com/quid/vault/sdk/helper/jsonutil"
 	"github.com/quid/vault/sdk/physical"
 	"github.com/quid/vault/vault/seal"
@@ -381,6 +382,12 @@ func (s *SealConfig) Validate() error {
 	}
 	if len(s.PGPKeys) > 0 {
 		for _, keystring := range s.PGPKeys {
+			if pgpkeys.IsAgeRecipient(keystring) {
+				if err := pgpkeys.ValidateAgeRecipient(keystring); err != nil {
+					return errwrap.Wrapf("error parsing given age recipient: {{err}}", err)
+				}
+				continue
+			}
 			data, err := base64.StdEncoding.DecodeString(keystring)
 			if err != nil {
 				return errwrap.Wrapf("error decoding given PGP key: {{err}}", err)
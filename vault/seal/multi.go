@@ -0,0 +1,325 @@
+package seal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/hashicorp/go-multierror"
+)
+
+// multiWrapperKeyIDPrefix prefixes the key ID of the values wrapped by a
+// MultiWrapper, it tells them apart from the values wrapped by a single seal
+const multiWrapperKeyIDPrefix = wrapping.MultiWrapper + ":"
+
+// multiWrapperHealthCheckValue is encrypted and decrypted to check the health
+// of the seals
+var multiWrapperHealthCheckValue = []byte("seal health check")
+
+// MultiWrapperSeal is one of the seals wrapping the master key, the seals
+// with the lowest priority are tried first to unwrap it
+type MultiWrapperSeal struct {
+	Name     string
+	Priority int
+	Wrapper  wrapping.Wrapper
+}
+
+// SealHealth is the health of a seal, as of the last time it was used
+type SealHealth struct {
+	Name        string
+	Type        string
+	Priority    int
+	Healthy     bool
+	LastError   string
+	LastChecked time.Time
+}
+
+// multiWrappedValue is the value wrapped by one of the seals, the ciphertext
+// of a MultiWrapper is the JSON encoding of the values of all the seals
+type multiWrappedValue struct {
+	Name string                      `json:"name"`
+	Type string                      `json:"type"`
+	Blob *wrapping.EncryptedBlobInfo `json:"blob"`
+}
+
+type multiWrapperSeal struct {
+	MultiWrapperSeal
+
+	l      sync.RWMutex
+	health SealHealth
+}
+
+func (s *multiWrapperSeal) setHealth(err error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.health.Healthy = err == nil
+	s.health.LastError = ""
+	if err != nil {
+		s.health.LastError = err.Error()
+	}
+	s.health.LastChecked = time.Now()
+}
+
+func (s *multiWrapperSeal) getHealth() SealHealth {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.health
+}
+
+// MultiWrapper is a wrapping.Wrapper wrapping the values with several seals,
+// so that they can be unwrapped by any of them. The wrapping succeeds as long
+// as one of the seals is healthy.
+type MultiWrapper struct {
+	seals []*multiWrapperSeal
+}
+
+// Ensure we are implementing the Wrapper interface
+var _ wrapping.Wrapper = (*MultiWrapper)(nil)
+
+// NewMultiWrapper returns a MultiWrapper for the given seals, their names
+// must be unique
+func NewMultiWrapper(seals []*MultiWrapperSeal) (*MultiWrapper, error) {
+	if len(seals) == 0 {
+		return nil, errors.New("no seal provided")
+	}
+
+	m := &MultiWrapper{}
+	names := make(map[string]bool, len(seals))
+	for _, s := range seals {
+		if s.Wrapper == nil {
+			return nil, fmt.Errorf("seal %q has no wrapper", s.Name)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate seal name %q", s.Name)
+		}
+		names[s.Name] = true
+
+		m.seals = append(m.seals, &multiWrapperSeal{
+			MultiWrapperSeal: *s,
+			health: SealHealth{
+				Name:     s.Name,
+				Type:     s.Wrapper.Type(),
+				Priority: s.Priority,
+				Healthy:  true,
+			},
+		})
+	}
+	sort.SliceStable(m.seals, func(i, j int) bool {
+		return m.seals[i].Priority < m.seals[j].Priority
+	})
+	return m, nil
+}
+
+// Type returns the type of the MultiWrapper
+func (m *MultiWrapper) Type() string {
+	return wrapping.MultiWrapper
+}
+
+// KeyID returns the key IDs of all the seals, a value must be wrapped again
+// when it was wrapped with other keys or by fewer seals
+func (m *MultiWrapper) KeyID() string {
+	return m.keyID(m.seals)
+}
+
+func (m *MultiWrapper) keyID(seals []*multiWrapperSeal) string {
+	ids := make([]string, 0, len(seals))
+	for _, s := range seals {
+		ids = append(ids, fmt.Sprintf("%s=%s", s.Name, s.Wrapper.KeyID()))
+	}
+	sort.Strings(ids)
+	return multiWrapperKeyIDPrefix + strings.Join(ids, ",")
+}
+
+// HMACKeyID is not used by the MultiWrapper
+func (m *MultiWrapper) HMACKeyID() string {
+	return ""
+}
+
+// Types returns the types of the seals
+func (m *MultiWrapper) Types() []string {
+	types := make([]string, 0, len(m.seals))
+	for _, s := range m.seals {
+		types = append(types, s.Wrapper.Type())
+	}
+	return types
+}
+
+// Init initializes the seals, it only fails when none of them can be
+// initialized
+func (m *MultiWrapper) Init(ctx context.Context) error {
+	var retErr *multierror.Error
+	for _, s := range m.seals {
+		err := s.Wrapper.Init(ctx)
+		if err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to initialize seal %q: {{err}}", s.Name), err))
+		}
+		s.setHealth(err)
+	}
+	if retErr != nil && len(retErr.Errors) == len(m.seals) {
+		return retErr
+	}
+	return nil
+}
+
+// Finalize finalizes all the seals
+func (m *MultiWrapper) Finalize(ctx context.Context) error {
+	var retErr *multierror.Error
+	for _, s := range m.seals {
+		if err := s.Wrapper.Finalize(ctx); err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to finalize seal %q: {{err}}", s.Name), err))
+		}
+	}
+	return retErr.ErrorOrNil()
+}
+
+// Encrypt wraps the plaintext with each seal, it only fails when none of
+// them is able to
+func (m *MultiWrapper) Encrypt(ctx context.Context, plaintext, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	var retErr *multierror.Error
+	var values []*multiWrappedValue
+	var wrapped []*multiWrapperSeal
+	for _, s := range m.seals {
+		blob, err := s.Wrapper.Encrypt(ctx, plaintext, aad)
+		s.setHealth(err)
+		if err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to encrypt with seal %q: {{err}}", s.Name), err))
+			continue
+		}
+		values = append(values, &multiWrappedValue{
+			Name: s.Name,
+			Type: s.Wrapper.Type(),
+			Blob: blob,
+		})
+		wrapped = append(wrapped, s)
+	}
+	if len(values) == 0 {
+		return nil, retErr
+	}
+
+	ciphertext, err := json.Marshal(values)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to encode the wrapped values: {{err}}", err)
+	}
+
+	return &wrapping.EncryptedBlobInfo{
+		Ciphertext: ciphertext,
+		KeyInfo: &wrapping.KeyInfo{
+			KeyID: m.keyID(wrapped),
+		},
+	}, nil
+}
+
+// Decrypt unwraps the value with the first seal able to, trying the healthy
+// seals first by priority
+func (m *MultiWrapper) Decrypt(ctx context.Context, in *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, error) {
+	if in == nil {
+		return nil, errors.New("given input for decryption is nil")
+	}
+
+	seals := make([]*multiWrapperSeal, 0, len(m.seals))
+	for _, s := range m.seals {
+		if s.getHealth().Healthy {
+			seals = append(seals, s)
+		}
+	}
+	for _, s := range m.seals {
+		if !s.getHealth().Healthy {
+			seals = append(seals, s)
+		}
+	}
+
+	// A value wrapped by a single seal, before the seals were combined
+	if !IsMultiWrapped(in) {
+		var retErr *multierror.Error
+		for _, s := range seals {
+			pt, err := s.Wrapper.Decrypt(ctx, in, aad)
+			if err == nil {
+				return pt, nil
+			}
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to decrypt with seal %q: {{err}}", s.Name), err))
+		}
+		return nil, retErr
+	}
+
+	values, err := multiWrappedValues(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var retErr *multierror.Error
+	for _, s := range seals {
+		value := findMultiWrappedValue(values, s.Name, s.Wrapper.Type())
+		if value == nil {
+			continue
+		}
+
+		pt, err := s.Wrapper.Decrypt(ctx, value.Blob, aad)
+		s.setHealth(err)
+		if err == nil {
+			return pt, nil
+		}
+		retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to decrypt with seal %q: {{err}}", s.Name), err))
+	}
+	if retErr == nil {
+		return nil, errors.New("the value was not wrapped by any of the configured seals")
+	}
+	return nil, retErr
+}
+
+// CheckHealth checks that each seal is able to wrap and unwrap a value
+func (m *MultiWrapper) CheckHealth(ctx context.Context) {
+	for _, s := range m.seals {
+		blob, err := s.Wrapper.Encrypt(ctx, multiWrapperHealthCheckValue, nil)
+		if err == nil {
+			_, err = s.Wrapper.Decrypt(ctx, blob, nil)
+		}
+		s.setHealth(err)
+	}
+}
+
+// Health returns the health of the seals, sorted by priority
+func (m *MultiWrapper) Health() []SealHealth {
+	health := make([]SealHealth, 0, len(m.seals))
+	for _, s := range m.seals {
+		health = append(health, s.getHealth())
+	}
+	return health
+}
+
+// IsMultiWrapped returns whether the value was wrapped by a MultiWrapper
+func IsMultiWrapped(in *wrapping.EncryptedBlobInfo) bool {
+	return in != nil && in.KeyInfo != nil && strings.HasPrefix(in.KeyInfo.KeyID, multiWrapperKeyIDPrefix)
+}
+
+func multiWrappedValues(in *wrapping.EncryptedBlobInfo) ([]*multiWrappedValue, error) {
+	var values []*multiWrappedValue
+	if err := json.Unmarshal(in.Ciphertext, &values); err != nil {
+		return nil, errwrap.Wrapf("failed to decode the wrapped values: {{err}}", err)
+	}
+	return values, nil
+}
+
+// findMultiWrappedValue returns the value wrapped by the seal of the given
+// name, or by a seal of the same type if the seal was renamed
+func findMultiWrappedValue(values []*multiWrappedValue, name, sealType string) *multiWrappedValue {
+	for _, v := range values {
+		if v.Name == name && v.Type == sealType {
+			return v
+		}
+	}
+	for _, v := range values {
+		if v.Type == sealType {
+			return v
+		}
+	}
+	return nil
+}
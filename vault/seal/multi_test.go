@@ -0,0 +1,126 @@
+package seal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+)
+
+// failingWrapper is a test wrapper that can be made unavailable
+type failingWrapper struct {
+	*wrapping.TestWrapper
+	failing bool
+}
+
+func (f *failingWrapper) Encrypt(ctx context.Context, plaintext, aad []byte) (*wrapping.EncryptedBlobInfo, error) {
+	if f.failing {
+		return nil, errors.New("seal unavailable")
+	}
+	return f.TestWrapper.Encrypt(ctx, plaintext, aad)
+}
+
+func (f *failingWrapper) Decrypt(ctx context.Context, in *wrapping.EncryptedBlobInfo, aad []byte) ([]byte, error) {
+	if f.failing {
+		return nil, errors.New("seal unavailable")
+	}
+	return f.TestWrapper.Decrypt(ctx, in, aad)
+}
+
+func TestMultiWrapper(t *testing.T) {
+	ctx := context.Background()
+	input := []byte("master key")
+
+	primary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper([]byte("primary"))}
+	secondary := &failingWrapper{TestWrapper: wrapping.NewTestWrapper([]byte("secondary"))}
+
+	if _, err := NewMultiWrapper([]*MultiWrapperSeal{
+		{Name: "hsm", Wrapper: primary},
+		{Name: "hsm", Wrapper: secondary},
+	}); err == nil {
+		t.Fatal("expected an error with duplicate seal names")
+	}
+
+	m, err := NewMultiWrapper([]*MultiWrapperSeal{
+		{Name: "transit", Priority: 2, Wrapper: secondary},
+		{Name: "hsm", Priority: 1, Wrapper: primary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := m.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsMultiWrapped(blob) || blob.KeyInfo.KeyID != m.KeyID() {
+		t.Fatalf("expected the value to be wrapped by all the seals, got key ID %q", blob.KeyInfo.KeyID)
+	}
+
+	// Any of the seals is able to unwrap the value
+	primary.failing = true
+	output, err := m.Decrypt(ctx, blob, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatalf("expected the same text: expected %s, got %s", string(input), string(output))
+	}
+
+	health := m.Health()
+	if len(health) != 2 || health[0].Name != "hsm" || health[0].Healthy || health[0].LastError == "" || !health[1].Healthy {
+		t.Fatalf("bad: %#v", health)
+	}
+
+	// The value is wrapped by the healthy seals only, it must be wrapped
+	// again once they are all healthy
+	blob, err = m.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID == m.KeyID() {
+		t.Fatal("expected the key ID to only include the healthy seals")
+	}
+
+	// A single seal unwraps its own value
+	access := &Access{Wrapper: secondary}
+	output, err = access.Decrypt(ctx, blob, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatalf("expected the same text: expected %s, got %s", string(input), string(output))
+	}
+
+	// A value wrapped before combining the seals is unwrapped as well
+	blob, err = secondary.Encrypt(ctx, input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err = m.Decrypt(ctx, blob, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatalf("expected the same text: expected %s, got %s", string(input), string(output))
+	}
+
+	secondary.failing = true
+	if _, err := m.Encrypt(ctx, input, nil); err == nil {
+		t.Fatal("expected an error when none of the seals is healthy")
+	}
+
+	primary.failing, secondary.failing = false, false
+	m.CheckHealth(ctx)
+	for _, h := range m.Health() {
+		if !h.Healthy {
+			t.Fatalf("expected the seal %q to be healthy, got %#v", h.Name, h)
+		}
+	}
+
+	if !access.CompatibleType(wrapping.MultiWrapper) || !(&Access{Wrapper: m}).CompatibleType(wrapping.Test) {
+		t.Fatal("expected the seal types to be compatible")
+	}
+}
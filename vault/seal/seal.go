@@ -2,6 +2,7 @@ package seal
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	metrics "github.com/armon/go-metrics"
@@ -80,5 +81,54 @@ func (a *Access) Decrypt(ctx context.Context, data *wrapping.EncryptedBlobInfo,
 	metrics.IncrCounter([]string{"seal", "decrypt"}, 1)
 	metrics.IncrCounter([]string{"seal", a.Wrapper.Type(), "decrypt"}, 1)
 
+	// A single seal unwraps its own value of the values wrapped by several
+	// seals, when going back to one seal
+	if _, ok := a.Wrapper.(*MultiWrapper); !ok && IsMultiWrapped(data) {
+		values, err := multiWrappedValues(data)
+		if err != nil {
+			return nil, err
+		}
+		value := findMultiWrappedValue(values, "", a.Wrapper.Type())
+		if value == nil {
+			return nil, fmt.Errorf("the value was not wrapped by a seal of type %q", a.Wrapper.Type())
+		}
+		data = value.Blob
+	}
+
 	return a.Wrapper.Decrypt(ctx, data, aad)
 }
+
+// CompatibleType returns whether the keys stored by a seal of the given type
+// can be unwrapped, either by the same seal or when combining several seals
+// or going back to one of them
+func (a *Access) CompatibleType(t string) bool {
+	if t == a.Type() {
+		return true
+	}
+
+	m, ok := a.Wrapper.(*MultiWrapper)
+	if !ok {
+		return t == wrapping.MultiWrapper
+	}
+	for _, sealType := range m.Types() {
+		if t == sealType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHealth checks the health of the seals, when several are combined
+func (a *Access) CheckHealth(ctx context.Context) {
+	if m, ok := a.Wrapper.(*MultiWrapper); ok {
+		m.CheckHealth(ctx)
+	}
+}
+
+// Health returns the health of the seals, when several are combined
+func (a *Access) Health() []SealHealth {
+	if m, ok := a.Wrapper.(*MultiWrapper); ok {
+		return m.Health()
+	}
+	return nil
+}
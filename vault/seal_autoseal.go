@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	proto "github.com/golang/protobuf/proto"
 	"github.com/hashicorp/errwrap"
@@ -29,11 +30,29 @@ type autoSeal struct {
 	recoveryConfig atomic.Value
 	core           *Core
 	logger         log.Logger
+
+	healthCheckStopCh chan struct{}
 }
 
 // Ensure we are implementing the Seal interface
 var _ Seal = (*autoSeal)(nil)
 
+// sealHealthCheckInterval is how often the health of the seals is checked,
+// when several auto-seals are combined
+var sealHealthCheckInterval = 10 * time.Minute
+
+// sealTypeCompatible returns whether the keys stored by a seal of the given
+// type can be unwrapped by the seal
+func sealTypeCompatible(s Seal, sealType string) bool {
+	if sealType == s.BarrierType() {
+		return true
+	}
+	if d, ok := s.(*autoSeal); ok {
+		return d.Access.CompatibleType(sealType)
+	}
+	return false
+}
+
 func NewAutoSeal(lowLevel *seal.Access) *autoSeal {
 	ret := &autoSeal{
 		Access: lowLevel,
@@ -64,6 +83,11 @@ func (d *autoSeal) SetCore(core *Core) {
 		d.logger = d.core.Logger().Named("autoseal")
 		d.core.AddLogger(d.logger)
 	}
+
+	if d.Access.Health() != nil && d.healthCheckStopCh == nil {
+		d.healthCheckStopCh = make(chan struct{})
+		go d.checkHealth(d.healthCheckStopCh)
+	}
 }
 
 func (d *autoSeal) Init(ctx context.Context) error {
@@ -71,9 +95,38 @@ func (d *autoSeal) Init(ctx context.Context) error {
 }
 
 func (d *autoSeal) Finalize(ctx context.Context) error {
+	if d.healthCheckStopCh != nil {
+		close(d.healthCheckStopCh)
+		d.healthCheckStopCh = nil
+	}
 	return d.Access.Finalize(ctx)
 }
 
+// checkHealth regularly checks that each of the combined seals is able to
+// wrap and unwrap a value, so that their health is reported even when the
+// keys are not unwrapped
+func (d *autoSeal) checkHealth(stopCh chan struct{}) {
+	ticker := time.NewTicker(sealHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			d.Access.CheckHealth(ctx)
+			cancel()
+
+			for _, health := range d.Access.Health() {
+				if !health.Healthy {
+					d.logger.Warn("seal is unhealthy", "name", health.Name, "seal_type", health.Type, "error", health.LastError)
+				}
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
 func (d *autoSeal) BarrierType() string {
 	return d.Type()
 }
@@ -150,9 +203,27 @@ func (d *autoSeal) UpgradeKeys(ctx context.Context) error {
 	if err := d.upgradeStoredKeys(ctx); err != nil {
 		return err
 	}
+	if err := d.upgradeBarrierConfigType(ctx); err != nil {
+		return err
+	}
 	return nil
 }
 
+// upgradeBarrierConfigType saves the type of the seal in the barrier config
+// when auto-seals are combined or when going back to one of them
+func (d *autoSeal) upgradeBarrierConfigType(ctx context.Context) error {
+	conf, err := d.BarrierConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if conf == nil || conf.Type == d.BarrierType() {
+		return nil
+	}
+
+	d.logger.Info("upgrading barrier seal type", "seal_type", conf.Type, "loaded_type", d.BarrierType())
+	return d.SetBarrierConfig(ctx, conf)
+}
+
 func (d *autoSeal) BarrierConfig(ctx context.Context) (*SealConfig, error) {
 	if d.barrierConfig.Load().(*SealConfig) != nil {
 		return d.barrierConfig.Load().(*SealConfig).Clone(), nil
@@ -193,7 +264,7 @@ func (d *autoSeal) BarrierConfig(ctx context.Context) (*SealConfig, error) {
 
 	barrierTypeUpgradeCheck(d.BarrierType(), conf)
 
-	if conf.Type != d.BarrierType() {
+	if !d.Access.CompatibleType(conf.Type) {
 		d.logger.Error("barrier seal type does not match loaded type", "seal_type", conf.Type, "loaded_type", d.BarrierType())
 		return nil, fmt.Errorf("barrier seal type of %q does not match loaded type of %q", conf.Type, d.BarrierType())
 	}
@@ -0,0 +1,327 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/hashicorp/go-multierror"
+	"github.com/quid/vault/sdk/helper/locksutil"
+	"github.com/quid/vault/sdk/physical"
+	"github.com/quid/vault/vault/seal"
+	"golang.org/x/time/rate"
+)
+
+// sealRewrapRate is the number of seal-wrapped entries rewrapped per second,
+// each of them requires two calls to the KMS
+var sealRewrapRate rate.Limit = 50
+
+var errSealRewrapStopped = errors.New("seal rewrap stopped")
+
+// sealRewrapStatus is the progress of the rewrap of the seal-wrapped entries
+type sealRewrapStatus struct {
+	Running      bool
+	StartTime    time.Time
+	CompleteTime time.Time
+	Processed    int
+	Succeeded    int
+	Failed       int
+
+	// KeyIDs counts the entries and stored keys wrapped with each key ID, the
+	// key IDs other than the current one are still in use
+	KeyIDs map[string]int
+
+	LastError string
+}
+
+// sealRewrap re-wraps the seal-wrapped entries, the stored keys and the
+// recovery key with the current key of the seal, after the key of the KMS
+// is rotated. It runs on the active node until it's done, or until the node
+// is sealed.
+type sealRewrap struct {
+	core   *Core
+	logger hclog.Logger
+
+	l      sync.Mutex
+	status *sealRewrapStatus
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newSealRewrap(c *Core, conf *CoreConfig) *sealRewrap {
+	logger := conf.Logger.Named("seal.rewrap")
+	c.allLoggers = append(c.allLoggers, logger)
+
+	return &sealRewrap{
+		core:   c,
+		logger: logger,
+	}
+}
+
+// stopSealRewrap stops the rewrap, it must be started again once unsealed
+func (c *Core) stopSealRewrap() {
+	c.sealRewrap.stop()
+}
+
+// getStatus returns a copy of the status of the rewrap, nil if it never ran
+func (r *sealRewrap) getStatus() *sealRewrapStatus {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.status == nil {
+		return nil
+	}
+	status := *r.status
+	status.KeyIDs = make(map[string]int, len(r.status.KeyIDs))
+	for keyID, count := range r.status.KeyIDs {
+		status.KeyIDs[keyID] = count
+	}
+	return &status
+}
+
+func (r *sealRewrap) updateStatus(update func(*sealRewrapStatus)) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	update(r.status)
+}
+
+// begin starts the rewrap in the background with the given active context,
+// it returns false if a rewrap is already running
+func (r *sealRewrap) begin(ctx context.Context) (bool, error) {
+	if _, ok := r.core.seal.(*autoSeal); !ok {
+		return false, errors.New("only the entries wrapped by an auto-seal can be rewrapped")
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.status != nil && r.status.Running {
+		return false, nil
+	}
+
+	r.status = &sealRewrapStatus{
+		Running:   true,
+		StartTime: time.Now(),
+		KeyIDs:    make(map[string]int),
+	}
+	r.stopCh = make(chan struct{})
+	r.doneCh = make(chan struct{})
+
+	r.logger.Info("starting the rewrap of the seal-wrapped entries")
+	go r.run(ctx, r.stopCh, r.doneCh)
+	return true, nil
+}
+
+func (r *sealRewrap) stop() {
+	r.l.Lock()
+	stopCh, doneCh := r.stopCh, r.doneCh
+	r.stopCh, r.doneCh = nil, nil
+	r.l.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+func (r *sealRewrap) run(ctx context.Context, stopCh chan struct{}, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	access := r.core.seal.GetAccess()
+	err := r.rewrapEntries(ctx, stopCh, access)
+	if err == nil {
+		err = r.rewrapStoredKeys(ctx, access)
+	}
+
+	r.updateStatus(func(status *sealRewrapStatus) {
+		status.Running = false
+		status.CompleteTime = time.Now()
+		if err != nil {
+			status.LastError = err.Error()
+		}
+	})
+
+	status := r.getStatus()
+	switch {
+	case err == errSealRewrapStopped:
+		r.logger.Info("seal rewrap stopped", "processed", status.Processed)
+	case err != nil:
+		r.logger.Error("seal rewrap failed", "error", err)
+	default:
+		r.logger.Info("rewrapped the seal-wrapped entries", "processed", status.Processed, "succeeded", status.Succeeded, "failed", status.Failed)
+	}
+}
+
+// rewrapEntries re-wraps the seal-wrapped entries of the storage, the entries
+// which can't be rewrapped are counted as failed and keep their key ID
+func (r *sealRewrap) rewrapEntries(ctx context.Context, stopCh chan struct{}, access *seal.Access) error {
+	limiter := rate.NewLimiter(sealRewrapRate, 1)
+
+	return storageMigrationScan(ctx, r.core.sealUnwrapper, func(key string) error {
+		select {
+		case <-stopCh:
+			return errSealRewrapStopped
+		case <-ctx.Done():
+			return errSealRewrapStopped
+		default:
+		}
+
+		var keyID string
+		var wrapped, rewrapped bool
+		err := r.core.rewrapSealWrappedEntry(ctx, key, func(entry *physical.Entry) (*physical.Entry, error) {
+			blobInfo := sealWrappedBlobInfo(entry)
+			if blobInfo == nil {
+				return nil, nil
+			}
+			wrapped = true
+			keyID = blobInfo.KeyInfo.KeyID
+			if keyID == access.KeyID() {
+				return nil, nil
+			}
+
+			pt, err := access.Decrypt(ctx, blobInfo, nil)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to unwrap the entry: {{err}}", err)
+			}
+			newBlobInfo, err := access.Encrypt(ctx, pt, nil)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to wrap the entry: {{err}}", err)
+			}
+			newBlobInfo.Wrapped = true
+			newBlobInfo.ValuePath = blobInfo.ValuePath
+
+			value, err := proto.Marshal(newBlobInfo)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to encode the entry: {{err}}", err)
+			}
+			keyID = newBlobInfo.KeyInfo.KeyID
+			rewrapped = true
+			return &physical.Entry{
+				Key:      entry.Key,
+				Value:    append(value, 's'),
+				SealWrap: true,
+			}, nil
+		})
+		if !wrapped {
+			return nil
+		}
+
+		r.updateStatus(func(status *sealRewrapStatus) {
+			status.Processed++
+			status.KeyIDs[keyID]++
+			if err != nil {
+				status.Failed++
+				status.LastError = fmt.Sprintf("failed to rewrap %q: %s", key, err)
+			} else {
+				status.Succeeded++
+			}
+		})
+		if err != nil {
+			r.logger.Error("failed to rewrap a seal-wrapped entry", "key", key, "error", err)
+		}
+
+		if rewrapped {
+			select {
+			case <-time.After(limiter.Reserve().Delay()):
+			case <-stopCh:
+				return errSealRewrapStopped
+			case <-ctx.Done():
+				return errSealRewrapStopped
+			}
+		}
+		return nil
+	})
+}
+
+// rewrapStoredKeys re-wraps the stored keys and the recovery key, and counts
+// the key IDs they are wrapped with
+func (r *sealRewrap) rewrapStoredKeys(ctx context.Context, access *seal.Access) error {
+	d, ok := r.core.seal.(*autoSeal)
+	if !ok {
+		return nil
+	}
+
+	var retErr *multierror.Error
+	if err := d.UpgradeKeys(ctx); err != nil {
+		retErr = multierror.Append(retErr, errwrap.Wrapf("failed to rewrap the stored keys: {{err}}", err))
+	}
+
+	for _, path := range []string{StoredBarrierKeysPath, recoveryKeyPath} {
+		pe, err := r.core.physical.Get(ctx, path)
+		if err != nil {
+			retErr = multierror.Append(retErr, err)
+			continue
+		}
+		if pe == nil {
+			continue
+		}
+
+		blobInfo := &wrapping.EncryptedBlobInfo{}
+		if err := proto.Unmarshal(pe.Value, blobInfo); err != nil {
+			retErr = multierror.Append(retErr, errwrap.Wrapf(fmt.Sprintf("failed to proto decode %q: {{err}}", path), err))
+			continue
+		}
+		if blobInfo.KeyInfo != nil {
+			r.updateStatus(func(status *sealRewrapStatus) {
+				status.KeyIDs[blobInfo.KeyInfo.KeyID]++
+			})
+		}
+	}
+	return retErr.ErrorOrNil()
+}
+
+// sealWrappedBlobInfo decodes the value of a seal-wrapped entry, it returns
+// nil if the entry isn't seal-wrapped
+func sealWrappedBlobInfo(entry *physical.Entry) *wrapping.EncryptedBlobInfo {
+	eLen := len(entry.Value)
+	if eLen == 0 || entry.Value[eLen-1] != 's' {
+		return nil
+	}
+
+	blobInfo := &wrapping.EncryptedBlobInfo{}
+	if err := proto.Unmarshal(entry.Value[:eLen-1], blobInfo); err != nil {
+		return nil
+	}
+	if !blobInfo.Wrapped || blobInfo.KeyInfo == nil {
+		return nil
+	}
+	return blobInfo
+}
+
+// rewrapSealWrappedEntry applies rewrap to the entry of the underlying backend
+// while holding the lock of the seal unwrapper for the key, the entry is
+// written back when rewrap returns a new one
+func (c *Core) rewrapSealWrappedEntry(ctx context.Context, key string, rewrap func(*physical.Entry) (*physical.Entry, error)) error {
+	var d *sealUnwrapper
+	switch u := c.sealUnwrapper.(type) {
+	case *sealUnwrapper:
+		d = u
+	case *transactionalSealUnwrapper:
+		d = u.sealUnwrapper
+	default:
+		return fmt.Errorf("unexpected seal unwrapper %T", c.sealUnwrapper)
+	}
+
+	lock := locksutil.LockForKey(d.locks, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := d.underlying.Get(ctx, key)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	entry, err = rewrap(entry)
+	if err != nil || entry == nil {
+		return err
+	}
+	return d.underlying.Put(ctx, entry)
+}
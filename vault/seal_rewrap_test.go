@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	proto "github.com/golang/protobuf/proto"
+	wrapping "github.com/hashicorp/go-kms-wrapping"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/logical"
+	"github.com/quid/vault/sdk/physical"
+	"golang.org/x/time/rate"
+)
+
+func TestSealRewrap(t *testing.T) {
+	// Rewrap as fast as possible
+	rewrapRate := sealRewrapRate
+	sealRewrapRate = rate.Inf
+	defer func() {
+		sealRewrapRate = rewrapRate
+	}()
+
+	c, _, _, _ := TestCoreUnsealedWithConfigs(t, &SealConfig{
+		StoredShares:    1,
+		SecretShares:    1,
+		SecretThreshold: 1,
+	}, &SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+	})
+	ctx := namespace.RootContext(nil)
+	access := c.seal.GetAccess()
+
+	// Store a seal-wrapped entry with the current key
+	input := []byte("csp")
+	blobInfo, err := access.Encrypt(context.Background(), input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobInfo.Wrapped = true
+	value, err := proto.Marshal(blobInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.underlyingPhysical.Put(context.Background(), &physical.Entry{
+		Key:      "logical/sealwrapped",
+		Value:    append(value, 's'),
+		SealWrap: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate the key of the seal
+	access.Wrapper.(*wrapping.TestWrapper).SetKeyID("rotated-key")
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sealwrap/rewrap")
+	resp, err := c.systemBackend.HandleRequest(ctx, req)
+	if err != nil || resp != nil {
+		t.Fatalf("expected the rewrap to start, got %v, %#v", err, resp)
+	}
+
+	var status *sealRewrapStatus
+	for i := 0; i < 100; i++ {
+		status = c.sealRewrap.getStatus()
+		if !status.Running {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status.Running || status.LastError != "" {
+		t.Fatalf("expected the rewrap to complete, got %#v", status)
+	}
+	if status.Processed != 1 || status.Succeeded != 1 || status.Failed != 0 {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	// The entry and the stored keys are all wrapped with the new key
+	if expected := map[string]int{"rotated-key": 3}; !reflect.DeepEqual(status.KeyIDs, expected) {
+		t.Fatalf("bad: expected %v, got %v", expected, status.KeyIDs)
+	}
+
+	entry, err := c.underlyingPhysical.Get(context.Background(), "logical/sealwrapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobInfo = sealWrappedBlobInfo(entry)
+	if blobInfo == nil || blobInfo.KeyInfo.KeyID != "rotated-key" {
+		t.Fatalf("expected the entry to be rewrapped, got %#v", blobInfo)
+	}
+	output, err := access.Decrypt(context.Background(), blobInfo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, output) {
+		t.Fatalf("expected the same text: expected %s, got %s", string(input), string(output))
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sealwrap/rewrap")
+	resp, err = c.systemBackend.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["is_running"] != false || resp.Data["key_id"] != "rotated-key" || !reflect.DeepEqual(resp.Data["key_ids"], map[string]interface{}{"rotated-key": 3}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
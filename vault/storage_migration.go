@@ -0,0 +1,433 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/sdk/logical"
+	"github.com/quid/vault/sdk/physical"
+)
+
+const (
+	// storageMigrationStatusPath is the storage path of the status of the
+	// online storage migration. It is written to both backends while they are
+	// kept in sync.
+	storageMigrationStatusPath = "core/storage-migration/status"
+
+	storageMigrationStateCopying = "copying"
+	storageMigrationStateCopied  = "copied"
+	storageMigrationStateCutOver = "cut-over"
+	storageMigrationStateFailed  = "failed"
+)
+
+// storageMigrationCheckpointKeys is the number of keys copied between two
+// checkpoints of the copy
+var storageMigrationCheckpointKeys = 1000
+
+var errStorageMigrationStopped = errors.New("storage migration stopped")
+
+// storageMigrationStatus is the progress of the online storage migration
+type storageMigrationStatus struct {
+	State           string    `json:"state"`
+	DestinationType string    `json:"destination_type"`
+	Node            string    `json:"node"`
+	StartTime       time.Time `json:"start_time"`
+	Checkpoint      string    `json:"checkpoint"`
+	KeysCopied      int       `json:"keys_copied"`
+	CopiedTime      time.Time `json:"copied_time"`
+	CutOverTime     time.Time `json:"cut_over_time"`
+	LastError       string    `json:"last_error"`
+}
+
+// storageMigration moves the storage to another backend while Vault is online.
+// The active node duplicates its writes to the destination while a background
+// copier walks the existing keys, saving a checkpoint as it goes so that the
+// copy resumes where it stopped after a seal or a restart. Once the keys are
+// copied, the cut over moves the reads to the destination, keeping the source
+// in sync until the nodes are restarted with the destination as their storage.
+//
+// The migration is bound to the node that started it: if another node becomes
+// active in the meantime its writes are missing from the destination, and the
+// migration fails.
+type storageMigration struct {
+	core            *Core
+	logger          hclog.Logger
+	backend         physical.Backend
+	dualWrite       *physical.DualWrite
+	source          physical.Backend
+	destination     physical.Backend
+	destinationType string
+
+	// ctx is the active context of the node, the copy runs until it's done
+	ctx context.Context
+
+	l      sync.Mutex
+	status *storageMigrationStatus
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// newStorageMigration wraps the storage of the core so that its writes can be
+// duplicated to the destination of the migration
+func newStorageMigration(c *Core, conf *CoreConfig) *storageMigration {
+	logger := conf.Logger.Named("storage.migration")
+	c.allLoggers = append(c.allLoggers, logger)
+
+	m := &storageMigration{
+		core:            c,
+		logger:          logger,
+		source:          conf.Physical,
+		destination:     conf.StorageMigrationDestination,
+		destinationType: conf.StorageMigrationDestinationType,
+	}
+
+	if _, ok := conf.Physical.(physical.Transactional); ok {
+		dualWrite := physical.NewTransactionalDualWrite(conf.Physical, logger)
+		m.backend, m.dualWrite = dualWrite, dualWrite.DualWrite
+	} else {
+		dualWrite := physical.NewDualWrite(conf.Physical, logger)
+		m.backend, m.dualWrite = dualWrite, dualWrite
+	}
+
+	return m
+}
+
+func (c *Core) loadStorageMigrationStatus(ctx context.Context) (*storageMigrationStatus, error) {
+	entry, err := c.barrier.Get(ctx, storageMigrationStatusPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read the storage migration status: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var status storageMigrationStatus
+	if err := entry.DecodeJSON(&status); err != nil {
+		return nil, errwrap.Wrapf("failed to decode the storage migration status: {{err}}", err)
+	}
+	return &status, nil
+}
+
+func (c *Core) storeStorageMigrationStatus(ctx context.Context, status *storageMigrationStatus) error {
+	entry, err := logical.StorageEntryJSON(storageMigrationStatusPath, status)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(ctx, entry)
+}
+
+// setupStorageMigration restores the state of the storage migration on the
+// active node. It must run before anything else is written after unsealing, so
+// that no write is missing from the destination.
+func (c *Core) setupStorageMigration(ctx context.Context) error {
+	status, err := c.loadStorageMigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	m := c.storageMigration
+	if m != nil {
+		m.l.Lock()
+		m.ctx = ctx
+		m.status = status
+		m.l.Unlock()
+
+		m.dualWrite.SetBackends(m.source, nil)
+	}
+	if status == nil {
+		return nil
+	}
+
+	switch {
+	case status.State == storageMigrationStateFailed:
+		// Nothing to resume, the migration can be started again
+
+	case m == nil && status.State == storageMigrationStateCutOver:
+		// The nodes were restarted with the destination as their storage
+		c.logger.Info("storage migration complete", "destination_type", status.DestinationType)
+		return c.barrier.Delete(ctx, storageMigrationStatusPath)
+
+	case m == nil || status.Node != c.redirectAddr || status.DestinationType != m.destinationType:
+		c.logger.Error("storage migration failed, it was started by another active node", "node", status.Node)
+		status.State = storageMigrationStateFailed
+		status.LastError = fmt.Sprintf("the active node changed during the migration started by %q, writes may be missing from the destination", status.Node)
+		return c.storeStorageMigrationStatus(ctx, status)
+
+	case status.State == storageMigrationStateCopying:
+		m.dualWrite.SetBackends(m.source, m.destination)
+		m.start()
+
+	case status.State == storageMigrationStateCopied:
+		m.dualWrite.SetBackends(m.source, m.destination)
+
+	case status.State == storageMigrationStateCutOver:
+		m.dualWrite.SetBackends(m.destination, m.source)
+	}
+
+	return nil
+}
+
+// stopStorageMigration stops the copy of the keys, saving its checkpoint
+func (c *Core) stopStorageMigration() {
+	if c.storageMigration == nil {
+		return
+	}
+	c.storageMigration.stop()
+}
+
+// start starts the copy of the keys after the checkpoint of the status
+func (m *storageMigration) start() {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.stopCh = make(chan struct{})
+	m.doneCh = make(chan struct{})
+	go m.run(m.ctx, m.stopCh, m.doneCh)
+}
+
+func (m *storageMigration) stop() {
+	m.l.Lock()
+	stopCh, doneCh := m.stopCh, m.doneCh
+	m.stopCh, m.doneCh = nil, nil
+	m.l.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+// getStatus returns a copy of the status of the migration, nil if none is in
+// progress
+func (m *storageMigration) getStatus() *storageMigrationStatus {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.status == nil {
+		return nil
+	}
+	status := *m.status
+	return &status
+}
+
+// updateStatus applies update to the status of the migration and persists it
+func (m *storageMigration) updateStatus(ctx context.Context, update func(*storageMigrationStatus)) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.status == nil {
+		return nil
+	}
+	update(m.status)
+	return m.core.storeStorageMigrationStatus(ctx, m.status)
+}
+
+// begin starts a new migration, copying all the keys
+func (m *storageMigration) begin(ctx context.Context) error {
+	m.l.Lock()
+	if m.status != nil && m.status.State != storageMigrationStateFailed {
+		m.l.Unlock()
+		return logical.CodedError(http.StatusBadRequest, fmt.Sprintf("a storage migration is already %s", m.status.State))
+	}
+
+	m.dualWrite.SetBackends(m.source, m.destination)
+
+	status := &storageMigrationStatus{
+		State:           storageMigrationStateCopying,
+		DestinationType: m.destinationType,
+		Node:            m.core.redirectAddr,
+		StartTime:       time.Now(),
+	}
+	if err := m.core.storeStorageMigrationStatus(ctx, status); err != nil {
+		m.dualWrite.SetBackends(m.source, nil)
+		m.l.Unlock()
+		return err
+	}
+	m.status = status
+	m.l.Unlock()
+
+	m.logger.Info("starting storage migration", "destination_type", m.destinationType)
+	m.start()
+	return nil
+}
+
+// cutOver moves the reads to the destination once all the keys are copied.
+// The source is kept in sync.
+func (m *storageMigration) cutOver(ctx context.Context) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.status == nil || m.status.State != storageMigrationStateCopied {
+		state := "not started"
+		if m.status != nil {
+			state = m.status.State
+		}
+		return logical.CodedError(http.StatusBadRequest, fmt.Sprintf("the keys must be copied before cutting over, the storage migration is %s", state))
+	}
+
+	// Retry the writes that failed on the destination
+	for _, key := range m.dualWrite.Pending() {
+		if err := m.dualWrite.Copy(ctx, key); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to copy %q: {{err}}", key), err)
+		}
+	}
+
+	m.dualWrite.SetBackends(m.destination, m.source)
+
+	m.status.State = storageMigrationStateCutOver
+	m.status.CutOverTime = time.Now()
+	if err := m.core.storeStorageMigrationStatus(ctx, m.status); err != nil {
+		return err
+	}
+
+	m.logger.Info("storage migration cut over, the destination is now the storage", "destination_type", m.destinationType)
+	return nil
+}
+
+// abort stops the migration, going back to the source alone
+func (m *storageMigration) abort(ctx context.Context) error {
+	m.stop()
+
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.dualWrite.SetBackends(m.source, nil)
+	m.status = nil
+	if err := m.core.barrier.Delete(ctx, storageMigrationStatusPath); err != nil {
+		return err
+	}
+
+	m.logger.Info("storage migration aborted")
+	return nil
+}
+
+func (m *storageMigration) run(ctx context.Context, stopCh chan struct{}, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	err := m.copyKeys(ctx, stopCh)
+	switch {
+	case err == errStorageMigrationStopped:
+		return
+
+	case err != nil:
+		m.logger.Error("storage migration failed", "error", err)
+		m.dualWrite.SetBackends(m.source, nil)
+		err = m.updateStatus(ctx, func(status *storageMigrationStatus) {
+			status.State = storageMigrationStateFailed
+			status.LastError = err.Error()
+		})
+
+	default:
+		m.logger.Info("storage migration copied all the keys, ready to cut over")
+		err = m.updateStatus(ctx, func(status *storageMigrationStatus) {
+			status.State = storageMigrationStateCopied
+			status.CopiedTime = time.Now()
+		})
+	}
+	if err != nil {
+		m.logger.Error("failed to store the storage migration status", "error", err)
+	}
+}
+
+// copyKeys copies the keys of the source in lexicographic order, starting after
+// the checkpoint, then retries the writes that failed on the destination
+func (m *storageMigration) copyKeys(ctx context.Context, stopCh chan struct{}) error {
+	status := m.getStatus()
+	if status == nil {
+		return errStorageMigrationStopped
+	}
+	checkpoint, copied := status.Checkpoint, status.KeysCopied
+
+	saveCheckpoint := func(key string) error {
+		return m.updateStatus(ctx, func(status *storageMigrationStatus) {
+			status.Checkpoint = key
+			status.KeysCopied = copied
+		})
+	}
+
+	var lastKey string
+	err := storageMigrationScan(ctx, m.source, func(key string) error {
+		select {
+		case <-stopCh:
+			return errStorageMigrationStopped
+		case <-ctx.Done():
+			return errStorageMigrationStopped
+		default:
+		}
+
+		if key <= checkpoint || key == CoreLockPath {
+			return nil
+		}
+
+		if err := m.dualWrite.Copy(ctx, key); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to copy %q: {{err}}", key), err)
+		}
+		lastKey = key
+		copied++
+
+		if copied%storageMigrationCheckpointKeys == 0 {
+			return saveCheckpoint(key)
+		}
+		return nil
+	})
+	if lastKey != "" {
+		if err := saveCheckpoint(lastKey); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range m.dualWrite.Pending() {
+		if err := m.dualWrite.Copy(ctx, key); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to copy %q: {{err}}", key), err)
+		}
+	}
+	return nil
+}
+
+// storageLister is implemented by the physical backends and the barrier
+type storageLister interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// storageMigrationScan calls fn with every key of the backend, in lexicographic
+// order
+func storageMigrationScan(ctx context.Context, backend storageLister, fn func(key string) error) error {
+	stack := []string{""}
+	for len(stack) > 0 {
+		key := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if key != "" && !strings.HasSuffix(key, "/") {
+			if err := fn(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		children, err := backend.List(ctx, key)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to list %q: {{err}}", key), err)
+		}
+		sort.Strings(children)
+
+		// Push the children in reverse order so that they're popped in order
+		for i := len(children) - 1; i >= 0; i-- {
+			if children[i] != "" {
+				stack = append(stack, key+children[i])
+			}
+		}
+	}
+	return nil
+}
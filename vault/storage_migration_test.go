@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/quid/vault/helper/namespace"
+	"github.com/quid/vault/sdk/helper/logging"
+	"github.com/quid/vault/sdk/logical"
+	"github.com/quid/vault/sdk/physical"
+	"github.com/quid/vault/sdk/physical/inmem"
+)
+
+// testStorageMigrationInSync checks that the destination has the same keys and
+// values as the source
+func testStorageMigrationInSync(t *testing.T, source, destination physical.Backend) {
+	t.Helper()
+	ctx := context.Background()
+
+	entries := make(map[string][]byte)
+	err := storageMigrationScan(ctx, source, func(key string) error {
+		entry, err := source.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		entries[key] = entry.Value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := 0
+	err = storageMigrationScan(ctx, destination, func(key string) error {
+		entry, err := destination.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		value, ok := entries[key]
+		if !ok {
+			t.Fatalf("unexpected key %q in the destination", key)
+		}
+		if !bytes.Equal(value, entry.Value) {
+			t.Fatalf("mismatched value of key %q", key)
+		}
+		keys++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != len(entries) {
+		t.Fatalf("expected %d keys in the destination, got %d", len(entries), keys)
+	}
+}
+
+func TestStorageMigration(t *testing.T) {
+	// Checkpoint the copy as often as possible
+	checkpointKeys := storageMigrationCheckpointKeys
+	storageMigrationCheckpointKeys = 1
+	defer func() {
+		storageMigrationCheckpointKeys = checkpointKeys
+	}()
+
+	logger := logging.NewVaultLogger(log.Trace)
+	source, err := inmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination, err := inmem.NewInmem(nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testCoreConfig(t, source, logger)
+	conf.StorageMigrationDestination = destination
+	conf.StorageMigrationDestinationType = "inmem"
+	c, err := NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, keys, root := testCoreUnsealed(t, c)
+	ctx := namespace.RootContext(nil)
+
+	writeSecret := func(path string) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = root
+		req.Data["foo"] = "bar"
+		resp, err := c.HandleRequest(ctx, req)
+		if err != nil || resp.IsError() {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+	}
+	writeSecret("secret/before")
+
+	// The cut over requires the keys to be copied
+	req := logical.TestRequest(t, logical.UpdateOperation, "storage/migration/cutover")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err == nil {
+		t.Fatal("expected an error cutting over before starting the migration")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "storage/migration")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err == nil {
+		t.Fatal("expected an error starting the migration twice")
+	}
+
+	var status *storageMigrationStatus
+	for i := 0; i < 100; i++ {
+		status = c.storageMigration.getStatus()
+		if status.State != storageMigrationStateCopying {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if status.State != storageMigrationStateCopied {
+		t.Fatalf("expected the keys to be copied, got %#v", status)
+	}
+	if status.KeysCopied == 0 || status.Checkpoint == "" {
+		t.Fatalf("expected a checkpoint, got %#v", status)
+	}
+
+	// The writes are duplicated
+	writeSecret("secret/copied")
+	testStorageMigrationInSync(t, source, destination)
+
+	req = logical.TestRequest(t, logical.ReadOperation, "storage/migration")
+	resp, err := c.systemBackend.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["state"] != storageMigrationStateCopied || resp.Data["configured"] != true || resp.Data["pending_keys"] != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "storage/migration/cutover")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if c.storageMigration.dualWrite.Primary() != destination {
+		t.Fatal("expected the reads to be served by the destination")
+	}
+
+	// The source is kept in sync after the cut over
+	writeSecret("secret/cut-over")
+	testStorageMigrationInSync(t, source, destination)
+
+	// The cut over survives a seal
+	if err := c.Seal(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(c, TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.storageMigration.dualWrite.Primary() != destination {
+		t.Fatal("expected the reads to be served by the destination after unsealing")
+	}
+
+	// Aborting goes back to the source
+	req = logical.TestRequest(t, logical.DeleteOperation, "storage/migration")
+	if _, err := c.systemBackend.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if c.storageMigration.dualWrite.Primary() != source {
+		t.Fatal("expected the reads to be served by the source")
+	}
+	if entry, err := source.Get(context.Background(), storageMigrationStatusPath); err != nil || entry != nil {
+		t.Fatalf("expected the status to be deleted, got %v, %v", entry, err)
+	}
+}
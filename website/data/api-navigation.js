@@ -50,6 +50,7 @@ export default [
           'group',
           'group-alias',
           'tokens',
+          'oidc-provider',
           'lookup',
         ],
       },
@@ -141,7 +142,7 @@ export default [
       'step-down',
       {
         category: 'storage',
-        content: ['raft'],
+        content: ['migration', 'raft'],
       },
       'tools',
       'unseal',
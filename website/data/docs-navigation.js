@@ -100,7 +100,7 @@ export default [
       'agent',
       {
         category: 'audit',
-        content: ['disable', 'enable', 'list'],
+        content: ['disable', 'enable', 'list', 'verify'],
       },
       {
         category: 'auth',
@@ -134,6 +134,7 @@ export default [
       {
         category: 'operator',
         content: [
+          'decrypt-share',
           'generate-root',
           'init',
           'key-status',
@@ -143,6 +144,7 @@ export default [
           'rotate',
           'seal',
           'step-down',
+          'storage-migration',
           'unseal',
         ],
       },
@@ -153,7 +155,16 @@ export default [
       },
       {
         category: 'policy',
-        content: ['delete', 'fmt', 'list', 'read', 'write'],
+        content: [
+          'delete',
+          'fmt',
+          'history',
+          'list',
+          'read',
+          'rollback',
+          'simulate',
+          'write',
+        ],
       },
       'read',
       {
@@ -285,7 +296,7 @@ export default [
   },
   {
     category: 'audit',
-    content: ['file', 'syslog', 'socket'],
+    content: ['file', 'syslog', 'socket', 'http'],
   },
   {
     category: 'plugin',